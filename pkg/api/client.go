@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/airplanedev/lib/pkg/build"
@@ -17,10 +18,35 @@ type IAPIClient interface {
 	GetTask(ctx context.Context, req GetTaskRequest) (res Task, err error)
 	// GetTaskMetadata fetches a task's metadata by slug. If the slug does not match a task, a *TaskMissingError is returned.
 	GetTaskMetadata(ctx context.Context, slug string) (res TaskMetadata, err error)
+	// GetView fetches a view by ID or slug. If it does not exist, a *ViewMissingError is returned.
 	GetView(ctx context.Context, req GetViewRequest) (res View, err error)
+	// GetResource fetches a resource by ID or slug. If it does not exist, a ResourceMissingError is returned.
+	GetResource(ctx context.Context, req GetResourceRequest) (res GetResourceResponse, err error)
 	ListResources(ctx context.Context, envSlug string) (res ListResourcesResponse, err error)
 	ListResourceMetadata(ctx context.Context) (res ListResourceMetadataResponse, err error)
 	CreateBuildUpload(ctx context.Context, req CreateBuildUploadRequest) (res CreateBuildUploadResponse, err error)
+	// CreateUpload creates an upload for a file, e.g. to pass as an upload parameter value. The file's
+	// content must be written to the returned write-only URL. See UploadFile.
+	CreateUpload(ctx context.Context, req CreateUploadRequest) (res CreateUploadResponse, err error)
+	GetUpload(ctx context.Context, req GetUploadRequest) (res GetUploadResponse, err error)
+	CreateTask(ctx context.Context, req CreateTaskRequest) (res CreateTaskResponse, err error)
+	// UpdateTask updates a task by slug. If the slug does not match a task, a *TaskMissingError is returned.
+	UpdateTask(ctx context.Context, req UpdateTaskRequest) (res UpdateTaskResponse, err error)
+	// ArchiveTask archives a task by slug. If the slug does not match a task, a *TaskMissingError is returned.
+	ArchiveTask(ctx context.Context, req ArchiveTaskRequest) (err error)
+	CreateView(ctx context.Context, req CreateViewRequest) (res View, err error)
+	// UpdateView updates a view by slug. If the slug does not match a view, a *ViewMissingError is returned.
+	UpdateView(ctx context.Context, req UpdateViewRequest) (res View, err error)
+	// ExecuteTask executes a task by slug. If the slug does not match a task, a *TaskMissingError is returned.
+	ExecuteTask(ctx context.Context, req ExecuteTaskRequest) (res ExecuteTaskResponse, err error)
+	GetRun(ctx context.Context, runID string) (res Run, err error)
+	ListRuns(ctx context.Context, req ListRunsRequest) (res ListRunsResponse, err error)
+	CancelRun(ctx context.Context, runID string) (err error)
+	GetOutputs(ctx context.Context, runID string) (res GetOutputsResponse, err error)
+	ListDisplays(ctx context.Context, runID string) (res ListDisplaysResponse, err error)
+	ListEnvs(ctx context.Context) (res ListEnvsResponse, err error)
+	// GetEnv fetches an environment by slug. If the slug does not match an environment, a *EnvMissingError is returned.
+	GetEnv(ctx context.Context, slug string) (res Env, err error)
 }
 
 // Task represents a task.
@@ -166,6 +192,21 @@ type UpdateTaskRequest struct {
 	BuildID                    *string                   `json:"buildID"`
 	InterpolationMode          *string                   `json:"interpolationMode"`
 	EnvSlug                    string                    `json:"envSlug"`
+	// Webhooks are keyed by slug. If nil, the task's webhooks are left unchanged. Otherwise,
+	// they replace the task's webhooks that have a slug. Webhooks without a slug, e.g. ones
+	// created in the UI, are kept.
+	Webhooks map[string]Webhook `json:"webhooks,omitempty"`
+}
+
+// UpdateTaskResponse represents an update task response.
+type UpdateTaskResponse struct {
+	TaskRevisionID string `json:"taskRevisionID"`
+}
+
+// ArchiveTaskRequest archives a task.
+type ArchiveTaskRequest struct {
+	Slug    string `json:"slug"`
+	EnvSlug string `json:"envSlug"`
 }
 
 type UpdateViewRequest struct {
@@ -184,6 +225,12 @@ type ListResourcesResponse struct {
 	Resources []Resource `json:"resources"`
 }
 
+type GetResourceRequest struct {
+	ID      string
+	Slug    string
+	EnvSlug string
+}
+
 type GetResourceResponse struct {
 	Resource
 }
@@ -514,6 +561,13 @@ type Schedule struct {
 	ParamValues map[string]interface{} `json:"paramValues,omitempty"`
 }
 
+type Webhook struct {
+	Name          string               `json:"name,omitempty"`
+	Description   string               `json:"description,omitempty"`
+	ParamMappings map[string]string    `json:"paramMappings,omitempty"`
+	Verification  *WebhookVerification `json:"verification,omitempty"`
+}
+
 type Display struct {
 	ID        string    `json:"id"`
 	RunID     string    `json:"runID"`
@@ -590,6 +644,10 @@ type Env struct {
 	ArchivedAt *time.Time `json:"archivedAt"`
 }
 
+type ListEnvsResponse struct {
+	Envs []Env `json:"envs"`
+}
+
 type EvaluateTemplateRequest struct {
 	// Value is an arbitrary value that can include one or more Template values.
 	// Each Template will be evaluated, and if successful, will be replaced in
@@ -597,8 +655,11 @@ type EvaluateTemplateRequest struct {
 	// If any templates fail to evaluate, the Template will be left in Value
 	// and a separate error will be returned in the response.
 	Value interface{} `json:"value"`
-	// TODO: Add Run struct to lib and use Run instead
-	RunID       string                        `json:"runID"`
+	// RunID is the ID of Run. It is kept for compatibility with callers that only
+	// know the run's ID.
+	RunID string `json:"runID"`
+	// Run is the run that templates are evaluated for, if any.
+	Run         *Run                          `json:"run,omitempty"`
 	Env         Env                           `json:"env"`
 	Resources   map[string]resources.Resource `json:"resources"`
 	Configs     map[string]string             `json:"configs"`
@@ -621,16 +682,38 @@ type EvaluateTemplateRequest struct {
 
 type EvaluateTemplateResponse struct {
 	Value interface{} `json:"value"`
+	// Errors contains an error for each template in the request's Value that
+	// failed to evaluate. Those templates are left as-is in Value.
+	Errors []TemplateError `json:"errors,omitempty"`
+}
+
+// TemplateError describes a template that failed to evaluate.
+type TemplateError struct {
+	// Path is the location of the template within the evaluated value, as a
+	// JS-style path, e.g. `body.items[0]`. It is empty if the value itself is
+	// the template.
+	Path     string `json:"path"`
+	Template string `json:"template"`
+	Msg      string `json:"msg"`
+}
+
+func (e TemplateError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("evaluating template %q: %s", e.Template, e.Msg)
+	}
+	return fmt.Sprintf("evaluating template %q at %s: %s", e.Template, e.Path, e.Msg)
 }
 
 func (r *EvaluateTemplateRequest) UnmarshalJSON(buf []byte) error {
 	var raw struct {
 		Value       interface{}                       `json:"value"`
 		RunID       string                            `json:"runID"`
+		Run         *Run                              `json:"run"`
 		Env         Env                               `json:"env"`
 		Resources   map[string]map[string]interface{} `json:"resources"`
 		Configs     map[string]string                 `json:"configs"`
 		ParamValues map[string]interface{}            `json:"paramValues"`
+		LookupMaps  map[string]interface{}            `json:"lookupMaps"`
 	}
 
 	if err := json.Unmarshal(buf, &raw); err != nil {
@@ -657,10 +740,12 @@ func (r *EvaluateTemplateRequest) UnmarshalJSON(buf []byte) error {
 
 	r.Value = raw.Value
 	r.RunID = raw.RunID
+	r.Run = raw.Run
 	r.Env = raw.Env
 	r.Resources = exportResources
 	r.Configs = raw.Configs
 	r.ParamValues = raw.ParamValues
+	r.LookupMaps = raw.LookupMaps
 
 	return nil
 }
@@ -0,0 +1,399 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	libhttp "github.com/airplanedev/lib/pkg/api/http"
+	"github.com/pkg/errors"
+)
+
+// HTTPClient is an IAPIClient that issues requests to the Airplane API over HTTP.
+type HTTPClient struct {
+	host   string
+	token  string
+	appURL string
+	http   libhttp.Client
+}
+
+var _ IAPIClient = &HTTPClient{}
+
+type HTTPClientOpts struct {
+	// ClientOpts configures the underlying HTTP client. Certain HTTP headers are required
+	// and must be set here (see libhttp.RequiredHeaders).
+	ClientOpts libhttp.ClientOpts
+	// AppURL is the URL of the Airplane web app. It is used to generate links in explainable
+	// errors.
+	//
+	// Defaults to DefaultAppURL.
+	AppURL string
+}
+
+// NewHTTPClient creates an IAPIClient that issues requests against the Airplane API at `host`,
+// authenticating with `token`.
+//
+// If `host` does not include a scheme, HTTPS is used unless the host points to localhost.
+func NewHTTPClient(host string, token string, opts HTTPClientOpts) *HTTPClient {
+	return &HTTPClient{
+		host:   normalizeHost(host),
+		token:  token,
+		appURL: getAppURL(opts.AppURL),
+		http:   libhttp.NewClient(opts.ClientOpts),
+	}
+}
+
+// GetTask implementation.
+func (c *HTTPClient) GetTask(ctx context.Context, req GetTaskRequest) (res Task, err error) {
+	q := url.Values{"slug": []string{req.Slug}}
+	if req.EnvSlug != "" {
+		q.Set("envSlug", req.EnvSlug)
+	}
+	if err := c.getJSON(ctx, "/v0/tasks/get", q, &res); err != nil {
+		if isNotFound(err) {
+			return Task{}, &TaskMissingError{AppURL: c.appURL, Slug: req.Slug}
+		}
+		return Task{}, errors.Wrap(err, "getting task")
+	}
+	res.URL = c.appURL + "/tasks/" + res.Slug
+	return res, nil
+}
+
+// GetTaskMetadata implementation.
+func (c *HTTPClient) GetTaskMetadata(ctx context.Context, slug string) (res TaskMetadata, err error) {
+	q := url.Values{"slug": []string{slug}}
+	if err := c.getJSON(ctx, "/v0/tasks/getMetadata", q, &res); err != nil {
+		if isNotFound(err) {
+			return TaskMetadata{}, &TaskMissingError{AppURL: c.appURL, Slug: slug}
+		}
+		return TaskMetadata{}, errors.Wrap(err, "getting task metadata")
+	}
+	return res, nil
+}
+
+// GetView implementation.
+func (c *HTTPClient) GetView(ctx context.Context, req GetViewRequest) (res View, err error) {
+	q := url.Values{}
+	if req.ID != "" {
+		q.Set("id", req.ID)
+	}
+	if req.Slug != "" {
+		q.Set("slug", req.Slug)
+	}
+	if err := c.getJSON(ctx, "/v0/views/get", q, &res); err != nil {
+		if isNotFound(err) {
+			return View{}, &ViewMissingError{AppURL: c.appURL, Slug: req.Slug, ID: req.ID}
+		}
+		return View{}, errors.Wrap(err, "getting view")
+	}
+	return res, nil
+}
+
+// GetResource implementation.
+func (c *HTTPClient) GetResource(ctx context.Context, req GetResourceRequest) (res GetResourceResponse, err error) {
+	q := url.Values{}
+	if req.ID != "" {
+		q.Set("id", req.ID)
+	}
+	if req.Slug != "" {
+		q.Set("slug", req.Slug)
+	}
+	if req.EnvSlug != "" {
+		q.Set("envSlug", req.EnvSlug)
+	}
+	if err := c.getJSON(ctx, "/v0/resources/get", q, &res); err != nil {
+		if isNotFound(err) {
+			return GetResourceResponse{}, ResourceMissingError{AppURL: c.appURL, Slug: req.Slug, ID: req.ID}
+		}
+		return GetResourceResponse{}, errors.Wrap(err, "getting resource")
+	}
+	return res, nil
+}
+
+// ListResources implementation.
+func (c *HTTPClient) ListResources(ctx context.Context, envSlug string) (res ListResourcesResponse, err error) {
+	q := url.Values{}
+	if envSlug != "" {
+		q.Set("envSlug", envSlug)
+	}
+	if err := c.getJSON(ctx, "/v0/resources/list", q, &res); err != nil {
+		return ListResourcesResponse{}, errors.Wrap(err, "listing resources")
+	}
+	return res, nil
+}
+
+// ListResourceMetadata implementation.
+func (c *HTTPClient) ListResourceMetadata(ctx context.Context) (res ListResourceMetadataResponse, err error) {
+	if err := c.getJSON(ctx, "/v0/resources/listMetadata", nil, &res); err != nil {
+		return ListResourceMetadataResponse{}, errors.Wrap(err, "listing resource metadata")
+	}
+	return res, nil
+}
+
+// CreateBuildUpload implementation.
+func (c *HTTPClient) CreateBuildUpload(ctx context.Context, req CreateBuildUploadRequest) (res CreateBuildUploadResponse, err error) {
+	if err := c.postJSON(ctx, "/v0/builds/createUpload", req, &res); err != nil {
+		return CreateBuildUploadResponse{}, errors.Wrap(err, "creating build upload")
+	}
+	return res, nil
+}
+
+// CreateUpload implementation.
+func (c *HTTPClient) CreateUpload(ctx context.Context, req CreateUploadRequest) (res CreateUploadResponse, err error) {
+	if err := c.postJSON(ctx, "/v0/uploads/create", req, &res); err != nil {
+		return CreateUploadResponse{}, errors.Wrap(err, "creating upload")
+	}
+	return res, nil
+}
+
+// GetUpload implementation.
+func (c *HTTPClient) GetUpload(ctx context.Context, req GetUploadRequest) (res GetUploadResponse, err error) {
+	q := url.Values{"id": []string{req.UploadID}}
+	if err := c.getJSON(ctx, "/v0/uploads/get", q, &res); err != nil {
+		return GetUploadResponse{}, errors.Wrapf(err, "getting upload %q", req.UploadID)
+	}
+	return res, nil
+}
+
+// CreateTask implementation.
+func (c *HTTPClient) CreateTask(ctx context.Context, req CreateTaskRequest) (res CreateTaskResponse, err error) {
+	if err := c.postJSON(ctx, "/v0/tasks/create", req, &res); err != nil {
+		return CreateTaskResponse{}, errors.Wrap(err, "creating task")
+	}
+	return res, nil
+}
+
+// UpdateTask implementation.
+func (c *HTTPClient) UpdateTask(ctx context.Context, req UpdateTaskRequest) (res UpdateTaskResponse, err error) {
+	if err := c.postJSON(ctx, "/v0/tasks/update", req, &res); err != nil {
+		if isNotFound(err) {
+			return UpdateTaskResponse{}, &TaskMissingError{AppURL: c.appURL, Slug: req.Slug}
+		}
+		return UpdateTaskResponse{}, errors.Wrap(err, "updating task")
+	}
+	return res, nil
+}
+
+// ArchiveTask implementation.
+func (c *HTTPClient) ArchiveTask(ctx context.Context, req ArchiveTaskRequest) error {
+	if err := c.postJSON(ctx, "/v0/tasks/archive", req, nil); err != nil {
+		if isNotFound(err) {
+			return &TaskMissingError{AppURL: c.appURL, Slug: req.Slug}
+		}
+		return errors.Wrap(err, "archiving task")
+	}
+	return nil
+}
+
+// CreateView implementation.
+func (c *HTTPClient) CreateView(ctx context.Context, req CreateViewRequest) (res View, err error) {
+	if err := c.postJSON(ctx, "/v0/views/create", req, &res); err != nil {
+		return View{}, errors.Wrap(err, "creating view")
+	}
+	return res, nil
+}
+
+// UpdateView implementation.
+func (c *HTTPClient) UpdateView(ctx context.Context, req UpdateViewRequest) (res View, err error) {
+	if err := c.postJSON(ctx, "/v0/views/update", req, &res); err != nil {
+		if isNotFound(err) {
+			return View{}, &ViewMissingError{AppURL: c.appURL, Slug: req.Slug}
+		}
+		return View{}, errors.Wrap(err, "updating view")
+	}
+	return res, nil
+}
+
+// ExecuteTask implementation.
+func (c *HTTPClient) ExecuteTask(ctx context.Context, req ExecuteTaskRequest) (res ExecuteTaskResponse, err error) {
+	if err := c.postJSON(ctx, "/v0/tasks/execute", req, &res); err != nil {
+		if isNotFound(err) {
+			return ExecuteTaskResponse{}, &TaskMissingError{AppURL: c.appURL, Slug: req.Slug}
+		}
+		return ExecuteTaskResponse{}, errors.Wrap(err, "executing task")
+	}
+	return res, nil
+}
+
+// GetRun implementation.
+func (c *HTTPClient) GetRun(ctx context.Context, runID string) (res Run, err error) {
+	var resp struct {
+		Run Run `json:"run"`
+	}
+	q := url.Values{"id": []string{runID}}
+	if err := c.getJSON(ctx, "/v0/runs/get", q, &resp); err != nil {
+		return Run{}, errors.Wrapf(err, "getting run %q", runID)
+	}
+	return resp.Run, nil
+}
+
+// ListRuns implementation.
+func (c *HTTPClient) ListRuns(ctx context.Context, req ListRunsRequest) (res ListRunsResponse, err error) {
+	q := url.Values{}
+	if req.TaskID != "" {
+		q.Set("taskID", req.TaskID)
+	}
+	if !req.Since.IsZero() {
+		q.Set("since", req.Since.Format(time.RFC3339))
+	}
+	if !req.Until.IsZero() {
+		q.Set("until", req.Until.Format(time.RFC3339))
+	}
+	if req.Page > 0 {
+		q.Set("page", strconv.Itoa(req.Page))
+	}
+	if req.Limit > 0 {
+		q.Set("limit", strconv.Itoa(req.Limit))
+	}
+	if err := c.getJSON(ctx, "/v0/runs/list", q, &res); err != nil {
+		return ListRunsResponse{}, errors.Wrap(err, "listing runs")
+	}
+	return res, nil
+}
+
+// CancelRun implementation.
+func (c *HTTPClient) CancelRun(ctx context.Context, runID string) error {
+	req := struct {
+		RunID string `json:"runID"`
+	}{runID}
+	if err := c.postJSON(ctx, "/v0/runs/cancel", req, nil); err != nil {
+		return errors.Wrapf(err, "cancelling run %q", runID)
+	}
+	return nil
+}
+
+// GetOutputs implementation.
+func (c *HTTPClient) GetOutputs(ctx context.Context, runID string) (res GetOutputsResponse, err error) {
+	q := url.Values{"id": []string{runID}}
+	if err := c.getJSON(ctx, "/v0/runs/getOutputs", q, &res); err != nil {
+		return GetOutputsResponse{}, errors.Wrapf(err, "getting outputs for run %q", runID)
+	}
+	return res, nil
+}
+
+// ListDisplays implementation.
+func (c *HTTPClient) ListDisplays(ctx context.Context, runID string) (res ListDisplaysResponse, err error) {
+	q := url.Values{"runID": []string{runID}}
+	if err := c.getJSON(ctx, "/v0/displays/list", q, &res); err != nil {
+		return ListDisplaysResponse{}, errors.Wrapf(err, "listing displays for run %q", runID)
+	}
+	return res, nil
+}
+
+// ListEnvs implementation.
+func (c *HTTPClient) ListEnvs(ctx context.Context) (res ListEnvsResponse, err error) {
+	if err := c.getJSON(ctx, "/v0/envs/list", nil, &res); err != nil {
+		return ListEnvsResponse{}, errors.Wrap(err, "listing environments")
+	}
+	return res, nil
+}
+
+// GetEnv implementation.
+func (c *HTTPClient) GetEnv(ctx context.Context, slug string) (res Env, err error) {
+	q := url.Values{"slug": []string{slug}}
+	if err := c.getJSON(ctx, "/v0/envs/get", q, &res); err != nil {
+		if isNotFound(err) {
+			return Env{}, &EnvMissingError{AppURL: c.appURL, Slug: slug}
+		}
+		return Env{}, errors.Wrap(err, "getting environment")
+	}
+	return res, nil
+}
+
+// InEnv returns a client that issues requests against the environment with slug `envSlug`.
+// See EnvClient.
+func (c *HTTPClient) InEnv(envSlug string) *EnvClient {
+	return InEnv(c, envSlug)
+}
+
+func (c *HTTPClient) getJSON(ctx context.Context, path string, q url.Values, resp any) error {
+	return c.http.GetJSON(ctx, c.url(ctx, path, q), resp, c.reqOpts())
+}
+
+func (c *HTTPClient) postJSON(ctx context.Context, path string, req any, resp any) error {
+	opts := c.reqOpts()
+	if prefix, ok := ctx.Value(idempotencyKeyPrefixKey{}).(string); ok {
+		body, err := json.Marshal(req)
+		if err != nil {
+			return errors.Wrap(err, "marshalling request body as JSON")
+		}
+		h := sha256.New()
+		for _, b := range [][]byte{[]byte(prefix), []byte(path), body} {
+			h.Write(b)
+			h.Write([]byte{0})
+		}
+		opts.IdempotencyKey = hex.EncodeToString(h.Sum(nil))
+	}
+	return c.http.PostJSON(ctx, c.url(ctx, path, nil), req, resp, opts)
+}
+
+type idempotencyKeyPrefixKey struct{}
+
+// WithIdempotencyKeyPrefix returns a context that derives the Idempotency-Key of each write
+// request issued with it from `prefix` and the request itself, rather than generating a
+// random key. Re-issuing the same request with the same prefix, e.g. when resuming a deploy
+// after a crash, then returns the original response instead of performing it twice.
+//
+// Use a prefix that is unique to the operation, such as a deploy ID.
+func WithIdempotencyKeyPrefix(ctx context.Context, prefix string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyPrefixKey{}, prefix)
+}
+
+type envSlugKey struct{}
+
+// WithEnvSlug returns a context that issues each request made with it against the environment
+// with slug `envSlug`, including requests that don't accept an environment themselves, such as
+// GetRun. An environment set on the request itself takes precedence. See EnvClient.
+func WithEnvSlug(ctx context.Context, envSlug string) context.Context {
+	return context.WithValue(ctx, envSlugKey{}, envSlug)
+}
+
+func envSlugFromContext(ctx context.Context) (string, bool) {
+	envSlug, ok := ctx.Value(envSlugKey{}).(string)
+	return envSlug, ok
+}
+
+func (c *HTTPClient) url(ctx context.Context, path string, q url.Values) string {
+	if envSlug, _ := envSlugFromContext(ctx); envSlug != "" && q.Get("envSlug") == "" {
+		if q == nil {
+			q = url.Values{}
+		}
+		q.Set("envSlug", envSlug)
+	}
+	u := c.host + path
+	if len(q) > 0 {
+		u += "?" + q.Encode()
+	}
+	return u
+}
+
+func (c *HTTPClient) reqOpts() libhttp.ReqOpts {
+	headers := map[string]string{}
+	if c.token != "" {
+		headers["X-Airplane-Token"] = c.token
+	}
+	return libhttp.ReqOpts{Headers: headers}
+}
+
+// normalizeHost prefixes `host` with a scheme, if one is not already set, and strips
+// any trailing slashes.
+func normalizeHost(host string) string {
+	host = strings.TrimRight(host, "/")
+	if strings.HasPrefix(host, "http://") || strings.HasPrefix(host, "https://") {
+		return host
+	}
+	if strings.HasPrefix(host, "localhost") || strings.HasPrefix(host, "127.0.0.1") {
+		return "http://" + host
+	}
+	return "https://" + host
+}
+
+func isNotFound(err error) bool {
+	var errsc libhttp.ErrStatusCode
+	return errors.As(err, &errsc) && errsc.StatusCode == 404
+}
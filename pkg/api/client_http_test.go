@@ -0,0 +1,493 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	libhttp "github.com/airplanedev/lib/pkg/api/http"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHTTPClient(url string) *HTTPClient {
+	return NewHTTPClient(url, "tkn_test", HTTPClientOpts{
+		ClientOpts: libhttp.ClientOpts{
+			Headers: map[string]string{
+				"X-Airplane-Client-Kind":    "test",
+				"X-Airplane-Client-Version": "1",
+			},
+			UserAgent: "airplane/test/1",
+		},
+		AppURL: "https://app.test",
+	})
+}
+
+func writeJSON(rw http.ResponseWriter, status int, v any) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	_ = json.NewEncoder(rw).Encode(v)
+}
+
+func TestHTTPClientGetTask(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		require.Equal("GET", req.Method)
+		require.Equal("/v0/tasks/get", req.URL.Path)
+		require.Equal("tkn_test", req.Header.Get("X-Airplane-Token"))
+		require.Equal("stage", req.URL.Query().Get("envSlug"))
+		switch req.URL.Query().Get("slug") {
+		case "my_task":
+			writeJSON(rw, 200, Task{ID: "tsk123", Slug: "my_task", Name: "My task"})
+		default:
+			writeJSON(rw, 404, libhttp.ErrorResponse{Error: "task not found"})
+		}
+	}))
+	defer server.Close()
+
+	client := newTestHTTPClient(server.URL)
+	task, err := client.GetTask(ctx, GetTaskRequest{Slug: "my_task", EnvSlug: "stage"})
+	require.NoError(err)
+	require.Equal("tsk123", task.ID)
+	require.Equal("My task", task.Name)
+	require.Equal("https://app.test/tasks/my_task", task.URL)
+
+	_, err = client.GetTask(ctx, GetTaskRequest{Slug: "missing", EnvSlug: "stage"})
+	var merr *TaskMissingError
+	require.ErrorAs(err, &merr)
+	require.Equal("missing", merr.Slug)
+	require.Equal("https://app.test", merr.AppURL)
+}
+
+func TestHTTPClientGetTaskMetadata(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		require.Equal("/v0/tasks/getMetadata", req.URL.Path)
+		if req.URL.Query().Get("slug") == "my_task" {
+			writeJSON(rw, 200, TaskMetadata{ID: "tsk123", Slug: "my_task", IsArchived: true})
+			return
+		}
+		writeJSON(rw, 404, libhttp.ErrorResponse{Error: "task not found"})
+	}))
+	defer server.Close()
+
+	client := newTestHTTPClient(server.URL)
+	md, err := client.GetTaskMetadata(ctx, "my_task")
+	require.NoError(err)
+	require.Equal(TaskMetadata{ID: "tsk123", Slug: "my_task", IsArchived: true}, md)
+
+	_, err = client.GetTaskMetadata(ctx, "missing")
+	var merr *TaskMissingError
+	require.ErrorAs(err, &merr)
+}
+
+func TestHTTPClientGetView(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		require.Equal("/v0/views/get", req.URL.Path)
+		if req.URL.Query().Get("slug") == "my_view" {
+			writeJSON(rw, 200, View{ID: "vew123", Slug: "my_view"})
+			return
+		}
+		writeJSON(rw, 404, libhttp.ErrorResponse{Error: "view not found"})
+	}))
+	defer server.Close()
+
+	client := newTestHTTPClient(server.URL)
+	view, err := client.GetView(ctx, GetViewRequest{Slug: "my_view"})
+	require.NoError(err)
+	require.Equal("vew123", view.ID)
+
+	_, err = client.GetView(ctx, GetViewRequest{Slug: "missing"})
+	var merr *ViewMissingError
+	require.ErrorAs(err, &merr)
+	require.Equal("missing", merr.Slug)
+
+	_, err = client.GetView(ctx, GetViewRequest{ID: "vew_missing"})
+	require.ErrorAs(err, &merr)
+	require.Equal("vew_missing", merr.ID)
+	require.EqualError(err, `view with ID "vew_missing" does not exist`)
+}
+
+func TestHTTPClientGetResource(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		require.Equal("/v0/resources/get", req.URL.Path)
+		q := req.URL.Query()
+		require.Equal("stage", q.Get("envSlug"))
+		if q.Get("slug") == "db" || q.Get("id") == "res123" {
+			writeJSON(rw, 200, map[string]any{"id": "res123", "slug": "db", "kind": "postgres"})
+			return
+		}
+		writeJSON(rw, 404, libhttp.ErrorResponse{Error: "resource not found"})
+	}))
+	defer server.Close()
+
+	client := newTestHTTPClient(server.URL)
+	resp, err := client.GetResource(ctx, GetResourceRequest{Slug: "db", EnvSlug: "stage"})
+	require.NoError(err)
+	require.Equal("res123", resp.ID)
+	require.Equal(KindPostgres, resp.Kind)
+
+	resp, err = client.GetResource(ctx, GetResourceRequest{ID: "res123", EnvSlug: "stage"})
+	require.NoError(err)
+	require.Equal("db", resp.Slug)
+
+	_, err = client.GetResource(ctx, GetResourceRequest{Slug: "missing", EnvSlug: "stage"})
+	var merr ResourceMissingError
+	require.ErrorAs(err, &merr)
+	require.Equal("missing", merr.Slug)
+	require.Equal("https://app.test", merr.AppURL)
+
+	_, err = client.GetResource(ctx, GetResourceRequest{ID: "res_missing", EnvSlug: "stage"})
+	require.ErrorAs(err, &merr)
+	require.Equal("res_missing", merr.ID)
+	require.EqualError(err, `resource with ID "res_missing" does not exist`)
+}
+
+func TestHTTPClientListResources(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v0/resources/list":
+			require.Equal("stage", req.URL.Query().Get("envSlug"))
+			writeJSON(rw, 200, map[string]any{
+				"resources": []map[string]any{
+					{"id": "res123", "slug": "db", "kind": "postgres"},
+				},
+			})
+		case "/v0/resources/listMetadata":
+			writeJSON(rw, 200, map[string]any{
+				"resources": []map[string]any{
+					{"id": "res123", "slug": "db"},
+				},
+			})
+		default:
+			require.Fail("unexpected path", req.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestHTTPClient(server.URL)
+	resp, err := client.ListResources(ctx, "stage")
+	require.NoError(err)
+	require.Len(resp.Resources, 1)
+	require.Equal("db", resp.Resources[0].Slug)
+	require.Equal(KindPostgres, resp.Resources[0].Kind)
+
+	mresp, err := client.ListResourceMetadata(ctx)
+	require.NoError(err)
+	require.Equal([]ResourceMetadata{{ID: "res123", Slug: "db"}}, mresp.Resources)
+}
+
+func TestHTTPClientCreateBuildUpload(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		require.Equal("POST", req.Method)
+		require.Equal("/v0/builds/createUpload", req.URL.Path)
+		require.NotEmpty(req.Header.Get("Idempotency-Key"))
+		var body CreateBuildUploadRequest
+		require.NoError(json.NewDecoder(req.Body).Decode(&body))
+		require.Equal(1024, body.SizeBytes)
+		writeJSON(rw, 200, CreateBuildUploadResponse{
+			Upload:       Upload{ID: "upl123"},
+			WriteOnlyURL: "https://storage.test/upl123",
+		})
+	}))
+	defer server.Close()
+
+	client := newTestHTTPClient(server.URL)
+	resp, err := client.CreateBuildUpload(ctx, CreateBuildUploadRequest{SizeBytes: 1024})
+	require.NoError(err)
+	require.Equal("upl123", resp.Upload.ID)
+	require.Equal("https://storage.test/upl123", resp.WriteOnlyURL)
+}
+
+func TestHTTPClientUploads(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v0/uploads/create":
+			require.Equal("POST", req.Method)
+			var body CreateUploadRequest
+			require.NoError(json.NewDecoder(req.Body).Decode(&body))
+			require.Equal(CreateUploadRequest{FileName: "report.csv", SizeBytes: 3}, body)
+			writeJSON(rw, 200, CreateUploadResponse{
+				Upload:       Upload{ID: "upl123", FileName: body.FileName},
+				ReadOnlyURL:  "https://storage.test/upl123?read",
+				WriteOnlyURL: "https://storage.test/upl123?write",
+			})
+		case "/v0/uploads/get":
+			require.Equal("GET", req.Method)
+			if req.URL.Query().Get("id") != "upl123" {
+				writeJSON(rw, 404, libhttp.ErrorResponse{Error: "upload not found"})
+				return
+			}
+			writeJSON(rw, 200, GetUploadResponse{
+				Upload:      Upload{ID: "upl123", FileName: "report.csv"},
+				ReadOnlyURL: "https://storage.test/upl123?read",
+			})
+		default:
+			t.Fatalf("unexpected path %s", req.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestHTTPClient(server.URL)
+	created, err := client.CreateUpload(ctx, CreateUploadRequest{FileName: "report.csv", SizeBytes: 3})
+	require.NoError(err)
+	require.Equal("upl123", created.Upload.ID)
+	require.Equal("https://storage.test/upl123?write", created.WriteOnlyURL)
+
+	got, err := client.GetUpload(ctx, GetUploadRequest{UploadID: "upl123"})
+	require.NoError(err)
+	require.Equal("report.csv", got.Upload.FileName)
+	require.Equal("https://storage.test/upl123?read", got.ReadOnlyURL)
+
+	_, err = client.GetUpload(ctx, GetUploadRequest{UploadID: "upl456"})
+	var errsc libhttp.ErrStatusCode
+	require.ErrorAs(err, &errsc)
+	require.Equal(404, errsc.StatusCode)
+}
+
+func TestNormalizeHost(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal("https://api.airplane.dev", normalizeHost("api.airplane.dev"))
+	require.Equal("https://api.airplane.dev", normalizeHost("https://api.airplane.dev/"))
+	require.Equal("http://localhost:5000", normalizeHost("localhost:5000"))
+	require.Equal("http://api.test", normalizeHost("http://api.test"))
+}
+
+func TestHTTPClientTaskWrites(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		require.Equal("POST", req.Method)
+		require.NotEmpty(req.Header.Get("Idempotency-Key"))
+		var body map[string]any
+		require.NoError(json.NewDecoder(req.Body).Decode(&body))
+		if body["slug"] == "missing" {
+			writeJSON(rw, 404, libhttp.ErrorResponse{Error: "task not found"})
+			return
+		}
+		switch req.URL.Path {
+		case "/v0/tasks/create":
+			require.Equal("stage", body["envSlug"])
+			writeJSON(rw, 200, CreateTaskResponse{TaskID: "tsk123", Slug: "my_task", TaskRevisionID: "tsr1"})
+		case "/v0/tasks/update":
+			require.Equal("My task", body["name"])
+			writeJSON(rw, 200, UpdateTaskResponse{TaskRevisionID: "tsr2"})
+		case "/v0/tasks/archive":
+			rw.WriteHeader(200)
+		default:
+			require.Fail("unexpected path", req.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestHTTPClient(server.URL)
+	cresp, err := client.CreateTask(ctx, CreateTaskRequest{Slug: "my_task", EnvSlug: "stage"})
+	require.NoError(err)
+	require.Equal(CreateTaskResponse{TaskID: "tsk123", Slug: "my_task", TaskRevisionID: "tsr1"}, cresp)
+
+	uresp, err := client.UpdateTask(ctx, UpdateTaskRequest{Slug: "my_task", Name: "My task"})
+	require.NoError(err)
+	require.Equal("tsr2", uresp.TaskRevisionID)
+
+	require.NoError(client.ArchiveTask(ctx, ArchiveTaskRequest{Slug: "my_task"}))
+
+	var merr *TaskMissingError
+	_, err = client.UpdateTask(ctx, UpdateTaskRequest{Slug: "missing"})
+	require.ErrorAs(err, &merr)
+	err = client.ArchiveTask(ctx, ArchiveTaskRequest{Slug: "missing"})
+	require.ErrorAs(err, &merr)
+}
+
+func TestHTTPClientViewWrites(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		var body map[string]any
+		require.NoError(json.NewDecoder(req.Body).Decode(&body))
+		if body["slug"] == "missing" {
+			writeJSON(rw, 404, libhttp.ErrorResponse{Error: "view not found"})
+			return
+		}
+		switch req.URL.Path {
+		case "/v0/views/create", "/v0/views/update":
+			writeJSON(rw, 200, View{ID: "vew123", Slug: body["slug"].(string), Name: body["name"].(string)})
+		default:
+			require.Fail("unexpected path", req.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestHTTPClient(server.URL)
+	view, err := client.CreateView(ctx, CreateViewRequest{Slug: "my_view", Name: "My view"})
+	require.NoError(err)
+	require.Equal("vew123", view.ID)
+
+	view, err = client.UpdateView(ctx, UpdateViewRequest{Slug: "my_view", Name: "Renamed"})
+	require.NoError(err)
+	require.Equal("Renamed", view.Name)
+
+	_, err = client.UpdateView(ctx, UpdateViewRequest{Slug: "missing"})
+	var merr *ViewMissingError
+	require.ErrorAs(err, &merr)
+}
+
+func TestHTTPClientRuns(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	cancelled := false
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v0/tasks/execute":
+			var body ExecuteTaskRequest
+			require.NoError(json.NewDecoder(req.Body).Decode(&body))
+			if body.Slug == "missing" {
+				writeJSON(rw, 404, libhttp.ErrorResponse{Error: "task not found"})
+				return
+			}
+			require.Equal(map[string]interface{}{"name": "World"}, body.ParamValues)
+			writeJSON(rw, 200, ExecuteTaskResponse{RunID: "run123"})
+		case "/v0/runs/get":
+			require.Equal("run123", req.URL.Query().Get("id"))
+			writeJSON(rw, 200, map[string]any{"run": Run{RunID: "run123", Status: RunActive}})
+		case "/v0/runs/list":
+			require.Equal("tsk123", req.URL.Query().Get("taskID"))
+			require.Equal("10", req.URL.Query().Get("limit"))
+			writeJSON(rw, 200, ListRunsResponse{Runs: []Run{{RunID: "run123"}}})
+		case "/v0/runs/cancel":
+			var body map[string]string
+			require.NoError(json.NewDecoder(req.Body).Decode(&body))
+			require.Equal("run123", body["runID"])
+			cancelled = true
+			rw.WriteHeader(200)
+		case "/v0/runs/getOutputs":
+			rw.Header().Set("Content-Type", "application/json")
+			_, _ = rw.Write([]byte(`{"output": {"b": 1, "a": 2}}`))
+		case "/v0/displays/list":
+			require.Equal("run123", req.URL.Query().Get("runID"))
+			writeJSON(rw, 200, ListDisplaysResponse{Displays: []Display{{ID: "dsp1", Kind: "markdown", Content: "# hi"}}})
+		default:
+			require.Fail("unexpected path", req.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestHTTPClient(server.URL)
+	eresp, err := client.ExecuteTask(ctx, ExecuteTaskRequest{
+		Slug:        "my_task",
+		ParamValues: map[string]interface{}{"name": "World"},
+	})
+	require.NoError(err)
+	require.Equal("run123", eresp.RunID)
+
+	_, err = client.ExecuteTask(ctx, ExecuteTaskRequest{Slug: "missing"})
+	var merr *TaskMissingError
+	require.ErrorAs(err, &merr)
+
+	run, err := client.GetRun(ctx, "run123")
+	require.NoError(err)
+	require.Equal(RunActive, run.Status)
+
+	lresp, err := client.ListRuns(ctx, ListRunsRequest{TaskID: "tsk123", Limit: 10})
+	require.NoError(err)
+	require.Len(lresp.Runs, 1)
+
+	require.NoError(client.CancelRun(ctx, "run123"))
+	require.True(cancelled)
+
+	oresp, err := client.GetOutputs(ctx, "run123")
+	require.NoError(err)
+	out, err := json.Marshal(oresp.Output)
+	require.NoError(err)
+	// Key order should be preserved.
+	require.Equal(`{"b":1,"a":2}`, string(out))
+
+	dresp, err := client.ListDisplays(ctx, "run123")
+	require.NoError(err)
+	require.Equal("# hi", dresp.Displays[0].Content)
+}
+
+func TestHTTPClientEnvs(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	envs := []Env{{ID: "env1", Slug: "prod"}, {ID: "env2", Slug: "staging"}}
+	var envSlugs []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/v0/envs/list":
+			writeJSON(rw, 200, ListEnvsResponse{Envs: envs})
+		case "/v0/envs/get":
+			for _, env := range envs {
+				if env.Slug == req.URL.Query().Get("slug") {
+					writeJSON(rw, 200, env)
+					return
+				}
+			}
+			writeJSON(rw, 404, libhttp.ErrorResponse{Error: "env not found"})
+		case "/v0/tasks/get":
+			envSlugs = append(envSlugs, req.URL.Query().Get("envSlug"))
+			writeJSON(rw, 200, Task{Slug: "my_task"})
+		case "/v0/tasks/update":
+			var body UpdateTaskRequest
+			require.NoError(json.NewDecoder(req.Body).Decode(&body))
+			envSlugs = append(envSlugs, body.EnvSlug)
+			writeJSON(rw, 200, UpdateTaskResponse{})
+		default:
+			t.Fatalf("unexpected request to %s", req.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestHTTPClient(server.URL)
+	res, err := client.ListEnvs(ctx)
+	require.NoError(err)
+	require.Equal(envs, res.Envs)
+
+	env, err := client.GetEnv(ctx, "staging")
+	require.NoError(err)
+	require.Equal("env2", env.ID)
+	_, err = client.GetEnv(ctx, "dev")
+	var merr *EnvMissingError
+	require.ErrorAs(err, &merr)
+	require.Equal("dev", merr.Slug)
+
+	// A scoped client fills in the environment unless the request sets one.
+	staging := client.InEnv("staging")
+	require.Equal("staging", staging.EnvSlug())
+	env, err = staging.Env(ctx)
+	require.NoError(err)
+	require.Equal("env2", env.ID)
+	_, err = staging.GetTask(ctx, GetTaskRequest{Slug: "my_task"})
+	require.NoError(err)
+	_, err = staging.UpdateTask(ctx, UpdateTaskRequest{Slug: "my_task"})
+	require.NoError(err)
+	_, err = staging.GetTask(ctx, GetTaskRequest{Slug: "my_task", EnvSlug: "prod"})
+	require.NoError(err)
+	_, err = InEnv(staging, "prod").GetTask(ctx, GetTaskRequest{Slug: "my_task"})
+	require.NoError(err)
+	require.Equal([]string{"staging", "staging", "prod", "prod"}, envSlugs)
+}
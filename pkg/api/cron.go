@@ -0,0 +1,305 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CronFieldError describes a single invalid field in a cron expression.
+type CronFieldError struct {
+	// Field is the name of the invalid field, e.g. "minute" or "dayOfWeek".
+	Field string
+	Value string
+	Msg   string
+}
+
+func (e CronFieldError) Error() string {
+	return fmt.Sprintf("%s %q: %s", e.Field, e.Value, e.Msg)
+}
+
+// ErrInvalidCronExpr is returned when a cron expression fails to parse. It contains
+// an error for each invalid field.
+type ErrInvalidCronExpr struct {
+	Expr   string
+	Errors []CronFieldError
+}
+
+func (e ErrInvalidCronExpr) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, ferr := range e.Errors {
+		msgs[i] = ferr.Error()
+	}
+	return fmt.Sprintf("invalid cron expression %q: %s", e.Expr, strings.Join(msgs, "; "))
+}
+
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	cronMinute     = cronField{name: "minute", min: 0, max: 59}
+	cronHour       = cronField{name: "hour", min: 0, max: 23}
+	cronDayOfMonth = cronField{name: "dayOfMonth", min: 1, max: 31}
+	cronMonth      = cronField{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// Both 0 and 7 represent Sunday.
+	cronDayOfWeek = cronField{name: "dayOfWeek", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// ParseCronExpr parses a standard 5-field cron expression ("minute hour day-of-month month
+// day-of-week"). Each field supports `*`, single values, ranges (`1-5`), steps (`*/15`, `0-30/10`)
+// and lists (`1,15`). Months and days of the week may also be referenced by their three-letter
+// English names, e.g. `jan-mar` or `mon-fri`.
+//
+// If the expression is invalid, an ErrInvalidCronExpr is returned.
+func ParseCronExpr(expr string) (CronExpr, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return CronExpr{}, errors.WithStack(ErrInvalidCronExpr{
+			Expr: expr,
+			Errors: []CronFieldError{{
+				Field: "expression",
+				Value: expr,
+				Msg:   fmt.Sprintf("expected 5 fields, got %d", len(fields)),
+			}},
+		})
+	}
+
+	ce := CronExpr{
+		Minute:     fields[0],
+		Hour:       fields[1],
+		DayOfMonth: fields[2],
+		Month:      fields[3],
+		DayOfWeek:  fields[4],
+	}
+	if err := ce.Validate(); err != nil {
+		return CronExpr{}, err
+	}
+	return ce, nil
+}
+
+// Validate checks that every field of the cron expression is valid. If not, an ErrInvalidCronExpr
+// is returned.
+func (ce CronExpr) Validate() error {
+	_, err := ce.schedule()
+	return err
+}
+
+// Next returns the next `n` times, strictly after `after`, at which the cron expression fires
+// when evaluated in `loc`. If `loc` is nil, UTC is used.
+//
+// Fewer than `n` times are returned if the expression does not fire within the next five years,
+// e.g. for `0 0 31 2 *`.
+func (ce CronExpr) Next(after time.Time, loc *time.Location, n int) ([]time.Time, error) {
+	s, err := ce.schedule()
+	if err != nil {
+		return nil, err
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	var times []time.Time
+	t := after.In(loc)
+	for len(times) < n {
+		next, ok := s.next(t)
+		if !ok {
+			break
+		}
+		times = append(times, next)
+		t = next
+	}
+	return times, nil
+}
+
+// cronBits is a bitset of values that a cron field matches.
+type cronBits uint64
+
+func (b cronBits) has(v int) bool {
+	return b&(1<<uint(v)) != 0
+}
+
+type cronSchedule struct {
+	minute, hour, dayOfMonth, month, dayOfWeek cronBits
+	// If either day field is restricted (not `*`), a day matches if either field matches.
+	// Otherwise, both must match. This mirrors the behavior of the standard cron daemon.
+	dayOfMonthStar, dayOfWeekStar bool
+}
+
+func (ce CronExpr) schedule() (cronSchedule, error) {
+	var s cronSchedule
+	var errs []CronFieldError
+	for _, f := range []struct {
+		field cronField
+		value string
+		bits  *cronBits
+	}{
+		{cronMinute, ce.Minute, &s.minute},
+		{cronHour, ce.Hour, &s.hour},
+		{cronDayOfMonth, ce.DayOfMonth, &s.dayOfMonth},
+		{cronMonth, ce.Month, &s.month},
+		{cronDayOfWeek, ce.DayOfWeek, &s.dayOfWeek},
+	} {
+		bits, err := f.field.parse(f.value)
+		if err != nil {
+			errs = append(errs, CronFieldError{Field: f.field.name, Value: f.value, Msg: err.Error()})
+			continue
+		}
+		*f.bits = bits
+	}
+	if len(errs) > 0 {
+		return cronSchedule{}, errors.WithStack(ErrInvalidCronExpr{Expr: ce.String(), Errors: errs})
+	}
+
+	// Sunday can be written as either 0 or 7.
+	if s.dayOfWeek.has(7) {
+		s.dayOfWeek |= 1
+	}
+	s.dayOfMonthStar = strings.HasPrefix(ce.DayOfMonth, "*")
+	s.dayOfWeekStar = strings.HasPrefix(ce.DayOfWeek, "*")
+	return s, nil
+}
+
+func (f cronField) parse(value string) (cronBits, error) {
+	if value == "" {
+		return 0, errors.New("must not be empty")
+	}
+
+	var bits cronBits
+	for _, part := range strings.Split(value, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepStr)
+			if err != nil || step <= 0 {
+				return 0, errors.Errorf("invalid step %q", stepStr)
+			}
+		}
+
+		var lo, hi int
+		switch {
+		case rng == "*":
+			lo, hi = f.min, f.max
+			if f.name == cronDayOfWeek.name {
+				// Avoid double-counting Sunday when stepping, e.g. `*/2`.
+				hi = 6
+			}
+		case strings.Contains(rng, "-"):
+			loStr, hiStr, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(loStr); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(hiStr); err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, errors.Errorf("invalid range %q: start is after end", rng)
+			}
+		default:
+			var err error
+			if lo, err = f.value(rng); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if hasStep {
+				// `a/n` is shorthand for `a-max/n`.
+				hi = f.max
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errors.Errorf("invalid value %q", s)
+	}
+	if v < f.min || v > f.max {
+		return 0, errors.Errorf("value %d out of range [%d, %d]", v, f.min, f.max)
+	}
+	return v, nil
+}
+
+func (s cronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dayOfMonth.has(t.Day())
+	dow := s.dayOfWeek.has(int(t.Weekday()))
+	if s.dayOfMonthStar || s.dayOfWeekStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// next returns the first time strictly after `t` that matches the schedule. Times are computed
+// in t's location.
+func (s cronSchedule) next(t time.Time) (time.Time, bool) {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	yearLimit := t.Year() + 5
+
+wrap:
+	if t.Year() > yearLimit {
+		return time.Time{}, false
+	}
+
+	for !s.month.has(int(t.Month())) {
+		t = advancePast(t, time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc))
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+
+	for !s.dayMatches(t) {
+		t = advancePast(t, time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc))
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+
+	for !s.hour.has(t.Hour()) {
+		// Advance by elapsed time rather than with time.Date, which may map a wall clock
+		// time that is skipped by a DST transition back to an earlier instant.
+		t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+		if t.Hour() == 0 {
+			goto wrap
+		}
+	}
+
+	for !s.minute.has(t.Minute()) {
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+
+	return t, true
+}
+
+// advancePast returns `next`, moved forward in whole hours until it is after `t`. This handles
+// wall clock times, such as midnight in some time zones, that are skipped by a DST transition.
+func advancePast(t, next time.Time) time.Time {
+	for !next.After(t) {
+		next = next.Add(time.Hour)
+	}
+	return next
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCronExpr(t *testing.T) {
+	for _, test := range []struct {
+		expr string
+		out  CronExpr
+	}{
+		{"* * * * *", CronExpr{"*", "*", "*", "*", "*"}},
+		{"0 0 * * *", CronExpr{"0", "0", "*", "*", "*"}},
+		{"*/15 9-17 1,15 jan-MAR mon-fri", CronExpr{"*/15", "9-17", "1,15", "jan-MAR", "mon-fri"}},
+		{"  5/10  0-23/2 * * 7 ", CronExpr{"5/10", "0-23/2", "*", "*", "7"}},
+	} {
+		t.Run(test.expr, func(t *testing.T) {
+			require := require.New(t)
+			ce, err := ParseCronExpr(test.expr)
+			require.NoError(err)
+			require.Equal(test.out, ce)
+
+			// Rendering should round-trip.
+			ce2, err := ParseCronExpr(ce.String())
+			require.NoError(err)
+			require.Equal(ce, ce2)
+		})
+	}
+}
+
+func TestParseCronExprErrors(t *testing.T) {
+	for _, test := range []struct {
+		expr   string
+		errors []CronFieldError
+	}{
+		{
+			expr:   "* * * *",
+			errors: []CronFieldError{{Field: "expression", Value: "* * * *", Msg: "expected 5 fields, got 4"}},
+		},
+		{
+			expr:   "60 * * * *",
+			errors: []CronFieldError{{Field: "minute", Value: "60", Msg: "value 60 out of range [0, 59]"}},
+		},
+		{
+			expr: "* 5-1 0 foo */0",
+			errors: []CronFieldError{
+				{Field: "hour", Value: "5-1", Msg: `invalid range "5-1": start is after end`},
+				{Field: "dayOfMonth", Value: "0", Msg: "value 0 out of range [1, 31]"},
+				{Field: "month", Value: "foo", Msg: `invalid value "foo"`},
+				{Field: "dayOfWeek", Value: "*/0", Msg: `invalid step "0"`},
+			},
+		},
+	} {
+		t.Run(test.expr, func(t *testing.T) {
+			require := require.New(t)
+			_, err := ParseCronExpr(test.expr)
+			var cerr ErrInvalidCronExpr
+			require.ErrorAs(err, &cerr)
+			require.Equal(test.errors, cerr.Errors)
+		})
+	}
+
+	// Validate should also catch empty fields on a hand-built CronExpr.
+	err := CronExpr{Minute: "0", Hour: "0", DayOfMonth: "*", Month: "*"}.Validate()
+	var cerr ErrInvalidCronExpr
+	require.ErrorAs(t, err, &cerr)
+	require.Equal(t, []CronFieldError{{Field: "dayOfWeek", Msg: "must not be empty"}}, cerr.Errors)
+}
+
+func TestCronExprNext(t *testing.T) {
+	nyc, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	for _, test := range []struct {
+		name  string
+		expr  string
+		after time.Time
+		loc   *time.Location
+		out   []time.Time
+	}{
+		{
+			name:  "every 15 minutes",
+			expr:  "*/15 * * * *",
+			after: time.Date(2023, 1, 1, 10, 7, 30, 0, time.UTC),
+			out: []time.Time{
+				time.Date(2023, 1, 1, 10, 15, 0, 0, time.UTC),
+				time.Date(2023, 1, 1, 10, 30, 0, 0, time.UTC),
+				time.Date(2023, 1, 1, 10, 45, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:  "exact minute is excluded",
+			expr:  "0 0 * * *",
+			after: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+			out: []time.Time{
+				time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:  "weekdays at 9am in a time zone",
+			expr:  "0 9 * * mon-fri",
+			after: time.Date(2023, 1, 6, 12, 0, 0, 0, nyc), // Friday
+			loc:   nyc,
+			out: []time.Time{
+				time.Date(2023, 1, 9, 9, 0, 0, 0, nyc),
+				time.Date(2023, 1, 10, 9, 0, 0, 0, nyc),
+			},
+		},
+		{
+			name:  "day of month or day of week",
+			expr:  "0 0 13 * fri",
+			after: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+			out: []time.Time{
+				time.Date(2023, 1, 6, 0, 0, 0, 0, time.UTC),
+				time.Date(2023, 1, 13, 0, 0, 0, 0, time.UTC),
+				time.Date(2023, 1, 20, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:  "leap day",
+			expr:  "0 0 29 feb *",
+			after: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+			out: []time.Time{
+				time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+				time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:  "never fires",
+			expr:  "0 0 31 feb *",
+			after: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+			out:   nil,
+		},
+		{
+			name:  "skips nonexistent DST hour",
+			expr:  "30 2 * * *",
+			after: time.Date(2023, 3, 11, 12, 0, 0, 0, nyc),
+			loc:   nyc,
+			out: []time.Time{
+				time.Date(2023, 3, 13, 2, 30, 0, 0, nyc),
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+			ce, err := ParseCronExpr(test.expr)
+			require.NoError(err)
+
+			n := len(test.out)
+			if n == 0 {
+				n = 1
+			}
+			times, err := ce.Next(test.after, test.loc, n)
+			require.NoError(err)
+			require.Equal(len(test.out), len(times))
+			for i := range test.out {
+				require.True(test.out[i].Equal(times[i]), "expected %s, got %s", test.out[i], times[i])
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+)
+
+// EnvClient is an IAPIClient that issues all requests against a single environment. Requests
+// that accept an environment slug, such as GetTaskRequest, default to the client's environment
+// if they don't set one. Other environment-scoped requests, such as GetRun, are issued with a
+// context from WithEnvSlug. Requests that aren't scoped to an environment, such as ListEnvs,
+// are passed through to the wrapped client.
+type EnvClient struct {
+	IAPIClient
+	envSlug string
+}
+
+var _ IAPIClient = &EnvClient{}
+
+// InEnv wraps `client` so that requests are issued against the environment with slug `envSlug`.
+// An empty slug refers to the team's default environment.
+func InEnv(client IAPIClient, envSlug string) *EnvClient {
+	if ec, ok := client.(*EnvClient); ok {
+		client = ec.IAPIClient
+	}
+	return &EnvClient{IAPIClient: client, envSlug: envSlug}
+}
+
+// EnvSlug returns the slug of the client's environment.
+func (c *EnvClient) EnvSlug() string {
+	return c.envSlug
+}
+
+// Env fetches the client's environment. If it does not exist, a *EnvMissingError is returned.
+func (c *EnvClient) Env(ctx context.Context) (Env, error) {
+	return c.IAPIClient.GetEnv(ctx, c.envSlug)
+}
+
+// GetTask implementation.
+func (c *EnvClient) GetTask(ctx context.Context, req GetTaskRequest) (res Task, err error) {
+	req.EnvSlug = c.slug(req.EnvSlug)
+	return c.IAPIClient.GetTask(ctx, req)
+}
+
+// GetTaskMetadata implementation.
+func (c *EnvClient) GetTaskMetadata(ctx context.Context, slug string) (res TaskMetadata, err error) {
+	return c.IAPIClient.GetTaskMetadata(c.ctx(ctx), slug)
+}
+
+// GetView implementation.
+func (c *EnvClient) GetView(ctx context.Context, req GetViewRequest) (res View, err error) {
+	return c.IAPIClient.GetView(c.ctx(ctx), req)
+}
+
+// GetResource implementation.
+func (c *EnvClient) GetResource(ctx context.Context, req GetResourceRequest) (res GetResourceResponse, err error) {
+	req.EnvSlug = c.slug(req.EnvSlug)
+	return c.IAPIClient.GetResource(ctx, req)
+}
+
+// ListResources implementation.
+func (c *EnvClient) ListResources(ctx context.Context, envSlug string) (res ListResourcesResponse, err error) {
+	return c.IAPIClient.ListResources(ctx, c.slug(envSlug))
+}
+
+// ListResourceMetadata implementation.
+func (c *EnvClient) ListResourceMetadata(ctx context.Context) (res ListResourceMetadataResponse, err error) {
+	return c.IAPIClient.ListResourceMetadata(c.ctx(ctx))
+}
+
+// CreateTask implementation.
+func (c *EnvClient) CreateTask(ctx context.Context, req CreateTaskRequest) (res CreateTaskResponse, err error) {
+	req.EnvSlug = c.slug(req.EnvSlug)
+	return c.IAPIClient.CreateTask(ctx, req)
+}
+
+// UpdateTask implementation.
+func (c *EnvClient) UpdateTask(ctx context.Context, req UpdateTaskRequest) (res UpdateTaskResponse, err error) {
+	req.EnvSlug = c.slug(req.EnvSlug)
+	return c.IAPIClient.UpdateTask(ctx, req)
+}
+
+// ArchiveTask implementation.
+func (c *EnvClient) ArchiveTask(ctx context.Context, req ArchiveTaskRequest) error {
+	req.EnvSlug = c.slug(req.EnvSlug)
+	return c.IAPIClient.ArchiveTask(ctx, req)
+}
+
+// CreateView implementation.
+func (c *EnvClient) CreateView(ctx context.Context, req CreateViewRequest) (res View, err error) {
+	return c.IAPIClient.CreateView(c.ctx(ctx), req)
+}
+
+// UpdateView implementation.
+func (c *EnvClient) UpdateView(ctx context.Context, req UpdateViewRequest) (res View, err error) {
+	return c.IAPIClient.UpdateView(c.ctx(ctx), req)
+}
+
+// ExecuteTask implementation.
+func (c *EnvClient) ExecuteTask(ctx context.Context, req ExecuteTaskRequest) (res ExecuteTaskResponse, err error) {
+	req.EnvSlug = c.slug(req.EnvSlug)
+	return c.IAPIClient.ExecuteTask(ctx, req)
+}
+
+// GetRun implementation.
+func (c *EnvClient) GetRun(ctx context.Context, runID string) (res Run, err error) {
+	return c.IAPIClient.GetRun(c.ctx(ctx), runID)
+}
+
+// ListRuns implementation.
+func (c *EnvClient) ListRuns(ctx context.Context, req ListRunsRequest) (res ListRunsResponse, err error) {
+	return c.IAPIClient.ListRuns(c.ctx(ctx), req)
+}
+
+// CancelRun implementation.
+func (c *EnvClient) CancelRun(ctx context.Context, runID string) error {
+	return c.IAPIClient.CancelRun(c.ctx(ctx), runID)
+}
+
+// GetOutputs implementation.
+func (c *EnvClient) GetOutputs(ctx context.Context, runID string) (res GetOutputsResponse, err error) {
+	return c.IAPIClient.GetOutputs(c.ctx(ctx), runID)
+}
+
+// ListDisplays implementation.
+func (c *EnvClient) ListDisplays(ctx context.Context, runID string) (res ListDisplaysResponse, err error) {
+	return c.IAPIClient.ListDisplays(c.ctx(ctx), runID)
+}
+
+// ctx scopes `ctx` to the client's environment, unless it is already scoped to one.
+func (c *EnvClient) ctx(ctx context.Context) context.Context {
+	if _, ok := envSlugFromContext(ctx); ok {
+		return ctx
+	}
+	return WithEnvSlug(ctx, c.envSlug)
+}
+
+func (c *EnvClient) slug(envSlug string) string {
+	if envSlug != "" {
+		return envSlug
+	}
+	return c.envSlug
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvClient(t *testing.T) {
+	ctx := context.Background()
+
+	var envSlug string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		envSlug = req.URL.Query().Get("envSlug")
+		if envSlug == "" && req.Method == "POST" {
+			var body struct {
+				EnvSlug string `json:"envSlug"`
+			}
+			_ = json.NewDecoder(req.Body).Decode(&body)
+			envSlug = body.EnvSlug
+		}
+		writeJSON(rw, 200, map[string]any{})
+	}))
+	defer server.Close()
+	client := newTestHTTPClient(server.URL)
+
+	for _, test := range []struct {
+		name string
+		call func(c IAPIClient) error
+	}{
+		{"GetTask", func(c IAPIClient) error {
+			_, err := c.GetTask(ctx, GetTaskRequest{Slug: "my_task"})
+			return err
+		}},
+		{"GetTaskMetadata", func(c IAPIClient) error {
+			_, err := c.GetTaskMetadata(ctx, "my_task")
+			return err
+		}},
+		{"GetView", func(c IAPIClient) error {
+			_, err := c.GetView(ctx, GetViewRequest{Slug: "my_view"})
+			return err
+		}},
+		{"GetResource", func(c IAPIClient) error {
+			_, err := c.GetResource(ctx, GetResourceRequest{Slug: "db"})
+			return err
+		}},
+		{"ListResources", func(c IAPIClient) error {
+			_, err := c.ListResources(ctx, "")
+			return err
+		}},
+		{"ListResourceMetadata", func(c IAPIClient) error {
+			_, err := c.ListResourceMetadata(ctx)
+			return err
+		}},
+		{"CreateTask", func(c IAPIClient) error {
+			_, err := c.CreateTask(ctx, CreateTaskRequest{Slug: "my_task"})
+			return err
+		}},
+		{"UpdateTask", func(c IAPIClient) error {
+			_, err := c.UpdateTask(ctx, UpdateTaskRequest{Slug: "my_task"})
+			return err
+		}},
+		{"ArchiveTask", func(c IAPIClient) error {
+			return c.ArchiveTask(ctx, ArchiveTaskRequest{Slug: "my_task"})
+		}},
+		{"CreateView", func(c IAPIClient) error {
+			_, err := c.CreateView(ctx, CreateViewRequest{Slug: "my_view"})
+			return err
+		}},
+		{"UpdateView", func(c IAPIClient) error {
+			_, err := c.UpdateView(ctx, UpdateViewRequest{Slug: "my_view"})
+			return err
+		}},
+		{"ExecuteTask", func(c IAPIClient) error {
+			_, err := c.ExecuteTask(ctx, ExecuteTaskRequest{Slug: "my_task"})
+			return err
+		}},
+		{"GetRun", func(c IAPIClient) error {
+			_, err := c.GetRun(ctx, "run123")
+			return err
+		}},
+		{"ListRuns", func(c IAPIClient) error {
+			_, err := c.ListRuns(ctx, ListRunsRequest{TaskID: "tsk123"})
+			return err
+		}},
+		{"CancelRun", func(c IAPIClient) error {
+			return c.CancelRun(ctx, "run123")
+		}},
+		{"GetOutputs", func(c IAPIClient) error {
+			_, err := c.GetOutputs(ctx, "run123")
+			return err
+		}},
+		{"ListDisplays", func(c IAPIClient) error {
+			_, err := c.ListDisplays(ctx, "run123")
+			return err
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+
+			envSlug = ""
+			require.NoError(test.call(client))
+			require.Equal("", envSlug)
+
+			require.NoError(test.call(InEnv(client, "staging")))
+			require.Equal("staging", envSlug)
+
+			// Re-scoping a client replaces its environment.
+			require.NoError(test.call(InEnv(InEnv(client, "staging"), "prod")))
+			require.Equal("prod", envSlug)
+		})
+	}
+
+	// An environment set on the context takes precedence over the client's.
+	require := require.New(t)
+	_, err := InEnv(client, "staging").GetRun(WithEnvSlug(ctx, "prod"), "run123")
+	require.NoError(err)
+	require.Equal("prod", envSlug)
+}
@@ -38,10 +38,15 @@ func (err TaskMissingError) ExplainError() string {
 type ViewMissingError struct {
 	AppURL string
 	Slug   string
+	// ID is set instead of Slug if the view was looked up by ID.
+	ID string
 }
 
 // Error implementation.
 func (err ViewMissingError) Error() string {
+	if err.Slug == "" && err.ID != "" {
+		return fmt.Sprintf("view with ID %q does not exist", err.ID)
+	}
 	return fmt.Sprintf("view with slug %q does not exist", err.Slug)
 }
 
@@ -51,14 +56,36 @@ func (err ViewMissingError) ExplainError() string {
 	return linkToCreatePage("view", url)
 }
 
+// EnvMissingError implements an explainable error.
+type EnvMissingError struct {
+	AppURL string
+	Slug   string
+}
+
+// Error implementation.
+func (err EnvMissingError) Error() string {
+	return fmt.Sprintf("environment with slug %q does not exist", err.Slug)
+}
+
+// ExplainError implementation.
+func (err EnvMissingError) ExplainError() string {
+	url := getAppURL(err.AppURL) + "/settings/environments"
+	return linkToCreatePage("environment", url)
+}
+
 // ResourceMissingError implements an explainable error.
 type ResourceMissingError struct {
 	AppURL string
 	Slug   string
+	// ID is set instead of Slug if the resource was looked up by ID.
+	ID string
 }
 
 // Error implementation.
 func (err ResourceMissingError) Error() string {
+	if err.Slug == "" && err.ID != "" {
+		return fmt.Sprintf("resource with ID %q does not exist", err.ID)
+	}
 	return fmt.Sprintf("resource with slug %q does not exist", err.Slug)
 }
 
@@ -16,6 +16,10 @@ import (
 	"github.com/pkg/errors"
 )
 
+// defaultMaxRetries is the number of times a request is retried, unless overridden with
+// ReqOpts.MaxRetries. Requests are attempted up to 10 times in total.
+const defaultMaxRetries = 9
+
 // RequiredHeaders are HTTP headers that must be set on every HTTP request.
 var RequiredHeaders = []string{"X-Airplane-Client-Kind", "X-Airplane-Client-Version", "User-Agent"}
 
@@ -53,6 +57,26 @@ type ClientOpts struct {
 	// from. Some common fields are `team/TEAM_ID`, `run/RUN_ID`, and `build/BUILD_ID`, e.g.
 	// "airplane/cli/v0.1.4 team/tea123".
 	UserAgent string
+	// Middleware wraps the transport that performs each attempt of each request, including
+	// retries. The first middleware is the outermost, so it sees requests first and responses
+	// last. Required headers and the User-Agent are validated again after all middleware has
+	// run.
+	Middleware []Middleware
+	// Limiter, if set, is waited on before every attempt of every request, including retries.
+	// Share a Limiter, such as a TokenBucket, between clients to give them a single budget.
+	// Time spent waiting counts towards Timeout. If Wait returns an error, the attempt fails
+	// with it.
+	Limiter Limiter
+	// MaxRetryAfter is the longest the client waits before retrying a 429 or 503 response
+	// that asks it to wait, through a Retry-After header or an exhausted rate limit. If the
+	// server asks for a longer wait, the request is not retried and an ErrStatusCode is
+	// returned instead, so that the caller can decide whether to wait.
+	//
+	// Defaults to 30s.
+	MaxRetryAfter time.Duration
+	// RateLimitHook is an optional hook that is called after each HTTP response that includes
+	// X-RateLimit-* headers. This hook is called once per retry.
+	RateLimitHook func(rl RateLimit)
 
 	// retryWaitMin overrides the minimum wait time between retries. Used for testing purposes only.
 	retryWaitMin time.Duration
@@ -68,6 +92,9 @@ func NewClient(opts ClientOpts) Client {
 	if opts.retryWaitMax == 0 {
 		opts.retryWaitMax = 30 * time.Second
 	}
+	if opts.MaxRetryAfter == 0 {
+		opts.MaxRetryAfter = 30 * time.Second
+	}
 
 	// Only disable the timeout if a negative value is explicitly passed. Otherwise,
 	// default to a reasonable amount.
@@ -80,28 +107,43 @@ func NewClient(opts ClientOpts) Client {
 
 	rhc := retryablehttp.NewClient()
 
-	rhc.Backoff = backoffExponential
+	rhc.Backoff = func(min, max time.Duration, attempt int, resp *http.Response) time.Duration {
+		return backoffExponential(min, max, opts.MaxRetryAfter, attempt, resp)
+	}
 	rhc.RetryWaitMin = opts.retryWaitMin
 	rhc.RetryWaitMax = opts.retryWaitMax
-	// Perform up to 9 retries (10 total attempts).
-	rhc.RetryMax = 9
+	rhc.RetryMax = defaultMaxRetries
 
 	// Disable retryablehttp's automatic error wrapping, otherwise we don't get an *http.Response
 	// when all retries fail which prevents us from initializing an ErrStatusCode.
 	rhc.ErrorHandler = retryablehttp.PassthroughErrorHandler
 
 	// Surface the underlying error message on failure.
-	rhc.CheckRetry = errorPropagatedRetryPolicy
+	rhc.CheckRetry = func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+		if retryAfterExceeded(resp, opts.MaxRetryAfter) {
+			return false, nil
+		}
+		return errorPropagatedRetryPolicy(ctx, resp, err)
+	}
 
 	// Disable logging.
 	rhc.Logger = nil
 
-	// Configure a per-request timeout.
-	//
-	// Currently, retryablehttp does not support a per-request timeout. If you need to support multiple timeouts,
-	// create multiple Clients.
+	// Configure a per-request timeout. This can be overridden on individual requests with
+	// ReqOpts.Timeout.
 	rhc.HTTPClient.Timeout = opts.Timeout
 
+	if opts.Limiter != nil {
+		rhc.HTTPClient.Transport = limitingTransport{base: rhc.HTTPClient.Transport, limiter: opts.Limiter}
+	}
+	if len(opts.Middleware) > 0 {
+		var rt http.RoundTripper = validatingTransport{base: rhc.HTTPClient.Transport}
+		for i := len(opts.Middleware) - 1; i >= 0; i-- {
+			rt = opts.Middleware[i](rt)
+		}
+		rhc.HTTPClient.Transport = rt
+	}
+
 	// Attach optional logging hooks.
 	if opts.RequestLogHook != nil {
 		rhc.RequestLogHook = func(l retryablehttp.Logger, r *http.Request, i int) {
@@ -109,9 +151,16 @@ func NewClient(opts ClientOpts) Client {
 			opts.RequestLogHook(r, i+1)
 		}
 	}
-	if opts.ResponseLogHook != nil {
+	if opts.ResponseLogHook != nil || opts.RateLimitHook != nil {
 		rhc.ResponseLogHook = func(l retryablehttp.Logger, r *http.Response) {
-			opts.ResponseLogHook(r)
+			if opts.RateLimitHook != nil {
+				if rl, ok := ParseRateLimit(r.Header, time.Now()); ok {
+					opts.RateLimitHook(rl)
+				}
+			}
+			if opts.ResponseLogHook != nil {
+				opts.ResponseLogHook(r)
+			}
 		}
 	}
 
@@ -137,6 +186,28 @@ type ReqOpts struct {
 	// from. Some common fields are `team/TEAM_ID`, `run/RUN_ID`, and `build/BUILD_ID`, e.g.
 	// "airplane/cli/v0.1.4 team/tea123".
 	UserAgent string
+	// Timeout overrides ClientOpts.Timeout for this request. It is the maximum amount of time
+	// spent performing a single attempt.
+	//
+	// A negative value will disable the timeout entirely.
+	//
+	// Defaults to ClientOpts.Timeout.
+	Timeout time.Duration
+	// MaxRetries is the maximum number of times this request is retried.
+	//
+	// A negative value will disable retries entirely.
+	//
+	// Defaults to 9.
+	MaxRetries int
+	// Retryable, if set, decides whether a failed attempt is retried, replacing the default
+	// policy (including the X-Airplane-Retryable header). Either `resp` or `err` is set. If
+	// the request's context is done, the request is never retried.
+	Retryable func(resp *http.Response, err error) bool
+	// IdempotencyKey is sent as the Idempotency-Key header. Reuse the same key when re-issuing
+	// a request, e.g. after a crash, so that the API does not perform it twice.
+	//
+	// Defaults to a random key for POST and PATCH requests. Retries always reuse the key.
+	IdempotencyKey string
 }
 
 // Get issues an HTTP GET request to the Airplane API.
@@ -158,6 +229,24 @@ func (c Client) Get(ctx context.Context, url string, opts ReqOpts) ([]byte, erro
 	return body, err
 }
 
+// GetStream issues an HTTP GET request to the Airplane API and returns the response body
+// without reading it into memory, e.g. to download a large file. The caller must close it.
+//
+// Since ClientOpts.Timeout would also bound the time spent reading the body, it does not apply
+// to streams. Set ReqOpts.Timeout or cancel `ctx` instead.
+//
+// If the API returns a non-2xx status code, an ErrStatusCode error will be returned.
+func (c Client) GetStream(ctx context.Context, url string, opts ReqOpts) (io.ReadCloser, error) {
+	if opts.Timeout == 0 {
+		opts.Timeout = -1
+	}
+	resp, err := c.send(ctx, http.MethodGet, url, nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
 // GetJSON issues an HTTP GET request to the Airplane API and unmarshals a the response body
 // as JSON into `resp`.
 //
@@ -312,9 +401,25 @@ func (c Client) doJSON(ctx context.Context, method string, url string, req []byt
 }
 
 func (c Client) do(ctx context.Context, method string, url string, req []byte, opts ReqOpts) ([]byte, http.Header, error) {
+	resp, err := c.send(ctx, method, url, req, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "reading response body")
+	}
+	return body, resp.Header, nil
+}
+
+// send issues an HTTP request and returns a 2xx response, whose body must be closed by the
+// caller. Other responses are converted into an ErrStatusCode.
+func (c Client) send(ctx context.Context, method string, url string, req []byte, opts ReqOpts) (*http.Response, error) {
 	httpreq, err := retryablehttp.NewRequestWithContext(ctx, method, url, req)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "initializing HTTP request")
+		return nil, errors.Wrap(err, "initializing HTTP request")
 	}
 
 	// Attach a GetBody method so that the net/http can automatically retry requests
@@ -340,49 +445,103 @@ func (c Client) do(ctx context.Context, method string, url string, req []byte, o
 	}
 
 	// Set an Idempotency-Key header. This will ensure we can safely retry all HTTP requests.
-	switch method {
+	switch {
+	case opts.IdempotencyKey != "":
+		httpreq.Header.Set("Idempotency-Key", opts.IdempotencyKey)
 	// Idempotency keys are not necessary for idempotent-by-definition methods, such as GET/DELETE.
-	case http.MethodPost, http.MethodPatch:
+	case method == http.MethodPost || method == http.MethodPatch:
 		idempotencyKey, err := uuid.NewRandom()
 		if err != nil {
-			return nil, nil, errors.Wrap(err, "generating idempotency key")
+			return nil, errors.Wrap(err, "generating idempotency key")
 		}
 		httpreq.Header.Set("Idempotency-Key", idempotencyKey.String())
 	}
 
-	// Validate headers
-	for _, h := range RequiredHeaders {
-		if v := httpreq.Header.Get(h); v == "" {
-			return nil, nil, errors.Errorf("required header %q not set", h)
-		}
-	}
-	if err := validateUserAgent(httpreq.Header.Get("User-Agent")); err != nil {
-		return nil, nil, err
+	// Validate headers. They are validated again after any middleware has run, see
+	// validatingTransport.
+	if err := validateHeaders(httpreq.Header); err != nil {
+		return nil, err
 	}
 
-	resp, err := c.http.Do(httpreq)
+	resp, err := c.retryableClient(opts).Do(httpreq)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "performing HTTP request")
+		return nil, errors.Wrap(err, "performing HTTP request")
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, nil, errors.Wrap(err, "reading response body")
-		}
+		return resp, nil
+	}
+
+	return nil, NewErrStatusCodeFromResponse(resp)
+}
 
-		return body, resp.Header, nil
+// retryableClient returns the client to perform a request with. If the request overrides the
+// client's timeout or retry policy, a new client is returned that shares the same connections.
+func (c Client) retryableClient(opts ReqOpts) *retryablehttp.Client {
+	if opts.Timeout == 0 && opts.MaxRetries == 0 && opts.Retryable == nil {
+		return c.http
 	}
 
-	return nil, nil, NewErrStatusCodeFromResponse(resp)
+	rhc := &retryablehttp.Client{
+		HTTPClient: &http.Client{
+			Transport:     c.http.HTTPClient.Transport,
+			CheckRedirect: c.http.HTTPClient.CheckRedirect,
+			Jar:           c.http.HTTPClient.Jar,
+			Timeout:       c.http.HTTPClient.Timeout,
+		},
+		RetryWaitMin:    c.http.RetryWaitMin,
+		RetryWaitMax:    c.http.RetryWaitMax,
+		RetryMax:        c.http.RetryMax,
+		RequestLogHook:  c.http.RequestLogHook,
+		ResponseLogHook: c.http.ResponseLogHook,
+		CheckRetry:      c.http.CheckRetry,
+		Backoff:         c.http.Backoff,
+		ErrorHandler:    c.http.ErrorHandler,
+	}
+	if opts.Timeout > 0 {
+		rhc.HTTPClient.Timeout = opts.Timeout
+	} else if opts.Timeout < 0 {
+		rhc.HTTPClient.Timeout = 0
+	}
+	if opts.MaxRetries > 0 {
+		rhc.RetryMax = opts.MaxRetries
+	} else if opts.MaxRetries < 0 {
+		rhc.RetryMax = 0
+	}
+	if opts.Retryable != nil {
+		rhc.CheckRetry = func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
+			if isInvalidRequest(err) {
+				return false, err
+			}
+			if retryAfterExceeded(resp, c.opts.MaxRetryAfter) {
+				return false, nil
+			}
+			return opts.Retryable(resp, err), nil
+		}
+	}
+	return rhc
 }
 
-// backoffExponential is a retryablehttp.Backoff function that produces an exponential
-// backoff policy with jitter.
+// backoffExponential produces an exponential backoff policy with jitter. It is used as the
+// client's retryablehttp.Backoff.
+//
+// If a 429 or 503 response tells the client how long to wait, through a Retry-After header or
+// an exhausted rate limit, that wait is used instead, even if it exceeds `max`. It is capped at
+// `maxRetryAfter`, although such responses are normally not retried at all, see
+// retryAfterExceeded.
 //
 // Inspired by: https://aws.amazon.com/blogs/architecture/exponential-backoff-and-jitter/
-func backoffExponential(min, max time.Duration, attempt int, resp *http.Response) time.Duration {
+func backoffExponential(min, max, maxRetryAfter time.Duration, attempt int, resp *http.Response) time.Duration {
+	if d, ok := serverBackoff(resp, time.Now()); ok {
+		if d > maxRetryAfter {
+			return maxRetryAfter
+		}
+		return d
+	}
+
 	if max <= min {
 		return min
 	}
@@ -396,8 +555,20 @@ func backoffExponential(min, max time.Duration, attempt int, resp *http.Response
 	return time.Duration(jitter * float64(duration))
 }
 
+// retryAfterExceeded reports whether `resp` asks the client to wait longer than `max` before
+// retrying. Such responses are returned to the caller as an ErrStatusCode rather than retried.
+func retryAfterExceeded(resp *http.Response, max time.Duration) bool {
+	d, ok := serverBackoff(resp, time.Now())
+	return ok && d > max
+}
+
 // errorPropagatedRetryPolicy is a modified version of retryablehttp.ErrorPropagatedRetryPolicy.
 func errorPropagatedRetryPolicy(ctx context.Context, resp *http.Response, err error) (bool, error) {
+	// Requests that middleware made invalid will fail the same way on every attempt.
+	if isInvalidRequest(err) {
+		return false, err
+	}
+
 	// Certain status codes, e.g. 409, can sometimes be transient and should be retried. This is indicated
 	// by a header.
 	if resp != nil {
@@ -423,6 +594,15 @@ func errorPropagatedRetryPolicy(ctx context.Context, resp *http.Response, err er
 	return retry, err
 }
 
+func validateHeaders(header http.Header) error {
+	for _, h := range RequiredHeaders {
+		if v := header.Get(h); v == "" {
+			return errors.Errorf("required header %q not set", h)
+		}
+	}
+	return validateUserAgent(header.Get("User-Agent"))
+}
+
 func isJSONContentType(header http.Header) bool {
 	return strings.Contains(header.Get("Content-Type"), "application/json")
 }
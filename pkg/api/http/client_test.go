@@ -406,6 +406,122 @@ func TestClientTimeout(t *testing.T) {
 	require.Equal("OK", string(body))
 }
 
+func TestClientReqOpts(t *testing.T) {
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	attempts := 0
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		attempts++
+		keys = append(keys, req.Header.Get("Idempotency-Key"))
+		mu.Unlock()
+		switch req.URL.Path {
+		case "/slow":
+			time.Sleep(20 * time.Millisecond)
+			_, _ = rw.Write([]byte(`OK`))
+		case "/conflict":
+			rw.WriteHeader(409)
+		default:
+			rw.WriteHeader(500)
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(ClientOpts{
+		Headers:      requiredHeaderValues,
+		UserAgent:    "airplane/test/1",
+		Timeout:      5 * time.Millisecond,
+		retryWaitMin: time.Millisecond,
+		retryWaitMax: time.Millisecond,
+	})
+	reset := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts = 0
+		keys = nil
+	}
+
+	t.Run("timeout", func(t *testing.T) {
+		require := require.New(t)
+		reset()
+		body, err := client.Get(ctx, server.URL+"/slow", ReqOpts{Timeout: time.Second})
+		require.NoError(err)
+		require.Equal("OK", string(body))
+
+		body, err = client.Get(ctx, server.URL+"/slow", ReqOpts{Timeout: -1})
+		require.NoError(err)
+		require.Equal("OK", string(body))
+		require.Equal(2, attempts)
+	})
+
+	t.Run("max retries", func(t *testing.T) {
+		require := require.New(t)
+		reset()
+		_, err := client.Get(ctx, server.URL+"/error", ReqOpts{MaxRetries: 2})
+		require.Error(err)
+		require.Equal(3, attempts)
+
+		reset()
+		_, err = client.Get(ctx, server.URL+"/error", ReqOpts{MaxRetries: -1})
+		var errsc ErrStatusCode
+		require.ErrorAs(err, &errsc)
+		require.Equal(500, errsc.StatusCode)
+		require.Equal(1, attempts)
+
+		// The client's defaults are unaffected.
+		reset()
+		_, err = client.Get(ctx, server.URL+"/error", ReqOpts{})
+		require.Error(err)
+		require.Equal(10, attempts)
+	})
+
+	t.Run("retryable", func(t *testing.T) {
+		require := require.New(t)
+		reset()
+		var statuses []int
+		_, err := client.Get(ctx, server.URL+"/conflict", ReqOpts{
+			MaxRetries: 3,
+			Retryable: func(resp *http.Response, err error) bool {
+				statuses = append(statuses, resp.StatusCode)
+				return resp.StatusCode == 409
+			},
+		})
+		var errsc ErrStatusCode
+		require.ErrorAs(err, &errsc)
+		require.Equal(409, errsc.StatusCode)
+		require.Equal(4, attempts)
+		require.Equal([]int{409, 409, 409, 409}, statuses)
+
+		reset()
+		_, err = client.Get(ctx, server.URL+"/error", ReqOpts{
+			Retryable: func(resp *http.Response, err error) bool { return false },
+		})
+		require.Error(err)
+		require.Equal(1, attempts)
+	})
+
+	t.Run("idempotency key", func(t *testing.T) {
+		require := require.New(t)
+		reset()
+		_, err := client.Post(ctx, server.URL+"/error", []byte(`{}`), ReqOpts{
+			MaxRetries:     1,
+			IdempotencyKey: "deploy-123",
+		})
+		require.Error(err)
+		require.Equal([]string{"deploy-123", "deploy-123"}, keys)
+
+		// Keys are only generated for POSTs and PATCHes, but can be set on any request.
+		reset()
+		_, err = client.Put(ctx, server.URL+"/error", []byte(`{}`), ReqOpts{MaxRetries: -1})
+		require.Error(err)
+		_, err = client.Put(ctx, server.URL+"/error", []byte(`{}`), ReqOpts{MaxRetries: -1, IdempotencyKey: "put-123"})
+		require.Error(err)
+		require.Equal([]string{"", "put-123"}, keys)
+	})
+}
+
 func TestClientRequiredHeaders(t *testing.T) {
 	require := require.New(t)
 	ctx := context.Background()
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -17,12 +18,32 @@ type ErrStatusCode struct {
 	// ErrorCode is a unique identifier of this error scenario extracted, if set, from the
 	// API's response
 	ErrorCode string
+	// RateLimit is the rate limit state reported by the response, if any.
+	RateLimit *RateLimit
+	// RetryAfter is how long the server asked the client to wait before retrying, if set
+	// through a Retry-After header.
+	RetryAfter time.Duration
+	// RequestID identifies the request that failed, if set through an X-Request-Id header.
+	// Include it when contacting support.
+	RequestID string
+	// Header is the header of the API's response, or nil if the error was not created from a
+	// response. It is a pointer so that ErrStatusCode stays comparable.
+	Header *http.Header
 }
 
 func (e ErrStatusCode) Error() string {
 	return fmt.Sprintf("%d: %s", e.StatusCode, e.Msg)
 }
 
+// Unwrap returns the registered ErrCode for ErrorCode, if any, so that errors.Is can be used
+// to check for known error codes. See ErrCode.
+func (e ErrStatusCode) Unwrap() error {
+	if c, ok := LookupErrCode(e.ErrorCode); ok {
+		return c
+	}
+	return nil
+}
+
 type ErrorResponse struct {
 	Error string `json:"error"`
 	Code  string `json:"code"`
@@ -31,6 +52,15 @@ type ErrorResponse struct {
 func NewErrStatusCodeFromResponse(resp *http.Response) error {
 	errsc := ErrStatusCode{
 		StatusCode: resp.StatusCode,
+		RequestID:  resp.Header.Get("X-Request-Id"),
+		Header:     &resp.Header,
+	}
+	now := time.Now()
+	if rl, ok := ParseRateLimit(resp.Header, now); ok {
+		errsc.RateLimit = &rl
+	}
+	if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now); ok {
+		errsc.RetryAfter = d
 	}
 
 	body, err := io.ReadAll(resp.Body)
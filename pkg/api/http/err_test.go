@@ -2,8 +2,10 @@ package http
 
 import (
 	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 )
 
@@ -15,3 +17,41 @@ func TestErrStatusCode(t *testing.T) {
 		Msg:        "no task found",
 	}.Error())
 }
+
+func TestErrCodes(t *testing.T) {
+	require := require.New(t)
+
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Content-Type", "application/json")
+	rec.Header().Set("X-Request-Id", "req_123")
+	rec.WriteHeader(http.StatusConflict)
+	_, _ = rec.WriteString(`{"error": "a task with slug \"my_task\" already exists", "code": "slug_already_exists"}`)
+
+	err := NewErrStatusCodeFromResponse(rec.Result())
+	var errsc ErrStatusCode
+	require.ErrorAs(err, &errsc)
+	require.Equal("req_123", errsc.RequestID)
+	require.Equal("application/json", errsc.Header.Get("Content-Type"))
+	// ErrStatusCode stays comparable, so that it can be compared with == and errors.Is.
+	require.True(err == error(errsc))
+
+	wrapped := errors.Wrap(err, "creating task")
+	require.ErrorIs(wrapped, ErrSlugAlreadyExists)
+	require.NotErrorIs(wrapped, ErrQuotaExceeded)
+
+	var explainer interface{ ExplainError() string }
+	require.ErrorAs(wrapped, &explainer)
+	require.Equal(ErrSlugAlreadyExists.Explanation, explainer.ExplainError())
+
+	// Unknown codes are still exposed, but don't match any sentinel.
+	err = ErrStatusCode{StatusCode: 400, ErrorCode: "something_new"}
+	for _, c := range ErrCodes() {
+		require.NotErrorIs(err, c)
+	}
+	require.False(errors.As(err, &explainer))
+
+	c, ok := LookupErrCode("quota_exceeded")
+	require.True(ok)
+	require.Same(ErrQuotaExceeded, c)
+	require.Panics(func() { RegisterErrCode("quota_exceeded", "", "") })
+}
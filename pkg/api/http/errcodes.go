@@ -0,0 +1,111 @@
+package http
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ErrCode is a known value of ErrStatusCode.ErrorCode. ErrCodes are sentinel errors: an
+// ErrStatusCode unwraps to the registered ErrCode for its code, so callers can check for
+// specific API errors with errors.Is:
+//
+//	if errors.Is(err, libhttp.ErrSlugAlreadyExists) { ... }
+//
+// ErrCodes are explainable errors, so errors.As can also be used to explain an ErrStatusCode.
+type ErrCode struct {
+	// Code is the code sent by the API in the "code" field of an error response.
+	Code string
+	// Msg is a short description of the error.
+	Msg string
+	// Explanation is a longer, user-facing description of how to resolve the error.
+	Explanation string
+}
+
+// Error implementation.
+func (c *ErrCode) Error() string {
+	return c.Msg
+}
+
+// ExplainError implementation.
+func (c *ErrCode) ExplainError() string {
+	return c.Explanation
+}
+
+var (
+	errCodesMu sync.RWMutex
+	errCodes   = map[string]*ErrCode{}
+)
+
+// RegisterErrCode registers a known API error code. It panics if `code` is already registered,
+// so it should only be called from package-level variable declarations.
+func RegisterErrCode(code, msg, explanation string) *ErrCode {
+	errCodesMu.Lock()
+	defer errCodesMu.Unlock()
+	if _, ok := errCodes[code]; ok {
+		panic(fmt.Sprintf("error code %q is already registered", code))
+	}
+	c := &ErrCode{Code: code, Msg: msg, Explanation: explanation}
+	errCodes[code] = c
+	return c
+}
+
+// LookupErrCode returns the registered ErrCode for `code`, if any.
+func LookupErrCode(code string) (*ErrCode, bool) {
+	errCodesMu.RLock()
+	defer errCodesMu.RUnlock()
+	c, ok := errCodes[code]
+	return c, ok
+}
+
+// ErrCodes returns every registered ErrCode, sorted by code.
+func ErrCodes() []*ErrCode {
+	errCodesMu.RLock()
+	defer errCodesMu.RUnlock()
+	codes := make([]*ErrCode, 0, len(errCodes))
+	for _, c := range errCodes {
+		codes = append(codes, c)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		return codes[i].Code < codes[j].Code
+	})
+	return codes
+}
+
+var (
+	ErrSlugAlreadyExists = RegisterErrCode(
+		"slug_already_exists",
+		"slug already exists",
+		"Another resource in this team already uses this slug. Choose a different slug, or update the existing one instead.",
+	)
+	ErrQuotaExceeded = RegisterErrCode(
+		"quota_exceeded",
+		"quota exceeded",
+		"Your team has reached a usage limit of its plan. Upgrade your plan or contact support@airplane.dev to raise the limit.",
+	)
+	ErrRateLimited = RegisterErrCode(
+		"rate_limited",
+		"rate limited",
+		"Too many requests were sent to the Airplane API in a short period of time. Wait a moment, then try again.",
+	)
+	ErrUnauthenticated = RegisterErrCode(
+		"unauthenticated",
+		"unauthenticated",
+		"Your credentials are missing, invalid or expired. Log in again, or check that your API key is valid.",
+	)
+	ErrPermissionDenied = RegisterErrCode(
+		"permission_denied",
+		"permission denied",
+		"You do not have permission to perform this action. Ask a team admin to grant you access.",
+	)
+	ErrLocked = RegisterErrCode(
+		"locked",
+		"locked",
+		"The resource is being modified by another request. Wait for it to finish, then try again.",
+	)
+	ErrValidationFailed = RegisterErrCode(
+		"validation_failed",
+		"validation failed",
+		"The request was rejected because some of its fields are invalid. Check the error message for details.",
+	)
+)
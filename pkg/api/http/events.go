@@ -0,0 +1,283 @@
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Event is a single event read from an event stream.
+type Event struct {
+	// ID is the event's ID, if any. For server-sent events, it is the most recent `id` field,
+	// which may have been set by an earlier event. For NDJSON, it is the line's top-level "id"
+	// field, if it is a string or a number.
+	ID string
+	// Type is the event's `event` field. It is always empty for NDJSON.
+	Type string
+	// Data is the event's payload: the `data` fields of a server-sent event joined by
+	// newlines, or a line of NDJSON.
+	Data []byte
+}
+
+type EventStreamOpts struct {
+	// ReqOpts configures the request that opens the stream, and every request that reopens it.
+	//
+	// As with GetStream, ClientOpts.Timeout does not apply.
+	ReqOpts ReqOpts
+	// LastEventID, if set, is sent as the Last-Event-ID header when the stream is first opened,
+	// to resume a stream that was read earlier.
+	LastEventID string
+	// MaxReconnects is the maximum number of times in a row that the stream is reopened after
+	// it fails mid-stream, e.g. because the connection was reset. The count resets whenever an
+	// event is read.
+	//
+	// A negative value will disable reconnects entirely.
+	//
+	// Defaults to 5.
+	MaxReconnects int
+	// ReconnectWait is the delay before reopening the stream. For server-sent events, the
+	// server can override it with a `retry` field.
+	//
+	// Defaults to 1s.
+	ReconnectWait time.Duration
+}
+
+// EventReader reads events from a server-sent event (text/event-stream) or NDJSON
+// (application/x-ndjson) stream. It is not safe for concurrent use.
+type EventReader struct {
+	c    Client
+	ctx  context.Context
+	url  string
+	opts EventStreamOpts
+
+	body   io.ReadCloser
+	r      *bufio.Reader
+	ndjson bool
+	lastID string
+	// idBuffer is the ID set by the most recent `id` field of a server-sent event. It becomes
+	// lastID once the event is dispatched.
+	idBuffer   string
+	reconnects int
+	done       bool
+}
+
+// Events opens an event stream with an HTTP GET request to the Airplane API. The stream is
+// opened when Next is first called, and must be closed with Close.
+//
+// If the stream fails mid-stream, it is reopened with a Last-Event-ID header set to the ID of
+// the last event that was read, so that the server can resume from there. A stream that the
+// server ends cleanly is not reopened.
+func (c Client) Events(ctx context.Context, url string, opts EventStreamOpts) *EventReader {
+	if opts.MaxReconnects == 0 {
+		opts.MaxReconnects = 5
+	} else if opts.MaxReconnects < 0 {
+		opts.MaxReconnects = 0
+	}
+	if opts.ReconnectWait <= 0 {
+		opts.ReconnectWait = time.Second
+	}
+	if opts.ReqOpts.Timeout == 0 {
+		opts.ReqOpts.Timeout = -1
+	}
+	return &EventReader{
+		c:      c,
+		ctx:    ctx,
+		url:    url,
+		opts:   opts,
+		lastID: opts.LastEventID,
+	}
+}
+
+// Next returns the next event. It returns io.EOF once the server has ended the stream.
+//
+// If the stream can't be (re)opened, the error from the request is returned, e.g. an
+// ErrStatusCode.
+func (er *EventReader) Next() (Event, error) {
+	for {
+		if er.done {
+			return Event{}, io.EOF
+		}
+		if er.body == nil {
+			if err := er.open(); err != nil {
+				return Event{}, err
+			}
+		}
+
+		var event Event
+		var err error
+		if er.ndjson {
+			event, err = er.readLine()
+		} else {
+			event, err = er.readEvent()
+		}
+		if err == nil {
+			er.reconnects = 0
+			return event, nil
+		}
+
+		_ = er.body.Close()
+		er.body = nil
+		if errors.Is(err, io.EOF) {
+			er.done = true
+			return Event{}, io.EOF
+		}
+		if er.ctx.Err() != nil {
+			return Event{}, er.ctx.Err()
+		}
+		if er.reconnects >= er.opts.MaxReconnects {
+			return Event{}, errors.Wrap(err, "reading event stream")
+		}
+		er.reconnects++
+
+		t := time.NewTimer(er.opts.ReconnectWait)
+		select {
+		case <-er.ctx.Done():
+			t.Stop()
+			return Event{}, er.ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// LastEventID returns the ID of the last event that was read. Pass it as
+// EventStreamOpts.LastEventID to resume the stream later.
+func (er *EventReader) LastEventID() string {
+	return er.lastID
+}
+
+// Close closes the stream. Subsequent calls to Next return io.EOF.
+func (er *EventReader) Close() error {
+	er.done = true
+	if er.body == nil {
+		return nil
+	}
+	err := er.body.Close()
+	er.body = nil
+	return err
+}
+
+func (er *EventReader) open() error {
+	opts := er.opts.ReqOpts
+	headers := map[string]string{}
+	for k, v := range opts.Headers {
+		headers[k] = v
+	}
+	headers["Accept"] = "text/event-stream, application/x-ndjson"
+	headers["Cache-Control"] = "no-cache"
+	if er.lastID != "" {
+		headers["Last-Event-ID"] = er.lastID
+	}
+	opts.Headers = headers
+
+	resp, err := er.c.send(er.ctx, http.MethodGet, er.url, nil, opts)
+	if err != nil {
+		return err
+	}
+	contentType := resp.Header.Get("Content-Type")
+	switch {
+	case strings.HasPrefix(contentType, "text/event-stream"):
+		er.ndjson = false
+	case strings.Contains(contentType, "ndjson"), strings.Contains(contentType, "jsonl"):
+		er.ndjson = true
+	default:
+		_ = resp.Body.Close()
+		return errors.Errorf(`expected "text/event-stream" or "application/x-ndjson" response: got %q`, contentType)
+	}
+	er.body = resp.Body
+	er.r = bufio.NewReader(resp.Body)
+	er.idBuffer = er.lastID
+	return nil
+}
+
+// readEvent reads a server-sent event, following
+// https://html.spec.whatwg.org/multipage/server-sent-events.html#event-stream-interpretation.
+func (er *EventReader) readEvent() (Event, error) {
+	var event Event
+	var data bytes.Buffer
+	hasData := false
+	for {
+		line, err := er.r.ReadString('\n')
+		if err != nil {
+			// A partial event is discarded, including its ID.
+			return Event{}, err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		if line == "" {
+			er.lastID = er.idBuffer
+			if !hasData {
+				// Dispatch nothing, but start a new event.
+				event.Type = ""
+				continue
+			}
+			event.ID = er.lastID
+			event.Data = data.Bytes()
+			return event, nil
+		}
+		if strings.HasPrefix(line, ":") {
+			// Comments, e.g. used as keep-alives.
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event.Type = value
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				er.idBuffer = value
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				er.opts.ReconnectWait = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+// readLine reads a line of NDJSON. Blank lines are skipped.
+func (er *EventReader) readLine() (Event, error) {
+	for {
+		line, err := er.r.ReadBytes('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && len(bytes.TrimSpace(line)) > 0) {
+			return Event{}, err
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		event := Event{Data: line}
+		// Lines that aren't objects are still returned, they just don't have an ID.
+		var fields struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if json.Unmarshal(line, &fields) == nil && len(fields.ID) > 0 {
+			var id string
+			if json.Unmarshal(fields.ID, &id) == nil {
+				event.ID = id
+			} else if _, err := strconv.ParseFloat(string(fields.ID), 64); err == nil {
+				event.ID = string(fields.ID)
+			}
+		}
+		if event.ID != "" {
+			er.lastID = event.ID
+		}
+		return event, nil
+	}
+}
@@ -0,0 +1,216 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEventClient() Client {
+	return NewClient(ClientOpts{
+		Headers:      requiredHeaderValues,
+		UserAgent:    "airplane/test/1",
+		retryWaitMin: time.Millisecond,
+		retryWaitMax: time.Millisecond,
+	})
+}
+
+func readEvents(er *EventReader) ([]Event, error) {
+	var events []Event
+	for {
+		event, err := er.Next()
+		if err == io.EOF {
+			return events, nil
+		} else if err != nil {
+			return events, err
+		}
+		events = append(events, event)
+	}
+}
+
+func TestClientGetStream(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	content := strings.Repeat("0123456789", 100_000)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		require.Equal("airplane/test/1", req.Header.Get("User-Agent"))
+		if req.URL.Path == "/missing" {
+			rw.WriteHeader(404)
+			_, _ = rw.Write([]byte("not found"))
+			return
+		}
+		_, _ = io.Copy(rw, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	client := NewClient(ClientOpts{
+		Headers:   requiredHeaderValues,
+		UserAgent: "airplane/test/1",
+		// Reading the body is not bound by the client's timeout.
+		Timeout: time.Nanosecond,
+	})
+	body, err := client.GetStream(ctx, server.URL+"/file", ReqOpts{})
+	require.NoError(err)
+	defer body.Close()
+	b, err := io.ReadAll(body)
+	require.NoError(err)
+	require.Equal(len(content), len(b))
+
+	_, err = newTestEventClient().GetStream(ctx, server.URL+"/missing", ReqOpts{})
+	var errsc ErrStatusCode
+	require.ErrorAs(err, &errsc)
+	require.Equal(404, errsc.StatusCode)
+	require.Equal("not found", errsc.Msg)
+
+	_, err = NewClient(ClientOpts{Headers: requiredHeaderValues}).GetStream(ctx, server.URL+"/file", ReqOpts{})
+	require.ErrorContains(err, `required header "User-Agent" not set`)
+}
+
+func TestClientEventsSSE(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var lastEventIDs []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		lastEventIDs = append(lastEventIDs, req.Header.Get("Last-Event-ID"))
+		attempt := len(lastEventIDs)
+		mu.Unlock()
+
+		require.Contains(req.Header.Get("Accept"), "text/event-stream")
+		rw.Header().Set("Content-Type", "text/event-stream")
+		flusher := rw.(http.Flusher)
+		switch attempt {
+		case 1:
+			_, _ = io.WriteString(rw, ": keep-alive\n\nretry: 1\nid: 1\ndata: hello\n\nevent: log\nid: 2\ndata: line one\ndata: line two\n\n")
+			_, _ = io.WriteString(rw, "id: 3\ndata: partial")
+			flusher.Flush()
+			// Break the connection mid-event.
+			panic(http.ErrAbortHandler)
+		case 2:
+			_, _ = io.WriteString(rw, "id: 3\r\ndata: world\r\n\r\n")
+			flusher.Flush()
+			panic(http.ErrAbortHandler)
+		default:
+			// The stream ends cleanly.
+			_, _ = io.WriteString(rw, "data:no space\n\n")
+		}
+	}))
+	defer server.Close()
+
+	er := newTestEventClient().Events(ctx, server.URL+"/logs", EventStreamOpts{})
+	defer er.Close()
+	events, err := readEvents(er)
+	require.NoError(err)
+	require.Equal([]Event{
+		{ID: "1", Data: []byte("hello")},
+		{ID: "2", Type: "log", Data: []byte("line one\nline two")},
+		{ID: "3", Data: []byte("world")},
+		{ID: "3", Data: []byte("no space")},
+	}, events)
+	require.Equal([]string{"", "2", "3"}, lastEventIDs)
+	require.Equal("3", er.LastEventID())
+
+	// Streams can be resumed later.
+	er = newTestEventClient().Events(ctx, server.URL+"/logs", EventStreamOpts{LastEventID: "3"})
+	_, err = readEvents(er)
+	require.NoError(err)
+	require.Equal("3", lastEventIDs[3])
+}
+
+func TestClientEventsNDJSON(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		attempts++
+		rw.Header().Set("Content-Type", "application/x-ndjson")
+		if attempts == 1 {
+			_, _ = io.WriteString(rw, `{"id": 1, "msg": "a"}`+"\n\n"+`{"id": "b", "msg": "b"}`+"\n")
+			rw.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		require.Equal("b", req.Header.Get("Last-Event-ID"))
+		_, _ = io.WriteString(rw, `{"msg": "c"}`+"\n"+`["d"]`)
+	}))
+	defer server.Close()
+
+	events, err := readEvents(newTestEventClient().Events(ctx, server.URL+"/logs", EventStreamOpts{
+		ReconnectWait: time.Millisecond,
+	}))
+	require.NoError(err)
+	require.Equal([]Event{
+		{ID: "1", Data: []byte(`{"id": 1, "msg": "a"}`)},
+		{ID: "b", Data: []byte(`{"id": "b", "msg": "b"}`)},
+		{Data: []byte(`{"msg": "c"}`)},
+		{Data: []byte(`["d"]`)},
+	}, events)
+}
+
+func TestClientEventsErrors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("reconnects are limited", func(t *testing.T) {
+		require := require.New(t)
+		attempts := 0
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			attempts++
+			rw.Header().Set("Content-Type", "text/event-stream")
+			_, _ = fmt.Fprintf(rw, "id: %d\ndata: x\n\n", attempts)
+			rw.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}))
+		defer server.Close()
+
+		er := newTestEventClient().Events(ctx, server.URL, EventStreamOpts{
+			MaxReconnects: 2,
+			ReconnectWait: time.Millisecond,
+		})
+		// Every reconnect reads an event, so the stream keeps going.
+		for i := 1; i <= 5; i++ {
+			event, err := er.Next()
+			require.NoError(err)
+			require.Equal(fmt.Sprint(i), event.ID)
+		}
+		require.NoError(er.Close())
+		_, err := er.Next()
+		require.Equal(io.EOF, err)
+
+		er = newTestEventClient().Events(ctx, server.URL, EventStreamOpts{MaxReconnects: -1})
+		_, err = er.Next()
+		require.NoError(err)
+		_, err = er.Next()
+		require.ErrorIs(err, io.ErrUnexpectedEOF)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		require := require.New(t)
+		server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.URL.Path == "/plain" {
+				_, _ = rw.Write([]byte("hello"))
+				return
+			}
+			rw.WriteHeader(403)
+		}))
+		defer server.Close()
+
+		_, err := newTestEventClient().Events(ctx, server.URL+"/forbidden", EventStreamOpts{}).Next()
+		var errsc ErrStatusCode
+		require.ErrorAs(err, &errsc)
+		require.Equal(403, errsc.StatusCode)
+
+		_, err = newTestEventClient().Events(ctx, server.URL+"/plain", EventStreamOpts{}).Next()
+		require.ErrorContains(err, `expected "text/event-stream" or "application/x-ndjson" response`)
+	})
+}
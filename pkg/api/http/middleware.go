@@ -0,0 +1,276 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Middleware wraps an http.RoundTripper, e.g. to modify requests before they are sent or to
+// observe responses. See ClientOpts.Middleware.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc is an http.RoundTripper implemented by a function.
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+// RoundTrip implements http.RoundTripper.
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// invalidRequestError is returned when middleware leaves a request without valid headers.
+type invalidRequestError struct {
+	err error
+}
+
+func (e invalidRequestError) Error() string {
+	return e.err.Error()
+}
+
+func (e invalidRequestError) Unwrap() error {
+	return e.err
+}
+
+func isInvalidRequest(err error) bool {
+	var ire invalidRequestError
+	return errors.As(err, &ire)
+}
+
+// validatingTransport validates the headers of requests after all middleware has run.
+type validatingTransport struct {
+	base http.RoundTripper
+}
+
+func (t validatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := validateHeaders(req.Header); err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, invalidRequestError{err}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// TokenSource provides the bearer tokens used by BearerAuth.
+type TokenSource interface {
+	// Token returns the current token.
+	Token(ctx context.Context) (string, error)
+	// Refresh returns a new token after the API rejected `expired` with a 401. Concurrent
+	// requests may call Refresh with the same expired token, so implementations should only
+	// refresh it once.
+	Refresh(ctx context.Context, expired string) (string, error)
+}
+
+// BearerAuth authenticates requests with an `Authorization: Bearer` header. If the API
+// responds with a 401, the token is refreshed and the request is sent again, once.
+func BearerAuth(ts TokenSource) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			ctx := req.Context()
+			token, err := ts.Token(ctx)
+			if err != nil {
+				return nil, errors.Wrap(err, "getting token")
+			}
+			getBody, err := replayableBody(req)
+			if err != nil {
+				return nil, err
+			}
+
+			first := withBearer(req, token)
+			if first.Body, err = getBody(); err != nil {
+				return nil, err
+			}
+			resp, err := next.RoundTrip(first)
+			if err != nil || resp.StatusCode != http.StatusUnauthorized {
+				return resp, err
+			}
+
+			refreshed, err := ts.Refresh(ctx, token)
+			if err != nil {
+				_ = resp.Body.Close()
+				return nil, errors.Wrap(err, "refreshing token")
+			}
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+
+			replay := withBearer(req, refreshed)
+			if replay.Body, err = getBody(); err != nil {
+				return nil, err
+			}
+			return next.RoundTrip(replay)
+		})
+	}
+}
+
+// replayableBody returns a function that returns a fresh copy of the request's body, so that the
+// request can be sent more than once. Bodies without a GetBody are read into memory. Either way,
+// the original body is closed, since RoundTrippers must close it.
+func replayableBody(req *http.Request) (func() (io.ReadCloser, error), error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return func() (io.ReadCloser, error) { return req.Body, nil }, nil
+	}
+	if req.GetBody != nil {
+		_ = req.Body.Close()
+		return req.GetBody, nil
+	}
+	b, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, errors.Wrap(err, "reading request body")
+	}
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(b)), nil
+	}, nil
+}
+
+func withBearer(req *http.Request, token string) *http.Request {
+	// RoundTrippers must not modify the original request.
+	r := req.Clone(req.Context())
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+// TraceContext identifies the trace and span that a request is made from. See
+// ContextWithTrace.
+type TraceContext struct {
+	// TraceID is 32 lowercase hex characters.
+	TraceID string
+	// SpanID is 16 lowercase hex characters.
+	SpanID string
+	// Sampled reports whether the caller is recording the trace.
+	Sampled bool
+}
+
+type traceContextKey struct{}
+
+// ContextWithTrace returns a context whose requests are traced as part of `tc`, see Tracing.
+func ContextWithTrace(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+// TraceFromContext returns the trace set with ContextWithTrace, if any.
+func TraceFromContext(ctx context.Context) (TraceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return tc, ok
+}
+
+var (
+	traceIDRegexp = regexp.MustCompile(`^[0-9a-f]{32}$`)
+	spanIDRegexp  = regexp.MustCompile(`^[0-9a-f]{16}$`)
+)
+
+// Tracing propagates the trace set on a request's context with ContextWithTrace as a W3C
+// `traceparent` header. Requests without a valid trace are sent as-is.
+func Tracing() Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			tc, ok := TraceFromContext(req.Context())
+			if !ok || !traceIDRegexp.MatchString(tc.TraceID) || !spanIDRegexp.MatchString(tc.SpanID) {
+				return next.RoundTrip(req)
+			}
+			flags := "00"
+			if tc.Sampled {
+				flags = "01"
+			}
+			r := req.Clone(req.Context())
+			r.Header.Set("traceparent", fmt.Sprintf("00-%s-%s-%s", tc.TraceID, tc.SpanID, flags))
+			return next.RoundTrip(r)
+		})
+	}
+}
+
+// Metrics receives an observation for every attempt of every request. See WithMetrics.
+type Metrics interface {
+	// Observe is called once an attempt completes. `endpoint` is the request's method and
+	// URL path, e.g. "GET /v0/tasks/get". Either `status` or `err` is set.
+	Observe(endpoint string, status int, err error, latency time.Duration)
+}
+
+// WithMetrics reports the latency and outcome of every attempt to `m`.
+func WithMetrics(m Metrics) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			status := 0
+			if resp != nil {
+				status = resp.StatusCode
+			}
+			m.Observe(req.Method+" "+req.URL.Path, status, err, time.Since(start))
+			return resp, err
+		})
+	}
+}
+
+// EndpointStats are the metrics collected for one endpoint by EndpointCounters.
+type EndpointStats struct {
+	Endpoint string
+	// Requests is the number of attempts, including retries.
+	Requests int
+	// Errors is the number of attempts that failed with an error or a 4xx or 5xx response.
+	Errors int
+	// TotalLatency is the sum of the latency of every attempt.
+	TotalLatency time.Duration
+	// MaxLatency is the latency of the slowest attempt.
+	MaxLatency time.Duration
+}
+
+// MeanLatency returns the average latency of an attempt.
+func (s EndpointStats) MeanLatency() time.Duration {
+	if s.Requests == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Requests)
+}
+
+// EndpointCounters is an in-memory Metrics that counts requests, errors and latency per
+// endpoint. It is safe for concurrent use.
+type EndpointCounters struct {
+	mu    sync.Mutex
+	stats map[string]EndpointStats
+}
+
+var _ Metrics = &EndpointCounters{}
+
+// Observe implements Metrics.
+func (c *EndpointCounters) Observe(endpoint string, status int, err error, latency time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stats == nil {
+		c.stats = map[string]EndpointStats{}
+	}
+
+	s := c.stats[endpoint]
+	s.Endpoint = endpoint
+	s.Requests++
+	if err != nil || status >= 400 {
+		s.Errors++
+	}
+	s.TotalLatency += latency
+	if latency > s.MaxLatency {
+		s.MaxLatency = latency
+	}
+	c.stats[endpoint] = s
+}
+
+// Snapshot returns the stats of every endpoint observed so far, sorted by endpoint.
+func (c *EndpointCounters) Snapshot() []EndpointStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := make([]EndpointStats, 0, len(c.stats))
+	for _, s := range c.stats {
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Endpoint < stats[j].Endpoint
+	})
+	return stats
+}
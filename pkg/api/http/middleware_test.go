@@ -0,0 +1,272 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testTokenSource struct {
+	mu        sync.Mutex
+	token     string
+	refreshes int
+}
+
+func (ts *testTokenSource) Token(ctx context.Context) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	return ts.token, nil
+}
+
+func (ts *testTokenSource) Refresh(ctx context.Context, expired string) (string, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.token == expired {
+		ts.refreshes++
+		ts.token = "fresh"
+	}
+	return ts.token, nil
+}
+
+func TestBearerAuth(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		b, _ := io.ReadAll(req.Body)
+		mu.Lock()
+		bodies = append(bodies, string(b))
+		mu.Unlock()
+		if req.URL.Path == "/unauthorized" || req.Header.Get("Authorization") != "Bearer fresh" {
+			rw.WriteHeader(401)
+			return
+		}
+		_, _ = rw.Write([]byte(`{"ok": true}`))
+	}))
+	defer server.Close()
+
+	ts := &testTokenSource{token: "expired"}
+	client := NewClient(ClientOpts{
+		Headers:    requiredHeaderValues,
+		UserAgent:  "airplane/test/1",
+		Middleware: []Middleware{BearerAuth(ts)},
+	})
+
+	resp, err := client.Post(ctx, server.URL, []byte(`{"a":"b"}`), ReqOpts{})
+	require.NoError(err)
+	require.Equal(`{"ok": true}`, string(resp))
+	require.Equal(1, ts.refreshes)
+	// The body is sent again with the refreshed token.
+	require.Equal([]string{`{"a":"b"}`, `{"a":"b"}`}, bodies)
+
+	_, err = client.Get(ctx, server.URL, ReqOpts{})
+	require.NoError(err)
+	require.Equal(1, ts.refreshes)
+
+	// A request is only replayed once.
+	ts.token = "expired"
+	bodies = nil
+	_, err = client.Get(ctx, server.URL+"/unauthorized", ReqOpts{})
+	var errsc ErrStatusCode
+	require.ErrorAs(err, &errsc)
+	require.Equal(401, errsc.StatusCode)
+	require.Len(bodies, 2)
+	require.Equal(2, ts.refreshes)
+}
+
+type closeTracker struct {
+	io.Reader
+	closed bool
+}
+
+func (c *closeTracker) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestReplayableBody(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		getBody bool
+	}{
+		{"with GetBody", true},
+		{"without GetBody", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+
+			body := &closeTracker{Reader: strings.NewReader("body")}
+			req, err := http.NewRequest("POST", "http://example.com", body)
+			require.NoError(err)
+			if test.getBody {
+				req.GetBody = func() (io.ReadCloser, error) {
+					return io.NopCloser(strings.NewReader("body")), nil
+				}
+			}
+
+			getBody, err := replayableBody(req)
+			require.NoError(err)
+			// The original body is always closed, since it is replaced by copies.
+			require.True(body.closed)
+			for i := 0; i < 2; i++ {
+				rc, err := getBody()
+				require.NoError(err)
+				b, err := io.ReadAll(rc)
+				require.NoError(err)
+				require.Equal("body", string(b))
+			}
+		})
+	}
+}
+
+func TestTracing(t *testing.T) {
+	require := require.New(t)
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		traceparent = req.Header.Get("traceparent")
+	}))
+	defer server.Close()
+
+	client := NewClient(ClientOpts{
+		Headers:    requiredHeaderValues,
+		UserAgent:  "airplane/test/1",
+		Middleware: []Middleware{Tracing()},
+	})
+
+	for _, test := range []struct {
+		name        string
+		trace       *TraceContext
+		traceparent string
+	}{
+		{"no trace", nil, ""},
+		{
+			"sampled",
+			&TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true},
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		},
+		{
+			"not sampled",
+			&TraceContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"},
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+		},
+		{"invalid", &TraceContext{TraceID: "abc", SpanID: "def"}, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			if test.trace != nil {
+				ctx = ContextWithTrace(ctx, *test.trace)
+			}
+			_, err := client.Get(ctx, server.URL, ReqOpts{})
+			require.NoError(err)
+			require.Equal(test.traceparent, traceparent)
+		})
+	}
+}
+
+func TestWithMetrics(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if req.URL.Path == "/flaky" && attempts%2 == 1 {
+			rw.WriteHeader(500)
+			return
+		}
+		if req.URL.Path == "/missing" {
+			rw.WriteHeader(404)
+			return
+		}
+		_, _ = rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	metrics := &EndpointCounters{}
+	client := NewClient(ClientOpts{
+		Headers:      requiredHeaderValues,
+		UserAgent:    "airplane/test/1",
+		Middleware:   []Middleware{WithMetrics(metrics)},
+		retryWaitMin: time.Millisecond,
+		retryWaitMax: time.Millisecond,
+	})
+
+	_, err := client.Get(ctx, server.URL+"/flaky", ReqOpts{})
+	require.NoError(err)
+	_, err = client.Get(ctx, server.URL+"/ok", ReqOpts{})
+	require.NoError(err)
+	_, err = client.Get(ctx, server.URL+"/missing", ReqOpts{})
+	require.Error(err)
+
+	stats := metrics.Snapshot()
+	require.Len(stats, 3)
+	for i, expected := range []EndpointStats{
+		{Endpoint: "GET /flaky", Requests: 2, Errors: 1},
+		{Endpoint: "GET /missing", Requests: 1, Errors: 1},
+		{Endpoint: "GET /ok", Requests: 1},
+	} {
+		require.Equal(expected.Endpoint, stats[i].Endpoint)
+		require.Equal(expected.Requests, stats[i].Requests)
+		require.Equal(expected.Errors, stats[i].Errors)
+		require.Greater(stats[i].TotalLatency, time.Duration(0))
+		require.LessOrEqual(stats[i].MaxLatency, stats[i].TotalLatency)
+	}
+}
+
+func TestMiddlewareValidation(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	attempts := 0
+	stripUserAgent := func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			attempts++
+			r := req.Clone(req.Context())
+			r.Header.Set("User-Agent", "curl/7.0")
+			return next.RoundTrip(r)
+		})
+	}
+
+	client := NewClient(ClientOpts{
+		Headers:      requiredHeaderValues,
+		UserAgent:    "airplane/test/1",
+		Middleware:   []Middleware{stripUserAgent},
+		retryWaitMin: time.Millisecond,
+		retryWaitMax: time.Millisecond,
+	})
+	_, err := client.Get(ctx, server.URL, ReqOpts{})
+	require.ErrorContains(err, `User-Agent must start with "airplane/"`)
+	var ire invalidRequestError
+	require.True(errors.As(err, &ire))
+	// Invalid requests never reach the server and are not retried.
+	require.Equal(0, requests)
+	require.Equal(1, attempts)
+
+	// The same applies when the retry policy is overridden.
+	_, err = client.Get(ctx, server.URL, ReqOpts{
+		Retryable: func(resp *http.Response, err error) bool { return true },
+	})
+	require.Error(err)
+	require.Equal(0, requests)
+	require.Equal(2, attempts)
+}
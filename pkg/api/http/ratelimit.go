@@ -0,0 +1,186 @@
+package http
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RateLimit is the rate limit state reported by the API in X-RateLimit-* headers.
+type RateLimit struct {
+	// Limit is the number of requests allowed in the current window (X-RateLimit-Limit).
+	Limit int
+	// Remaining is the number of requests left in the current window (X-RateLimit-Remaining).
+	Remaining int
+	// Reset is when the current window ends (X-RateLimit-Reset). The header is either a Unix
+	// timestamp or, for values below a billion, a number of seconds from now. Zero if unset.
+	Reset time.Time
+}
+
+// resetDeltaMax is the largest X-RateLimit-Reset value that is treated as a number of seconds
+// rather than as a Unix timestamp. A billion seconds is ~31 years.
+const resetDeltaMax = 1_000_000_000
+
+// ParseRateLimit extracts the rate limit state from response headers. It returns false if the
+// response has no X-RateLimit-Limit or X-RateLimit-Remaining header.
+func ParseRateLimit(header http.Header, now time.Time) (RateLimit, bool) {
+	limit, err := strconv.Atoi(header.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return RateLimit{}, false
+	}
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return RateLimit{}, false
+	}
+
+	rl := RateLimit{Limit: limit, Remaining: remaining}
+	if reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64); err == nil && reset >= 0 {
+		if reset < resetDeltaMax {
+			rl.Reset = now.Add(time.Duration(reset) * time.Second)
+		} else {
+			rl.Reset = time.Unix(reset, 0)
+		}
+	}
+	return rl, true
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of seconds or an
+// HTTP-date, into the duration to wait from `now`. Dates in the past result in no wait.
+func parseRetryAfter(header string, now time.Time) (time.Duration, bool) {
+	if header == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(header, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	t, err := http.ParseTime(header)
+	if err != nil {
+		return 0, false
+	}
+	if d := t.Sub(now); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
+
+// serverBackoff returns how long the server asked the client to wait before retrying a 429 or
+// 503 response, either through a Retry-After header or, if that's not set, through the reset
+// time of an exhausted rate limit.
+func serverBackoff(resp *http.Response, now time.Time) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now); ok {
+		return d, true
+	}
+	if rl, ok := ParseRateLimit(resp.Header, now); ok && rl.Remaining == 0 && !rl.Reset.IsZero() {
+		if d := rl.Reset.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// Limiter limits the rate of outgoing requests. Wait blocks until a request may be sent, or
+// returns an error if `ctx` is cancelled first.
+type Limiter interface {
+	Wait(ctx context.Context) error
+}
+
+// limitingTransport waits on a Limiter before sending each request.
+type limitingTransport struct {
+	base    http.RoundTripper
+	limiter Limiter
+}
+
+func (t limitingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context()); err != nil {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, errors.Wrap(err, "waiting for rate limiter")
+	}
+	return t.base.RoundTrip(req)
+}
+
+// TokenBucket is a Limiter that allows bursts of up to `burst` requests, refilled at a steady
+// rate. It is safe for concurrent use, so a single TokenBucket can be shared between clients
+// to give them one budget.
+type TokenBucket struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+var _ Limiter = &TokenBucket{}
+
+// NewTokenBucket creates a TokenBucket that allows `perSecond` requests per second on
+// average, with bursts of up to `burst` requests. The bucket starts out full.
+func NewTokenBucket(perSecond float64, burst int) *TokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:   perSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait implements Limiter.
+func (tb *TokenBucket) Wait(ctx context.Context) error {
+	for {
+		delay := tb.take()
+		if delay == 0 {
+			return nil
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// take consumes a token if one is available. Otherwise, it returns how long to wait until the
+// next token is available.
+func (tb *TokenBucket) take() time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	now := time.Now()
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > tb.burst {
+		tb.tokens = tb.burst
+	}
+	tb.last = now
+
+	if tb.tokens >= 1 {
+		tb.tokens--
+		return 0
+	}
+	if tb.rate <= 0 {
+		// The bucket never refills, so wait until the context is cancelled.
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration((1 - tb.tokens) / tb.rate * float64(time.Second))
+}
@@ -0,0 +1,248 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	for _, test := range []struct {
+		header string
+		wait   time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"120", 2 * time.Minute, true},
+		{"-1", 0, false},
+		{"Mon, 02 Jan 2023 15:04:35 GMT", 30 * time.Second, true},
+		{"Mon, 02 Jan 2023 15:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	} {
+		t.Run(test.header, func(t *testing.T) {
+			wait, ok := parseRetryAfter(test.header, now)
+			require.Equal(t, test.ok, ok)
+			require.Equal(t, test.wait, wait)
+		})
+	}
+}
+
+func TestParseRateLimit(t *testing.T) {
+	require := require.New(t)
+	now := time.Date(2023, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	_, ok := ParseRateLimit(http.Header{}, now)
+	require.False(ok)
+
+	header := http.Header{}
+	header.Set("X-RateLimit-Limit", "100")
+	header.Set("X-RateLimit-Remaining", "7")
+	rl, ok := ParseRateLimit(header, now)
+	require.True(ok)
+	require.Equal(RateLimit{Limit: 100, Remaining: 7}, rl)
+
+	header.Set("X-RateLimit-Reset", "30")
+	rl, _ = ParseRateLimit(header, now)
+	require.Equal(now.Add(30*time.Second), rl.Reset)
+
+	header.Set("X-RateLimit-Reset", strconv.FormatInt(now.Add(time.Hour).Unix(), 10))
+	rl, _ = ParseRateLimit(header, now)
+	require.True(now.Add(time.Hour).Equal(rl.Reset))
+}
+
+func TestBackoffServer(t *testing.T) {
+	require := require.New(t)
+
+	resp := func(status int, headers map[string]string) *http.Response {
+		r := &http.Response{StatusCode: status, Header: http.Header{}}
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		return r
+	}
+
+	// Retry-After is honored on 429s and 503s, even beyond the maximum wait.
+	require.Equal(time.Minute, backoffExponential(time.Millisecond, time.Second, time.Hour, 0, resp(429, map[string]string{"Retry-After": "60"})))
+	require.Equal(2*time.Second, backoffExponential(time.Millisecond, time.Second, time.Hour, 3, resp(503, map[string]string{"Retry-After": "2"})))
+	// But it is capped at the maximum Retry-After.
+	require.Equal(10*time.Second, backoffExponential(time.Millisecond, time.Second, 10*time.Second, 0, resp(429, map[string]string{"Retry-After": "60"})))
+	// An exhausted rate limit is waited out.
+	wait := backoffExponential(time.Millisecond, time.Second, time.Hour, 0, resp(429, map[string]string{
+		"X-RateLimit-Limit":     "10",
+		"X-RateLimit-Remaining": "0",
+		"X-RateLimit-Reset":     "5",
+	}))
+	require.InDelta(5*time.Second, wait, float64(100*time.Millisecond))
+	// Other responses use the jittered exponential backoff.
+	require.LessOrEqual(backoffExponential(time.Millisecond, time.Second, time.Hour, 0, resp(500, map[string]string{"Retry-After": "60"})), time.Millisecond)
+	require.LessOrEqual(backoffExponential(time.Millisecond, time.Second, time.Hour, 0, resp(429, nil)), time.Millisecond)
+	require.LessOrEqual(backoffExponential(time.Millisecond, time.Second, time.Hour, 0, nil), time.Millisecond)
+}
+
+func TestTokenBucket(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	tb := NewTokenBucket(100, 2)
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		require.NoError(tb.Wait(ctx))
+	}
+	// The first two requests use the burst, and the other two wait ~10ms each.
+	require.GreaterOrEqual(time.Since(start), 15*time.Millisecond)
+
+	empty := NewTokenBucket(0, 1)
+	require.NoError(empty.Wait(ctx))
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(empty.Wait(ctx), context.DeadlineExceeded)
+}
+
+func TestClientRateLimits(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		rw.Header().Set("X-RateLimit-Limit", "10")
+		rw.Header().Set("X-RateLimit-Remaining", strconv.Itoa(10-requests))
+		if req.URL.Path == "/limited" {
+			rw.Header().Set("Retry-After", "0")
+			rw.WriteHeader(429)
+			return
+		}
+		_, _ = rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	var seen []RateLimit
+	client := NewClient(ClientOpts{
+		Headers:   requiredHeaderValues,
+		UserAgent: "airplane/test/1",
+		Limiter:   NewTokenBucket(1000, 1),
+		RateLimitHook: func(rl RateLimit) {
+			seen = append(seen, rl)
+		},
+		retryWaitMin: time.Millisecond,
+		retryWaitMax: time.Millisecond,
+	})
+
+	// Concurrent requests share the limiter.
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := NewClient(ClientOpts{
+				Headers:   requiredHeaderValues,
+				UserAgent: "airplane/test/1",
+				Limiter:   client.opts.Limiter,
+			}).Get(ctx, server.URL+"/ok", ReqOpts{})
+			require.NoError(err)
+		}()
+	}
+	wg.Wait()
+
+	_, err := client.Get(ctx, server.URL+"/ok", ReqOpts{})
+	require.NoError(err)
+	require.Equal([]RateLimit{{Limit: 10, Remaining: 4}}, seen)
+
+	// Rate limit headers are exposed on errors.
+	_, err = client.Get(ctx, server.URL+"/limited", ReqOpts{})
+	var errsc ErrStatusCode
+	require.ErrorAs(err, &errsc)
+	require.Equal(429, errsc.StatusCode)
+	require.Equal(&RateLimit{Limit: 10, Remaining: -6}, errsc.RateLimit)
+	require.Equal(time.Duration(0), errsc.RetryAfter)
+	require.Len(seen, 11)
+}
+
+func TestClientMaxRetryAfter(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		rw.Header().Set("Retry-After", "3600")
+		rw.WriteHeader(429)
+	}))
+	defer server.Close()
+
+	client := NewClient(ClientOpts{
+		Headers:      requiredHeaderValues,
+		UserAgent:    "airplane/test/1",
+		retryWaitMin: time.Millisecond,
+		retryWaitMax: time.Millisecond,
+	})
+	for _, opts := range []ReqOpts{
+		{},
+		{Retryable: func(resp *http.Response, err error) bool { return true }},
+	} {
+		requests = 0
+		start := time.Now()
+		_, err := client.Get(ctx, server.URL, opts)
+		var errsc ErrStatusCode
+		require.ErrorAs(err, &errsc)
+		require.Equal(429, errsc.StatusCode)
+		require.Equal(time.Hour, errsc.RetryAfter)
+		// The request is not retried, rather than waiting for an hour.
+		require.Equal(1, requests)
+		require.Less(time.Since(start), time.Second)
+	}
+}
+
+type errLimiter struct{}
+
+func (errLimiter) Wait(ctx context.Context) error {
+	return errors.New("limiter closed")
+}
+
+func TestClientLimiterError(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		requests++
+		_, _ = rw.Write([]byte(`OK`))
+	}))
+	defer server.Close()
+
+	client := NewClient(ClientOpts{
+		Headers:   requiredHeaderValues,
+		UserAgent: "airplane/test/1",
+		Limiter:   errLimiter{},
+	})
+	_, err := client.Get(ctx, server.URL, ReqOpts{MaxRetries: -1})
+	require.ErrorContains(err, "limiter closed")
+	require.Equal(0, requests)
+
+	// A request's timeout stops the wait.
+	empty := NewTokenBucket(0, 1)
+	require.NoError(empty.Wait(ctx))
+	_, err = NewClient(ClientOpts{
+		Headers:   requiredHeaderValues,
+		UserAgent: "airplane/test/1",
+		Limiter:   empty,
+	}).Get(ctx, server.URL, ReqOpts{Timeout: 10 * time.Millisecond, MaxRetries: -1})
+	require.ErrorContains(err, "waiting for rate limiter")
+	require.Equal(0, requests)
+}
@@ -0,0 +1,265 @@
+package api
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/airplanedev/ojson"
+	"github.com/pkg/errors"
+)
+
+// JSONSchemaDraft07 is the URI of the JSON Schema draft that JSONSchema conforms to.
+const JSONSchemaDraft07 = "http://json-schema.org/draft-07/schema#"
+
+// JSONSchema is the subset of a JSON Schema (draft-07) that parameters are converted to and
+// from. See Parameters.JSONSchema and ParametersFromJSONSchema.
+type JSONSchema struct {
+	Schema      string `json:"$schema,omitempty"`
+	Type        string `json:"type,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Format      string `json:"format,omitempty"`
+	// ContentMediaType is set to "application/sql" for SQL parameters.
+	ContentMediaType string       `json:"contentMediaType,omitempty"`
+	Pattern          string       `json:"pattern,omitempty"`
+	Enum             []Value      `json:"enum,omitempty"`
+	OneOf            []JSONSchema `json:"oneOf,omitempty"`
+	Const            Value        `json:"const,omitempty"`
+	Default          Value        `json:"default,omitempty"`
+
+	Properties           JSONSchemaProperties `json:"properties,omitempty"`
+	Required             []string             `json:"required,omitempty"`
+	AdditionalProperties *bool                `json:"additionalProperties,omitempty"`
+
+	// AirplaneType and AirplaneComponent preserve the parameter type and component where they
+	// can't be inferred from standard keywords. Other consumers of the schema ignore them.
+	AirplaneType      Type      `json:"x-airplane-type,omitempty"`
+	AirplaneComponent Component `json:"x-airplane-component,omitempty"`
+}
+
+// JSONSchemaProperty is a named property of an object schema.
+type JSONSchemaProperty struct {
+	Name   string
+	Schema JSONSchema
+}
+
+// JSONSchemaProperties are the properties of an object schema. They are (un)marshalled as a
+// JSON object whose key order matches the order of the properties.
+type JSONSchemaProperties []JSONSchemaProperty
+
+// MarshalJSON implementation.
+func (p JSONSchemaProperties) MarshalJSON() ([]byte, error) {
+	o := ojson.NewObject()
+	for _, prop := range p {
+		o.Set(prop.Name, prop.Schema)
+	}
+	return json.Marshal(o)
+}
+
+// UnmarshalJSON implementation.
+func (p *JSONSchemaProperties) UnmarshalJSON(buf []byte) error {
+	var v ojson.Value
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return err
+	}
+	o, ok := v.V.(*ojson.Object)
+	if !ok {
+		return errors.New("expected properties to be an object")
+	}
+
+	props := make(JSONSchemaProperties, 0, len(o.KeyOrder()))
+	for _, name := range o.KeyOrder() {
+		value, _ := o.Get(name)
+		b, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		var schema JSONSchema
+		if err := json.Unmarshal(b, &schema); err != nil {
+			return errors.Wrapf(err, "property %q", name)
+		}
+		props = append(props, JSONSchemaProperty{Name: name, Schema: schema})
+	}
+	*p = props
+	return nil
+}
+
+// JSONSchema converts the parameters to a JSON Schema (draft-07) of an object whose properties
+// are the parameter values, keyed by slug. Each parameter is converted as follows:
+//
+//   - Name and Desc become the title and description, and Default becomes the default.
+//   - TypeString, TypeBoolean and TypeInteger keep their names. TypeFloat becomes "number".
+//   - TypeDate and TypeDatetime become strings with the "date" and "date-time" formats.
+//   - TypeUpload and TypeConfigVar become strings, with x-airplane-type set to the original type.
+//   - ComponentEditorSQL sets contentMediaType to "application/sql". Components are also kept
+//     in x-airplane-component.
+//   - Constraints.Regex becomes the pattern. Constraints.Options become an enum if none of
+//     them have labels, or a oneOf of consts titled by their labels otherwise.
+//   - Parameters that aren't Constraints.Optional are required.
+//
+// The conversion is lossy in a few ways that only matter to consumers other than
+// ParametersFromJSONSchema:
+//
+//   - Uploads, config variables and textarea components are only distinguishable from plain
+//     strings through the x-airplane-* keywords. Config variables passed as objects of the form
+//     `{"name": "..."}` do not satisfy the schema.
+//   - Patterns are Go regular expressions, which differ from the ECMA 262 dialect that JSON
+//     Schema specifies in some edge cases (e.g. lookarounds are not supported).
+//   - Parameters with a default are required by the schema, even though Parameters.Validate
+//     accepts a missing value for them.
+func (p Parameters) JSONSchema() JSONSchema {
+	schema := JSONSchema{
+		Schema:               JSONSchemaDraft07,
+		Type:                 "object",
+		Properties:           JSONSchemaProperties{},
+		AdditionalProperties: new(bool),
+	}
+	for _, param := range p {
+		schema.Properties = append(schema.Properties, JSONSchemaProperty{
+			Name:   param.Slug,
+			Schema: param.jsonSchema(),
+		})
+		if !param.Constraints.Optional {
+			schema.Required = append(schema.Required, param.Slug)
+		}
+	}
+	return schema
+}
+
+func (p Parameter) jsonSchema() JSONSchema {
+	schema := JSONSchema{
+		Title:             p.Name,
+		Description:       p.Desc,
+		Default:           p.Default,
+		Pattern:           p.Constraints.Regex,
+		AirplaneComponent: p.Component,
+	}
+
+	switch p.Type {
+	case TypeFloat:
+		schema.Type = "number"
+	case TypeDate:
+		schema.Type, schema.Format = "string", "date"
+	case TypeDatetime:
+		schema.Type, schema.Format = "string", "date-time"
+	case TypeUpload, TypeConfigVar:
+		schema.Type, schema.AirplaneType = "string", p.Type
+	default:
+		schema.Type = string(p.Type)
+	}
+	if p.Component == ComponentEditorSQL {
+		schema.ContentMediaType = "application/sql"
+	}
+
+	hasLabels := false
+	for _, opt := range p.Constraints.Options {
+		hasLabels = hasLabels || opt.Label != ""
+	}
+	for _, opt := range p.Constraints.Options {
+		if hasLabels {
+			schema.OneOf = append(schema.OneOf, JSONSchema{Const: opt.Value, Title: opt.Label})
+		} else {
+			schema.Enum = append(schema.Enum, opt.Value)
+		}
+	}
+	return schema
+}
+
+// ParametersFromJSONSchema converts a JSON Schema (draft-07) of an object to parameters, one
+// per property and in the same order. It reverses Parameters.JSONSchema, and also accepts
+// schemas written by hand or by other tools:
+//
+//   - A property's title becomes the parameter's name, defaulting to the property's name.
+//   - Strings with the "date" and "date-time" formats become TypeDate and TypeDatetime, and
+//     other strings become TypeString. Strings with a contentMediaType of "application/sql"
+//     use ComponentEditorSQL.
+//   - "number" becomes TypeFloat.
+//   - Properties that aren't required are Constraints.Optional.
+//
+// Properties of other types, such as arrays and nested objects, are rejected. Keywords that
+// parameters can't represent, such as minLength or maximum, are ignored.
+func ParametersFromJSONSchema(schema JSONSchema) (Parameters, error) {
+	if schema.Type != "" && schema.Type != "object" {
+		return nil, errors.Errorf("expected a schema of type object, got %q", schema.Type)
+	}
+
+	required := map[string]bool{}
+	for _, slug := range schema.Required {
+		required[slug] = true
+	}
+
+	params := Parameters{}
+	var unsupported []string
+	for _, prop := range schema.Properties {
+		param, err := parameterFromJSONSchema(prop.Name, prop.Schema)
+		if err != nil {
+			unsupported = append(unsupported, err.Error())
+			continue
+		}
+		param.Constraints.Optional = !required[prop.Name]
+		params = append(params, param)
+	}
+	if len(unsupported) > 0 {
+		sort.Strings(unsupported)
+		return nil, errors.Errorf("unsupported properties: %s", strings.Join(unsupported, "; "))
+	}
+	return params, nil
+}
+
+func parameterFromJSONSchema(slug string, schema JSONSchema) (Parameter, error) {
+	param := Parameter{
+		Name:      schema.Title,
+		Slug:      slug,
+		Desc:      schema.Description,
+		Component: schema.AirplaneComponent,
+		Default:   schema.Default,
+		Constraints: Constraints{
+			Regex: schema.Pattern,
+		},
+	}
+	if param.Name == "" {
+		param.Name = slug
+	}
+
+	switch schema.Type {
+	case "string":
+		switch {
+		case schema.AirplaneType == TypeUpload || schema.AirplaneType == TypeConfigVar:
+			param.Type = schema.AirplaneType
+		case schema.Format == "date":
+			param.Type = TypeDate
+		case schema.Format == "date-time":
+			param.Type = TypeDatetime
+		default:
+			param.Type = TypeString
+		}
+		if param.Component == ComponentNone && schema.ContentMediaType == "application/sql" {
+			param.Component = ComponentEditorSQL
+		}
+	case "boolean":
+		param.Type = TypeBoolean
+	case "integer":
+		param.Type = TypeInteger
+	case "number":
+		param.Type = TypeFloat
+	case "":
+		return Parameter{}, errors.Errorf("%s: missing type", slug)
+	default:
+		return Parameter{}, errors.Errorf("%s: type %q is not supported", slug, schema.Type)
+	}
+
+	for _, v := range schema.Enum {
+		param.Constraints.Options = append(param.Constraints.Options, ConstraintOption{Value: v})
+	}
+	for _, opt := range schema.OneOf {
+		if opt.Const == nil {
+			return Parameter{}, errors.Errorf("%s: oneOf must only contain consts", slug)
+		}
+		param.Constraints.Options = append(param.Constraints.Options, ConstraintOption{
+			Label: opt.Title,
+			Value: opt.Const,
+		})
+	}
+	return param, nil
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+func TestParametersJSONSchemaRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		param Parameter
+	}{
+		{"string", Parameter{Type: TypeString, Default: "Alice", Constraints: Constraints{Regex: "^[A-Z][a-z]+$"}}},
+		{"textarea", Parameter{Type: TypeString, Component: ComponentTextarea, Constraints: Constraints{Optional: true}}},
+		{"sql", Parameter{Type: TypeString, Component: ComponentEditorSQL}},
+		{"boolean", Parameter{Type: TypeBoolean, Default: false}},
+		{"integer", Parameter{Type: TypeInteger, Default: float64(3)}},
+		{"float", Parameter{Type: TypeFloat, Constraints: Constraints{Optional: true}}},
+		{"date", Parameter{Type: TypeDate, Default: "2023-01-31"}},
+		{"datetime", Parameter{Type: TypeDatetime}},
+		{"upload", Parameter{Type: TypeUpload, Constraints: Constraints{Optional: true}}},
+		{"configvar", Parameter{Type: TypeConfigVar}},
+		{"enum", Parameter{Type: TypeString, Constraints: Constraints{
+			Options: []ConstraintOption{{Value: "red"}, {Value: "blue"}},
+		}}},
+		{"labelled options", Parameter{Type: TypeInteger, Constraints: Constraints{
+			Optional: true,
+			Options:  []ConstraintOption{{Label: "Small", Value: float64(1)}, {Label: "Large", Value: float64(2)}},
+		}}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+			param := test.param
+			param.Name = "My param"
+			param.Slug = "my_param"
+			param.Desc = "A parameter."
+			// Parameters are surrounded by others to check that their order is kept.
+			params := Parameters{
+				{Name: "First", Slug: "first", Type: TypeString},
+				param,
+				{Name: "Last", Slug: "last", Type: TypeString},
+			}
+
+			b, err := json.Marshal(params.JSONSchema())
+			require.NoError(err)
+			var schema JSONSchema
+			require.NoError(json.Unmarshal(b, &schema))
+			got, err := ParametersFromJSONSchema(schema)
+			require.NoError(err)
+			require.Equal(params, got)
+		})
+	}
+}
+
+func TestParametersJSONSchema(t *testing.T) {
+	require := require.New(t)
+
+	b, err := json.Marshal(Parameters{
+		{Name: "Name", Slug: "name", Type: TypeString, Constraints: Constraints{Regex: "^[a-z]+$"}},
+		{Name: "Query", Slug: "query", Type: TypeString, Component: ComponentEditorSQL},
+		{Name: "Since", Slug: "since", Type: TypeDatetime, Constraints: Constraints{Optional: true}},
+		{Name: "Size", Slug: "size", Type: TypeFloat, Constraints: Constraints{
+			Options: []ConstraintOption{{Label: "Small", Value: 0.5}, {Label: "Large", Value: 2}},
+		}},
+		{Name: "Report", Slug: "report", Type: TypeUpload, Constraints: Constraints{Optional: true}},
+	}.JSONSchema())
+	require.NoError(err)
+	require.JSONEq(`{
+		"$schema": "http://json-schema.org/draft-07/schema#",
+		"type": "object",
+		"properties": {
+			"name": {"type": "string", "title": "Name", "pattern": "^[a-z]+$"},
+			"query": {
+				"type": "string",
+				"title": "Query",
+				"contentMediaType": "application/sql",
+				"x-airplane-component": "editor-sql"
+			},
+			"since": {"type": "string", "title": "Since", "format": "date-time"},
+			"size": {
+				"type": "number",
+				"title": "Size",
+				"oneOf": [{"const": 0.5, "title": "Small"}, {"const": 2, "title": "Large"}]
+			},
+			"report": {"type": "string", "title": "Report", "x-airplane-type": "upload"}
+		},
+		"required": ["name", "query", "size"],
+		"additionalProperties": false
+	}`, string(b))
+	// Properties are ordered like the parameters.
+	require.Regexp(`"name".*"query".*"since".*"size".*"report"`, string(b))
+}
+
+func TestParametersFromJSONSchema(t *testing.T) {
+	require := require.New(t)
+
+	var schema JSONSchema
+	require.NoError(json.Unmarshal([]byte(`{
+		"type": "object",
+		"properties": {
+			"email": {"type": "string", "format": "email", "minLength": 3},
+			"birthday": {"type": "string", "format": "date", "title": "Birthday"},
+			"query": {"type": "string", "contentMediaType": "application/sql"},
+			"plan": {"type": "string", "enum": ["free", "pro"], "default": "free"}
+		},
+		"required": ["email"]
+	}`), &schema))
+	params, err := ParametersFromJSONSchema(schema)
+	require.NoError(err)
+	require.Equal(Parameters{
+		{Name: "email", Slug: "email", Type: TypeString},
+		{Name: "Birthday", Slug: "birthday", Type: TypeDate, Constraints: Constraints{Optional: true}},
+		{Name: "query", Slug: "query", Type: TypeString, Component: ComponentEditorSQL, Constraints: Constraints{Optional: true}},
+		{Name: "plan", Slug: "plan", Type: TypeString, Default: "free", Constraints: Constraints{
+			Optional: true,
+			Options:  []ConstraintOption{{Value: "free"}, {Value: "pro"}},
+		}},
+	}, params)
+
+	require.NoError(json.Unmarshal([]byte(`{
+		"type": "object",
+		"properties": {
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"address": {"type": "object"},
+			"anything": {}
+		}
+	}`), &schema))
+	_, err = ParametersFromJSONSchema(schema)
+	require.EqualError(err, `unsupported properties: address: type "object" is not supported; anything: missing type; tags: type "array" is not supported`)
+
+	_, err = ParametersFromJSONSchema(JSONSchema{Type: "string"})
+	require.EqualError(err, `expected a schema of type object, got "string"`)
+}
+
+func TestParametersJSONSchemaValidation(t *testing.T) {
+	b, err := json.Marshal(testParams.JSONSchema())
+	require.NoError(t, err)
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(b))
+	require.NoError(t, err)
+
+	// The schema agrees with Parameters.Validate.
+	for _, test := range []struct {
+		name   string
+		values map[string]interface{}
+		valid  bool
+	}{
+		{"valid", map[string]interface{}{"name": "Alice", "admin": true, "birthday": "1990-01-31", "size": 2}, true},
+		{"missing required", map[string]interface{}{"admin": true}, false},
+		{"pattern", map[string]interface{}{"name": "alice", "admin": true}, false},
+		{"integer", map[string]interface{}{"name": "Alice", "admin": true, "age": 1.5}, false},
+		{"date", map[string]interface{}{"name": "Alice", "admin": true, "birthday": "tomorrow"}, false},
+		{"option", map[string]interface{}{"name": "Alice", "admin": true, "size": 3}, false},
+		{"unknown", map[string]interface{}{"name": "Alice", "admin": true, "foo": "bar"}, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+			result, err := schema.Validate(gojsonschema.NewGoLoader(test.values))
+			require.NoError(err)
+			require.Equal(test.valid, result.Valid(), result.Errors())
+			require.Equal(test.valid, testParams.Validate(test.values) == nil)
+		})
+	}
+}
@@ -2,18 +2,53 @@ package mock
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"time"
 
 	"github.com/airplanedev/lib/pkg/api"
+	libhttp "github.com/airplanedev/lib/pkg/api/http"
+	"github.com/airplanedev/ojson"
 )
 
+// MockClient is an in-memory api.IAPIClient. Write operations (e.g. CreateTask) update
+// Tasks and Views in-place so tests can inspect what a deploy would have written.
 type MockClient struct {
 	Tasks     map[string]api.Task
 	Resources []api.Resource
 	Views     map[string]api.View
+	// Runs are keyed by run ID. Runs created by ExecuteTask start out as api.RunQueued;
+	// tests can update them directly to simulate progress.
+	Runs     map[string]api.Run
+	Outputs  map[string]ojson.Value
+	Displays map[string][]api.Display
+	// Envs are keyed by slug.
+	Envs map[string]api.Env
+	// Uploads are keyed by ID.
+	Uploads map[string]api.Upload
+
+	// lastIDs holds the last ID number handed out per ID prefix, e.g. "tsk".
+	lastIDs map[string]int
 }
 
 var _ api.IAPIClient = &MockClient{}
 
+// newID returns the next ID with the given prefix. IDs are never reused, even if the
+// objects they were handed out for are removed, and IDs for which taken returns true
+// (e.g. ones used by fixtures the test seeded) are skipped.
+func (mc *MockClient) newID(prefix string, taken func(id string) bool) string {
+	if mc.lastIDs == nil {
+		mc.lastIDs = map[string]int{}
+	}
+	for {
+		mc.lastIDs[prefix]++
+		id := fmt.Sprintf("%s%d", prefix, mc.lastIDs[prefix])
+		if !taken(id) {
+			return id
+		}
+	}
+}
+
 func (mc *MockClient) GetTask(ctx context.Context, req api.GetTaskRequest) (res api.Task, err error) {
 	task, ok := mc.Tasks[req.Slug]
 	if !ok {
@@ -34,6 +69,15 @@ func (mc *MockClient) GetTaskMetadata(ctx context.Context, slug string) (res api
 	}, nil
 }
 
+func (mc *MockClient) GetResource(ctx context.Context, req api.GetResourceRequest) (res api.GetResourceResponse, err error) {
+	for _, r := range mc.Resources {
+		if (req.ID != "" && r.ID == req.ID) || (req.ID == "" && r.Slug == req.Slug) {
+			return api.GetResourceResponse{Resource: r}, nil
+		}
+	}
+	return api.GetResourceResponse{}, api.ResourceMissingError{AppURL: "api/", Slug: req.Slug, ID: req.ID}
+}
+
 func (mc *MockClient) ListResources(ctx context.Context, envSlug string) (res api.ListResourcesResponse, err error) {
 	return api.ListResourcesResponse{
 		Resources: mc.Resources,
@@ -60,6 +104,40 @@ func (mc *MockClient) CreateBuildUpload(ctx context.Context, req api.CreateBuild
 	}, nil
 }
 
+func (mc *MockClient) CreateUpload(ctx context.Context, req api.CreateUploadRequest) (res api.CreateUploadResponse, err error) {
+	if mc.Uploads == nil {
+		mc.Uploads = map[string]api.Upload{}
+	}
+	id := mc.newID("upl", func(id string) bool {
+		_, ok := mc.Uploads[id]
+		return ok
+	})
+	upload := api.Upload{
+		ID:        id,
+		FileName:  req.FileName,
+		URL:       "readOnlyURL",
+		SizeBytes: req.SizeBytes,
+		CreatedAt: time.Now(),
+	}
+	mc.Uploads[id] = upload
+	return api.CreateUploadResponse{
+		Upload:       upload,
+		ReadOnlyURL:  "readOnlyURL",
+		WriteOnlyURL: "writeOnlyURL",
+	}, nil
+}
+
+func (mc *MockClient) GetUpload(ctx context.Context, req api.GetUploadRequest) (res api.GetUploadResponse, err error) {
+	upload, ok := mc.Uploads[req.UploadID]
+	if !ok {
+		return api.GetUploadResponse{}, libhttp.NewErrNotFound("upload with ID %q does not exist", req.UploadID)
+	}
+	return api.GetUploadResponse{
+		Upload:      upload,
+		ReadOnlyURL: upload.URL,
+	}, nil
+}
+
 func (mc *MockClient) GetView(ctx context.Context, req api.GetViewRequest) (res api.View, err error) {
 	a, ok := mc.Views[req.Slug]
 	if !ok {
@@ -67,3 +145,304 @@ func (mc *MockClient) GetView(ctx context.Context, req api.GetViewRequest) (res
 	}
 	return a, nil
 }
+
+func (mc *MockClient) CreateTask(ctx context.Context, req api.CreateTaskRequest) (res api.CreateTaskResponse, err error) {
+	if mc.Tasks == nil {
+		mc.Tasks = map[string]api.Task{}
+	}
+	if _, ok := mc.Tasks[req.Slug]; ok {
+		return api.CreateTaskResponse{}, libhttp.NewErrConflict("task with slug %q already exists", req.Slug)
+	}
+
+	now := time.Now()
+	id := mc.newID("tsk", func(id string) bool {
+		for _, t := range mc.Tasks {
+			if t.ID == id {
+				return true
+			}
+		}
+		return false
+	})
+	mc.Tasks[req.Slug] = api.Task{
+		ID:               id,
+		Name:             req.Name,
+		Slug:             req.Slug,
+		Description:      req.Description,
+		Image:            req.Image,
+		Command:          req.Command,
+		Arguments:        req.Arguments,
+		Parameters:       req.Parameters,
+		Configs:          req.Configs,
+		Constraints:      req.Constraints,
+		Env:              req.EnvVars,
+		ResourceRequests: req.ResourceRequests,
+		Resources:        req.Resources,
+		Kind:             req.Kind,
+		KindOptions:      req.KindOptions,
+		Runtime:          req.Runtime,
+		Repo:             req.Repo,
+		Timeout:          req.Timeout,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+
+	return api.CreateTaskResponse{
+		TaskID:         id,
+		Slug:           req.Slug,
+		TaskRevisionID: id + "-rev",
+	}, nil
+}
+
+func (mc *MockClient) UpdateTask(ctx context.Context, req api.UpdateTaskRequest) (res api.UpdateTaskResponse, err error) {
+	task, ok := mc.Tasks[req.Slug]
+	if !ok {
+		return api.UpdateTaskResponse{}, &api.TaskMissingError{AppURL: "api/", Slug: req.Slug}
+	}
+
+	task.Name = req.Name
+	task.Description = req.Description
+	task.Image = req.Image
+	task.Command = req.Command
+	task.Arguments = req.Arguments
+	task.Parameters = req.Parameters
+	if req.Configs != nil {
+		task.Configs = *req.Configs
+	}
+	task.Constraints = req.Constraints
+	task.Env = req.Env
+	task.ResourceRequests = req.ResourceRequests
+	task.Resources = req.Resources
+	task.Kind = req.Kind
+	task.KindOptions = req.KindOptions
+	task.Runtime = req.Runtime
+	task.Repo = req.Repo
+	if req.RequireExplicitPermissions != nil {
+		task.RequireExplicitPermissions = *req.RequireExplicitPermissions
+	}
+	if req.Permissions != nil {
+		task.Permissions = *req.Permissions
+	}
+	if req.ExecuteRules.DisallowSelfApprove != nil {
+		task.ExecuteRules.DisallowSelfApprove = *req.ExecuteRules.DisallowSelfApprove
+	}
+	if req.ExecuteRules.RequireRequests != nil {
+		task.ExecuteRules.RequireRequests = *req.ExecuteRules.RequireRequests
+	}
+	task.Timeout = req.Timeout
+	if req.InterpolationMode != nil {
+		task.InterpolationMode = *req.InterpolationMode
+	}
+	if req.Webhooks != nil {
+		task.Triggers = replaceWebhookTriggers(task.Triggers, req.Webhooks)
+	}
+	task.UpdatedAt = time.Now()
+	mc.Tasks[req.Slug] = task
+
+	return api.UpdateTaskResponse{
+		TaskRevisionID: fmt.Sprintf("%s-rev-%d", task.ID, task.UpdatedAt.UnixNano()),
+	}, nil
+}
+
+func (mc *MockClient) ArchiveTask(ctx context.Context, req api.ArchiveTaskRequest) error {
+	task, ok := mc.Tasks[req.Slug]
+	if !ok {
+		return &api.TaskMissingError{AppURL: "api/", Slug: req.Slug}
+	}
+	task.IsArchived = true
+	mc.Tasks[req.Slug] = task
+	return nil
+}
+
+func (mc *MockClient) CreateView(ctx context.Context, req api.CreateViewRequest) (res api.View, err error) {
+	if mc.Views == nil {
+		mc.Views = map[string]api.View{}
+	}
+	if _, ok := mc.Views[req.Slug]; ok {
+		return api.View{}, libhttp.NewErrConflict("view with slug %q already exists", req.Slug)
+	}
+
+	id := mc.newID("vew", func(id string) bool {
+		for _, v := range mc.Views {
+			if v.ID == id {
+				return true
+			}
+		}
+		return false
+	})
+	view := api.View{
+		ID:          id,
+		Slug:        req.Slug,
+		Name:        req.Name,
+		Description: req.Description,
+		CreatedAt:   time.Now(),
+		EnvVars:     envVarsToMap(req.EnvVars),
+	}
+	mc.Views[req.Slug] = view
+	return view, nil
+}
+
+func (mc *MockClient) UpdateView(ctx context.Context, req api.UpdateViewRequest) (res api.View, err error) {
+	view, ok := mc.Views[req.Slug]
+	if !ok {
+		return api.View{}, &api.ViewMissingError{AppURL: "api/", Slug: req.Slug}
+	}
+
+	view.Name = req.Name
+	view.Description = req.Description
+	view.EnvVars = envVarsToMap(req.EnvVars)
+	mc.Views[req.Slug] = view
+	return view, nil
+}
+
+func (mc *MockClient) ExecuteTask(ctx context.Context, req api.ExecuteTaskRequest) (res api.ExecuteTaskResponse, err error) {
+	task, ok := mc.Tasks[req.Slug]
+	if !ok {
+		return api.ExecuteTaskResponse{}, &api.TaskMissingError{AppURL: "api/", Slug: req.Slug}
+	}
+	if mc.Runs == nil {
+		mc.Runs = map[string]api.Run{}
+	}
+
+	now := time.Now()
+	runID := mc.newID("run", func(id string) bool {
+		_, ok := mc.Runs[id]
+		return ok
+	})
+	mc.Runs[runID] = api.Run{
+		RunID:       runID,
+		TaskID:      task.ID,
+		TaskName:    task.Name,
+		Status:      api.RunQueued,
+		ParamValues: req.ParamValues,
+		Parameters:  &task.Parameters,
+		EnvSlug:     req.EnvSlug,
+		CreatedAt:   now,
+		QueuedAt:    &now,
+	}
+	return api.ExecuteTaskResponse{RunID: runID}, nil
+}
+
+func (mc *MockClient) GetRun(ctx context.Context, runID string) (res api.Run, err error) {
+	run, ok := mc.Runs[runID]
+	if !ok {
+		return api.Run{}, libhttp.NewErrNotFound("run with ID %q does not exist", runID)
+	}
+	return run, nil
+}
+
+func (mc *MockClient) ListRuns(ctx context.Context, req api.ListRunsRequest) (res api.ListRunsResponse, err error) {
+	runs := []api.Run{}
+	for _, run := range mc.Runs {
+		if req.TaskID != "" && run.TaskID != req.TaskID {
+			continue
+		}
+		if !req.Since.IsZero() && run.CreatedAt.Before(req.Since) {
+			continue
+		}
+		if !req.Until.IsZero() && run.CreatedAt.After(req.Until) {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].CreatedAt.After(runs[j].CreatedAt)
+	})
+	return api.ListRunsResponse{Runs: runs}, nil
+}
+
+func (mc *MockClient) CancelRun(ctx context.Context, runID string) error {
+	run, ok := mc.Runs[runID]
+	if !ok {
+		return libhttp.NewErrNotFound("run with ID %q does not exist", runID)
+	}
+	if run.Status.IsTerminal() {
+		return libhttp.NewErrBadRequest("run with ID %q has already finished", runID)
+	}
+	now := time.Now()
+	run.Status = api.RunCancelled
+	run.CancelledAt = &now
+	mc.Runs[runID] = run
+	return nil
+}
+
+func (mc *MockClient) GetOutputs(ctx context.Context, runID string) (res api.GetOutputsResponse, err error) {
+	if _, ok := mc.Runs[runID]; !ok {
+		return api.GetOutputsResponse{}, libhttp.NewErrNotFound("run with ID %q does not exist", runID)
+	}
+	return api.GetOutputsResponse{Output: mc.Outputs[runID]}, nil
+}
+
+func (mc *MockClient) ListDisplays(ctx context.Context, runID string) (res api.ListDisplaysResponse, err error) {
+	if _, ok := mc.Runs[runID]; !ok {
+		return api.ListDisplaysResponse{}, libhttp.NewErrNotFound("run with ID %q does not exist", runID)
+	}
+	return api.ListDisplaysResponse{Displays: mc.Displays[runID]}, nil
+}
+
+func (mc *MockClient) ListEnvs(ctx context.Context) (res api.ListEnvsResponse, err error) {
+	envs := []api.Env{}
+	for _, env := range mc.Envs {
+		envs = append(envs, env)
+	}
+	sort.Slice(envs, func(i, j int) bool {
+		return envs[i].Slug < envs[j].Slug
+	})
+	return api.ListEnvsResponse{Envs: envs}, nil
+}
+
+func (mc *MockClient) GetEnv(ctx context.Context, slug string) (res api.Env, err error) {
+	env, ok := mc.Envs[slug]
+	if !ok {
+		return api.Env{}, &api.EnvMissingError{AppURL: "api/", Slug: slug}
+	}
+	return env, nil
+}
+
+// replaceWebhookTriggers replaces the webhook triggers in `triggers` that have a slug with
+// `webhooks`. Other triggers, including webhooks without a slug, are kept as-is.
+func replaceWebhookTriggers(triggers []api.Trigger, webhooks map[string]api.Webhook) []api.Trigger {
+	var updated []api.Trigger
+	for _, trigger := range triggers {
+		if trigger.Kind != api.TriggerKindWebhook || trigger.Slug == nil {
+			updated = append(updated, trigger)
+		}
+	}
+
+	slugs := make([]string, 0, len(webhooks))
+	for slug := range webhooks {
+		slugs = append(slugs, slug)
+	}
+	sort.Strings(slugs)
+	for _, slug := range slugs {
+		slug := slug
+		webhook := webhooks[slug]
+		updated = append(updated, api.Trigger{
+			Name:        webhook.Name,
+			Description: webhook.Description,
+			Slug:        &slug,
+			Kind:        api.TriggerKindWebhook,
+			KindConfig: api.TriggerKindConfig{
+				Webhook: &api.TriggerKindConfigWebhook{
+					ParamMappings: webhook.ParamMappings,
+					Verification:  webhook.Verification,
+				},
+			},
+		})
+	}
+	return updated
+}
+
+// envVarsToMap flattens env vars into the representation returned on api.View. Config
+// references are not resolved.
+func envVarsToMap(envVars api.EnvVars) map[string]string {
+	if envVars == nil {
+		return nil
+	}
+	m := make(map[string]string, len(envVars))
+	for k, v := range envVars {
+		if v.Value != nil {
+			m[k] = *v.Value
+		}
+	}
+	return m
+}
@@ -0,0 +1,102 @@
+package mock
+
+import (
+	"context"
+	"testing"
+
+	"github.com/airplanedev/lib/pkg/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMockClientWrites(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	client := &MockClient{}
+
+	cresp, err := client.CreateTask(ctx, api.CreateTaskRequest{Slug: "my_task", Name: "My task"})
+	require.NoError(err)
+	require.Equal("my_task", cresp.Slug)
+
+	_, err = client.CreateTask(ctx, api.CreateTaskRequest{Slug: "my_task"})
+	require.Error(err)
+
+	timeout := 60
+	_, err = client.UpdateTask(ctx, api.UpdateTaskRequest{Slug: "my_task", Name: "Renamed", Timeout: timeout})
+	require.NoError(err)
+	task, err := client.GetTask(ctx, api.GetTaskRequest{Slug: "my_task"})
+	require.NoError(err)
+	require.Equal(cresp.TaskID, task.ID)
+	require.Equal("Renamed", task.Name)
+	require.Equal(timeout, task.Timeout)
+
+	require.NoError(client.ArchiveTask(ctx, api.ArchiveTaskRequest{Slug: "my_task"}))
+	md, err := client.GetTaskMetadata(ctx, "my_task")
+	require.NoError(err)
+	require.True(md.IsArchived)
+
+	_, err = client.UpdateTask(ctx, api.UpdateTaskRequest{Slug: "missing"})
+	var merr *api.TaskMissingError
+	require.ErrorAs(err, &merr)
+
+	value := "bar"
+	_, err = client.CreateView(ctx, api.CreateViewRequest{
+		Slug:    "my_view",
+		Name:    "My view",
+		EnvVars: api.EnvVars{"FOO": {Value: &value}},
+	})
+	require.NoError(err)
+	view, err := client.UpdateView(ctx, api.UpdateViewRequest{Slug: "my_view", Name: "Renamed"})
+	require.NoError(err)
+	require.Equal("Renamed", view.Name)
+	require.Equal(view, client.Views["my_view"])
+}
+
+func TestMockClientIDs(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	// Seed fixtures whose IDs a count-based generator would hand out again.
+	client := &MockClient{
+		Tasks: map[string]api.Task{
+			"seeded": {ID: "tsk2", Slug: "seeded"},
+		},
+		Views: map[string]api.View{
+			"seeded": {ID: "vew1", Slug: "seeded"},
+		},
+		Runs: map[string]api.Run{
+			"run2": {RunID: "run2", TaskID: "tsk2"},
+		},
+		Uploads: map[string]api.Upload{
+			"upl2": {ID: "upl2"},
+		},
+	}
+
+	taskIDs := map[string]bool{"tsk2": true}
+	for _, slug := range []string{"a", "b", "c"} {
+		resp, err := client.CreateTask(ctx, api.CreateTaskRequest{Slug: slug})
+		require.NoError(err)
+		require.False(taskIDs[resp.TaskID], "duplicate task ID %s", resp.TaskID)
+		taskIDs[resp.TaskID] = true
+	}
+
+	view, err := client.CreateView(ctx, api.CreateViewRequest{Slug: "my_view"})
+	require.NoError(err)
+	require.NotEqual("vew1", view.ID)
+
+	runIDs := map[string]bool{"run2": true}
+	for i := 0; i < 3; i++ {
+		resp, err := client.ExecuteTask(ctx, api.ExecuteTaskRequest{Slug: "seeded"})
+		require.NoError(err)
+		require.False(runIDs[resp.RunID], "duplicate run ID %s", resp.RunID)
+		runIDs[resp.RunID] = true
+	}
+	require.Len(client.Runs, 4)
+
+	uploadIDs := map[string]bool{"upl2": true}
+	for i := 0; i < 3; i++ {
+		resp, err := client.CreateUpload(ctx, api.CreateUploadRequest{FileName: "a.tar.gz"})
+		require.NoError(err)
+		require.False(uploadIDs[resp.Upload.ID], "duplicate upload ID %s", resp.Upload.ID)
+		uploadIDs[resp.Upload.ID] = true
+	}
+	require.Len(client.Uploads, 4)
+}
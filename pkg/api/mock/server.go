@@ -0,0 +1,567 @@
+package mock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/airplanedev/lib/pkg/api"
+	libhttp "github.com/airplanedev/lib/pkg/api/http"
+	"github.com/pkg/errors"
+)
+
+// Server is a fake Airplane API served over HTTP, for use in integration tests with
+// api.HTTPClient. Requests for tasks, views, resources, runs and environments are served by
+// Client, so tests can seed and inspect that state directly when no requests are in flight. The
+// server also supports uploads.
+//
+// Latency and errors can be injected with ServerOpts and Server.InjectFault, and every request
+// is recorded, see Server.Requests.
+type Server struct {
+	// URL is the base URL of the server, e.g. http://127.0.0.1:1234.
+	URL string
+	// Client holds the state of tasks, views, resources, runs and environments.
+	Client *MockClient
+
+	server  *httptest.Server
+	opts    ServerOpts
+	routes  map[string]route
+	uploads map[string]serverUpload
+
+	mu        sync.Mutex
+	faults    []*Fault
+	requests  []RecordedRequest
+	responses map[string]recordedResponse
+}
+
+type ServerOpts struct {
+	// Client is the initial state of tasks, views, resources, runs and environments. Defaults
+	// to an empty MockClient.
+	Client *MockClient
+	// Latency is added to every request before it is handled.
+	Latency time.Duration
+	// Token, if set, must be passed in the X-Airplane-Token header of every API request.
+	// Otherwise, a 401 is returned.
+	Token string
+}
+
+// Fault is an error that the server returns in place of a response.
+type Fault struct {
+	// Path is the URL path of the requests to fail, e.g. /v0/tasks/get. If empty, every
+	// request fails.
+	Path string
+	// StatusCode is the status code of the error response, e.g. 500 or 429.
+	StatusCode int
+	// Msg and Code are returned in the body of the error response.
+	Msg  string
+	Code string
+	// Retryable, if set, is returned as the X-Airplane-Retryable header.
+	Retryable *bool
+	// Headers are extra headers to set on the error response, e.g. Retry-After.
+	Headers map[string]string
+	// Times is the number of requests to fail. If zero, every matching request fails.
+	Times int
+	// AfterHandling handles the request before returning the error, to simulate a response
+	// that is lost after the server has processed a request.
+	AfterHandling bool
+
+	hits int
+}
+
+// RecordedRequest is a request received by a Server.
+type RecordedRequest struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+	// RequestID is the ID that the server sent back in the X-Request-Id header.
+	RequestID string
+	// StatusCode is the status code that the server responded with.
+	StatusCode int
+}
+
+type recordedResponse struct {
+	status int
+	body   []byte
+}
+
+type serverUpload struct {
+	upload  api.Upload
+	content []byte
+}
+
+type route struct {
+	method  string
+	handler func(ctx context.Context, r *http.Request, body []byte) (any, error)
+}
+
+// NewServer starts a fake Airplane API. The server must be closed with Close.
+func NewServer(opts ServerOpts) *Server {
+	if opts.Client == nil {
+		opts.Client = &MockClient{}
+	}
+	s := &Server{
+		Client:    opts.Client,
+		opts:      opts,
+		uploads:   map[string]serverUpload{},
+		responses: map[string]recordedResponse{},
+	}
+	s.routes = map[string]route{
+		"/v0/tasks/get":              {http.MethodGet, s.getTask},
+		"/v0/tasks/getMetadata":      {http.MethodGet, s.getTaskMetadata},
+		"/v0/tasks/create":           {http.MethodPost, s.createTask},
+		"/v0/tasks/update":           {http.MethodPost, s.updateTask},
+		"/v0/tasks/archive":          {http.MethodPost, s.archiveTask},
+		"/v0/tasks/execute":          {http.MethodPost, s.executeTask},
+		"/v0/views/get":              {http.MethodGet, s.getView},
+		"/v0/views/create":           {http.MethodPost, s.createView},
+		"/v0/views/update":           {http.MethodPost, s.updateView},
+		"/v0/resources/get":          {http.MethodGet, s.getResource},
+		"/v0/resources/list":         {http.MethodGet, s.listResources},
+		"/v0/resources/listMetadata": {http.MethodGet, s.listResourceMetadata},
+		"/v0/runs/get":               {http.MethodGet, s.getRun},
+		"/v0/runs/list":              {http.MethodGet, s.listRuns},
+		"/v0/runs/cancel":            {http.MethodPost, s.cancelRun},
+		"/v0/runs/getOutputs":        {http.MethodGet, s.getOutputs},
+		"/v0/displays/list":          {http.MethodGet, s.listDisplays},
+		"/v0/builds/createUpload":    {http.MethodPost, s.createBuildUpload},
+		"/v0/uploads/create":         {http.MethodPost, s.createUpload},
+		"/v0/uploads/get":            {http.MethodGet, s.getUpload},
+		"/v0/envs/list":              {http.MethodGet, s.listEnvs},
+		"/v0/envs/get":               {http.MethodGet, s.getEnv},
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// InjectFault causes matching requests to fail. Faults are checked in the order they were
+// injected, and the first match is used.
+func (s *Server) InjectFault(f Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = append(s.faults, &f)
+}
+
+// ClearFaults removes all injected faults.
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = nil
+}
+
+// Requests returns every request received by the server so far, in order.
+func (s *Server) Requests() []RecordedRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]RecordedRequest(nil), s.requests...)
+}
+
+// UploadContent returns the content written to an upload, if any.
+func (s *Server) UploadContent(uploadID string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.uploads[uploadID]
+	if !ok || u.content == nil {
+		return nil, false
+	}
+	return u.content, true
+}
+
+// storagePath is the path that upload content is read from and written to.
+const storagePath = "/storage/"
+
+func (s *Server) serveHTTP(rw http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.opts.Latency > 0 {
+		select {
+		case <-time.After(s.opts.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	// Requests are handled one at a time, since MockClient is not safe for concurrent use.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec := RecordedRequest{
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Query:     r.URL.Query(),
+		Header:    r.Header.Clone(),
+		Body:      body,
+		RequestID: fmt.Sprintf("req%d", len(s.requests)+1),
+	}
+	rw.Header().Set("X-Request-Id", rec.RequestID)
+	rec.StatusCode, body = s.handle(r, body, rw.Header())
+	s.requests = append(s.requests, rec)
+
+	rw.WriteHeader(rec.StatusCode)
+	_, _ = rw.Write(body)
+}
+
+// handle returns the status code and body to respond with. Headers may be set on `header`.
+func (s *Server) handle(r *http.Request, body []byte, header http.Header) (int, []byte) {
+	if strings.HasPrefix(r.URL.Path, storagePath) {
+		return s.handleStorage(r, body, header)
+	}
+
+	header.Set("Content-Type", "application/json")
+	if s.opts.Token != "" && r.Header.Get("X-Airplane-Token") != s.opts.Token {
+		return errorResponse(libhttp.NewErrUnauthorized("invalid token"))
+	}
+
+	fault := s.matchFault(r.URL.Path)
+	if fault != nil && !fault.AfterHandling {
+		return fault.respond(header)
+	}
+
+	// Replay the original response to retries of a request with the same idempotency key, as
+	// the API does.
+	key := r.Header.Get("Idempotency-Key")
+	if resp, ok := s.responses[key]; ok && key != "" {
+		return resp.status, resp.body
+	}
+
+	status, respBody := s.route(r, body)
+	if key != "" && status < 500 {
+		s.responses[key] = recordedResponse{status: status, body: respBody}
+	}
+
+	if fault != nil {
+		return fault.respond(header)
+	}
+	return status, respBody
+}
+
+func (s *Server) route(r *http.Request, body []byte) (int, []byte) {
+	rt, ok := s.routes[r.URL.Path]
+	if !ok {
+		return errorResponse(libhttp.NewErrNotFound("unknown endpoint %s", r.URL.Path))
+	}
+	if r.Method != rt.method {
+		return errorResponse(newErrStatusCode(http.StatusMethodNotAllowed, "expected %s, got %s", rt.method, r.Method))
+	}
+	if rt.method == http.MethodPost {
+		if len(body) == 0 {
+			return errorResponse(libhttp.NewErrBadRequest("missing request body"))
+		}
+		if !json.Valid(body) {
+			return errorResponse(libhttp.NewErrBadRequest("request body is not valid JSON"))
+		}
+	}
+
+	resp, err := rt.handler(r.Context(), r, body)
+	if err != nil {
+		return errorResponse(err)
+	}
+	if resp == nil {
+		resp = struct{}{}
+	}
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return errorResponse(libhttp.NewErrInternalServerError("marshalling response: %v", err))
+	}
+	return http.StatusOK, b
+}
+
+func (s *Server) matchFault(path string) *Fault {
+	for _, f := range s.faults {
+		if f.Path != "" && f.Path != path {
+			continue
+		}
+		if f.Times > 0 && f.hits >= f.Times {
+			continue
+		}
+		f.hits++
+		return f
+	}
+	return nil
+}
+
+func (f *Fault) respond(header http.Header) (int, []byte) {
+	if f.Retryable != nil {
+		header.Set("X-Airplane-Retryable", strconv.FormatBool(*f.Retryable))
+	}
+	for k, v := range f.Headers {
+		header.Set(k, v)
+	}
+	msg := f.Msg
+	if msg == "" {
+		msg = http.StatusText(f.StatusCode)
+	}
+	b, _ := json.Marshal(libhttp.ErrorResponse{Error: msg, Code: f.Code})
+	return f.StatusCode, b
+}
+
+// errorResponse converts an error from a handler into a response. Missing tasks, views,
+// resources and environments become 404s, and libhttp.ErrStatusCode errors keep their status
+// code.
+func errorResponse(err error) (int, []byte) {
+	errsc := libhttp.NewErrBadRequest("%s", err.Error())
+	var tme *api.TaskMissingError
+	var vme *api.ViewMissingError
+	var eme *api.EnvMissingError
+	var rme api.ResourceMissingError
+	switch {
+	case errors.As(err, &errsc):
+	case errors.As(err, &tme), errors.As(err, &vme), errors.As(err, &eme), errors.As(err, &rme):
+		errsc = libhttp.NewErrNotFound("%s", err.Error())
+	}
+	b, _ := json.Marshal(libhttp.ErrorResponse{Error: errsc.Msg, Code: errsc.ErrorCode})
+	return errsc.StatusCode, b
+}
+
+func newErrStatusCode(status int, msg string, args ...any) libhttp.ErrStatusCode {
+	return libhttp.ErrStatusCode{StatusCode: status, Msg: fmt.Sprintf(msg, args...)}
+}
+
+func decode(body []byte, v any) error {
+	if err := json.Unmarshal(body, v); err != nil {
+		return libhttp.NewErrBadRequest("decoding request: %v", err)
+	}
+	return nil
+}
+
+func (s *Server) getTask(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	q := r.URL.Query()
+	return s.Client.GetTask(ctx, api.GetTaskRequest{Slug: q.Get("slug"), EnvSlug: q.Get("envSlug")})
+}
+
+func (s *Server) getTaskMetadata(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	return s.Client.GetTaskMetadata(ctx, r.URL.Query().Get("slug"))
+}
+
+func (s *Server) createTask(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	var req api.CreateTaskRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	return s.Client.CreateTask(ctx, req)
+}
+
+func (s *Server) updateTask(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	var req api.UpdateTaskRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	return s.Client.UpdateTask(ctx, req)
+}
+
+func (s *Server) archiveTask(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	var req api.ArchiveTaskRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	return nil, s.Client.ArchiveTask(ctx, req)
+}
+
+func (s *Server) executeTask(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	var req api.ExecuteTaskRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	return s.Client.ExecuteTask(ctx, req)
+}
+
+func (s *Server) getView(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	q := r.URL.Query()
+	if id := q.Get("id"); id != "" {
+		for _, view := range s.Client.Views {
+			if view.ID == id {
+				return view, nil
+			}
+		}
+		return nil, libhttp.NewErrNotFound("view with ID %q does not exist", id)
+	}
+	return s.Client.GetView(ctx, api.GetViewRequest{Slug: q.Get("slug")})
+}
+
+func (s *Server) createView(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	var req api.CreateViewRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	return s.Client.CreateView(ctx, req)
+}
+
+func (s *Server) updateView(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	var req api.UpdateViewRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	return s.Client.UpdateView(ctx, req)
+}
+
+func (s *Server) getResource(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	q := r.URL.Query()
+	return s.Client.GetResource(ctx, api.GetResourceRequest{ID: q.Get("id"), Slug: q.Get("slug"), EnvSlug: q.Get("envSlug")})
+}
+
+func (s *Server) listResources(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	return s.Client.ListResources(ctx, r.URL.Query().Get("envSlug"))
+}
+
+func (s *Server) listResourceMetadata(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	return s.Client.ListResourceMetadata(ctx)
+}
+
+func (s *Server) getRun(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	run, err := s.Client.GetRun(ctx, r.URL.Query().Get("id"))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]api.Run{"run": run}, nil
+}
+
+func (s *Server) listRuns(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	q := r.URL.Query()
+	req := api.ListRunsRequest{TaskID: q.Get("taskID")}
+	for param, t := range map[string]*time.Time{"since": &req.Since, "until": &req.Until} {
+		if v := q.Get(param); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, libhttp.NewErrBadRequest("invalid %s: %v", param, err)
+			}
+			*t = parsed
+		}
+	}
+	return s.Client.ListRuns(ctx, req)
+}
+
+func (s *Server) cancelRun(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	var req struct {
+		RunID string `json:"runID"`
+	}
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	return nil, s.Client.CancelRun(ctx, req.RunID)
+}
+
+func (s *Server) getOutputs(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	return s.Client.GetOutputs(ctx, r.URL.Query().Get("id"))
+}
+
+func (s *Server) listDisplays(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	return s.Client.ListDisplays(ctx, r.URL.Query().Get("runID"))
+}
+
+func (s *Server) createBuildUpload(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	var req api.CreateBuildUploadRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	// Build uploads are not tracked by Client, so they get IDs of their own.
+	id := fmt.Sprintf("upl_build%d", len(s.uploads)+1)
+	upload := api.Upload{
+		ID:        id,
+		FileName:  "build.tar.gz",
+		URL:       s.URL + storagePath + id,
+		SizeBytes: req.SizeBytes,
+		CreatedAt: time.Now(),
+	}
+	s.uploads[id] = serverUpload{upload: upload}
+	return api.CreateBuildUploadResponse{
+		Upload:       upload,
+		WriteOnlyURL: upload.URL,
+	}, nil
+}
+
+func (s *Server) createUpload(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	var req api.CreateUploadRequest
+	if err := decode(body, &req); err != nil {
+		return nil, err
+	}
+	resp, err := s.Client.CreateUpload(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	// Point the upload at the server's storage.
+	resp.Upload.URL = s.URL + storagePath + resp.Upload.ID
+	resp.ReadOnlyURL = resp.Upload.URL
+	resp.WriteOnlyURL = resp.Upload.URL
+	s.Client.Uploads[resp.Upload.ID] = resp.Upload
+	s.uploads[resp.Upload.ID] = serverUpload{upload: resp.Upload}
+	return resp, nil
+}
+
+func (s *Server) getUpload(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	return s.Client.GetUpload(ctx, api.GetUploadRequest{UploadID: r.URL.Query().Get("id")})
+}
+
+// handleStorage serves upload content, mimicking signed storage URLs: content is written with
+// a PUT and read with a GET.
+//
+// Content can also be written in chunks, by setting a Content-Range header of the form
+// "bytes <first>-<last>/<total>" on each PUT. Every chunk but the last is acknowledged with a 308
+// and a Range header of the form "bytes=0-<last>".
+func (s *Server) handleStorage(r *http.Request, body []byte, header http.Header) (int, []byte) {
+	id := strings.TrimPrefix(r.URL.Path, storagePath)
+	u, ok := s.uploads[id]
+	if !ok {
+		return http.StatusNotFound, []byte("upload not found")
+	}
+	if fault := s.matchFault(r.URL.Path); fault != nil {
+		return fault.respond(header)
+	}
+	switch r.Method {
+	case http.MethodPut:
+		contentRange := r.Header.Get("Content-Range")
+		if contentRange == "" {
+			u.content = append([]byte{}, body...)
+			s.uploads[id] = u
+			return http.StatusOK, nil
+		}
+		var first, last, total int64
+		if _, err := fmt.Sscanf(contentRange, "bytes %d-%d/%d", &first, &last, &total); err != nil {
+			return http.StatusBadRequest, []byte("invalid Content-Range")
+		}
+		// Chunks may be resent, but they can't skip over content that hasn't been written.
+		if first > int64(len(u.content)) || last-first+1 != int64(len(body)) {
+			return http.StatusBadRequest, []byte("chunk does not match Content-Range")
+		}
+		u.content = append(u.content[:first:first], body...)
+		s.uploads[id] = u
+		if last+1 < total {
+			header.Set("Range", fmt.Sprintf("bytes=0-%d", last))
+			return http.StatusPermanentRedirect, nil
+		}
+		return http.StatusOK, nil
+	case http.MethodGet:
+		if u.content == nil {
+			return http.StatusNotFound, []byte("upload has no content")
+		}
+		header.Set("Content-Type", "application/octet-stream")
+		return http.StatusOK, u.content
+	default:
+		return http.StatusMethodNotAllowed, nil
+	}
+}
+
+func (s *Server) listEnvs(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	return s.Client.ListEnvs(ctx)
+}
+
+func (s *Server) getEnv(ctx context.Context, r *http.Request, body []byte) (any, error) {
+	return s.Client.GetEnv(ctx, r.URL.Query().Get("slug"))
+}
@@ -0,0 +1,356 @@
+package mock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/airplanedev/lib/pkg/api"
+	libhttp "github.com/airplanedev/lib/pkg/api/http"
+	"github.com/airplanedev/lib/pkg/build"
+	"github.com/airplanedev/lib/pkg/deploy/archive"
+	"github.com/airplanedev/lib/pkg/deploy/discover"
+	"github.com/airplanedev/lib/pkg/deploy/taskdir/definitions"
+	"github.com/airplanedev/lib/pkg/utils/logger"
+	"github.com/airplanedev/lib/pkg/utils/pointers"
+	"github.com/stretchr/testify/require"
+)
+
+var testClientOpts = libhttp.ClientOpts{
+	Headers: map[string]string{
+		"X-Airplane-Client-Kind":    "test",
+		"X-Airplane-Client-Version": "1",
+	},
+	UserAgent: "airplane/test/1",
+}
+
+func newTestServer(t *testing.T, opts ServerOpts) (*Server, *api.HTTPClient) {
+	opts.Token = "tkn_test"
+	server := NewServer(opts)
+	t.Cleanup(server.Close)
+	return server, api.NewHTTPClient(server.URL, "tkn_test", api.HTTPClientOpts{ClientOpts: testClientOpts})
+}
+
+func TestServer(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	server, client := newTestServer(t, ServerOpts{
+		Client: &MockClient{
+			Resources: []api.Resource{{ID: "res1", Slug: "db", Name: "DB"}},
+			Envs:      map[string]api.Env{"prod": {ID: "env1", Slug: "prod", Name: "Production"}},
+		},
+	})
+
+	_, err := client.GetTask(ctx, api.GetTaskRequest{Slug: "my_task"})
+	var tme *api.TaskMissingError
+	require.ErrorAs(err, &tme)
+
+	created, err := client.CreateTask(ctx, api.CreateTaskRequest{Slug: "my_task", Name: "My task"})
+	require.NoError(err)
+	_, err = client.CreateTask(ctx, api.CreateTaskRequest{Slug: "my_task", Name: "My task"})
+	var errsc libhttp.ErrStatusCode
+	require.ErrorAs(err, &errsc)
+	require.Equal(http.StatusConflict, errsc.StatusCode)
+
+	task, err := client.GetTask(ctx, api.GetTaskRequest{Slug: "my_task"})
+	require.NoError(err)
+	require.Equal(created.TaskID, task.ID)
+	require.Equal("My task", task.Name)
+
+	require.NoError(client.ArchiveTask(ctx, api.ArchiveTaskRequest{Slug: "my_task"}))
+	metadata, err := client.GetTaskMetadata(ctx, "my_task")
+	require.NoError(err)
+	require.True(metadata.IsArchived)
+	require.True(server.Client.Tasks["my_task"].IsArchived)
+
+	view, err := client.CreateView(ctx, api.CreateViewRequest{Slug: "my_view", Name: "My view"})
+	require.NoError(err)
+	view, err = client.GetView(ctx, api.GetViewRequest{ID: view.ID})
+	require.NoError(err)
+	require.Equal("my_view", view.Slug)
+
+	resources, err := client.ListResources(ctx, "prod")
+	require.NoError(err)
+	require.Equal("db", resources.Resources[0].Slug)
+	resource, err := client.GetResource(ctx, api.GetResourceRequest{Slug: "db"})
+	require.NoError(err)
+	require.Equal("res1", resource.ID)
+	_, err = client.GetResource(ctx, api.GetResourceRequest{Slug: "missing"})
+	var rme api.ResourceMissingError
+	require.ErrorAs(err, &rme)
+
+	env, err := client.GetEnv(ctx, "prod")
+	require.NoError(err)
+	require.Equal("env1", env.ID)
+	_, err = client.GetEnv(ctx, "stage")
+	var eme *api.EnvMissingError
+	require.ErrorAs(err, &eme)
+
+	// Uploads are served as well.
+	hc := libhttp.NewClient(testClientOpts)
+
+	upload, err := client.CreateBuildUpload(ctx, api.CreateBuildUploadRequest{SizeBytes: 5})
+	require.NoError(err)
+	_, err = hc.Put(ctx, upload.WriteOnlyURL, []byte("hello"), libhttp.ReqOpts{})
+	require.NoError(err)
+	content, ok := server.UploadContent(upload.Upload.ID)
+	require.True(ok)
+	require.Equal([]byte("hello"), content)
+
+	// Requests without a valid token are rejected.
+	unauthed := api.NewHTTPClient(server.URL, "", api.HTTPClientOpts{ClientOpts: testClientOpts})
+	_, err = unauthed.GetTask(ctx, api.GetTaskRequest{Slug: "my_task"})
+	require.ErrorAs(err, &errsc)
+	require.Equal(http.StatusUnauthorized, errsc.StatusCode)
+
+	requests := server.Requests()
+	require.Equal("/v0/tasks/get", requests[0].Path)
+	require.Equal(http.StatusNotFound, requests[0].StatusCode)
+	require.Equal("tkn_test", requests[0].Header.Get("X-Airplane-Token"))
+	require.Equal(http.MethodPost, requests[1].Method)
+	require.Contains(string(requests[1].Body), `"slug":"my_task"`)
+}
+
+func TestServerFaults(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("retries 5xx", func(t *testing.T) {
+		require := require.New(t)
+		server, client := newTestServer(t, ServerOpts{})
+		server.InjectFault(Fault{Path: "/v0/tasks/create", StatusCode: 503, Times: 2})
+
+		_, err := client.CreateTask(ctx, api.CreateTaskRequest{Slug: "my_task"})
+		require.NoError(err)
+
+		requests := server.Requests()
+		require.Len(requests, 3)
+		require.Equal(503, requests[0].StatusCode)
+		require.Equal(503, requests[1].StatusCode)
+		require.Equal(200, requests[2].StatusCode)
+		// Retries reuse the same idempotency key.
+		key := requests[0].Header.Get("Idempotency-Key")
+		require.NotEmpty(key)
+		require.Equal(key, requests[2].Header.Get("Idempotency-Key"))
+	})
+
+	t.Run("retries 429", func(t *testing.T) {
+		require := require.New(t)
+		server, client := newTestServer(t, ServerOpts{})
+		server.InjectFault(Fault{StatusCode: 429, Times: 1})
+
+		_, err := client.ListResources(ctx, "")
+		require.NoError(err)
+		require.Len(server.Requests(), 2)
+	})
+
+	t.Run("respects X-Airplane-Retryable", func(t *testing.T) {
+		require := require.New(t)
+		server, client := newTestServer(t, ServerOpts{})
+		server.InjectFault(Fault{
+			Path:       "/v0/tasks/get",
+			StatusCode: 500,
+			Msg:        "task is locked",
+			Code:       "locked",
+			Retryable:  pointers.Bool(false),
+		})
+		server.InjectFault(Fault{Path: "/v0/views/get", StatusCode: 409, Retryable: pointers.Bool(true), Times: 1})
+
+		_, err := client.GetTask(ctx, api.GetTaskRequest{Slug: "my_task"})
+		var errsc libhttp.ErrStatusCode
+		require.ErrorAs(err, &errsc)
+		require.Equal(500, errsc.StatusCode)
+		require.Equal("task is locked", errsc.Msg)
+		require.Equal("locked", errsc.ErrorCode)
+		require.ErrorIs(err, libhttp.ErrLocked)
+		require.Equal("false", errsc.Header.Get("X-Airplane-Retryable"))
+		require.Len(server.Requests(), 1)
+		require.Equal(server.Requests()[0].RequestID, errsc.RequestID)
+
+		// The retry gets through the fault, and finds that the view doesn't exist.
+		_, err = client.GetView(ctx, api.GetViewRequest{Slug: "my_view"})
+		var vme *api.ViewMissingError
+		require.ErrorAs(err, &vme)
+		require.Len(server.Requests(), 3)
+	})
+
+	t.Run("replays lost responses", func(t *testing.T) {
+		require := require.New(t)
+		server, client := newTestServer(t, ServerOpts{})
+		server.InjectFault(Fault{Path: "/v0/tasks/create", StatusCode: 502, Times: 1, AfterHandling: true})
+
+		// The first attempt creates the task, but its response is lost. The retry must not
+		// fail with a conflict.
+		resp, err := client.CreateTask(ctx, api.CreateTaskRequest{Slug: "my_task"})
+		require.NoError(err)
+		require.Equal("my_task", resp.Slug)
+		require.Len(server.Client.Tasks, 1)
+		require.Len(server.Requests(), 2)
+	})
+
+	t.Run("idempotency key prefix", func(t *testing.T) {
+		require := require.New(t)
+		server, client := newTestServer(t, ServerOpts{})
+
+		// Re-issuing a create with the same prefix, e.g. after a crash, replays the original
+		// response. Other requests and other prefixes get keys of their own.
+		deployCtx := api.WithIdempotencyKeyPrefix(ctx, "dep123")
+		req := api.CreateTaskRequest{Slug: "my_task"}
+		first, err := client.CreateTask(deployCtx, req)
+		require.NoError(err)
+		second, err := client.CreateTask(deployCtx, req)
+		require.NoError(err)
+		require.Equal(first, second)
+		_, err = client.CreateTask(deployCtx, api.CreateTaskRequest{Slug: "other_task"})
+		require.NoError(err)
+		require.Len(server.Client.Tasks, 2)
+
+		_, err = client.CreateTask(api.WithIdempotencyKeyPrefix(ctx, "dep456"), req)
+		var errsc libhttp.ErrStatusCode
+		require.ErrorAs(err, &errsc)
+		require.Equal(http.StatusConflict, errsc.StatusCode)
+
+		requests := server.Requests()
+		require.Equal(requests[0].Header.Get("Idempotency-Key"), requests[1].Header.Get("Idempotency-Key"))
+		require.NotEqual(requests[0].Header.Get("Idempotency-Key"), requests[2].Header.Get("Idempotency-Key"))
+	})
+
+	t.Run("latency", func(t *testing.T) {
+		require := require.New(t)
+		_, client := newTestServer(t, ServerOpts{Latency: 50 * time.Millisecond})
+
+		start := time.Now()
+		_, err := client.ListResources(ctx, "")
+		require.NoError(err)
+		require.GreaterOrEqual(time.Since(start), 50*time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		_, err = client.ListResources(ctx, "")
+		require.ErrorIs(err, context.DeadlineExceeded)
+	})
+}
+
+func TestServerUploads(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	server, client := newTestServer(t, ServerOpts{})
+
+	created, err := client.CreateUpload(ctx, api.CreateUploadRequest{FileName: "report.csv", SizeBytes: 3})
+	require.NoError(err)
+	require.Equal("report.csv", created.Upload.FileName)
+
+	hc := libhttp.NewClient(testClientOpts)
+	_, err = hc.Put(ctx, created.WriteOnlyURL, []byte("a,b"), libhttp.ReqOpts{})
+	require.NoError(err)
+	content, err := hc.Get(ctx, created.ReadOnlyURL, libhttp.ReqOpts{})
+	require.NoError(err)
+	require.True(bytes.Equal([]byte("a,b"), content))
+
+	got, err := client.GetUpload(ctx, api.GetUploadRequest{UploadID: created.Upload.ID})
+	require.NoError(err)
+	require.Equal(created.Upload.ID, got.Upload.ID)
+	require.Equal(created.ReadOnlyURL, got.ReadOnlyURL)
+	_, err = client.GetUpload(ctx, api.GetUploadRequest{UploadID: "upl_missing"})
+	var errsc libhttp.ErrStatusCode
+	require.ErrorAs(err, &errsc)
+	require.Equal(http.StatusNotFound, errsc.StatusCode)
+
+	// Uploads can be written in chunks, and failed chunks are retried.
+	server.InjectFault(Fault{Path: "/storage/upl2", StatusCode: 503, Times: 1})
+	upload, err := api.UploadReader(ctx, client, bytes.NewReader([]byte("hello world")), 11, api.UploadOpts{
+		FileName:     "hello.txt",
+		ChunkSize:    4,
+		RetryWaitMin: time.Millisecond,
+	})
+	require.NoError(err)
+	require.Equal("upl2", upload.ID)
+	require.Equal("hello.txt", server.Client.Uploads["upl2"].FileName)
+	content, ok := server.UploadContent(upload.ID)
+	require.True(ok)
+	require.Equal("hello world", string(content))
+}
+
+func TestServerDiscoverDeploy(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+	server, client := newTestServer(t, ServerOpts{})
+
+	dir := t.TempDir()
+	require.NoError(os.WriteFile(filepath.Join(dir, "my_task.sh"), []byte("echo hello\n"), 0644))
+	require.NoError(os.WriteFile(filepath.Join(dir, "my_task.task.yaml"), []byte(
+		"slug: my_task\nname: My task\nshell:\n  entrypoint: my_task.sh\n",
+	), 0644))
+
+	// Discover the definition, creating the task since it doesn't exist yet.
+	d := &discover.Discoverer{
+		TaskDiscoverers: []discover.TaskDiscoverer{&discover.DefnDiscoverer{
+			Client: client,
+			Logger: &logger.MockLogger{},
+			MissingTaskHandler: func(ctx context.Context, def definitions.DefinitionInterface) (*api.TaskMetadata, error) {
+				resp, err := client.CreateTask(ctx, api.CreateTaskRequest{Slug: def.GetSlug(), Name: def.GetName()})
+				if err != nil {
+					return nil, err
+				}
+				return &api.TaskMetadata{ID: resp.TaskID, Slug: resp.Slug}, nil
+			},
+		}},
+		Client: client,
+		Logger: &logger.MockLogger{},
+	}
+	server.InjectFault(Fault{Path: "/v0/tasks/getMetadata", StatusCode: http.StatusServiceUnavailable, Times: 1})
+	taskConfigs, _, err := d.Discover(ctx, dir)
+	require.NoError(err)
+	require.Len(taskConfigs, 1)
+	tc := taskConfigs[0]
+	require.Equal(server.Client.Tasks["my_task"].ID, tc.TaskID)
+
+	// Archive the task's root and upload it.
+	archiver := archive.NewAPIArchiver(&logger.MockLogger{}, client, &archive.HttpUploader{})
+	uploadID, size, err := archiver.Archive(ctx, tc.TaskRoot)
+	require.NoError(err)
+	content, ok := server.UploadContent(uploadID)
+	require.True(ok)
+	require.Len(content, size)
+
+	// Deploy the task.
+	req, err := tc.Def.GetUpdateTaskRequest(ctx, client, false)
+	require.NoError(err)
+	_, err = client.UpdateTask(ctx, req)
+	require.NoError(err)
+	task := server.Client.Tasks["my_task"]
+	require.Equal("My task", task.Name)
+	require.Equal(build.TaskKindShell, task.Kind)
+
+	var methodPaths []string
+	for _, r := range server.Requests() {
+		methodPaths = append(methodPaths, r.Method+" "+r.Path)
+	}
+	// The script and its definition are both discovered, so the task is looked up twice.
+	require.Equal([]string{
+		"GET /v0/tasks/getMetadata",
+		"GET /v0/tasks/getMetadata",
+		"POST /v0/tasks/create",
+		"GET /v0/tasks/getMetadata",
+		"POST /v0/builds/createUpload",
+		"PUT /storage/" + uploadID,
+		"POST /v0/tasks/update",
+	}, methodPaths)
+
+	requests := server.Requests()
+	require.Equal(http.StatusServiceUnavailable, requests[0].StatusCode)
+	require.Equal(http.StatusNotFound, requests[1].StatusCode)
+	require.Equal("my_task", requests[1].Query.Get("slug"))
+	require.Equal(http.StatusOK, requests[3].StatusCode)
+	require.Equal(content, requests[5].Body)
+
+	var update api.UpdateTaskRequest
+	require.NoError(json.Unmarshal(requests[6].Body, &update))
+	require.Equal("my_task", update.Slug)
+	require.Equal("My task", update.Name)
+	require.Equal(build.TaskKindShell, update.Kind)
+}
@@ -0,0 +1,306 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParamError describes why the value for a single parameter is invalid.
+type ParamError struct {
+	Slug string
+	Msg  string
+}
+
+func (e ParamError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Slug, e.Msg)
+}
+
+// ParamErrors is returned by Parameters.Validate and Parameters.Coerce when one or more
+// parameter values are invalid. Errors are sorted by parameter slug.
+type ParamErrors []ParamError
+
+func (e ParamErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, perr := range e {
+		msgs[i] = perr.Error()
+	}
+	return "invalid parameter values: " + strings.Join(msgs, "; ")
+}
+
+const (
+	// DateLayout is the format of TypeDate parameter values.
+	DateLayout = "2006-01-02"
+	// DatetimeLayout is the format of TypeDatetime parameter values.
+	DatetimeLayout = time.RFC3339Nano
+)
+
+// Validate checks `values`, keyed by parameter slug, against the types and constraints of
+// the parameters. Values are expected to be in their JSON-decoded form, e.g. integers may be
+// float64s. Each value is checked as follows:
+//
+//   - A parameter without a value, or with a nil value, must be optional or have a default.
+//   - TypeString, TypeDate, TypeDatetime, TypeUpload and TypeConfigVar values must be strings.
+//     Dates must use DateLayout and datetimes must use DatetimeLayout. Uploads are referenced by
+//     upload ID and config variables by name. A config variable may also be passed as an object
+//     of the form `{"name": "..."}`.
+//   - TypeInteger values must be whole numbers and TypeFloat values must be numbers.
+//   - TypeBoolean values must be booleans.
+//   - If set, the value must match Constraints.Regex and be one of Constraints.Options.
+//
+// Values for unknown parameters are rejected. If any value is invalid, ParamErrors is returned.
+func (p Parameters) Validate(values map[string]interface{}) error {
+	var errs ParamErrors
+	bySlug := make(map[string]Parameter, len(p))
+	for _, param := range p {
+		bySlug[param.Slug] = param
+
+		v, ok := values[param.Slug]
+		if !ok || v == nil {
+			if !param.Constraints.Optional && param.Default == nil {
+				errs = append(errs, ParamError{Slug: param.Slug, Msg: "a value is required"})
+			}
+			continue
+		}
+		if err := param.validate(v); err != nil {
+			errs = append(errs, ParamError{Slug: param.Slug, Msg: err.Error()})
+		}
+	}
+	for slug := range values {
+		if _, ok := bySlug[slug]; !ok {
+			errs = append(errs, ParamError{Slug: slug, Msg: "unknown parameter"})
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Slug < errs[j].Slug })
+	return errs
+}
+
+// Coerce converts string values, e.g. from CLI flags or environment variables, into values
+// of each parameter's type that can be passed to Validate or used to execute a task:
+//
+//   - TypeBoolean values are parsed with strconv.ParseBool and also accept "yes" and "no".
+//   - TypeInteger values become int64s and TypeFloat values become float64s.
+//   - TypeDate and TypeDatetime values are checked against DateLayout and DatetimeLayout,
+//     and otherwise kept as strings.
+//   - All other types are kept as strings.
+//
+// An empty string is treated as an unset value for all types except TypeString. Coerce does not
+// check constraints; call Validate on the result. If a value can't be converted, ParamErrors is
+// returned.
+func (p Parameters) Coerce(values map[string]string) (map[string]interface{}, error) {
+	var errs ParamErrors
+	bySlug := make(map[string]Parameter, len(p))
+	for _, param := range p {
+		bySlug[param.Slug] = param
+	}
+
+	out := make(map[string]interface{}, len(values))
+	for slug, s := range values {
+		param, ok := bySlug[slug]
+		if !ok {
+			errs = append(errs, ParamError{Slug: slug, Msg: "unknown parameter"})
+			continue
+		}
+		if s == "" && param.Type != TypeString {
+			continue
+		}
+		v, err := param.coerce(s)
+		if err != nil {
+			errs = append(errs, ParamError{Slug: slug, Msg: err.Error()})
+			continue
+		}
+		out[slug] = v
+	}
+
+	if len(errs) > 0 {
+		sort.SliceStable(errs, func(i, j int) bool { return errs[i].Slug < errs[j].Slug })
+		return nil, errs
+	}
+	return out, nil
+}
+
+func (p Parameter) coerce(s string) (interface{}, error) {
+	switch p.Type {
+	case TypeBoolean:
+		switch strings.ToLower(s) {
+		case "yes", "y":
+			return true, nil
+		case "no", "n":
+			return false, nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, fmt.Errorf("expected a boolean, got %q", s)
+		}
+		return b, nil
+	case TypeInteger:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected an integer, got %q", s)
+		}
+		return i, nil
+	case TypeFloat:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("expected a number, got %q", s)
+		}
+		return f, nil
+	case TypeDate:
+		if _, err := time.Parse(DateLayout, s); err != nil {
+			return nil, fmt.Errorf("expected a date in the format YYYY-MM-DD, got %q", s)
+		}
+		return s, nil
+	case TypeDatetime:
+		if _, err := time.Parse(DatetimeLayout, s); err != nil {
+			return nil, fmt.Errorf("expected an RFC 3339 datetime, got %q", s)
+		}
+		return s, nil
+	default:
+		return s, nil
+	}
+}
+
+func (p Parameter) validate(v interface{}) error {
+	switch p.Type {
+	case TypeString, TypeUpload:
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("expected a string, got %T", v)
+		}
+	case TypeConfigVar:
+		if _, ok := configVarName(v); !ok {
+			return fmt.Errorf("expected the name of a config variable, got %T", v)
+		}
+	case TypeBoolean:
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("expected a boolean, got %T", v)
+		}
+	case TypeInteger:
+		f, ok := toFloat64(v)
+		if !ok {
+			return fmt.Errorf("expected an integer, got %T", v)
+		}
+		if f != math.Trunc(f) {
+			return fmt.Errorf("expected an integer, got %v", f)
+		}
+	case TypeFloat:
+		if _, ok := toFloat64(v); !ok {
+			return fmt.Errorf("expected a number, got %T", v)
+		}
+	case TypeDate:
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("expected a date string, got %T", v)
+		}
+		if _, err := time.Parse(DateLayout, s); err != nil {
+			return fmt.Errorf("expected a date in the format YYYY-MM-DD, got %q", s)
+		}
+	case TypeDatetime:
+		s, ok := v.(string)
+		if !ok {
+			return fmt.Errorf("expected a datetime string, got %T", v)
+		}
+		if _, err := time.Parse(DatetimeLayout, s); err != nil {
+			return fmt.Errorf("expected an RFC 3339 datetime, got %q", s)
+		}
+	default:
+		return fmt.Errorf("unknown parameter type %q", p.Type)
+	}
+
+	if p.Constraints.Regex != "" {
+		s, ok := v.(string)
+		if ok {
+			re, err := regexp.Compile(p.Constraints.Regex)
+			if err != nil {
+				return fmt.Errorf("invalid regex constraint %q: %v", p.Constraints.Regex, err)
+			}
+			if !re.MatchString(s) {
+				return fmt.Errorf("value %q does not match regex %q", s, p.Constraints.Regex)
+			}
+		}
+	}
+
+	if len(p.Constraints.Options) > 0 {
+		found := false
+		for _, opt := range p.Constraints.Options {
+			if optionEquals(opt.Value, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("value %v is not one of the allowed options", v)
+		}
+	}
+
+	return nil
+}
+
+func configVarName(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case map[string]interface{}:
+		name, ok := v["name"].(string)
+		return name, ok
+	default:
+		return "", false
+	}
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// optionEquals compares an option value to a parameter value. Numbers are compared by value,
+// regardless of their Go type, and config variables are compared by name.
+func optionEquals(opt Value, v interface{}) bool {
+	if of, ok := toFloat64(opt); ok {
+		vf, ok := toFloat64(v)
+		return ok && of == vf
+	}
+	if on, ok := configVarName(opt); ok {
+		vn, ok := configVarName(v)
+		return ok && on == vn
+	}
+	return reflect.DeepEqual(opt, v)
+}
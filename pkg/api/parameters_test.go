@@ -0,0 +1,132 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testParams = Parameters{
+	{Slug: "name", Type: TypeString, Constraints: Constraints{Regex: "^[A-Z][a-z]+$"}},
+	{Slug: "bio", Type: TypeString, Component: ComponentTextarea, Constraints: Constraints{Optional: true}},
+	{Slug: "admin", Type: TypeBoolean, Default: false},
+	{Slug: "age", Type: TypeInteger, Constraints: Constraints{Optional: true}},
+	{Slug: "score", Type: TypeFloat, Constraints: Constraints{Optional: true}},
+	{Slug: "birthday", Type: TypeDate, Constraints: Constraints{Optional: true}},
+	{Slug: "signup", Type: TypeDatetime, Constraints: Constraints{Optional: true}},
+	{Slug: "avatar", Type: TypeUpload, Constraints: Constraints{Optional: true}},
+	{Slug: "api_key", Type: TypeConfigVar, Constraints: Constraints{Optional: true}},
+	{Slug: "size", Type: TypeInteger, Constraints: Constraints{
+		Optional: true,
+		Options: []ConstraintOption{
+			{Label: "Small", Value: 1},
+			{Label: "Large", Value: 2},
+		},
+	}},
+}
+
+func TestParametersValidate(t *testing.T) {
+	require := require.New(t)
+
+	// Values as they would be decoded from JSON.
+	var values map[string]interface{}
+	require.NoError(json.Unmarshal([]byte(`{
+		"name": "Alice",
+		"bio": "",
+		"age": 30,
+		"score": 9.5,
+		"birthday": "1990-01-31",
+		"signup": "2023-01-02T15:04:05Z",
+		"avatar": "upl123",
+		"api_key": {"name": "stripe_key"},
+		"size": 2
+	}`), &values))
+	require.NoError(testParams.Validate(values))
+
+	// Go-typed values should also be accepted.
+	require.NoError(testParams.Validate(map[string]interface{}{
+		"name":    "Bob",
+		"admin":   true,
+		"age":     int64(30),
+		"api_key": "stripe_key",
+		"size":    1,
+	}))
+
+	err := testParams.Validate(map[string]interface{}{
+		"name":     "alice",
+		"admin":    "yes",
+		"age":      30.5,
+		"score":    "high",
+		"birthday": "01/31/1990",
+		"signup":   "2023-01-02",
+		"avatar":   123,
+		"size":     3,
+		"unknown":  "foo",
+	})
+	var perrs ParamErrors
+	require.ErrorAs(err, &perrs)
+	require.Equal(ParamErrors{
+		{Slug: "admin", Msg: "expected a boolean, got string"},
+		{Slug: "age", Msg: "expected an integer, got 30.5"},
+		{Slug: "avatar", Msg: "expected a string, got int"},
+		{Slug: "birthday", Msg: `expected a date in the format YYYY-MM-DD, got "01/31/1990"`},
+		{Slug: "name", Msg: `value "alice" does not match regex "^[A-Z][a-z]+$"`},
+		{Slug: "score", Msg: "expected a number, got string"},
+		{Slug: "signup", Msg: `expected an RFC 3339 datetime, got "2023-01-02"`},
+		{Slug: "size", Msg: "value 3 is not one of the allowed options"},
+		{Slug: "unknown", Msg: "unknown parameter"},
+	}, perrs)
+
+	// Required parameters without a default must be set.
+	err = testParams.Validate(map[string]interface{}{"name": nil})
+	require.ErrorAs(err, &perrs)
+	require.Equal(ParamErrors{{Slug: "name", Msg: "a value is required"}}, perrs)
+}
+
+func TestParametersCoerce(t *testing.T) {
+	require := require.New(t)
+
+	values, err := testParams.Coerce(map[string]string{
+		"name":     "Alice",
+		"bio":      "",
+		"admin":    "yes",
+		"age":      "30",
+		"score":    "9.5",
+		"birthday": "1990-01-31",
+		"signup":   "2023-01-02T15:04:05-07:00",
+		"avatar":   "upl123",
+		"api_key":  "stripe_key",
+		"size":     "",
+	})
+	require.NoError(err)
+	require.Equal(map[string]interface{}{
+		"name":     "Alice",
+		"bio":      "",
+		"admin":    true,
+		"age":      int64(30),
+		"score":    9.5,
+		"birthday": "1990-01-31",
+		"signup":   "2023-01-02T15:04:05-07:00",
+		"avatar":   "upl123",
+		"api_key":  "stripe_key",
+	}, values)
+	require.NoError(testParams.Validate(values))
+
+	_, err = testParams.Coerce(map[string]string{
+		"admin":    "maybe",
+		"age":      "thirty",
+		"score":    "NaN",
+		"birthday": "tomorrow",
+		"unknown":  "foo",
+	})
+	var perrs ParamErrors
+	require.ErrorAs(err, &perrs)
+	require.Equal(ParamErrors{
+		{Slug: "admin", Msg: `expected a boolean, got "maybe"`},
+		{Slug: "age", Msg: `expected an integer, got "thirty"`},
+		{Slug: "birthday", Msg: `expected a date in the format YYYY-MM-DD, got "tomorrow"`},
+		{Slug: "score", Msg: `expected a number, got "NaN"`},
+		{Slug: "unknown", Msg: "unknown parameter"},
+	}, perrs)
+}
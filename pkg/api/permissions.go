@@ -0,0 +1,406 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	ActionTasksGet     Action = "tasks.get"
+	ActionTasksRequest Action = "tasks.request"
+	ActionTasksExecute Action = "tasks.execute"
+	ActionTasksApprove Action = "tasks.approve"
+	ActionTasksUpdate  Action = "tasks.update"
+	ActionRunsGet      Action = "runs.get"
+
+	ActionRunbooksGet     Action = "runbooks.get"
+	ActionRunbooksRequest Action = "runbooks.request"
+	ActionRunbooksExecute Action = "runbooks.execute"
+	ActionRunbooksApprove Action = "runbooks.approve"
+	ActionRunbooksUpdate  Action = "runbooks.update"
+
+	ActionSessionsGet     Action = "sessions.get"
+	ActionSessionsExecute Action = "sessions.execute"
+	ActionSessionsUpdate  Action = "sessions.update"
+
+	ActionResourcesUse Action = "resources.use"
+)
+
+// ObjectKind is the kind of object that an AccessPolicy applies to.
+type ObjectKind string
+
+const (
+	ObjectKindTask     ObjectKind = "task"
+	ObjectKindRunbook  ObjectKind = "runbook"
+	ObjectKindSession  ObjectKind = "session"
+	ObjectKindResource ObjectKind = "resource"
+)
+
+// actionKinds maps each action to the kind of object it applies to.
+var actionKinds = map[Action]ObjectKind{
+	ActionTasksGet:        ObjectKindTask,
+	ActionTasksRequest:    ObjectKindTask,
+	ActionTasksExecute:    ObjectKindTask,
+	ActionTasksApprove:    ObjectKindTask,
+	ActionTasksUpdate:     ObjectKindTask,
+	ActionRunsGet:         ObjectKindTask,
+	ActionRunbooksGet:     ObjectKindRunbook,
+	ActionRunbooksRequest: ObjectKindRunbook,
+	ActionRunbooksExecute: ObjectKindRunbook,
+	ActionRunbooksApprove: ObjectKindRunbook,
+	ActionRunbooksUpdate:  ObjectKindRunbook,
+	ActionSessionsGet:     ObjectKindSession,
+	ActionSessionsExecute: ObjectKindSession,
+	ActionSessionsUpdate:  ObjectKindSession,
+	ActionResourcesUse:    ObjectKindResource,
+}
+
+// roleActions lists the actions granted by each object-level role. Team roles are handled
+// separately by AccessPolicy.Evaluate.
+var roleActions = map[RoleID][]Action{
+	RoleTaskViewer:    {ActionTasksGet},
+	RoleTaskRequester: {ActionTasksGet, ActionTasksRequest},
+	RoleTaskExecuter:  {ActionTasksGet, ActionTasksRequest, ActionTasksExecute, ActionTasksApprove, ActionRunsGet},
+	RoleTaskAdmin: {
+		ActionTasksGet, ActionTasksRequest, ActionTasksExecute, ActionTasksApprove, ActionTasksUpdate,
+		ActionRunsGet,
+	},
+	RoleRunViewer:        {ActionRunsGet},
+	RoleRunbookViewer:    {ActionRunbooksGet},
+	RoleRunbookRequester: {ActionRunbooksGet, ActionRunbooksRequest},
+	RoleRunbookExecuter:  {ActionRunbooksGet, ActionRunbooksRequest, ActionRunbooksExecute, ActionRunbooksApprove},
+	RoleRunbookAdmin: {
+		ActionRunbooksGet, ActionRunbooksRequest, ActionRunbooksExecute, ActionRunbooksApprove,
+		ActionRunbooksUpdate,
+	},
+	RoleSessionViewer:   {ActionSessionsGet},
+	RoleSessionExecuter: {ActionSessionsGet, ActionSessionsExecute},
+	RoleSessionAdmin:    {ActionSessionsGet, ActionSessionsExecute, ActionSessionsUpdate},
+	RoleResourceUser:    {ActionResourcesUse},
+}
+
+// defaultRoles is the role that every team member has on an object that does not require
+// explicit permissions.
+var defaultRoles = map[ObjectKind]RoleID{
+	ObjectKindTask:     RoleTaskExecuter,
+	ObjectKindRunbook:  RoleRunbookExecuter,
+	ObjectKindSession:  RoleSessionExecuter,
+	ObjectKindResource: RoleResourceUser,
+}
+
+// Actions returns the actions granted by an object-level role, e.g. RoleTaskViewer. Team roles
+// return nil.
+func (r RoleID) Actions() []Action {
+	return append([]Action(nil), roleActions[r]...)
+}
+
+// Subject is a user attempting to take an action.
+type Subject struct {
+	UserID   string
+	GroupIDs []string
+	// TeamRole is the user's team-wide role, either RoleTeamAdmin, RoleTeamDeveloper or empty
+	// for other team members.
+	TeamRole RoleID
+}
+
+// CallerKind is the kind of caller that executes a task. An empty CallerKind represents a user
+// executing a task directly.
+type CallerKind string
+
+const (
+	CallerKindTask CallerKind = "task"
+	CallerKindView CallerKind = "view"
+)
+
+// AccessRequest describes an action that a subject would like to take.
+type AccessRequest struct {
+	Subject Subject
+	Action  Action
+	// Caller is the kind of caller that is executing or requesting the task on behalf of
+	// the subject, if any. It is checked against ExecuteRules.RestrictCallers.
+	Caller CallerKind
+	// RequesterID is the ID of the user that created the request being approved. It is only
+	// used for approve actions and is checked against ExecuteRules.DisallowSelfApprove.
+	RequesterID string
+}
+
+// AccessDecision is the result of evaluating an AccessRequest.
+type AccessDecision struct {
+	Allowed bool
+	// Reason explains why access was allowed or denied.
+	Reason string
+}
+
+// AccessPolicy describes who can access a task, runbook, session or resource.
+type AccessPolicy struct {
+	Kind ObjectKind
+	// RequireExplicitPermissions restricts access to team admins and the subjects in Permissions.
+	// Otherwise, every team member can use the object, and Permissions are ignored.
+	RequireExplicitPermissions bool
+	Permissions                Permissions
+	// ExecuteRules only apply to tasks and runbooks.
+	ExecuteRules ExecuteRules
+}
+
+// AccessPolicy returns the access policy of the task.
+func (t Task) AccessPolicy() AccessPolicy {
+	return AccessPolicy{
+		Kind:                       ObjectKindTask,
+		RequireExplicitPermissions: t.RequireExplicitPermissions,
+		Permissions:                t.Permissions,
+		ExecuteRules:               t.ExecuteRules,
+	}
+}
+
+// Evaluate decides whether the request is allowed by the policy, following the same rules as
+// the Airplane API:
+//
+//   - Execute rules apply to everyone, including team admins. If DisallowSelfApprove is set,
+//     users cannot approve their own requests. If RestrictCallers is set, the task can only be
+//     executed or requested by one of the listed callers, and not directly by users.
+//   - Team admins can take any action.
+//   - If the object does not require explicit permissions, team developers can take any action
+//     and other team members have the default role for the object, e.g. RoleTaskExecuter.
+//   - Otherwise, the subject must be granted the action, or a role that includes it, by a
+//     permission on the subject's user ID or one of its groups.
+func (p AccessPolicy) Evaluate(req AccessRequest) AccessDecision {
+	kind, ok := actionKinds[req.Action]
+	if !ok {
+		return deny("unknown action %q", req.Action)
+	}
+	if kind != p.Kind {
+		return deny("action %q does not apply to a %s", req.Action, p.Kind)
+	}
+
+	switch req.Action {
+	case ActionTasksApprove, ActionRunbooksApprove:
+		if p.ExecuteRules.DisallowSelfApprove && req.RequesterID != "" && req.RequesterID == req.Subject.UserID {
+			return deny("users cannot approve their own requests")
+		}
+	case ActionTasksExecute, ActionTasksRequest, ActionRunbooksExecute, ActionRunbooksRequest:
+		if len(p.ExecuteRules.RestrictCallers) > 0 && !p.callerAllowed(req.Caller) {
+			return deny("only callers of kind %s are allowed", strings.Join(p.ExecuteRules.RestrictCallers, ", "))
+		}
+	}
+
+	switch {
+	case req.Subject.TeamRole == RoleTeamAdmin:
+		return allow("team admins have full access")
+	case !p.RequireExplicitPermissions && req.Subject.TeamRole == RoleTeamDeveloper:
+		return allow("team developers have full access to %ss that do not require explicit permissions", p.Kind)
+	case !p.RequireExplicitPermissions:
+		role := defaultRoles[p.Kind]
+		if roleGrants(role, "", req.Action) {
+			return allow("team members have the %s role on %ss that do not require explicit permissions", role, p.Kind)
+		}
+		return deny("the %s role does not grant %s", role, req.Action)
+	}
+
+	for _, perm := range p.Permissions {
+		if !perm.appliesTo(req.Subject) || !roleGrants(perm.RoleID, perm.Action, req.Action) {
+			continue
+		}
+		if perm.RoleID != "" {
+			return allow("granted by the %s role on %s", perm.RoleID, perm.grantee())
+		}
+		return allow("granted by the %s action on %s", perm.Action, perm.grantee())
+	}
+	return deny("no permission grants %s", req.Action)
+}
+
+func (p AccessPolicy) callerAllowed(caller CallerKind) bool {
+	if caller == "" {
+		return false
+	}
+	for _, c := range p.ExecuteRules.RestrictCallers {
+		if CallerKind(c) == caller {
+			return true
+		}
+	}
+	return false
+}
+
+func allow(format string, args ...interface{}) AccessDecision {
+	return AccessDecision{Allowed: true, Reason: fmt.Sprintf(format, args...)}
+}
+
+func deny(format string, args ...interface{}) AccessDecision {
+	return AccessDecision{Allowed: false, Reason: fmt.Sprintf(format, args...)}
+}
+
+// roleGrants reports whether a permission with the given role or action grants `want`.
+func roleGrants(role RoleID, action Action, want Action) bool {
+	if action != "" {
+		return action == want
+	}
+	for _, a := range roleActions[role] {
+		if a == want {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Permission) appliesTo(s Subject) bool {
+	if p.SubUserID != nil {
+		return *p.SubUserID == s.UserID
+	}
+	if p.SubGroupID != nil {
+		for _, g := range s.GroupIDs {
+			if g == *p.SubGroupID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p Permission) grantee() Grantee {
+	switch {
+	case p.SubUserID != nil:
+		return Grantee{Kind: GranteeKindUser, ID: *p.SubUserID}
+	case p.SubGroupID != nil:
+		return Grantee{Kind: GranteeKindGroup, ID: *p.SubGroupID}
+	default:
+		return Grantee{}
+	}
+}
+
+// GranteeKind is the kind of subject that a permission is granted to.
+type GranteeKind string
+
+const (
+	GranteeKindTeam  GranteeKind = "team"
+	GranteeKindGroup GranteeKind = "group"
+	GranteeKindUser  GranteeKind = "user"
+)
+
+// Grantee is a user, a group or the whole team. Team grantees have no ID.
+type Grantee struct {
+	Kind GranteeKind
+	ID   string
+}
+
+func (g Grantee) String() string {
+	if g.Kind == GranteeKindTeam {
+		return "team"
+	}
+	return fmt.Sprintf("%s %s", g.Kind, g.ID)
+}
+
+// Grants returns the actions that the policy grants to each grantee. Access that team admins
+// and developers have by virtue of their team role is not included.
+func (p AccessPolicy) Grants() map[Grantee][]Action {
+	sets := p.grantSets()
+	grants := make(map[Grantee][]Action, len(sets))
+	for g, set := range sets {
+		grants[g] = sortedActions(set)
+	}
+	return grants
+}
+
+func (p AccessPolicy) grantSets() map[Grantee]map[Action]bool {
+	sets := map[Grantee]map[Action]bool{}
+	add := func(g Grantee, actions ...Action) {
+		if sets[g] == nil {
+			sets[g] = map[Action]bool{}
+		}
+		for _, a := range actions {
+			if actionKinds[a] == p.Kind {
+				sets[g][a] = true
+			}
+		}
+	}
+
+	if !p.RequireExplicitPermissions {
+		add(Grantee{Kind: GranteeKindTeam}, roleActions[defaultRoles[p.Kind]]...)
+		return sets
+	}
+	for _, perm := range p.Permissions {
+		g := perm.grantee()
+		if g.Kind == "" {
+			continue
+		}
+		if perm.RoleID != "" {
+			add(g, roleActions[perm.RoleID]...)
+		} else if perm.Action != "" {
+			add(g, perm.Action)
+		}
+	}
+	return sets
+}
+
+// AccessChange describes the actions that a grantee gains or loses between two policies.
+type AccessChange struct {
+	Grantee Grantee
+	Gained  []Action
+	Lost    []Action
+}
+
+// DiffAccess compares the grants of two policies for the same object, e.g. before and after a
+// deploy. Changes are sorted by grantee kind (team, group, user) and then ID. Grantees whose
+// access is unchanged are omitted.
+func DiffAccess(before, after AccessPolicy) []AccessChange {
+	beforeSets := before.grantSets()
+	afterSets := after.grantSets()
+
+	grantees := map[Grantee]bool{}
+	for g := range beforeSets {
+		grantees[g] = true
+	}
+	for g := range afterSets {
+		grantees[g] = true
+	}
+
+	var changes []AccessChange
+	for g := range grantees {
+		var gained, lost map[Action]bool
+		for a := range afterSets[g] {
+			if !beforeSets[g][a] {
+				if gained == nil {
+					gained = map[Action]bool{}
+				}
+				gained[a] = true
+			}
+		}
+		for a := range beforeSets[g] {
+			if !afterSets[g][a] {
+				if lost == nil {
+					lost = map[Action]bool{}
+				}
+				lost[a] = true
+			}
+		}
+		if len(gained) == 0 && len(lost) == 0 {
+			continue
+		}
+		changes = append(changes, AccessChange{
+			Grantee: g,
+			Gained:  sortedActions(gained),
+			Lost:    sortedActions(lost),
+		})
+	}
+
+	granteeOrder := map[GranteeKind]int{GranteeKindTeam: 0, GranteeKindGroup: 1, GranteeKindUser: 2}
+	sort.Slice(changes, func(i, j int) bool {
+		gi, gj := changes[i].Grantee, changes[j].Grantee
+		if gi.Kind != gj.Kind {
+			return granteeOrder[gi.Kind] < granteeOrder[gj.Kind]
+		}
+		return gi.ID < gj.ID
+	})
+	return changes
+}
+
+func sortedActions(set map[Action]bool) []Action {
+	if len(set) == 0 {
+		return nil
+	}
+	actions := make([]Action, 0, len(set))
+	for a := range set {
+		actions = append(actions, a)
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i] < actions[j] })
+	return actions
+}
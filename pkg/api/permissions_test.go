@@ -0,0 +1,128 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/airplanedev/lib/pkg/utils/pointers"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessPolicyEvaluate(t *testing.T) {
+	alice := Subject{UserID: "usr_alice", GroupIDs: []string{"grp_eng"}}
+	bob := Subject{UserID: "usr_bob"}
+	admin := Subject{UserID: "usr_admin", TeamRole: RoleTeamAdmin}
+	dev := Subject{UserID: "usr_dev", TeamRole: RoleTeamDeveloper}
+
+	open := Task{}.AccessPolicy()
+	explicit := Task{
+		RequireExplicitPermissions: true,
+		Permissions: Permissions{
+			{RoleID: RoleTaskViewer, SubGroupID: pointers.String("grp_eng")},
+			{RoleID: RoleTaskExecuter, SubUserID: pointers.String("usr_bob")},
+			{Action: ActionTasksUpdate, SubUserID: pointers.String("usr_alice")},
+		},
+		ExecuteRules: ExecuteRules{DisallowSelfApprove: true},
+	}.AccessPolicy()
+	restricted := Task{ExecuteRules: ExecuteRules{RestrictCallers: []string{"task"}}}.AccessPolicy()
+
+	for _, test := range []struct {
+		name    string
+		policy  AccessPolicy
+		req     AccessRequest
+		allowed bool
+	}{
+		{"open: member can execute", open, AccessRequest{Subject: bob, Action: ActionTasksExecute}, true},
+		{"open: member can't update", open, AccessRequest{Subject: bob, Action: ActionTasksUpdate}, false},
+		{"open: developer can update", open, AccessRequest{Subject: dev, Action: ActionTasksUpdate}, true},
+		{"wrong kind", open, AccessRequest{Subject: admin, Action: ActionResourcesUse}, false},
+		{"unknown action", open, AccessRequest{Subject: admin, Action: "tasks.delete"}, false},
+		{"explicit: admin can update", explicit, AccessRequest{Subject: admin, Action: ActionTasksUpdate}, true},
+		{"explicit: developer needs a permission", explicit, AccessRequest{Subject: dev, Action: ActionTasksGet}, false},
+		{"explicit: group role", explicit, AccessRequest{Subject: alice, Action: ActionTasksGet}, true},
+		{"explicit: group role is limited", explicit, AccessRequest{Subject: alice, Action: ActionTasksExecute}, false},
+		{"explicit: user action", explicit, AccessRequest{Subject: alice, Action: ActionTasksUpdate}, true},
+		{"explicit: user role", explicit, AccessRequest{Subject: bob, Action: ActionTasksExecute}, true},
+		{
+			"explicit: approve someone else's request", explicit,
+			AccessRequest{Subject: bob, Action: ActionTasksApprove, RequesterID: "usr_alice"}, true,
+		},
+		{
+			"explicit: self approval", explicit,
+			AccessRequest{Subject: bob, Action: ActionTasksApprove, RequesterID: "usr_bob"}, false,
+		},
+		{
+			"explicit: self approval applies to admins", explicit,
+			AccessRequest{Subject: admin, Action: ActionTasksApprove, RequesterID: "usr_admin"}, false,
+		},
+		{"restricted: direct execution", restricted, AccessRequest{Subject: admin, Action: ActionTasksExecute}, false},
+		{
+			"restricted: allowed caller", restricted,
+			AccessRequest{Subject: bob, Action: ActionTasksExecute, Caller: CallerKindTask}, true,
+		},
+		{
+			"restricted: other caller", restricted,
+			AccessRequest{Subject: bob, Action: ActionTasksRequest, Caller: CallerKindView}, false,
+		},
+		{"restricted: viewing is unaffected", restricted, AccessRequest{Subject: bob, Action: ActionTasksGet}, true},
+		{
+			"resource", AccessPolicy{Kind: ObjectKindResource},
+			AccessRequest{Subject: bob, Action: ActionResourcesUse}, true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			decision := test.policy.Evaluate(test.req)
+			require.Equal(t, test.allowed, decision.Allowed, decision.Reason)
+			require.NotEmpty(t, decision.Reason)
+		})
+	}
+}
+
+func TestDiffAccess(t *testing.T) {
+	require := require.New(t)
+
+	before := Task{}.AccessPolicy()
+	after := Task{
+		RequireExplicitPermissions: true,
+		Permissions: Permissions{
+			{RoleID: RoleTaskExecuter, SubGroupID: pointers.String("grp_eng")},
+			{RoleID: RoleTaskAdmin, SubUserID: pointers.String("usr_alice")},
+			{RoleID: RoleTaskViewer, SubUserID: pointers.String("usr_bob")},
+			// Permissions for other kinds of objects are ignored.
+			{RoleID: RoleResourceUser, SubUserID: pointers.String("usr_carol")},
+		},
+	}.AccessPolicy()
+
+	require.Empty(DiffAccess(before, before))
+	require.Equal([]AccessChange{
+		{
+			Grantee: Grantee{Kind: GranteeKindTeam},
+			Lost:    []Action{ActionRunsGet, ActionTasksApprove, ActionTasksExecute, ActionTasksGet, ActionTasksRequest},
+		},
+		{
+			Grantee: Grantee{Kind: GranteeKindGroup, ID: "grp_eng"},
+			Gained:  []Action{ActionRunsGet, ActionTasksApprove, ActionTasksExecute, ActionTasksGet, ActionTasksRequest},
+		},
+		{
+			Grantee: Grantee{Kind: GranteeKindUser, ID: "usr_alice"},
+			Gained: []Action{
+				ActionRunsGet, ActionTasksApprove, ActionTasksExecute, ActionTasksGet, ActionTasksRequest,
+				ActionTasksUpdate,
+			},
+		},
+		{
+			Grantee: Grantee{Kind: GranteeKindUser, ID: "usr_bob"},
+			Gained:  []Action{ActionTasksGet},
+		},
+	}, DiffAccess(before, after))
+
+	// Downgrading a user only reports the lost actions.
+	downgraded := after
+	downgraded.Permissions = append(Permissions{}, after.Permissions...)
+	downgraded.Permissions[1] = Permission{RoleID: RoleTaskExecuter, SubUserID: pointers.String("usr_alice")}
+	require.Equal([]AccessChange{
+		{
+			Grantee: Grantee{Kind: GranteeKindUser, ID: "usr_alice"},
+			Lost:    []Action{ActionTasksUpdate},
+		},
+	}, DiffAccess(after, downgraded))
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"time"
+
+	"github.com/airplanedev/ojson"
+	"github.com/pkg/errors"
+)
+
+// RunStatus enumerates run statuses.
+type RunStatus string
+
+// All RunStatus values.
+const (
+	RunNotStarted RunStatus = "NotStarted"
+	RunQueued     RunStatus = "Queued"
+	RunActive     RunStatus = "Active"
+	RunSucceeded  RunStatus = "Succeeded"
+	RunFailed     RunStatus = "Failed"
+	RunCancelled  RunStatus = "Cancelled"
+)
+
+// IsTerminal returns true if a run in this status will not transition to another status.
+func (s RunStatus) IsTerminal() bool {
+	switch s {
+	case RunSucceeded, RunFailed, RunCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run represents a single execution of a task.
+type Run struct {
+	RunID       string                 `json:"runID"`
+	TaskID      string                 `json:"taskID"`
+	TaskName    string                 `json:"taskName"`
+	TeamID      string                 `json:"teamID"`
+	Status      RunStatus              `json:"status"`
+	ParamValues map[string]interface{} `json:"paramValues"`
+	Parameters  *Parameters            `json:"parameters"`
+	// ParentID is the ID of the run that executed this run, if any.
+	ParentID  string `json:"parentID"`
+	CreatorID string `json:"creatorID"`
+	EnvID     string `json:"envID"`
+	EnvSlug   string `json:"envSlug"`
+	IsStdAPI  bool   `json:"isStdAPI"`
+
+	CreatedAt   time.Time  `json:"createdAt"`
+	QueuedAt    *time.Time `json:"queuedAt"`
+	ActiveAt    *time.Time `json:"activeAt"`
+	SucceededAt *time.Time `json:"succeededAt"`
+	FailedAt    *time.Time `json:"failedAt"`
+	CancelledAt *time.Time `json:"cancelledAt"`
+	CancelledBy *string    `json:"cancelledBy"`
+}
+
+// ExecuteTaskRequest executes a task by slug.
+type ExecuteTaskRequest struct {
+	Slug        string                 `json:"slug"`
+	ParamValues map[string]interface{} `json:"paramValues"`
+	// Resources optionally overrides the resources attached to the task. It maps
+	// resource aliases to resource IDs.
+	Resources map[string]string `json:"resources,omitempty"`
+	EnvSlug   string            `json:"envSlug"`
+}
+
+// ExecuteTaskResponse represents an execute task response.
+type ExecuteTaskResponse struct {
+	RunID string `json:"runID"`
+}
+
+type ListRunsRequest struct {
+	TaskID string
+	Since  time.Time
+	Until  time.Time
+	// Page starts at zero.
+	Page  int
+	Limit int
+}
+
+type ListRunsResponse struct {
+	Runs []Run `json:"runs"`
+}
+
+type GetOutputsResponse struct {
+	Output ojson.Value `json:"output"`
+}
+
+type ListDisplaysResponse struct {
+	Displays []Display `json:"displays"`
+}
+
+type WaitForRunOpts struct {
+	// PollIntervalMin is the delay before the first poll. Each subsequent poll doubles
+	// the delay, up to PollIntervalMax.
+	//
+	// Defaults to 500ms.
+	PollIntervalMin time.Duration
+	// PollIntervalMax is the maximum delay between polls.
+	//
+	// Defaults to 5s.
+	PollIntervalMax time.Duration
+}
+
+// WaitForRun polls a run until it reaches a terminal status (see RunStatus.IsTerminal) and
+// returns the final run. Cancel `ctx` to stop waiting early.
+func WaitForRun(ctx context.Context, client IAPIClient, runID string, opts WaitForRunOpts) (Run, error) {
+	if opts.PollIntervalMin <= 0 {
+		opts.PollIntervalMin = 500 * time.Millisecond
+	}
+	if opts.PollIntervalMax < opts.PollIntervalMin {
+		opts.PollIntervalMax = 5 * time.Second
+		if opts.PollIntervalMax < opts.PollIntervalMin {
+			opts.PollIntervalMax = opts.PollIntervalMin
+		}
+	}
+
+	delay := opts.PollIntervalMin
+	for {
+		run, err := client.GetRun(ctx, runID)
+		if err != nil {
+			return Run{}, err
+		}
+		if run.Status.IsTerminal() {
+			return run, nil
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return Run{}, errors.Wrapf(ctx.Err(), "waiting for run %q", runID)
+		case <-t.C:
+		}
+
+		delay *= 2
+		if delay > opts.PollIntervalMax {
+			delay = opts.PollIntervalMax
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWaitForRun(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		polls++
+		status := RunActive
+		if polls >= 3 {
+			status = RunSucceeded
+		}
+		writeJSON(rw, 200, map[string]any{"run": Run{RunID: "run123", Status: status}})
+	}))
+	defer server.Close()
+
+	client := newTestHTTPClient(server.URL)
+	run, err := WaitForRun(ctx, client, "run123", WaitForRunOpts{
+		PollIntervalMin: time.Millisecond,
+		PollIntervalMax: 2 * time.Millisecond,
+	})
+	require.NoError(err)
+	require.Equal(RunSucceeded, run.Status)
+	require.Equal(3, polls)
+}
+
+func TestWaitForRunContextCancelled(t *testing.T) {
+	require := require.New(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		writeJSON(rw, 200, map[string]any{"run": Run{RunID: "run123", Status: RunQueued}})
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	client := newTestHTTPClient(server.URL)
+	_, err := WaitForRun(ctx, client, "run123", WaitForRunOpts{
+		PollIntervalMin: time.Millisecond,
+		PollIntervalMax: 5 * time.Millisecond,
+	})
+	require.ErrorIs(err, context.DeadlineExceeded)
+}
+
+func TestRunStatusIsTerminal(t *testing.T) {
+	require := require.New(t)
+
+	require.False(RunQueued.IsTerminal())
+	require.False(RunActive.IsTerminal())
+	require.True(RunSucceeded.IsTerminal())
+	require.True(RunFailed.IsTerminal())
+	require.True(RunCancelled.IsTerminal())
+}
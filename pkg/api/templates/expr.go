@@ -0,0 +1,389 @@
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pkg/errors"
+)
+
+// undefinedType represents JavaScript's `undefined`, e.g. the value of a missing property.
+type undefinedType struct{}
+
+var undefined = undefinedType{}
+
+type builtinFunc func(args []interface{}) (interface{}, error)
+
+// globals are available in every template and cannot be overridden by lookup maps.
+var globals = map[string]interface{}{
+	"JSON": map[string]interface{}{
+		"stringify": builtinFunc(jsonStringify),
+		"parse":     builtinFunc(jsonParse),
+	},
+}
+
+var (
+	identRegex  = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*`)
+	numberRegex = regexp.MustCompile(`^(\d+(\.\d*)?|\.\d+)([eE][+-]?\d+)?`)
+)
+
+// parser evaluates a single template expression as it parses it.
+type parser struct {
+	src   string
+	pos   int
+	scope map[string]interface{}
+}
+
+// parseTemplate evaluates the expression at the start of src, which must be followed by `}}`.
+func (p *parser) parseTemplate() (interface{}, error) {
+	v, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.consume("}}") {
+		if p.pos >= len(p.src) {
+			return nil, errors.New("unterminated template: expected }}")
+		}
+		return nil, errors.Errorf("unexpected %q", p.src[p.pos:p.pos+1])
+	}
+	return v, nil
+}
+
+func (p *parser) parseExpr() (interface{}, error) {
+	v, desc, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+
+	// Once an optional chain (`?.`) reaches a null or undefined value, the rest of the
+	// chain evaluates to undefined.
+	shortCircuit := false
+	for {
+		p.skipSpace()
+		optional := p.consume("?.")
+		if optional && (v == nil || v == undefined) {
+			shortCircuit = true
+		}
+
+		switch {
+		case p.consume("["):
+			key, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			p.skipSpace()
+			if !p.consume("]") {
+				return nil, errors.New("expected ]")
+			}
+			if !shortCircuit {
+				if v, err = getProperty(v, key); err != nil {
+					return nil, err
+				}
+				desc = fmt.Sprintf("%s[%s]", desc, formatKey(key))
+			}
+		case p.consume("("):
+			args, err := p.parseArgs()
+			if err != nil {
+				return nil, err
+			}
+			if !shortCircuit {
+				fn, ok := v.(builtinFunc)
+				if !ok {
+					return nil, errors.Errorf("%s is not a function", desc)
+				}
+				if v, err = fn(args); err != nil {
+					return nil, err
+				}
+				desc += "(...)"
+			}
+		case optional || p.consume("."):
+			p.skipSpace()
+			name := identRegex.FindString(p.src[p.pos:])
+			if name == "" {
+				return nil, errors.New("expected a property name")
+			}
+			p.pos += len(name)
+			if !shortCircuit {
+				if v, err = getProperty(v, name); err != nil {
+					return nil, err
+				}
+				desc += "." + name
+			}
+		default:
+			if shortCircuit {
+				return undefined, nil
+			}
+			return v, nil
+		}
+	}
+}
+
+func (p *parser) parseArgs() ([]interface{}, error) {
+	var args []interface{}
+	p.skipSpace()
+	if p.consume(")") {
+		return args, nil
+	}
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		p.skipSpace()
+		if p.consume(")") {
+			return args, nil
+		}
+		if !p.consume(",") {
+			return nil, errors.New("expected , or )")
+		}
+	}
+}
+
+// parsePrimary parses a literal, identifier or parenthesized expression. It also returns a
+// description of the expression for use in error messages.
+func (p *parser) parsePrimary() (interface{}, string, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return nil, "", errors.New("unterminated template: expected }}")
+	}
+	rest := p.src[p.pos:]
+
+	switch c := rest[0]; {
+	case c == '(':
+		p.pos++
+		v, err := p.parseExpr()
+		if err != nil {
+			return nil, "", err
+		}
+		p.skipSpace()
+		if !p.consume(")") {
+			return nil, "", errors.New("expected )")
+		}
+		return v, "(...)", nil
+	case c == '"' || c == '\'' || c == '`':
+		s, err := p.parseString(c)
+		if err != nil {
+			return nil, "", err
+		}
+		return s, strconv.Quote(s), nil
+	case c == '-':
+		p.pos++
+		p.skipSpace()
+		num := numberRegex.FindString(p.src[p.pos:])
+		if num == "" {
+			return nil, "", errors.New("expected a number after -")
+		}
+		p.pos += len(num)
+		f, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			return nil, "", errors.Errorf("invalid number %q", num)
+		}
+		return -f, "-" + num, nil
+	}
+
+	if num := numberRegex.FindString(rest); num != "" {
+		p.pos += len(num)
+		f, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			return nil, "", errors.Errorf("invalid number %q", num)
+		}
+		return f, num, nil
+	}
+
+	name := identRegex.FindString(rest)
+	if name == "" {
+		if strings.HasPrefix(rest, "}}") {
+			return nil, "", errors.New("expected an expression")
+		}
+		return nil, "", errors.Errorf("unexpected %q", rest[:1])
+	}
+	p.pos += len(name)
+	switch name {
+	case "true":
+		return true, name, nil
+	case "false":
+		return false, name, nil
+	case "null":
+		return nil, name, nil
+	case "undefined":
+		return undefined, name, nil
+	}
+	v, ok := p.scope[name]
+	if !ok {
+		return nil, "", errors.Errorf("%s is not defined", name)
+	}
+	return v, name, nil
+}
+
+func (p *parser) parseString(quote byte) (string, error) {
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return b.String(), nil
+		case c == '\\' && p.pos+1 < len(p.src):
+			p.pos++
+			switch e := p.src[p.pos]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'u':
+				if p.pos+5 > len(p.src) {
+					return "", errors.New("invalid unicode escape")
+				}
+				r, err := strconv.ParseUint(p.src[p.pos+1:p.pos+5], 16, 16)
+				if err != nil {
+					return "", errors.New("invalid unicode escape")
+				}
+				b.WriteRune(rune(r))
+				p.pos += 4
+			default:
+				b.WriteByte(e)
+			}
+			p.pos++
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", errors.New("unterminated string")
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && strings.ContainsRune(" \t\r\n", rune(p.src[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *parser) consume(s string) bool {
+	if strings.HasPrefix(p.src[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+// getProperty returns `v[key]` with JavaScript semantics: missing properties are undefined,
+// and reading a property of null or undefined is an error.
+func getProperty(v interface{}, key interface{}) (interface{}, error) {
+	name := formatValue(key)
+	switch v := v.(type) {
+	case nil, undefinedType:
+		return nil, errors.Errorf("cannot read properties of %s (reading '%s')", formatValue(v), name)
+	case map[string]interface{}:
+		if prop, ok := v[name]; ok {
+			return prop, nil
+		}
+	case []interface{}:
+		if name == "length" {
+			return float64(len(v)), nil
+		}
+		if i, ok := toIndex(key); ok && i < len(v) {
+			return v[i], nil
+		}
+	case string:
+		units := utf16.Encode([]rune(v))
+		if name == "length" {
+			return float64(len(units)), nil
+		}
+		if i, ok := toIndex(key); ok && i < len(units) {
+			return string(utf16.Decode(units[i : i+1])), nil
+		}
+	}
+	return undefined, nil
+}
+
+func toIndex(key interface{}) (int, bool) {
+	switch k := key.(type) {
+	case float64:
+		if k >= 0 && k == math.Trunc(k) && k <= math.MaxInt32 {
+			return int(k), true
+		}
+	case string:
+		i, err := strconv.Atoi(k)
+		if err == nil && i >= 0 && strconv.Itoa(i) == k {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func formatKey(key interface{}) string {
+	if s, ok := key.(string); ok {
+		return strconv.Quote(s)
+	}
+	return formatValue(key)
+}
+
+// formatNumber formats a number the way JavaScript would, e.g. 1 instead of 1.0.
+func formatNumber(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "NaN"
+	case math.IsInf(f, 1):
+		return "Infinity"
+	case math.IsInf(f, -1):
+		return "-Infinity"
+	}
+	if abs := math.Abs(f); abs != 0 && (abs >= 1e21 || abs < 1e-6) {
+		s := strconv.FormatFloat(f, 'g', -1, 64)
+		// Go pads exponents to two digits, e.g. 1e-07, but JavaScript does not.
+		s = strings.Replace(s, "e-0", "e-", 1)
+		return strings.Replace(s, "e+0", "e+", 1)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func jsonStringify(args []interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return undefined, nil
+	}
+	switch args[0].(type) {
+	case undefinedType, builtinFunc:
+		return undefined, nil
+	}
+
+	var indent string
+	if len(args) >= 3 {
+		switch space := args[2].(type) {
+		case float64:
+			indent = strings.Repeat(" ", int(math.Max(0, math.Min(10, space))))
+		case string:
+			indent = space
+			if len(indent) > 10 {
+				indent = indent[:10]
+			}
+		}
+	}
+	b, err := marshalJSON(args[0], indent)
+	if err != nil {
+		return nil, errors.Wrap(err, "JSON.stringify")
+	}
+	return string(b), nil
+}
+
+func jsonParse(args []interface{}) (interface{}, error) {
+	// Like JavaScript, non-string arguments are converted to strings first.
+	s := formatValue(undefined)
+	if len(args) > 0 {
+		s = formatValue(args[0])
+	}
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, errors.Wrap(err, "JSON.parse")
+	}
+	return v, nil
+}
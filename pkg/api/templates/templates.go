@@ -0,0 +1,240 @@
+// Package templates evaluates Airplane templates, e.g. `{{params.id}}`, locally. It mirrors
+// the server-side evaluation of api.EvaluateTemplateRequest so that task options can be
+// interpolated in the same way outside of Airplane.
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/airplanedev/lib/pkg/api"
+	"github.com/airplanedev/path"
+	"github.com/pkg/errors"
+)
+
+// Evaluate evaluates every template in req.Value and returns the updated value.
+//
+// Any string that contains one or more `{{expr}}` blocks is a template. If the entire string is a
+// single block, the template is replaced by the value of its expression, preserving its type.
+// Otherwise, each block is replaced by its value converted to a string, with objects and arrays
+// encoded as JSON. Maps and slices are walked recursively.
+//
+// Expressions are a subset of JavaScript: literals, property access (`a.b`, `a["b"]`, `a[0]`,
+// `a?.b`), parentheses and calls to `JSON.stringify` and `JSON.parse`. The following
+// namespaces are available:
+//
+//   - params: req.ParamValues
+//   - configs: req.Configs, keyed by config name
+//   - resources: req.Resources, keyed by resource slug
+//   - env: req.Env
+//   - run: req.Run, with its ID also available as `run.id`
+//
+// Each entry in req.LookupMaps adds a namespace, but cannot override the ones above.
+//
+// Templates that fail to evaluate are left as-is in the returned value and reported in
+// Errors, ordered by their location in the value with object keys sorted. An error is only returned if the request itself is invalid.
+func Evaluate(req api.EvaluateTemplateRequest) (api.EvaluateTemplateResponse, error) {
+	scope, err := newScope(req)
+	if err != nil {
+		return api.EvaluateTemplateResponse{}, err
+	}
+
+	var value interface{}
+	if err := normalize(req.Value, &value); err != nil {
+		return api.EvaluateTemplateResponse{}, errors.Wrap(err, "normalizing value")
+	}
+
+	e := evaluator{scope: scope}
+	value = e.walk(value, path.P{})
+	return api.EvaluateTemplateResponse{
+		Value:  value,
+		Errors: e.errs,
+	}, nil
+}
+
+func newScope(req api.EvaluateTemplateRequest) (map[string]interface{}, error) {
+	lookups := make(map[string]interface{}, len(req.LookupMaps)+5)
+	for namespace, m := range req.LookupMaps {
+		lookups[namespace] = m
+	}
+
+	params := req.ParamValues
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	lookups["params"] = params
+
+	configs := req.Configs
+	if configs == nil {
+		configs = map[string]string{}
+	}
+	lookups["configs"] = configs
+
+	lookups["env"] = req.Env
+
+	res := make(map[string]interface{}, len(req.Resources))
+	for slug, r := range req.Resources {
+		res[slug] = r
+	}
+	lookups["resources"] = res
+
+	run := map[string]interface{}{}
+	runID := req.RunID
+	if req.Run != nil {
+		if err := normalize(req.Run, &run); err != nil {
+			return nil, errors.Wrap(err, "normalizing run")
+		}
+		if req.Run.RunID != "" {
+			runID = req.Run.RunID
+		}
+	}
+	run["id"] = runID
+	lookups["run"] = run
+
+	// Round-trip through JSON so that expressions only need to handle JSON-decoded values,
+	// just as they would on the server.
+	var scope map[string]interface{}
+	if err := normalize(lookups, &scope); err != nil {
+		return nil, errors.Wrap(err, "normalizing lookup maps")
+	}
+	for name, v := range globals {
+		scope[name] = v
+	}
+	return scope, nil
+}
+
+func normalize(in interface{}, out interface{}) error {
+	b, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
+
+type evaluator struct {
+	scope map[string]interface{}
+	errs  []api.TemplateError
+}
+
+func (e *evaluator) walk(v interface{}, p path.P) interface{} {
+	switch v := v.(type) {
+	case string:
+		out, err := e.evaluate(v)
+		if err != nil {
+			e.errs = append(e.errs, api.TemplateError{
+				Path:     p.ToJS(),
+				Template: v,
+				Msg:      err.Error(),
+			})
+			return v
+		}
+		return out
+	case map[string]interface{}:
+		// Walk keys in order so that errors are reported deterministically.
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		out := make(map[string]interface{}, len(v))
+		for _, k := range keys {
+			out[k] = e.walk(v[k], p.Str(k))
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = e.walk(item, p.Int(i))
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// evaluate evaluates a single string. Strings without any `{{` are returned unchanged.
+func (e *evaluator) evaluate(s string) (interface{}, error) {
+	var b strings.Builder
+	rest := s
+	for {
+		start := strings.Index(rest, "{{")
+		if start < 0 {
+			b.WriteString(rest)
+			break
+		}
+		b.WriteString(rest[:start])
+
+		p := &parser{src: rest[start+2:], scope: e.scope}
+		v, err := p.parseTemplate()
+		if err != nil {
+			return nil, err
+		}
+		if start == 0 && rest == s && p.pos == len(p.src) {
+			// The whole string is a single template, so keep the value's type.
+			if v == undefined {
+				return nil, nil
+			}
+			return v, nil
+		}
+		str, err := toString(v)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(str)
+		rest = p.src[p.pos:]
+	}
+	return b.String(), nil
+}
+
+// toString converts a value to a string for interpolation into a larger string.
+func toString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case map[string]interface{}, []interface{}:
+		b, err := marshalJSON(v, "")
+		if err != nil {
+			return "", err
+		}
+		return string(b), nil
+	default:
+		return formatValue(v), nil
+	}
+}
+
+// formatValue formats a primitive value the way JavaScript's String() would.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case undefinedType:
+		return "undefined"
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	case float64:
+		return formatNumber(v)
+	case string:
+		return v
+	case builtinFunc:
+		return "function"
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+func marshalJSON(v interface{}, indent string) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
@@ -0,0 +1,149 @@
+package templates
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/airplanedev/lib/pkg/api"
+	"github.com/airplanedev/lib/pkg/resources"
+	"github.com/airplanedev/lib/pkg/resources/kinds"
+	"github.com/stretchr/testify/require"
+)
+
+func testRequest(value interface{}) api.EvaluateTemplateRequest {
+	return api.EvaluateTemplateRequest{
+		Value: value,
+		Run: &api.Run{
+			RunID:  "run123",
+			TaskID: "tsk123",
+		},
+		Env: api.Env{ID: "env123", Slug: "prod", Name: "Production"},
+		Resources: map[string]resources.Resource{
+			"db": &kinds.PostgresResource{
+				BaseResource: resources.BaseResource{Kind: kinds.ResourceKindPostgres, Slug: "db"},
+				Host:         "db.example.com",
+				Port:         "5432",
+			},
+		},
+		Configs: map[string]string{
+			"api_key":     "secret",
+			"team/region": "us-west-2",
+		},
+		ParamValues: map[string]interface{}{
+			"id":    int64(42),
+			"name":  "Alice",
+			"admin": true,
+			"tags":  []string{"a", "b"},
+			"user":  map[string]interface{}{"email": "alice@example.com"},
+			"none":  nil,
+		},
+		LookupMaps: map[string]interface{}{
+			"block":  map[string]interface{}{"output": []interface{}{map[string]interface{}{"n": 1}}},
+			"params": map[string]interface{}{"id": "overridden"},
+		},
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		in   interface{}
+		out  interface{}
+	}{
+		{"plain string", "hello", "hello"},
+		{"non-strings", 5, float64(5)},
+		{"whole number", "{{params.id}}", float64(42)},
+		{"whole bool", "{{ params.admin }}", true},
+		{"whole array", "{{params.tags}}", []interface{}{"a", "b"}},
+		{"whole object", "{{params.user}}", map[string]interface{}{"email": "alice@example.com"}},
+		{"whole null", "{{params.none}}", nil},
+		{"whole missing", "{{params.missing}}", nil},
+		{"interpolated", "id={{params.id}}&name={{params.name}}", "id=42&name=Alice"},
+		{"interpolated object", "user: {{params.user}}", `user: {"email":"alice@example.com"}`},
+		{"interpolated missing", "{{params.missing}}!", "undefined!"},
+		{"brackets", `{{configs["team/region"]}}`, "us-west-2"},
+		{"indexes", "{{params.tags[1]}} {{params.tags.length}}", "b 2"},
+		{"resources", "{{resources.db.host}}:{{resources.db.port}}", "db.example.com:5432"},
+		{"env", "{{env.slug}} {{env.id}}", "prod env123"},
+		{"run", "{{run.id}} {{run.runID}} {{run.taskID}}", "run123 run123 tsk123"},
+		{"lookup maps", "{{block.output[0].n}}", float64(1)},
+		{"defaults can't be overridden", "{{params.id}}", float64(42)},
+		{"optional chaining", "{{params.missing?.foo.bar}}", nil},
+		{"literals", `{{"a\"b"}}{{'c'}}{{-1.5}}{{null}}`, `a"bc-1.5null`},
+		{"JSON.stringify", "{{JSON.stringify(params.user)}}", `{"email":"alice@example.com"}`},
+		{"JSON.stringify indent", "{{JSON.stringify(params.tags, null, 2)}}", "[\n  \"a\",\n  \"b\"\n]"},
+		{"JSON.parse", `{{JSON.parse("[1, 2]")[1]}}`, float64(2)},
+		{
+			name: "nested",
+			in: map[string]interface{}{
+				"url":     "https://{{resources.db.host}}/users/{{params.id}}",
+				"body":    map[string]interface{}{"admin": "{{params.admin}}"},
+				"headers": []interface{}{"X-Key: {{configs.api_key}}"},
+			},
+			out: map[string]interface{}{
+				"url":     "https://db.example.com/users/42",
+				"body":    map[string]interface{}{"admin": true},
+				"headers": []interface{}{"X-Key: secret"},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+			resp, err := Evaluate(testRequest(test.in))
+			require.NoError(err)
+			require.Empty(resp.Errors)
+			require.Equal(test.out, resp.Value)
+		})
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	require := require.New(t)
+
+	resp, err := Evaluate(testRequest(map[string]interface{}{
+		"ok":      "{{params.name}}",
+		"unknown": "{{foo.bar}}",
+		"items": []interface{}{
+			"{{params.missing.bar}}",
+			"a {{params.name",
+			"{{params.name params.id}}",
+			"{{}}",
+			"{{params.name()}}",
+		},
+	}))
+	require.NoError(err)
+	require.Equal(map[string]interface{}{
+		"ok":      "Alice",
+		"unknown": "{{foo.bar}}",
+		"items": []interface{}{
+			"{{params.missing.bar}}",
+			"a {{params.name",
+			"{{params.name params.id}}",
+			"{{}}",
+			"{{params.name()}}",
+		},
+	}, resp.Value)
+	require.Equal([]api.TemplateError{
+		{Path: "items[0]", Template: "{{params.missing.bar}}", Msg: "cannot read properties of undefined (reading 'bar')"},
+		{Path: "items[1]", Template: "a {{params.name", Msg: "unterminated template: expected }}"},
+		{Path: "items[2]", Template: "{{params.name params.id}}", Msg: `unexpected "p"`},
+		{Path: "items[3]", Template: "{{}}", Msg: "expected an expression"},
+		{Path: "items[4]", Template: "{{params.name()}}", Msg: "params.name is not a function"},
+		{Path: "unknown", Template: "{{foo.bar}}", Msg: "foo is not defined"},
+	}, resp.Errors)
+}
+
+func TestEvaluateRequestJSON(t *testing.T) {
+	require := require.New(t)
+
+	// Requests should evaluate the same after a round trip through JSON.
+	b, err := json.Marshal(testRequest("{{block.output[0].n}} {{resources.db.host}}"))
+	require.NoError(err)
+	var req api.EvaluateTemplateRequest
+	require.NoError(json.Unmarshal(b, &req))
+
+	resp, err := Evaluate(req)
+	require.NoError(err)
+	require.Empty(resp.Errors)
+	require.Equal("1 db.example.com", resp.Value)
+}
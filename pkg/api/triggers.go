@@ -21,11 +21,13 @@ const (
 	TriggerKindUnknown  TriggerKind = ""
 	TriggerKindForm     TriggerKind = "form"
 	TriggerKindSchedule TriggerKind = "schedule"
+	TriggerKindWebhook  TriggerKind = "webhook"
 )
 
 type TriggerKindConfig struct {
 	Form     *TriggerKindConfigForm     `json:"form,omitempty"`
 	Schedule *TriggerKindConfigSchedule `json:"schedule,omitempty"`
+	Webhook  *TriggerKindConfigWebhook  `json:"webhook,omitempty"`
 }
 
 type TriggerKindConfigForm struct {
@@ -37,6 +39,22 @@ type TriggerKindConfigSchedule struct {
 	CronExpr    CronExpr               `json:"cronExpr"`
 }
 
+type TriggerKindConfigWebhook struct {
+	// ParamMappings maps parameter slugs to JavaScript template expressions that are
+	// evaluated against the inbound request, e.g. `{{body.user.email}}`.
+	ParamMappings map[string]string    `json:"paramMappings"`
+	Verification  *WebhookVerification `json:"verification,omitempty"`
+}
+
+// WebhookVerification requires inbound webhook requests to be signed with a shared secret.
+type WebhookVerification struct {
+	// SecretConfig is the name of the config variable that stores the shared secret.
+	SecretConfig string `json:"secretConfig"`
+	// Header is the request header that carries the HMAC-SHA256 signature of the request body.
+	// If empty, the server's default header is used.
+	Header string `json:"header,omitempty"`
+}
+
 type CronExpr struct {
 	Minute     string `json:"minute,omitempty"`
 	Hour       string `json:"hour,omitempty"`
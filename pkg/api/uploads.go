@@ -0,0 +1,273 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	libhttp "github.com/airplanedev/lib/pkg/api/http"
+	"github.com/pkg/errors"
+)
+
+type UploadOpts struct {
+	// FileName is the name of the uploaded file. UploadFile defaults it to the base name of the
+	// file's path.
+	FileName string
+	// ChunkSize, if set, uploads the content in chunks of this many bytes. Each chunk is sent as
+	// a PUT with a Content-Range header, and the storage backend must respond with a 308 and a
+	// Range header for every chunk but the last.
+	//
+	// Defaults to uploading the content in a single PUT.
+	ChunkSize int64
+	// MaxRetries is the number of times a chunk is retried after a network error, a 429 or a
+	// 5xx response.
+	//
+	// Defaults to 3.
+	MaxRetries int
+	// RetryWaitMin is the delay before the first retry of a chunk. Each subsequent retry doubles
+	// the delay.
+	//
+	// Defaults to 500ms.
+	RetryWaitMin time.Duration
+	// Progress, if set, is called as content is sent with the number of bytes sent so far. The
+	// count can decrease if a chunk is retried.
+	Progress func(sent, total int64)
+	// HTTPClient is used to write to the upload's write-only URL.
+	//
+	// Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+}
+
+// UploadFile uploads the file at `path` and returns the created upload. Its ID can be used
+// directly as the value of an upload parameter. See UploadReader.
+func UploadFile(ctx context.Context, client IAPIClient, path string, opts UploadOpts) (Upload, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Upload{}, errors.Wrap(err, "opening file")
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return Upload{}, errors.Wrap(err, "stat on file")
+	}
+	if opts.FileName == "" {
+		opts.FileName = filepath.Base(path)
+	}
+	return UploadReader(ctx, client, f, info.Size(), opts)
+}
+
+// UploadReader creates an upload and streams `sizeBytes` bytes from `r` to its write-only URL.
+// The returned upload's ID can be used directly as the value of an upload parameter.
+//
+// Chunks that fail with a network error, a 429 or a 5xx are retried. If `r` implements
+// io.ReaderAt (e.g. an *os.File), chunks are re-read from it. Otherwise, each chunk is
+// buffered in memory so that it can be retried.
+func UploadReader(ctx context.Context, client IAPIClient, r io.Reader, sizeBytes int64, opts UploadOpts) (Upload, error) {
+	if opts.MaxRetries <= 0 {
+		opts.MaxRetries = 3
+	}
+	if opts.RetryWaitMin <= 0 {
+		opts.RetryWaitMin = 500 * time.Millisecond
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+
+	resp, err := client.CreateUpload(ctx, CreateUploadRequest{
+		FileName:  opts.FileName,
+		SizeBytes: int(sizeBytes),
+	})
+	if err != nil {
+		return Upload{}, err
+	}
+
+	u := uploader{
+		opts:  opts,
+		url:   resp.WriteOnlyURL,
+		r:     r,
+		total: sizeBytes,
+	}
+	if err := u.upload(ctx); err != nil {
+		return Upload{}, errors.Wrapf(err, "uploading %q", opts.FileName)
+	}
+	return resp.Upload, nil
+}
+
+type uploader struct {
+	opts  UploadOpts
+	url   string
+	r     io.Reader
+	total int64
+
+	// buf holds the content starting at bufStart that has been read from r, if r does not
+	// implement io.ReaderAt.
+	buf      []byte
+	bufStart int64
+}
+
+func (u *uploader) upload(ctx context.Context) error {
+	if u.opts.ChunkSize <= 0 || u.total == 0 {
+		// Send all content in a single request.
+		_, err := u.sendChunk(ctx, 0, u.total, false)
+		return err
+	}
+
+	var offset int64
+	for offset < u.total {
+		end := offset + u.opts.ChunkSize
+		if end > u.total {
+			end = u.total
+		}
+		next, err := u.sendChunk(ctx, offset, end, true)
+		if err != nil {
+			return err
+		}
+		if next <= offset {
+			return errors.Errorf("storage did not persist any content after byte %d", offset)
+		}
+		offset = next
+	}
+	return nil
+}
+
+// sendChunk writes bytes [start, end) to the upload, retrying on transient errors. It returns
+// the offset of the first byte that the storage backend has not persisted.
+func (u *uploader) sendChunk(ctx context.Context, start, end int64, ranged bool) (int64, error) {
+	body, err := u.chunkBody(start, end)
+	if err != nil {
+		return 0, err
+	}
+
+	delay := u.opts.RetryWaitMin
+	for attempt := 0; ; attempt++ {
+		next, retry, err := u.put(ctx, body, start, end, ranged)
+		if err == nil {
+			return next, nil
+		}
+		if !retry || attempt >= u.opts.MaxRetries {
+			return 0, err
+		}
+
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return 0, errors.Wrap(ctx.Err(), "waiting to retry upload")
+		case <-t.C:
+		}
+		delay *= 2
+	}
+}
+
+// chunkBody returns a reader over bytes [start, end) of the content that can be re-read by
+// seeking back to the start.
+func (u *uploader) chunkBody(start, end int64) (io.ReadSeeker, error) {
+	if ra, ok := u.r.(io.ReaderAt); ok {
+		return io.NewSectionReader(ra, start, end-start), nil
+	}
+	// Chunks are requested in order, but the storage backend may not have persisted all of the
+	// previous chunk, so keep whatever part of it is still needed and read the rest.
+	bufEnd := u.bufStart + int64(len(u.buf))
+	if start < u.bufStart || start > bufEnd {
+		return nil, errors.Errorf("cannot resume upload from byte %d", start)
+	}
+	buf := make([]byte, end-start)
+	n := copy(buf, u.buf[start-u.bufStart:])
+	if _, err := io.ReadFull(u.r, buf[n:]); err != nil {
+		return nil, errors.Wrap(err, "reading content")
+	}
+	u.buf, u.bufStart = buf, start
+	return bytes.NewReader(buf), nil
+}
+
+// put sends a single request and returns the next offset to upload from. If it fails,
+// `retry` reports whether the request can be retried.
+func (u *uploader) put(ctx context.Context, body io.ReadSeeker, start, end int64, ranged bool) (next int64, retry bool, err error) {
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return 0, false, errors.Wrap(err, "seeking chunk")
+	}
+	var reader io.Reader = body
+	if u.opts.Progress != nil {
+		reader = &progressReader{r: body, sent: start, total: u.total, progress: u.opts.Progress}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.url, reader)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "creating upload request")
+	}
+	req.ContentLength = end - start
+	if req.ContentLength == 0 {
+		req.Body = http.NoBody
+	}
+	if ranged {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end-1, u.total))
+	} else {
+		req.Header.Set("X-Goog-Content-Length-Range", fmt.Sprintf("0,%d", u.total))
+	}
+
+	resp, err := u.opts.HTTPClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return 0, false, errors.Wrap(ctx.Err(), "uploading content")
+		}
+		return 0, true, errors.Wrap(err, "uploading content")
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return end, false, nil
+	case ranged && resp.StatusCode == http.StatusPermanentRedirect:
+		// The storage backend reports the range it has persisted so far, which may be less
+		// than what was sent.
+		next, err := parsePersistedRange(resp.Header.Get("Range"))
+		if err != nil {
+			return 0, false, err
+		}
+		return next, false, nil
+	default:
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return 0, retry, libhttp.NewErrStatusCodeFromResponse(resp)
+	}
+}
+
+// parsePersistedRange parses a Range header of the form "bytes=0-<end>" and returns the
+// offset after <end>. A missing header means that nothing has been persisted.
+func parsePersistedRange(header string) (int64, error) {
+	if header == "" {
+		return 0, nil
+	}
+	_, end, ok := strings.Cut(strings.TrimPrefix(header, "bytes="), "-")
+	if !ok {
+		return 0, errors.Errorf("invalid Range header %q", header)
+	}
+	n, err := strconv.ParseInt(end, 10, 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid Range header %q", header)
+	}
+	return n + 1, nil
+}
+
+type progressReader struct {
+	r        io.Reader
+	sent     int64
+	total    int64
+	progress func(sent, total int64)
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 {
+		pr.sent += int64(n)
+		pr.progress(pr.sent, pr.total)
+	}
+	return n, err
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	libhttp "github.com/airplanedev/lib/pkg/api/http"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStorage serves /v0/uploads/create and a resumable storage URL at /storage.
+type fakeStorage struct {
+	mu      sync.Mutex
+	content []byte
+	puts    []string
+	// fail returns an error status for the nth PUT (starting at 1), if set.
+	fail func(n int) int
+	// persistHalf only persists the first half of chunks that aren't the last.
+	persistHalf bool
+}
+
+func (fs *fakeStorage) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if req.URL.Path == "/v0/uploads/create" {
+		var body CreateUploadRequest
+		_ = json.NewDecoder(req.Body).Decode(&body)
+		writeJSON(rw, 200, CreateUploadResponse{
+			Upload:       Upload{ID: "upl123", FileName: body.FileName, SizeBytes: body.SizeBytes},
+			WriteOnlyURL: "http://" + req.Host + "/storage",
+		})
+		return
+	}
+
+	body, _ := io.ReadAll(req.Body)
+	contentRange := req.Header.Get("Content-Range")
+	fs.puts = append(fs.puts, contentRange)
+	if fs.fail != nil {
+		if status := fs.fail(len(fs.puts)); status != 0 {
+			rw.WriteHeader(status)
+			_, _ = rw.Write([]byte("storage error"))
+			return
+		}
+	}
+	if contentRange == "" {
+		fs.content = body
+		return
+	}
+
+	var first, last, total int
+	_, err := fmt.Sscanf(contentRange, "bytes %d-%d/%d", &first, &last, &total)
+	if err != nil || first > len(fs.content) || last-first+1 != len(body) {
+		rw.WriteHeader(400)
+		return
+	}
+	if last+1 == total {
+		fs.content = append(fs.content[:first], body...)
+		return
+	}
+	if fs.persistHalf {
+		body = body[:len(body)/2]
+	}
+	fs.content = append(fs.content[:first], body...)
+	rw.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(fs.content)-1))
+	rw.WriteHeader(http.StatusPermanentRedirect)
+}
+
+// onlyReader hides any other methods of a reader, such as ReadAt.
+type onlyReader struct {
+	io.Reader
+}
+
+func TestUploadReader(t *testing.T) {
+	content := []byte("the quick brown fox jumps over the lazy dog")
+	size := int64(len(content))
+
+	for _, test := range []struct {
+		name    string
+		storage *fakeStorage
+		reader  func() io.Reader
+		opts    UploadOpts
+		puts    []string
+	}{
+		{
+			name:    "single request",
+			storage: &fakeStorage{},
+			reader:  func() io.Reader { return bytes.NewReader(content) },
+			puts:    []string{""},
+		},
+		{
+			name:    "chunks",
+			storage: &fakeStorage{},
+			reader:  func() io.Reader { return bytes.NewReader(content) },
+			opts:    UploadOpts{ChunkSize: 16},
+			puts:    []string{"bytes 0-15/43", "bytes 16-31/43", "bytes 32-42/43"},
+		},
+		{
+			name:    "buffered chunks",
+			storage: &fakeStorage{},
+			reader:  func() io.Reader { return onlyReader{bytes.NewReader(content)} },
+			opts:    UploadOpts{ChunkSize: 16},
+			puts:    []string{"bytes 0-15/43", "bytes 16-31/43", "bytes 32-42/43"},
+		},
+		{
+			name: "retries",
+			storage: &fakeStorage{fail: func(n int) int {
+				return map[int]int{1: 503, 3: 429}[n]
+			}},
+			reader: func() io.Reader { return onlyReader{bytes.NewReader(content)} },
+			opts:   UploadOpts{ChunkSize: 32},
+			puts:   []string{"bytes 0-31/43", "bytes 0-31/43", "bytes 32-42/43", "bytes 32-42/43"},
+		},
+		{
+			name:    "partially persisted chunks",
+			storage: &fakeStorage{persistHalf: true},
+			reader:  func() io.Reader { return onlyReader{bytes.NewReader(content)} },
+			opts:    UploadOpts{ChunkSize: 20},
+			puts:    []string{"bytes 0-19/43", "bytes 10-29/43", "bytes 20-39/43", "bytes 30-42/43"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+			server := httptest.NewServer(test.storage)
+			defer server.Close()
+
+			var lastSent, lastTotal int64
+			test.opts.FileName = "fox.txt"
+			test.opts.RetryWaitMin = time.Millisecond
+			test.opts.Progress = func(sent, total int64) {
+				lastSent, lastTotal = sent, total
+			}
+			upload, err := UploadReader(context.Background(), newTestHTTPClient(server.URL), test.reader(), size, test.opts)
+			require.NoError(err)
+			require.Equal("upl123", upload.ID)
+			require.Equal("fox.txt", upload.FileName)
+			require.Equal(string(content), string(test.storage.content))
+			require.Equal(test.puts, test.storage.puts)
+			require.Equal(size, lastSent)
+			require.Equal(size, lastTotal)
+		})
+	}
+}
+
+func TestUploadReaderErrors(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("client errors are not retried", func(t *testing.T) {
+		require := require.New(t)
+		storage := &fakeStorage{fail: func(int) int { return 403 }}
+		server := httptest.NewServer(storage)
+		defer server.Close()
+
+		_, err := UploadReader(ctx, newTestHTTPClient(server.URL), strings.NewReader("abc"), 3, UploadOpts{})
+		var errsc libhttp.ErrStatusCode
+		require.ErrorAs(err, &errsc)
+		require.Equal(403, errsc.StatusCode)
+		require.Equal("storage error", errsc.Msg)
+		require.Len(storage.puts, 1)
+	})
+
+	t.Run("retries are limited", func(t *testing.T) {
+		require := require.New(t)
+		storage := &fakeStorage{fail: func(int) int { return 500 }}
+		server := httptest.NewServer(storage)
+		defer server.Close()
+
+		_, err := UploadReader(ctx, newTestHTTPClient(server.URL), strings.NewReader("abc"), 3, UploadOpts{
+			MaxRetries:   2,
+			RetryWaitMin: time.Millisecond,
+		})
+		var errsc libhttp.ErrStatusCode
+		require.ErrorAs(err, &errsc)
+		require.Equal(500, errsc.StatusCode)
+		require.Len(storage.puts, 3)
+	})
+
+	t.Run("short reader", func(t *testing.T) {
+		require := require.New(t)
+		server := httptest.NewServer(&fakeStorage{})
+		defer server.Close()
+
+		_, err := UploadReader(ctx, newTestHTTPClient(server.URL), onlyReader{strings.NewReader("abc")}, 10, UploadOpts{})
+		require.ErrorIs(err, io.ErrUnexpectedEOF)
+	})
+}
+
+func TestUploadFile(t *testing.T) {
+	require := require.New(t)
+
+	path := filepath.Join(t.TempDir(), "report.csv")
+	require.NoError(os.WriteFile(path, []byte("a,b\n1,2\n"), 0644))
+
+	storage := &fakeStorage{}
+	server := httptest.NewServer(storage)
+	defer server.Close()
+
+	upload, err := UploadFile(context.Background(), newTestHTTPClient(server.URL), path, UploadOpts{ChunkSize: 3})
+	require.NoError(err)
+	require.Equal("report.csv", upload.FileName)
+	require.Equal(8, upload.SizeBytes)
+	require.Equal("a,b\n1,2\n", string(storage.content))
+	require.Len(storage.puts, 3)
+}
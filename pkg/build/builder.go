@@ -5,8 +5,8 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"text/template"
 	"unicode"
@@ -16,7 +16,6 @@ import (
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
 	dockerJSONMessage "github.com/docker/docker/pkg/jsonmessage"
-	"github.com/mattn/go-isatty"
 	"github.com/pkg/errors"
 )
 
@@ -30,6 +29,13 @@ type ImageBuilder interface {
 type RegistryAuth struct {
 	Token string
 	Repo  string
+
+	// Credentials provides the credentials of the registries that base images are pulled
+	// from and that images are pushed to, e.g. DockerConfigCredentials.
+	//
+	// If nil, Token is used for the registry of Repo, as the "oauth2accesstoken" user that
+	// Google's registries expect.
+	Credentials CredentialProvider
 }
 
 // Response represents a build response.
@@ -37,6 +43,9 @@ type Response struct {
 	ImageURL string
 	// Optional, only if applicable
 	BuildID string
+	// Fingerprint is the content-addressed key of the build's inputs, see Fingerprint. If an
+	// image was already built with the same fingerprint, it can be reused instead.
+	Fingerprint string
 }
 
 // Host returns the registry hostname.
@@ -71,6 +80,20 @@ type LocalConfig struct {
 
 	// BuildArgs is a map of build-time environment variables to use.
 	BuildArgs map[string]string
+
+	// BuildKit, if set, builds images with BuildKit instead of the legacy builder.
+	BuildKit *BuildKitOptions
+
+	// Platforms are the platforms to build the image for. If empty, DefaultPlatforms is used.
+	//
+	// Images for multiple platforms are built with BuildKit and pushed as a multi-platform
+	// image during Build, since they can't be loaded into the Docker daemon. This requires
+	// Auth to be set.
+	Platforms []Platform
+
+	// EventSink receives the events of builds and pushes. If nil, the events are written
+	// to os.Stderr.
+	EventSink EventSink
 }
 
 type DockerfileConfig struct {
@@ -78,16 +101,42 @@ type DockerfileConfig struct {
 	Root         string
 	Options      KindOptions
 	BuildArgKeys []string
+	// CacheMounts adds BuildKit cache and secret mounts to package installs. The resulting
+	// Dockerfile can only be built with BuildKit.
+	CacheMounts bool
+	// BuildKit is true if the image is built with BuildKit. Go tasks are then compiled on the
+	// platform of the build host and cross-compiled for the target platform. The resulting
+	// Dockerfile can only be built with BuildKit.
+	BuildKit bool
+	// Platforms are the platforms that the image is built for. If empty, DefaultPlatforms
+	// is used.
+	Platforms []Platform
+}
+
+// dockerfileOptions are the options of a generated Dockerfile that depend on how the image is
+// built, rather than on the task.
+type dockerfileOptions struct {
+	// CacheMounts adds BuildKit cache and secret mounts to package installs.
+	CacheMounts bool
+	// BuildKit is true if the image is built with BuildKit, which sets the platform build
+	// args, e.g. $BUILDPLATFORM, that cross-compiling stages need.
+	BuildKit bool
+	// Platforms are the platforms that the image is built for.
+	Platforms []Platform
 }
 
 // Builder implements an image builder.
 type Builder struct {
-	root     string
-	name     string
-	options  KindOptions
-	auth     *RegistryAuth
-	buildEnv map[string]string
-	client   *client.Client
+	root      string
+	name      string
+	options   KindOptions
+	auth      *RegistryAuth
+	buildEnv  map[string]string
+	buildKit  *BuildKitOptions
+	platforms []Platform
+	events    EventSink
+	client    *client.Client
+	pushed    pushedImages
 }
 
 // New returns a new local builder with c.
@@ -104,6 +153,14 @@ func New(c LocalConfig) (*Builder, *client.Client, error) {
 		c.Options = KindOptions{}
 	}
 
+	platforms, err := validatePlatforms(c.Platforms)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(platforms) > 1 && c.Auth == nil {
+		return nil, nil, errors.New("build: building for multiple platforms requires registry auth")
+	}
+
 	client, err := client.NewClientWithOpts(
 		client.FromEnv,
 		client.WithAPIVersionNegotiation(),
@@ -113,12 +170,15 @@ func New(c LocalConfig) (*Builder, *client.Client, error) {
 	}
 
 	return &Builder{
-		root:     c.Root,
-		name:     c.Builder,
-		options:  c.Options,
-		auth:     c.Auth,
-		buildEnv: c.BuildArgs,
-		client:   client,
+		root:      c.Root,
+		name:      c.Builder,
+		options:   c.Options,
+		auth:      c.Auth,
+		buildEnv:  c.BuildArgs,
+		buildKit:  c.BuildKit,
+		platforms: platforms,
+		events:    c.EventSink,
+		client:    client,
 	}, client, nil
 }
 
@@ -153,18 +213,13 @@ func (b *Builder) Build(ctx context.Context, taskID, version string) (*Response,
 	}
 	defer tree.Close()
 
-	var buildEnvKeys []string
-	for k := range b.buildEnv {
-		buildEnvKeys = append(buildEnvKeys, k)
+	dockerfile, err := b.dockerfile()
+	if err != nil {
+		return nil, err
 	}
-	dockerfile, err := BuildDockerfile(DockerfileConfig{
-		Builder:      b.name,
-		Root:         b.root,
-		Options:      b.options,
-		BuildArgKeys: buildEnvKeys,
-	})
+	fingerprint, err := b.fingerprint(ctx, dockerfile)
 	if err != nil {
-		return nil, errors.Wrap(err, "creating dockerfile")
+		return nil, err
 	}
 
 	dockerfilePath := ".airplane/Dockerfile"
@@ -179,6 +234,39 @@ func (b *Builder) Build(ctx context.Context, taskID, version string) (*Response,
 		return nil, err
 	}
 
+	authConfigs, err := b.authconfigs(ctx, dockerfile, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.usesBuildKit() {
+		var opts BuildKitOptions
+		if b.buildKit != nil {
+			opts = *b.buildKit
+		}
+		push := len(b.platforms) > 1
+		if err := buildWithBuildKit(ctx, b.client, buildKitBuild{
+			ContextDir:     tree.Dir(),
+			DockerfilePath: dockerfilePath,
+			Tag:            uri,
+			Platforms:      b.platforms,
+			Push:           push,
+			BuildArgs:      b.buildEnv,
+			AuthConfigs:    authConfigs,
+			Options:        opts,
+			Events:         b.events,
+		}); err != nil {
+			return nil, err
+		}
+		if push {
+			b.pushed.add(uri)
+		}
+		return &Response{
+			ImageURL:    uri,
+			Fingerprint: fingerprint,
+		}, nil
+	}
+
 	bc, err := tree.Archive()
 	if err != nil {
 		return nil, err
@@ -195,8 +283,8 @@ func (b *Builder) Build(ctx context.Context, taskID, version string) (*Response,
 		Dockerfile:  dockerfilePath,
 		Tags:        []string{uri},
 		BuildArgs:   buildArgs,
-		Platform:    "linux/amd64",
-		AuthConfigs: b.authconfigs(),
+		Platform:    string(b.platforms[0]),
+		AuthConfigs: authConfigs,
 	}
 
 	resp, err := b.client.ImageBuild(ctx, bc, opts)
@@ -205,6 +293,7 @@ func (b *Builder) Build(ctx context.Context, taskID, version string) (*Response,
 	}
 	defer resp.Body.Close()
 
+	events := newDockerMessages(eventSinkOrDefault(b.events))
 	scanner := bufiox.NewScanner(resp.Body)
 	for scanner.Scan() {
 		var event *dockerJSONMessage.JSONMessage
@@ -212,26 +301,95 @@ func (b *Builder) Build(ctx context.Context, taskID, version string) (*Response,
 			return nil, errors.Wrap(err, "unmarshalling docker build event")
 		}
 
-		if err := event.Display(os.Stderr, isatty.IsTerminal(os.Stderr.Fd())); err != nil {
+		if err := events.handle(event); err != nil {
 			return nil, errors.Wrap(err, "docker build")
 		}
 	}
 	if err := scanner.Err(); err != nil {
 		return nil, errors.Wrap(err, "scanning")
 	}
+	events.done()
 
 	return &Response{
-		ImageURL: uri,
+		ImageURL:    uri,
+		Fingerprint: fingerprint,
 	}, nil
 }
 
-// Push pushes the given image.
+// Fingerprint returns the fingerprint of the image that Build would build, without building
+// it. It matches the Response.Fingerprint of a Build with the same inputs, as long as the tags
+// of its base images still refer to the same images.
+func (b *Builder) Fingerprint(ctx context.Context) (string, error) {
+	dockerfile, err := b.dockerfile()
+	if err != nil {
+		return "", err
+	}
+	return b.fingerprint(ctx, dockerfile)
+}
+
+func (b *Builder) dockerfile() (string, error) {
+	var buildEnvKeys []string
+	for k := range b.buildEnv {
+		buildEnvKeys = append(buildEnvKeys, k)
+	}
+	sort.Strings(buildEnvKeys)
+	dockerfile, err := BuildDockerfile(DockerfileConfig{
+		Builder:      b.name,
+		Root:         b.root,
+		Options:      b.options,
+		BuildArgKeys: buildEnvKeys,
+		CacheMounts:  b.buildKit != nil,
+		BuildKit:     b.usesBuildKit(),
+		Platforms:    b.platforms,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "creating dockerfile")
+	}
+	return dockerfile, nil
+}
+
+// usesBuildKit returns true if images are built with BuildKit rather than with the legacy
+// builder, which can't build for multiple platforms.
+func (b *Builder) usesBuildKit() bool {
+	return b.buildKit != nil || len(b.platforms) > 1
+}
+
+// fingerprint returns the fingerprint of a build of `dockerfile`. The base images of the
+// Dockerfile that aren't pinned to a digest are resolved against their registry.
+func (b *Builder) fingerprint(ctx context.Context, dockerfile string) (string, error) {
+	digests, err := resolveBaseImages(ctx, b.client, b.auth, dockerfile)
+	if err != nil {
+		return "", err
+	}
+	fingerprint, err := Fingerprint(FingerprintInputs{
+		Root:             b.root,
+		Dockerfile:       dockerfile,
+		BaseImageDigests: digests,
+		Options:          b.options,
+		BuildArgs:        b.buildEnv,
+		Platforms:        b.platforms,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "computing fingerprint")
+	}
+	return fingerprint, nil
+}
+
+// Push pushes the given image. Multi-platform images are pushed during Build, so pushing them
+// again is a no-op.
 func (b *Builder) Push(ctx context.Context, uri string) error {
 	if b.auth == nil {
 		return errors.New("push requires registry auth")
 	}
+	if b.pushed.has(uri) {
+		return nil
+	}
 
-	authjson, err := json.Marshal(b.registryAuth())
+	auth, err := b.registryAuth(ctx, uri)
+	if err != nil {
+		return err
+	}
+	authjson, err := json.Marshal(auth)
 	if err != nil {
 		return err
 	}
@@ -244,6 +402,7 @@ func (b *Builder) Push(ctx context.Context, uri string) error {
 	}
 	defer resp.Close()
 
+	events := newDockerMessages(eventSinkOrDefault(b.events))
 	scanner := bufiox.NewScanner(resp)
 	for scanner.Scan() {
 		var event *dockerJSONMessage.JSONMessage
@@ -251,34 +410,29 @@ func (b *Builder) Push(ctx context.Context, uri string) error {
 			return errors.Wrap(err, "unmarshalling docker build event")
 		}
 
-		if err := event.Display(os.Stderr, isatty.IsTerminal(os.Stderr.Fd())); err != nil {
+		if err := events.handle(event); err != nil {
 			return errors.Wrap(err, "docker push")
 		}
 	}
 	if err := scanner.Err(); err != nil {
 		return errors.Wrap(err, "scanning")
 	}
+	events.done()
 
 	return nil
 }
 
-// RegistryAuth returns the registry auth.
-func (b *Builder) registryAuth() types.AuthConfig {
-	return types.AuthConfig{
-		Username: "oauth2accesstoken",
-		Password: b.auth.Token,
-	}
+// registryAuth returns the registry auth to push `uri` with.
+func (b *Builder) registryAuth(ctx context.Context, uri string) (types.AuthConfig, error) {
+	return pushAuthConfig(ctx, b.auth, uri)
 }
 
-// Authconfigs returns the authconfigs to use.
-func (b *Builder) authconfigs() map[string]types.AuthConfig {
-	if b.auth == nil {
-		return map[string]types.AuthConfig{}
-	}
-
-	return map[string]types.AuthConfig{
-		b.auth.host(): b.registryAuth(),
-	}
+// authconfigs returns the authconfigs to pull the base images of `dockerfile`, to push
+// `uri` and to access the registry caches of the build with.
+func (b *Builder) authconfigs(ctx context.Context, dockerfile, uri string) (map[string]types.AuthConfig, error) {
+	images := append(baseImages(dockerfile), uri)
+	images = append(images, b.buildKit.cacheRefs()...)
+	return registryAuthConfigs(ctx, b.auth, images...)
 }
 
 // SanitizeID sanitizes the given ID.
@@ -307,6 +461,7 @@ const (
 	NamePython Name = "python"
 	NameNode   Name = "node"
 	NameShell  Name = "shell"
+	NameGo     Name = "go"
 	NameView   Name = "view"
 
 	NameSQL     Name = "sql"
@@ -316,7 +471,7 @@ const (
 
 func NeedsBuilding(kind TaskKind) (bool, error) {
 	switch Name(kind) {
-	case NamePython, NameNode, NameShell:
+	case NamePython, NameNode, NameShell, NameGo:
 		return true, nil
 	case NameImage, NameSQL, NameREST, NameBuiltin:
 		return false, nil
@@ -328,13 +483,27 @@ func NeedsBuilding(kind TaskKind) (bool, error) {
 func BuildDockerfile(c DockerfileConfig) (string, error) {
 	switch Name(c.Builder) {
 	case NamePython:
-		return python(c.Root, c.Options, c.BuildArgKeys)
+		return python(c.Root, c.Options, c.BuildArgKeys, dockerfileOptions{
+			CacheMounts: c.CacheMounts,
+			Platforms:   c.Platforms,
+		})
 	case NameNode:
-		return node(c.Root, c.Options, c.BuildArgKeys)
+		return node(c.Root, c.Options, c.BuildArgKeys, dockerfileOptions{
+			CacheMounts: c.CacheMounts,
+			Platforms:   c.Platforms,
+		})
 	case NameShell:
 		return shell(c.Root, c.Options)
+	case NameGo:
+		return golang(c.Root, c.Options, c.BuildArgKeys, dockerfileOptions{
+			CacheMounts: c.CacheMounts,
+			BuildKit:    c.BuildKit,
+			Platforms:   c.Platforms,
+		})
 	case NameView:
-		return view(c.Root, c.Options)
+		return view(c.Root, c.Options, dockerfileOptions{
+			Platforms: c.Platforms,
+		})
 	default:
 		return "", errors.Errorf("build: unknown builder type %q", c.Builder)
 	}
@@ -161,6 +161,24 @@ func RunTests(tt *testing.T, ctx context.Context, tests []Test) {
 							})
 							require.True(strings.Contains(string(out), testRun.SearchString), "unable to find %q in output:\n%s", test.SearchString, string(out))
 						}
+					case GoBuildType:
+						for _, testRun := range test.BundleRuns {
+							entrypoint := []string{GoBinaryPath(testRun.RelEntrypoint)}
+							if testRun.ExportName != "" {
+								entrypoint = append(entrypoint, testRun.ExportName)
+							}
+							out := runTask(t, ctx, client, runTaskConfig{
+								Image:       resp.ImageURL,
+								ParamValues: test.ParamValues,
+								Entrypoint:  entrypoint,
+								Kind:        test.Kind,
+							})
+							ss := testRun.SearchString
+							if ss == "" {
+								ss = test.SearchString
+							}
+							require.True(strings.Contains(string(out), ss), "unable to find %q in output:\n%s", ss, string(out))
+						}
 					default:
 						require.Fail("bundle tests are not available for build context type")
 					}
@@ -0,0 +1,489 @@
+package build
+
+import (
+	"context"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+
+	dockerconfig "github.com/docker/cli/cli/config"
+	"github.com/docker/cli/cli/config/configfile"
+	clitypes "github.com/docker/cli/cli/config/types"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	dockerJSONMessage "github.com/docker/docker/pkg/jsonmessage"
+	bkclient "github.com/moby/buildkit/client"
+	"github.com/moby/buildkit/session"
+	"github.com/moby/buildkit/session/auth/authprovider"
+	"github.com/moby/buildkit/session/secrets/secretsprovider"
+	"github.com/pkg/errors"
+	"golang.org/x/sync/errgroup"
+)
+
+// BuildKitOptions configures builds that run through BuildKit, rather than through the Docker
+// daemon's legacy image build API.
+//
+// BuildKit builds support importing and exporting the build cache, so that repeat builds of
+// unchanged tasks can skip most steps, even on machines that haven't built them before. The
+// generated Dockerfiles also use cache mounts for package managers (npm, yarn and pip), so
+// that dependencies are only downloaded once when they do change.
+type BuildKitOptions struct {
+	// Address is the address of the BuildKit daemon to build with, e.g.
+	// "unix:///run/buildkit/buildkitd.sock" or "tcp://buildkitd:1234".
+	//
+	// If empty, the BuildKit that is built into the Docker daemon is used. It can only export
+	// inline caches, and can't build images for multiple platforms.
+	Address string
+
+	// CacheFrom are the caches to import.
+	CacheFrom []BuildCache
+
+	// CacheTo are the caches to export the build cache to once the build finishes.
+	CacheTo []BuildCache
+
+	// Secrets are made available to the build without being stored in the image. See
+	// BuildSecret.
+	Secrets []BuildSecret
+}
+
+// cacheRefs returns the image references of the registry caches that the build imports
+// or exports, which need registry credentials like the images that the build pulls.
+func (o *BuildKitOptions) cacheRefs() []string {
+	if o == nil {
+		return nil
+	}
+	var refs []string
+	for _, c := range append(append([]BuildCache{}, o.CacheFrom...), o.CacheTo...) {
+		if c.Type == BuildCacheTypeRegistry && c.Ref != "" {
+			refs = append(refs, c.Ref)
+		}
+	}
+	return refs
+}
+
+type BuildCacheType string
+
+const (
+	// BuildCacheTypeLocal stores the cache in a local directory.
+	BuildCacheTypeLocal BuildCacheType = "local"
+	// BuildCacheTypeRegistry stores the cache as a separate image in a registry.
+	BuildCacheTypeRegistry BuildCacheType = "registry"
+	// BuildCacheTypeInline embeds the cache in the built image. It can only be exported, and
+	// is imported with a registry cache that references a pushed image.
+	BuildCacheTypeInline BuildCacheType = "inline"
+)
+
+// BuildCache is a BuildKit cache source or destination.
+type BuildCache struct {
+	Type BuildCacheType
+
+	// Dir is the directory of a local cache.
+	Dir string
+
+	// Ref is the image reference of a registry cache, e.g. "us-docker.pkg.dev/repo/cache:main".
+	Ref string
+
+	// Mode is the cache export mode: "min" only exports the layers of the final image, while
+	// "max" exports the layers of every intermediate step, including the dependency installs.
+	//
+	// Ignored when importing. If empty, defaults to "max".
+	Mode string
+}
+
+// entry returns the BuildKit cache import or export of the cache.
+func (c BuildCache) entry(export bool) (bkclient.CacheOptionsEntry, error) {
+	entry := bkclient.CacheOptionsEntry{Type: string(c.Type), Attrs: map[string]string{}}
+	switch c.Type {
+	case BuildCacheTypeLocal:
+		if c.Dir == "" {
+			return bkclient.CacheOptionsEntry{}, errors.New("local build cache requires a directory")
+		}
+		if export {
+			entry.Attrs["dest"] = c.Dir
+		} else {
+			entry.Attrs["src"] = c.Dir
+		}
+	case BuildCacheTypeRegistry:
+		if c.Ref == "" {
+			return bkclient.CacheOptionsEntry{}, errors.New("registry build cache requires an image reference")
+		}
+		entry.Attrs["ref"] = c.Ref
+	case BuildCacheTypeInline:
+		if !export {
+			return bkclient.CacheOptionsEntry{}, errors.New("inline build cache can only be exported: import it with a registry cache instead")
+		}
+		return entry, nil
+	default:
+		return bkclient.CacheOptionsEntry{}, errors.Errorf("unknown build cache type %q", c.Type)
+	}
+
+	if export {
+		mode := c.Mode
+		if mode == "" {
+			mode = "max"
+		}
+		if mode != "min" && mode != "max" {
+			return bkclient.CacheOptionsEntry{}, errors.Errorf("unknown build cache mode %q", mode)
+		}
+		entry.Attrs["mode"] = mode
+	}
+	return entry, nil
+}
+
+const (
+	// NPMRCSecretID is the ID of a build secret that, if set, is mounted as the `.npmrc` of
+	// npm and yarn installs. Prefer it over the BUILD_NPM_RC build arg, which is stored in the
+	// image's history.
+	NPMRCSecretID = "npmrc"
+	// PipConfSecretID is the ID of a build secret that, if set, is mounted as the global
+	// pip.conf of pip installs, e.g. to configure credentials for a private index.
+	PipConfSecretID = "pipconf"
+	// NetrcSecretID is the ID of a build secret that, if set, is mounted as the `.netrc` of
+	// Go module downloads, e.g. to fetch private modules.
+	NetrcSecretID = "netrc"
+)
+
+// BuildSecret is a secret that is made available to the build without being stored in the
+// image. Dockerfile steps can read it by mounting it with `RUN --mount=type=secret,id=<ID>`.
+//
+// Exactly one of Src or Env must be set.
+type BuildSecret struct {
+	ID string
+	// Src is the path of a file that contains the secret.
+	Src string
+	// Env is the name of an environment variable that contains the secret.
+	Env string
+}
+
+func (s BuildSecret) source() (secretsprovider.Source, error) {
+	if s.ID == "" {
+		return secretsprovider.Source{}, errors.New("build secret requires an ID")
+	}
+	if (s.Src == "") == (s.Env == "") {
+		return secretsprovider.Source{}, errors.Errorf("build secret %q requires exactly one of a source file or an environment variable", s.ID)
+	}
+	return secretsprovider.Source{ID: s.ID, FilePath: s.Src, Env: s.Env}, nil
+}
+
+var (
+	npmInstallRegexp  = regexp.MustCompile(`\bnpm (install|ci)\b`)
+	yarnInstallRegexp = regexp.MustCompile(`\byarn( install)?( |$)`)
+	pnpmInstallRegexp = regexp.MustCompile(`\bpnpm (install|i)\b`)
+	pipInstallRegexp  = regexp.MustCompile(`\bpip3? install\b`)
+	poetryRegexp      = regexp.MustCompile(`\bpoetry install\b`)
+	pipenvRegexp      = regexp.MustCompile(`\bpipenv install\b`)
+	goModRegexp       = regexp.MustCompile(`\bgo (mod download|build)\b`)
+)
+
+// runMounts returns the `--mount` flags of a RUN step that runs `cmd`, so that package
+// managers keep their download cache across builds and can read their credentials from
+// build secrets. It returns an empty string if `cmd` doesn't install packages.
+func runMounts(cmd string) string {
+	var mounts []string
+	npm := npmInstallRegexp.MatchString(cmd) || yarnInstallRegexp.MatchString(cmd)
+	pnpm := pnpmInstallRegexp.MatchString(cmd)
+	if npm {
+		mounts = append(mounts,
+			"--mount=type=cache,id=airplane-npm,target=/root/.npm",
+			"--mount=type=cache,id=airplane-yarn,target=/usr/local/share/.cache/yarn",
+			"--mount=type=cache,id=airplane-yarn-berry,target=/root/.yarn/berry/cache",
+		)
+	}
+	if pnpm {
+		mounts = append(mounts, "--mount=type=cache,id=airplane-pnpm,target=/root/.local/share/pnpm/store")
+	}
+	if npm || pnpm {
+		mounts = append(mounts, "--mount=type=secret,id="+NPMRCSecretID+",target=/root/.npmrc,required=false")
+	}
+	if pipInstallRegexp.MatchString(cmd) {
+		mounts = append(mounts,
+			"--mount=type=cache,id=airplane-pip,target=/root/.cache/pip",
+			"--mount=type=secret,id="+PipConfSecretID+",target=/etc/pip.conf,required=false",
+		)
+	}
+	if poetryRegexp.MatchString(cmd) {
+		mounts = append(mounts, "--mount=type=cache,id=airplane-poetry,target=/root/.cache/pypoetry")
+	}
+	if pipenvRegexp.MatchString(cmd) {
+		mounts = append(mounts, "--mount=type=cache,id=airplane-pipenv,target=/root/.cache/pipenv")
+	}
+	if goModRegexp.MatchString(cmd) {
+		mounts = append(mounts,
+			"--mount=type=cache,id=airplane-go-mod,target=/go/pkg/mod",
+			"--mount=type=cache,id=airplane-go-build,target=/root/.cache/go-build",
+			"--mount=type=secret,id="+NetrcSecretID+",target=/root/.netrc,required=false",
+		)
+	}
+	if len(mounts) == 0 {
+		return ""
+	}
+	return strings.Join(mounts, " ") + " "
+}
+
+// withRunMounts adds cache and secret mounts to the package installs in `cmd`. See runMounts.
+func withRunMounts(cmd string) string {
+	mounts := runMounts(cmd)
+	if mounts == "" {
+		return cmd
+	}
+	// The yarn cache is kept in a cache mount rather than in the image, so there's nothing
+	// to clean, and cleaning it would throw away the cache.
+	cmd = strings.TrimSuffix(cmd, " && yarn cache clean")
+	return mounts + cmd
+}
+
+// withRunMounts adds cache and secret mounts to the package installs of the instructions.
+func (i BuildInstructions) withRunMounts() BuildInstructions {
+	instructions := make([]InstallInstruction, len(i.InstallInstructions))
+	for j, ii := range i.InstallInstructions {
+		if ii.Cmd != "" {
+			ii.Cmd = withRunMounts(ii.Cmd)
+		}
+		instructions[j] = ii
+	}
+	i.InstallInstructions = instructions
+	return i
+}
+
+// pushedImages tracks the images that were pushed while they were built. It is safe for
+// concurrent use.
+type pushedImages struct {
+	mu   sync.Mutex
+	uris map[string]bool
+}
+
+func (p *pushedImages) add(uri string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.uris == nil {
+		p.uris = map[string]bool{}
+	}
+	p.uris[uri] = true
+}
+
+func (p *pushedImages) has(uri string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.uris[uri]
+}
+
+// buildKitBuild describes a single BuildKit build.
+type buildKitBuild struct {
+	// ContextDir is the directory of the build context.
+	ContextDir     string
+	DockerfilePath string
+	Tag            string
+	Platforms      []Platform
+	Target         string
+	// Push pushes the image to its registry instead of loading it into the Docker daemon,
+	// which is required for multi-platform images.
+	Push        bool
+	BuildArgs   map[string]string
+	AuthConfigs map[string]types.AuthConfig
+	Options     BuildKitOptions
+	// Events receives the events of the build. If nil, they are written to os.Stderr.
+	Events EventSink
+}
+
+// solveOpt returns the options of the BuildKit solve that runs the build. Unless the image is
+// pushed or built by the Docker daemon's BuildKit, it is exported as a Docker image tarball to
+// `load`.
+func (b buildKitBuild) solveOpt(load io.WriteCloser) (bkclient.SolveOpt, error) {
+	daemon := b.Options.Address == ""
+	opt := bkclient.SolveOpt{
+		Frontend: "dockerfile.v0",
+		FrontendAttrs: map[string]string{
+			"filename": b.DockerfilePath,
+			"platform": platformsString(b.Platforms),
+		},
+		LocalDirs: map[string]string{
+			"context":    b.ContextDir,
+			"dockerfile": b.ContextDir,
+		},
+	}
+	if b.Target != "" {
+		opt.FrontendAttrs["target"] = b.Target
+	}
+	for k, v := range b.BuildArgs {
+		opt.FrontendAttrs["build-arg:"+k] = v
+	}
+
+	switch {
+	case b.Push && daemon:
+		return bkclient.SolveOpt{}, errors.New("building for multiple platforms requires a BuildKit daemon: set BuildKitOptions.Address")
+	case b.Push:
+		opt.Exports = []bkclient.ExportEntry{{
+			Type:  bkclient.ExporterImage,
+			Attrs: map[string]string{"name": b.Tag, "push": "true"},
+		}}
+	case daemon:
+		// The Docker daemon's BuildKit stores the image in the daemon directly.
+		opt.Exports = []bkclient.ExportEntry{{
+			Type:  "moby",
+			Attrs: map[string]string{"name": b.Tag},
+		}}
+	default:
+		opt.Exports = []bkclient.ExportEntry{{
+			Type:  bkclient.ExporterDocker,
+			Attrs: map[string]string{"name": b.Tag},
+			Output: func(map[string]string) (io.WriteCloser, error) {
+				return load, nil
+			},
+		}}
+	}
+
+	for _, c := range b.Options.CacheFrom {
+		entry, err := c.entry(false)
+		if err != nil {
+			return bkclient.SolveOpt{}, err
+		}
+		opt.CacheImports = append(opt.CacheImports, entry)
+	}
+	for _, c := range b.Options.CacheTo {
+		entry, err := c.entry(true)
+		if err != nil {
+			return bkclient.SolveOpt{}, err
+		}
+		if daemon && c.Type != BuildCacheTypeInline {
+			return bkclient.SolveOpt{}, errors.Errorf("exporting a %s build cache requires a BuildKit daemon: set BuildKitOptions.Address", c.Type)
+		}
+		opt.CacheExports = append(opt.CacheExports, entry)
+	}
+
+	var sources []secretsprovider.Source
+	for _, s := range b.Options.Secrets {
+		source, err := s.source()
+		if err != nil {
+			return bkclient.SolveOpt{}, err
+		}
+		sources = append(sources, source)
+	}
+	secrets, err := secretsprovider.NewStore(sources)
+	if err != nil {
+		return bkclient.SolveOpt{}, errors.Wrap(err, "loading build secrets")
+	}
+	config, err := dockerConfigWithAuth(b.AuthConfigs)
+	if err != nil {
+		return bkclient.SolveOpt{}, err
+	}
+	opt.Session = []session.Attachable{
+		authprovider.NewDockerAuthProvider(config),
+		secretsprovider.NewSecretProvider(secrets),
+	}
+	return opt, nil
+}
+
+// newBuildKitClient connects to the BuildKit daemon at `address`, or to the Docker daemon's
+// BuildKit through the Engine API if `address` is empty.
+func newBuildKitClient(ctx context.Context, docker *client.Client, address string) (*bkclient.Client, error) {
+	var opts []bkclient.ClientOpt
+	if address == "" {
+		opts = append(opts,
+			bkclient.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return docker.DialHijack(ctx, "/grpc", "h2c", nil)
+			}),
+			bkclient.WithSessionDialer(func(ctx context.Context, proto string, meta map[string][]string) (net.Conn, error) {
+				return docker.DialHijack(ctx, "/session", proto, meta)
+			}),
+		)
+	}
+	c, err := bkclient.New(ctx, address, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "connecting to buildkit")
+	}
+	return c, nil
+}
+
+// buildWithBuildKit runs a build with BuildKit. Images that aren't pushed end up in the Docker
+// daemon, like images built by the legacy builder.
+func buildWithBuildKit(ctx context.Context, docker *client.Client, b buildKitBuild) error {
+	c, err := newBuildKitClient(ctx, docker, b.Options.Address)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	pr, pw := io.Pipe()
+	opt, err := b.solveOpt(pw)
+	if err != nil {
+		return err
+	}
+
+	eg, egctx := errgroup.WithContext(ctx)
+	statuses := make(chan *bkclient.SolveStatus)
+	eg.Go(func() error {
+		_, err := c.Solve(egctx, nil, opt, statuses)
+		// Solve only closes the export's writer if it succeeded.
+		_ = pw.CloseWithError(err)
+		return errors.Wrap(err, "buildkit build")
+	})
+	if opt.Exports[0].Type == bkclient.ExporterDocker {
+		eg.Go(func() error {
+			err := loadImage(egctx, docker, pr)
+			_ = pr.CloseWithError(err)
+			return err
+		})
+	}
+
+	// Statuses are handled on this goroutine, so that events are sent from the goroutine that
+	// called Build, as EventSink promises. Solve closes the channel once it returns.
+	trace := newBuildKitTrace(eventSinkOrDefault(b.Events))
+	for status := range statuses {
+		trace.handle(status)
+	}
+	if err := eg.Wait(); err != nil {
+		trace.fail(err.Error())
+		return err
+	}
+	return nil
+}
+
+// loadImage loads a Docker image tarball into the Docker daemon.
+func loadImage(ctx context.Context, docker *client.Client, r io.Reader) error {
+	resp, err := docker.ImageLoad(ctx, r, true)
+	if err != nil {
+		return errors.Wrap(err, "loading image")
+	}
+	defer resp.Body.Close()
+	if err := dockerJSONMessage.DisplayJSONMessagesStream(resp.Body, io.Discard, 0, false, nil); err != nil {
+		return errors.Wrap(err, "loading image")
+	}
+	return nil
+}
+
+// dockerConfigWithAuth loads the user's Docker config and adds `auths` to it. BuildKit reads
+// registry credentials from the config, through the build's session. Registries in `auths` use
+// those credentials, while the user's credential store and helpers keep serving every other
+// registry. The config is only used in memory and is never saved.
+func dockerConfigWithAuth(auths map[string]types.AuthConfig) (*configfile.ConfigFile, error) {
+	dir, err := dockerConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	config, err := dockerconfig.Load(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "loading docker config")
+	}
+
+	if config.AuthConfigs == nil {
+		config.AuthConfigs = map[string]clitypes.AuthConfig{}
+	}
+	if config.CredentialHelpers == nil {
+		config.CredentialHelpers = map[string]string{}
+	}
+	for host, auth := range auths {
+		config.AuthConfigs[host] = clitypes.AuthConfig{
+			Username:      auth.Username,
+			Password:      auth.Password,
+			ServerAddress: auth.ServerAddress,
+			IdentityToken: auth.IdentityToken,
+			RegistryToken: auth.RegistryToken,
+		}
+		// An empty helper makes Docker read the credentials of the registry from AuthConfigs,
+		// rather than from the credential store.
+		config.CredentialHelpers[host] = ""
+	}
+	return config, nil
+}
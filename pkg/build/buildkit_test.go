@@ -0,0 +1,296 @@
+package build
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/airplanedev/lib/pkg/examples"
+	"github.com/docker/docker/api/types"
+	bkclient "github.com/moby/buildkit/client"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildCacheEntry(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		cache  BuildCache
+		export bool
+		attrs  map[string]string
+		err    bool
+	}{
+		{"local import", BuildCache{Type: BuildCacheTypeLocal, Dir: "/tmp/cache"}, false, map[string]string{"src": "/tmp/cache"}, false},
+		{"local export", BuildCache{Type: BuildCacheTypeLocal, Dir: "/tmp/cache"}, true, map[string]string{"dest": "/tmp/cache", "mode": "max"}, false},
+		{"local without dir", BuildCache{Type: BuildCacheTypeLocal}, false, nil, true},
+		{"registry import", BuildCache{Type: BuildCacheTypeRegistry, Ref: "repo/cache:main", Mode: "min"}, false, map[string]string{"ref": "repo/cache:main"}, false},
+		{"registry export", BuildCache{Type: BuildCacheTypeRegistry, Ref: "repo/cache:main", Mode: "min"}, true, map[string]string{"ref": "repo/cache:main", "mode": "min"}, false},
+		{"registry without ref", BuildCache{Type: BuildCacheTypeRegistry}, true, nil, true},
+		{"inline export", BuildCache{Type: BuildCacheTypeInline}, true, map[string]string{}, false},
+		{"inline import", BuildCache{Type: BuildCacheTypeInline}, false, nil, true},
+		{"unknown mode", BuildCache{Type: BuildCacheTypeLocal, Dir: "/tmp/cache", Mode: "all"}, true, nil, true},
+		{"unknown type", BuildCache{Type: "gha"}, false, nil, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+			entry, err := test.cache.entry(test.export)
+			if test.err {
+				require.Error(err)
+				return
+			}
+			require.NoError(err)
+			require.Equal(bkclient.CacheOptionsEntry{Type: string(test.cache.Type), Attrs: test.attrs}, entry)
+		})
+	}
+}
+
+func TestBuildKitSolveOpt(t *testing.T) {
+	require := require.New(t)
+	t.Setenv("DOCKER_CONFIG", t.TempDir())
+	t.Setenv("TOKEN", "secret")
+
+	b := buildKitBuild{
+		ContextDir:     "/tmp/context",
+		DockerfilePath: ".airplane/Dockerfile",
+		Tag:            "repo/task-abc:v1",
+		Platforms:      []Platform{PlatformLinuxAMD64},
+		Target:         "task-build",
+		BuildArgs:      map[string]string{"B": "2", "A": "1"},
+		Options: BuildKitOptions{
+			Address:   "tcp://buildkitd:1234",
+			CacheFrom: []BuildCache{{Type: BuildCacheTypeLocal, Dir: "/cache"}},
+			CacheTo:   []BuildCache{{Type: BuildCacheTypeLocal, Dir: "/cache"}},
+			Secrets:   []BuildSecret{{ID: "token", Env: "TOKEN"}},
+		},
+	}
+	opt, err := b.solveOpt(nopWriteCloser{})
+	require.NoError(err)
+	require.Equal("dockerfile.v0", opt.Frontend)
+	require.Equal(map[string]string{
+		"filename":    ".airplane/Dockerfile",
+		"platform":    "linux/amd64",
+		"target":      "task-build",
+		"build-arg:A": "1",
+		"build-arg:B": "2",
+	}, opt.FrontendAttrs)
+	require.Equal(map[string]string{"context": "/tmp/context", "dockerfile": "/tmp/context"}, opt.LocalDirs)
+	require.Equal([]bkclient.CacheOptionsEntry{{Type: "local", Attrs: map[string]string{"src": "/cache"}}}, opt.CacheImports)
+	require.Equal([]bkclient.CacheOptionsEntry{{Type: "local", Attrs: map[string]string{"dest": "/cache", "mode": "max"}}}, opt.CacheExports)
+	require.Len(opt.Session, 2)
+	// The image is loaded into the Docker daemon.
+	require.Len(opt.Exports, 1)
+	require.Equal(bkclient.ExporterDocker, opt.Exports[0].Type)
+	require.Equal(map[string]string{"name": "repo/task-abc:v1"}, opt.Exports[0].Attrs)
+	require.NotNil(opt.Exports[0].Output)
+
+	b.Options.Secrets = []BuildSecret{{ID: "token", Src: "/token", Env: "TOKEN"}}
+	_, err = b.solveOpt(nopWriteCloser{})
+	require.Error(err)
+	b.Options.Secrets = []BuildSecret{{ID: "token", Src: filepath.Join(t.TempDir(), "missing")}}
+	_, err = b.solveOpt(nopWriteCloser{})
+	require.Error(err)
+	b.Options.Secrets = nil
+
+	// The Docker daemon's BuildKit stores the image itself, but can only export inline caches.
+	b.Options.Address = ""
+	_, err = b.solveOpt(nopWriteCloser{})
+	require.ErrorContains(err, "exporting a local build cache requires a BuildKit daemon")
+	b.Options.CacheTo = []BuildCache{{Type: BuildCacheTypeInline}}
+	opt, err = b.solveOpt(nopWriteCloser{})
+	require.NoError(err)
+	require.Equal([]bkclient.ExportEntry{{Type: "moby", Attrs: map[string]string{"name": "repo/task-abc:v1"}}}, opt.Exports)
+
+	// Multi-platform images can't be loaded into the daemon, so they are pushed instead.
+	b = buildKitBuild{
+		ContextDir:     "/tmp/context",
+		DockerfilePath: ".airplane/Dockerfile",
+		Tag:            "repo/task-abc:v1",
+		Platforms:      []Platform{PlatformLinuxAMD64, PlatformLinuxARM64},
+		Push:           true,
+	}
+	_, err = b.solveOpt(nopWriteCloser{})
+	require.ErrorContains(err, "requires a BuildKit daemon")
+	b.Options.Address = "unix:///run/buildkit/buildkitd.sock"
+	opt, err = b.solveOpt(nopWriteCloser{})
+	require.NoError(err)
+	require.Equal("linux/amd64,linux/arm64", opt.FrontendAttrs["platform"])
+	require.Equal([]bkclient.ExportEntry{{
+		Type:  bkclient.ExporterImage,
+		Attrs: map[string]string{"name": "repo/task-abc:v1", "push": "true"},
+	}}, opt.Exports)
+}
+
+type nopWriteCloser struct{}
+
+func (nopWriteCloser) Write(p []byte) (int, error) { return len(p), nil }
+func (nopWriteCloser) Close() error                { return nil }
+
+func TestValidatePlatforms(t *testing.T) {
+	require := require.New(t)
+
+	platforms, err := validatePlatforms(nil)
+	require.NoError(err)
+	require.Equal(DefaultPlatforms, platforms)
+
+	platforms, err = validatePlatforms([]Platform{PlatformLinuxARM64})
+	require.NoError(err)
+	require.Equal([]Platform{PlatformLinuxARM64}, platforms)
+
+	_, err = validatePlatforms([]Platform{PlatformLinuxARM64, "windows/amd64"})
+	require.ErrorContains(err, `unsupported platform "windows/amd64"`)
+
+	bc := BuildContext{Type: PythonBuildType, Version: BuildTypeVersionPython310}
+	require.True(bc.Valid())
+	bc.Platforms = []Platform{"linux/arm"}
+	require.False(bc.Valid())
+}
+
+func TestWithRunMounts(t *testing.T) {
+	require := require.New(t)
+
+	cmd := withRunMounts("yarn install --non-interactive --frozen-lockfile && yarn cache clean")
+	require.True(strings.HasPrefix(cmd, "--mount=type=cache,id=airplane-npm,target=/root/.npm "))
+	require.Contains(cmd, "--mount=type=secret,id=npmrc,target=/root/.npmrc,required=false")
+	require.True(strings.HasSuffix(cmd, " yarn install --non-interactive --frozen-lockfile"))
+
+	cmd = withRunMounts("npm ci")
+	require.Contains(cmd, "target=/root/.npm")
+	require.NotContains(cmd, "pip")
+
+	cmd = withRunMounts("npm install -g pnpm@8 && pnpm install --frozen-lockfile")
+	require.Contains(cmd, "--mount=type=cache,id=airplane-pnpm,target=/root/.local/share/pnpm/store ")
+	require.Equal(1, strings.Count(cmd, "target=/root/.npmrc"))
+
+	cmd = withRunMounts("pip install -r requirements.txt")
+	require.Equal("--mount=type=cache,id=airplane-pip,target=/root/.cache/pip --mount=type=secret,id=pipconf,target=/etc/pip.conf,required=false pip install -r requirements.txt", cmd)
+
+	cmd = withRunMounts(`pip install "poetry>=1.2,<2" && POETRY_VIRTUALENVS_CREATE=false poetry install --no-root`)
+	require.Contains(cmd, "target=/root/.cache/pip ")
+	require.Contains(cmd, "--mount=type=cache,id=airplane-poetry,target=/root/.cache/pypoetry ")
+
+	cmd = withRunMounts("pip install pipenv && pipenv install --system --deploy")
+	require.Contains(cmd, "--mount=type=cache,id=airplane-pipenv,target=/root/.cache/pipenv ")
+
+	cmd = withRunMounts("go mod download")
+	require.Equal("--mount=type=cache,id=airplane-go-mod,target=/go/pkg/mod --mount=type=cache,id=airplane-go-build,target=/root/.cache/go-build --mount=type=secret,id=netrc,target=/root/.netrc,required=false go mod download", cmd)
+
+	for _, cmd := range []string{
+		`[ -z "${BUILD_NPM_RC}" ] || echo "${BUILD_NPM_RC}" > .npmrc`,
+		"echo '{}' > /airplane/package.json",
+		"./airplane_preinstall.sh",
+	} {
+		require.Equal(cmd, withRunMounts(cmd))
+	}
+}
+
+func TestCacheMountDockerfiles(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config DockerfileConfig
+	}{
+		{
+			name: "node",
+			config: DockerfileConfig{
+				Builder: string(NameNode),
+				Root:    "javascript/simple",
+				Options: KindOptions{"shim": "true", "entrypoint": "main.js"},
+			},
+		},
+		{
+			name: "python",
+			config: DockerfileConfig{
+				Builder: string(NamePython),
+				Root:    "python/requirements",
+				Options: KindOptions{"shim": "true", "entrypoint": "main.py"},
+			},
+		},
+		{
+			name: "go",
+			config: DockerfileConfig{
+				Builder: string(NameGo),
+				Root:    "go/simple",
+				Options: KindOptions{"entrypoint": "main.go"},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+			c := test.config
+			c.Root = examples.Path(t, c.Root)
+
+			dockerfile, err := BuildDockerfile(c)
+			require.NoError(err)
+			require.NotContains(dockerfile, "--mount")
+
+			c.CacheMounts = true
+			dockerfile, err = BuildDockerfile(c)
+			require.NoError(err)
+			require.Contains(dockerfile, "RUN --mount=type=cache")
+		})
+	}
+}
+
+func TestDockerConfigWithAuth(t *testing.T) {
+	require := require.New(t)
+
+	userDir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", userDir)
+	original := `{
+		"auths": {"ghcr.io": {"auth": "Z2g6dG9rZW4="}},
+		"credsStore": "desktop",
+		"credHelpers": {"us-docker.pkg.dev": "gcloud", "gcr.io": "gcloud"}
+	}`
+	require.NoError(os.WriteFile(filepath.Join(userDir, "config.json"), []byte(original), 0600))
+
+	config, err := dockerConfigWithAuth(map[string]types.AuthConfig{
+		"us-docker.pkg.dev": {Username: "oauth2accesstoken", Password: "secret"},
+		"token.example.com": {IdentityToken: "refresh"},
+	})
+	require.NoError(err)
+
+	// The given registries use the given credentials, without going through the credential
+	// store or helpers.
+	auth, err := config.GetAuthConfig("us-docker.pkg.dev")
+	require.NoError(err)
+	require.Equal("oauth2accesstoken", auth.Username)
+	require.Equal("secret", auth.Password)
+	auth, err = config.GetAuthConfig("token.example.com")
+	require.NoError(err)
+	require.Equal("refresh", auth.IdentityToken)
+
+	// Every other registry still uses the user's credential store and helpers.
+	require.Equal("desktop", config.CredentialsStore)
+	require.Equal("gcloud", config.CredentialHelpers["gcr.io"])
+
+	// The user's config is left as is.
+	b, err := os.ReadFile(filepath.Join(userDir, "config.json"))
+	require.NoError(err)
+	require.Equal(original, string(b))
+}
+
+func TestBuildKitAuthConfigs(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	// Registry caches need credentials like the images that the build pulls.
+	b := &Builder{
+		auth: &RegistryAuth{
+			Repo: "us-docker.pkg.dev/airplane/tasks",
+			Credentials: ChainCredentials{
+				StaticCredentials{Host: "us-docker.pkg.dev", Username: "oauth2accesstoken", Password: "token"},
+				StaticCredentials{Host: "ghcr.io", Username: "gh", Password: "cache"},
+			},
+		},
+		buildKit: &BuildKitOptions{
+			CacheFrom: []BuildCache{{Type: BuildCacheTypeRegistry, Ref: "ghcr.io/airplanedev/cache:main"}},
+			CacheTo:   []BuildCache{{Type: BuildCacheTypeLocal, Dir: "/cache"}},
+		},
+	}
+	configs, err := b.authconfigs(ctx, "FROM python:3.10\n", "us-docker.pkg.dev/airplane/tasks/task-abc:v1")
+	require.NoError(err)
+	require.Equal(map[string]types.AuthConfig{
+		"us-docker.pkg.dev": {Username: "oauth2accesstoken", Password: "token", ServerAddress: "us-docker.pkg.dev"},
+		"ghcr.io":           {Username: "gh", Password: "cache", ServerAddress: "ghcr.io"},
+	}, configs)
+}
@@ -5,7 +5,6 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"os"
 	"path/filepath"
 	"strings"
 
@@ -14,8 +13,8 @@ import (
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/client"
 	dockerJSONMessage "github.com/docker/docker/pkg/jsonmessage"
-	"github.com/mattn/go-isatty"
 	controlapi "github.com/moby/buildkit/api/services/control"
+	bkclient "github.com/moby/buildkit/client"
 	"github.com/pkg/errors"
 )
 
@@ -47,6 +46,23 @@ type BundleLocalConfig struct {
 
 	// Target is the docker target to build.
 	Target string
+
+	// Platforms are the platforms to build the image for. If empty, the build context's
+	// platforms are used, which default to DefaultPlatforms.
+	//
+	// As with LocalConfig.Platforms, images for multiple platforms are pushed during Build.
+	Platforms []Platform
+
+	// BuildKit configures the build cache and secrets of the build.
+	//
+	// Bundles are always built with BuildKit. If set, the build runs through a BuildKit
+	// client, which supports cache import and export and build secrets, rather than through
+	// the Docker daemon's build API.
+	BuildKit *BuildKitOptions
+
+	// EventSink receives the events of builds and pushes. If nil, the events are written
+	// to os.Stderr.
+	EventSink EventSink
 }
 
 type BundleDockerfileConfig struct {
@@ -56,6 +72,11 @@ type BundleDockerfileConfig struct {
 	BuildArgKeys    []string
 	FilesToBuild    []string
 	FilesToDiscover []string
+	// CacheMounts adds BuildKit cache and secret mounts to package installs.
+	CacheMounts bool
+	// Platforms are the platforms that the image is built for. If empty, DefaultPlatforms
+	// is used.
+	Platforms []Platform
 }
 
 // Builder implements an image builder.
@@ -68,6 +89,10 @@ type BundleBuilder struct {
 	auth            *RegistryAuth
 	client          *client.Client
 	target          string
+	buildKit        *BuildKitOptions
+	platforms       []Platform
+	events          EventSink
+	pushed          pushedImages
 }
 
 // New returns a new local builder with c.
@@ -84,6 +109,18 @@ func NewBundleBuilder(c BundleLocalConfig) (*BundleBuilder, *client.Client, erro
 		c.Options = KindOptions{}
 	}
 
+	platforms := c.Platforms
+	if len(platforms) == 0 {
+		platforms = c.BuildContext.Platforms
+	}
+	platforms, err := validatePlatforms(platforms)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(platforms) > 1 && c.Auth == nil {
+		return nil, nil, errors.New("build: building for multiple platforms requires registry auth")
+	}
+
 	client, err := client.NewClientWithOpts(
 		client.FromEnv,
 		client.WithAPIVersionNegotiation(),
@@ -101,6 +138,9 @@ func NewBundleBuilder(c BundleLocalConfig) (*BundleBuilder, *client.Client, erro
 		auth:            c.Auth,
 		client:          client,
 		target:          c.Target,
+		buildKit:        c.BuildKit,
+		platforms:       platforms,
+		events:          c.EventSink,
 	}, client, nil
 }
 
@@ -135,15 +175,13 @@ func (b *BundleBuilder) Build(ctx context.Context, bundleBuildID, version string
 	}
 	defer tree.Close()
 
-	dockerfile, err := BuildBundleDockerfile(BundleDockerfileConfig{
-		BuildContext:    b.buildContext,
-		Root:            b.root,
-		Options:         b.options,
-		FilesToBuild:    b.filesToBuild,
-		FilesToDiscover: b.filesToDiscover,
-	})
+	dockerfile, err := b.dockerfile()
 	if err != nil {
-		return nil, errors.Wrap(err, "creating dockerfile")
+		return nil, err
+	}
+	fingerprint, err := b.fingerprint(ctx, dockerfile)
+	if err != nil {
+		return nil, err
 	}
 
 	dockerfilePath := ".airplane/Dockerfile"
@@ -158,6 +196,39 @@ func (b *BundleBuilder) Build(ctx context.Context, bundleBuildID, version string
 		return nil, err
 	}
 
+	authConfigs, err := b.authconfigs(ctx, dockerfile, uri)
+	if err != nil {
+		return nil, err
+	}
+
+	if b.buildKit != nil || len(b.platforms) > 1 {
+		var opts BuildKitOptions
+		if b.buildKit != nil {
+			opts = *b.buildKit
+		}
+		push := len(b.platforms) > 1
+		if err := buildWithBuildKit(ctx, b.client, buildKitBuild{
+			ContextDir:     tree.Dir(),
+			DockerfilePath: dockerfilePath,
+			Tag:            uri,
+			Platforms:      b.platforms,
+			Push:           push,
+			Target:         b.target,
+			AuthConfigs:    authConfigs,
+			Options:        opts,
+			Events:         b.events,
+		}); err != nil {
+			return nil, err
+		}
+		if push {
+			b.pushed.add(uri)
+		}
+		return &Response{
+			ImageURL:    uri,
+			Fingerprint: fingerprint,
+		}, nil
+	}
+
 	bc, err := tree.Archive()
 	if err != nil {
 		return nil, err
@@ -167,8 +238,8 @@ func (b *BundleBuilder) Build(ctx context.Context, bundleBuildID, version string
 	opts := types.ImageBuildOptions{
 		Dockerfile:  dockerfilePath,
 		Tags:        []string{uri},
-		Platform:    "linux/amd64",
-		AuthConfigs: b.authconfigs(),
+		Platform:    string(b.platforms[0]),
+		AuthConfigs: authConfigs,
 		Version:     types.BuilderBuildKit,
 		Target:      b.target,
 	}
@@ -179,6 +250,7 @@ func (b *BundleBuilder) Build(ctx context.Context, bundleBuildID, version string
 	}
 	defer resp.Body.Close()
 
+	events := newBuildKitTrace(eventSinkOrDefault(b.events))
 	scanner := bufiox.NewScanner(resp.Body)
 	for scanner.Scan() {
 		var msg *dockerJSONMessage.JSONMessage
@@ -189,6 +261,7 @@ func (b *BundleBuilder) Build(ctx context.Context, bundleBuildID, version string
 		var resp controlapi.StatusResponse
 
 		if msg.ErrorMessage != "" {
+			events.fail(msg.ErrorMessage)
 			return nil, errors.Wrap(errors.New(msg.ErrorMessage), "building image")
 		}
 		if msg.ID != "moby.buildkit.trace" {
@@ -204,35 +277,82 @@ func (b *BundleBuilder) Build(ctx context.Context, bundleBuildID, version string
 			continue
 		}
 
-		for _, v := range resp.GetVertexes() {
-			fmt.Fprintln(os.Stderr, v.Name)
-			if v.Cached {
-				fmt.Fprintln(os.Stderr, "CACHED")
-			}
-			if v.Error != "" {
-				fmt.Fprintln(os.Stderr, v.Error)
-			}
-		}
-		for _, l := range resp.GetLogs() {
-			fmt.Fprintln(os.Stderr, string(l.GetMsg()))
-		}
+		events.handle(bkclient.NewSolveStatus(&resp))
 	}
 	if err := scanner.Err(); err != nil {
 		return nil, errors.Wrap(err, "scanning")
 	}
 
 	return &Response{
-		ImageURL: uri,
+		ImageURL:    uri,
+		Fingerprint: fingerprint,
 	}, nil
 }
 
-// Push pushes the given image.
+// Fingerprint returns the fingerprint of the image that Build would build, without building
+// it. It matches the Response.Fingerprint of a Build with the same inputs, as long as the tags
+// of its base images still refer to the same images.
+func (b *BundleBuilder) Fingerprint(ctx context.Context) (string, error) {
+	dockerfile, err := b.dockerfile()
+	if err != nil {
+		return "", err
+	}
+	return b.fingerprint(ctx, dockerfile)
+}
+
+func (b *BundleBuilder) dockerfile() (string, error) {
+	dockerfile, err := BuildBundleDockerfile(BundleDockerfileConfig{
+		BuildContext:    b.buildContext,
+		Root:            b.root,
+		Options:         b.options,
+		FilesToBuild:    b.filesToBuild,
+		FilesToDiscover: b.filesToDiscover,
+		CacheMounts:     b.buildKit != nil,
+		Platforms:       b.platforms,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "creating dockerfile")
+	}
+	return dockerfile, nil
+}
+
+// fingerprint returns the fingerprint of a build of `dockerfile`. The base images of the
+// Dockerfile that aren't pinned to a digest are resolved against their registry.
+func (b *BundleBuilder) fingerprint(ctx context.Context, dockerfile string) (string, error) {
+	digests, err := resolveBaseImages(ctx, b.client, b.auth, dockerfile)
+	if err != nil {
+		return "", err
+	}
+	fingerprint, err := Fingerprint(FingerprintInputs{
+		Root:             b.root,
+		Dockerfile:       dockerfile,
+		BaseImageDigests: digests,
+		BuildContext:     b.buildContext,
+		Options:          b.options,
+		Platforms:        b.platforms,
+		Target:           b.target,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "computing fingerprint")
+	}
+	return fingerprint, nil
+}
+
+// Push pushes the given image. Multi-platform images are pushed during Build, so pushing them
+// again is a no-op.
 func (b *BundleBuilder) Push(ctx context.Context, uri string) error {
 	if b.auth == nil {
 		return errors.New("push requires registry auth")
 	}
+	if b.pushed.has(uri) {
+		return nil
+	}
 
-	authjson, err := json.Marshal(b.registryAuth())
+	auth, err := b.registryAuth(ctx, uri)
+	if err != nil {
+		return err
+	}
+	authjson, err := json.Marshal(auth)
 	if err != nil {
 		return err
 	}
@@ -245,6 +365,7 @@ func (b *BundleBuilder) Push(ctx context.Context, uri string) error {
 	}
 	defer resp.Close()
 
+	events := newDockerMessages(eventSinkOrDefault(b.events))
 	scanner := bufiox.NewScanner(resp)
 	for scanner.Scan() {
 		var event *dockerJSONMessage.JSONMessage
@@ -252,60 +373,79 @@ func (b *BundleBuilder) Push(ctx context.Context, uri string) error {
 			return errors.Wrap(err, "unmarshalling docker build event")
 		}
 
-		if err := event.Display(os.Stderr, isatty.IsTerminal(os.Stderr.Fd())); err != nil {
+		if err := events.handle(event); err != nil {
 			return errors.Wrap(err, "docker push")
 		}
 	}
 	if err := scanner.Err(); err != nil {
 		return errors.Wrap(err, "scanning")
 	}
+	events.done()
 
 	return nil
 }
 
-// RegistryAuth returns the registry auth.
-func (b *BundleBuilder) registryAuth() types.AuthConfig {
-	return types.AuthConfig{
-		Username: "oauth2accesstoken",
-		Password: b.auth.Token,
-	}
+// registryAuth returns the registry auth to push `uri` with.
+func (b *BundleBuilder) registryAuth(ctx context.Context, uri string) (types.AuthConfig, error) {
+	return pushAuthConfig(ctx, b.auth, uri)
 }
 
-// Authconfigs returns the authconfigs to use.
-func (b *BundleBuilder) authconfigs() map[string]types.AuthConfig {
-	if b.auth == nil {
-		return map[string]types.AuthConfig{}
-	}
-
-	return map[string]types.AuthConfig{
-		b.auth.host(): b.registryAuth(),
-	}
+// authconfigs returns the authconfigs to pull the base images of `dockerfile`, to push
+// `uri` and to access the registry caches of the build with.
+func (b *BundleBuilder) authconfigs(ctx context.Context, dockerfile, uri string) (map[string]types.AuthConfig, error) {
+	images := append(baseImages(dockerfile), uri)
+	images = append(images, b.buildKit.cacheRefs()...)
+	return registryAuthConfigs(ctx, b.auth, images...)
 }
 
 func BuildBundleDockerfile(c BundleDockerfileConfig) (string, error) {
 	switch c.BuildContext.Type {
 	case NodeBuildType:
-		return nodeBundle(c.Root, c.BuildContext, c.Options, c.BuildArgKeys, c.FilesToBuild, c.FilesToDiscover)
+		return nodeBundle(c.Root, c.BuildContext, c.Options, c.BuildArgKeys, c.FilesToBuild, c.FilesToDiscover, dockerfileOptions{
+			CacheMounts: c.CacheMounts,
+			Platforms:   c.Platforms,
+		})
 	case ShellBuildType:
 		return shellBundle(c.Root)
+	case GoBuildType:
+		// Bundles are always built with BuildKit.
+		return golangBundle(c.Root, c.BuildContext, c.BuildArgKeys, c.FilesToBuild, dockerfileOptions{
+			CacheMounts: c.CacheMounts,
+			BuildKit:    true,
+			Platforms:   c.Platforms,
+		})
 	case ViewBuildType:
-		return viewBundle(c.Root, c.BuildContext, c.Options, c.FilesToBuild, c.FilesToDiscover)
+		return viewBundle(c.Root, c.BuildContext, c.Options, c.FilesToBuild, c.FilesToDiscover, dockerfileOptions{
+			Platforms: c.Platforms,
+		})
 	case PythonBuildType:
-		return pythonBundle(c.Root, c.BuildContext, c.Options, c.BuildArgKeys, c.FilesToDiscover)
+		return pythonBundle(c.Root, c.BuildContext, c.Options, c.BuildArgKeys, c.FilesToDiscover, dockerfileOptions{
+			CacheMounts: c.CacheMounts,
+			Platforms:   c.Platforms,
+		})
 	default:
 		return "", errors.Errorf("build: unknown build type %v", c.BuildContext.Type)
 	}
 }
 
 func GetBundleBuildInstructions(c BundleDockerfileConfig) (BuildInstructions, error) {
+	var instructions BuildInstructions
+	var err error
 	switch c.BuildContext.Type {
 	case PythonBuildType:
-		return getPythonBundleBuildInstructions(c.Root, c.Options, "")
+		instructions, err = getPythonBundleBuildInstructions(c.Root, c.Options, "")
 	case NodeBuildType:
-		return getNodeBundleBuildInstructions(c.Root, c.Options)
+		instructions, err = getNodeBundleBuildInstructions(c.Root, string(c.BuildContext.VersionOrDefault()), c.Options)
 	default:
 		return BuildInstructions{}, ErrUnsupportedBuilder{
 			Type: c.BuildContext.Type,
 		}
 	}
+	if err != nil {
+		return BuildInstructions{}, err
+	}
+	if c.CacheMounts {
+		instructions = instructions.withRunMounts()
+	}
+	return instructions, nil
 }
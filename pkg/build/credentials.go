@@ -0,0 +1,288 @@
+package build
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/pkg/errors"
+)
+
+// CredentialProvider provides the credentials of container registries, which are used to pull
+// base images and to push the images that are built.
+type CredentialProvider interface {
+	// Credentials returns the credentials for the registry at `host`, e.g. "ghcr.io" or
+	// "docker.io". If the provider has no credentials for the registry, it returns false and
+	// the registry is accessed anonymously.
+	Credentials(ctx context.Context, host string) (types.AuthConfig, bool, error)
+}
+
+// StaticCredentials authenticates to a single registry with a username and password, e.g. a
+// robot account or an access token.
+type StaticCredentials struct {
+	// Host is the registry that the credentials are used for, e.g. "ghcr.io" or
+	// "123456789012.dkr.ecr.us-west-2.amazonaws.com".
+	Host     string
+	Username string
+	Password string
+}
+
+var _ CredentialProvider = StaticCredentials{}
+
+// Credentials implements CredentialProvider.
+func (c StaticCredentials) Credentials(ctx context.Context, host string) (types.AuthConfig, bool, error) {
+	if normalizeRegistryHost(c.Host) != host {
+		return types.AuthConfig{}, false, nil
+	}
+	return types.AuthConfig{
+		Username: c.Username,
+		Password: c.Password,
+	}, true, nil
+}
+
+// AnonymousCredentials accesses every registry anonymously.
+type AnonymousCredentials struct{}
+
+var _ CredentialProvider = AnonymousCredentials{}
+
+// Credentials implements CredentialProvider.
+func (AnonymousCredentials) Credentials(ctx context.Context, host string) (types.AuthConfig, bool, error) {
+	return types.AuthConfig{}, false, nil
+}
+
+// ChainCredentials uses the credentials of the first provider that has credentials for a
+// registry.
+type ChainCredentials []CredentialProvider
+
+var _ CredentialProvider = ChainCredentials{}
+
+// Credentials implements CredentialProvider.
+func (c ChainCredentials) Credentials(ctx context.Context, host string) (types.AuthConfig, bool, error) {
+	for _, p := range c {
+		auth, ok, err := p.Credentials(ctx, host)
+		if err != nil || ok {
+			return auth, ok, err
+		}
+	}
+	return types.AuthConfig{}, false, nil
+}
+
+// DockerConfigCredentials uses the credentials that `docker login` stores in a Docker
+// config.json, either in the config itself or in a credential helper (`credHelpers` and
+// `credsStore`) such as `docker-credential-ecr-login`.
+type DockerConfigCredentials struct {
+	// Dir is the directory that contains the config.json.
+	//
+	// Defaults to $DOCKER_CONFIG, or ~/.docker.
+	Dir string
+}
+
+var _ CredentialProvider = DockerConfigCredentials{}
+
+type dockerConfig struct {
+	Auths       map[string]dockerConfigAuth `json:"auths"`
+	CredHelpers map[string]string           `json:"credHelpers"`
+	CredsStore  string                      `json:"credsStore"`
+}
+
+type dockerConfigAuth struct {
+	Auth          string `json:"auth"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	IdentityToken string `json:"identitytoken"`
+}
+
+// Credentials implements CredentialProvider.
+func (c DockerConfigCredentials) Credentials(ctx context.Context, host string) (types.AuthConfig, bool, error) {
+	dir := c.Dir
+	if dir == "" {
+		var err error
+		if dir, err = dockerConfigDir(); err != nil {
+			return types.AuthConfig{}, false, err
+		}
+	}
+
+	var config dockerConfig
+	b, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if os.IsNotExist(err) {
+		return types.AuthConfig{}, false, nil
+	} else if err != nil {
+		return types.AuthConfig{}, false, errors.Wrap(err, "reading docker config")
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return types.AuthConfig{}, false, errors.Wrap(err, "parsing docker config")
+	}
+
+	helper := config.CredsStore
+	for key, h := range config.CredHelpers {
+		if normalizeRegistryHost(key) == host {
+			helper = h
+			break
+		}
+	}
+	if helper != "" {
+		auth, ok, err := credentialHelperGet(ctx, helper, authConfigKey(host))
+		if err != nil || ok {
+			return auth, ok, err
+		}
+	}
+
+	for key, a := range config.Auths {
+		if normalizeRegistryHost(key) != host {
+			continue
+		}
+		auth := types.AuthConfig{
+			Username:      a.Username,
+			Password:      a.Password,
+			IdentityToken: a.IdentityToken,
+		}
+		if a.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(a.Auth)
+			if err != nil {
+				return types.AuthConfig{}, false, errors.Wrapf(err, "decoding docker config auth for %s", key)
+			}
+			username, password, ok := strings.Cut(string(decoded), ":")
+			if !ok {
+				return types.AuthConfig{}, false, errors.Errorf("invalid docker config auth for %s", key)
+			}
+			auth.Username, auth.Password = username, password
+		}
+		if auth.Username == "" && auth.Password == "" && auth.IdentityToken == "" {
+			// Entries are left empty when the credentials are kept in a credential store.
+			continue
+		}
+		return auth, true, nil
+	}
+	return types.AuthConfig{}, false, nil
+}
+
+// credentialHelperGet gets the credentials for `serverURL` from the `docker-credential-<helper>`
+// credential helper, see https://github.com/docker/docker-credential-helpers.
+func credentialHelperGet(ctx context.Context, helper, serverURL string) (types.AuthConfig, bool, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(serverURL)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		// Helpers print this message, on stdout, if they have no credentials for the server.
+		if strings.Contains(stdout.String()+stderr.String(), "credentials not found") {
+			return types.AuthConfig{}, false, nil
+		}
+		return types.AuthConfig{}, false, errors.Wrapf(err, "docker-credential-%s: %s", helper, strings.TrimSpace(stdout.String()+stderr.String()))
+	}
+
+	var creds struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &creds); err != nil {
+		return types.AuthConfig{}, false, errors.Wrapf(err, "parsing docker-credential-%s output", helper)
+	}
+	if creds.Username == "<token>" {
+		return types.AuthConfig{IdentityToken: creds.Secret}, true, nil
+	}
+	return types.AuthConfig{Username: creds.Username, Password: creds.Secret}, true, nil
+}
+
+// dockerConfigDir returns the directory of the user's Docker config.
+func dockerConfigDir() (string, error) {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.Wrap(err, "getting home directory")
+	}
+	return filepath.Join(home, ".docker"), nil
+}
+
+const (
+	dockerHubHost = "docker.io"
+	// dockerHubAuthKey is the key that Docker uses for the credentials of Docker Hub.
+	dockerHubAuthKey = "https://index.docker.io/v1/"
+)
+
+// registryHost returns the host of the registry of `image`, e.g. "ghcr.io" for
+// "ghcr.io/airplanedev/image:tag" and "docker.io" for "python:3.10".
+func registryHost(image string) string {
+	host, _, ok := strings.Cut(image, "/")
+	if !ok || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		return dockerHubHost
+	}
+	return normalizeRegistryHost(host)
+}
+
+// normalizeRegistryHost returns the host of a registry address, which may be a URL as used in
+// Docker's config.json.
+func normalizeRegistryHost(address string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(address, "https://"), "http://")
+	host, _, _ = strings.Cut(host, "/")
+	switch host {
+	case "index.docker.io", "registry-1.docker.io", "registry.hub.docker.com":
+		return dockerHubHost
+	}
+	return host
+}
+
+// authConfigKey returns the key of the auth config of `host`, as Docker expects it.
+func authConfigKey(host string) string {
+	if host == dockerHubHost {
+		return dockerHubAuthKey
+	}
+	return host
+}
+
+// credentials returns the provider of the registry credentials.
+func (r RegistryAuth) credentials() CredentialProvider {
+	if r.Credentials != nil {
+		return r.Credentials
+	}
+	return StaticCredentials{
+		Host:     r.host(),
+		Username: "oauth2accesstoken",
+		Password: r.Token,
+	}
+}
+
+// registryAuthConfigs returns the auth configs of the registries of `images`, e.g. the base
+// images of a build and the image that is built. Registries without credentials are left out.
+func registryAuthConfigs(ctx context.Context, auth *RegistryAuth, images ...string) (map[string]types.AuthConfig, error) {
+	configs := map[string]types.AuthConfig{}
+	if auth == nil {
+		return configs, nil
+	}
+	provider := auth.credentials()
+	for _, image := range images {
+		host := registryHost(image)
+		key := authConfigKey(host)
+		if _, ok := configs[key]; ok {
+			continue
+		}
+		config, ok, err := provider.Credentials(ctx, host)
+		if err != nil {
+			return nil, errors.Wrapf(err, "getting credentials for %s", host)
+		}
+		if ok {
+			config.ServerAddress = key
+			configs[key] = config
+		}
+	}
+	return configs, nil
+}
+
+// pushAuthConfig returns the auth config to push `image` with. If there are no credentials for
+// its registry, the image is pushed anonymously.
+func pushAuthConfig(ctx context.Context, auth *RegistryAuth, image string) (types.AuthConfig, error) {
+	configs, err := registryAuthConfigs(ctx, auth, image)
+	if err != nil {
+		return types.AuthConfig{}, err
+	}
+	return configs[authConfigKey(registryHost(image))], nil
+}
@@ -0,0 +1,142 @@
+package build
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryHost(t *testing.T) {
+	for _, test := range []struct {
+		image string
+		host  string
+	}{
+		{"python:3.10", "docker.io"},
+		{"library/python:3.10", "docker.io"},
+		{"docker.io/library/python:3.10", "docker.io"},
+		{"index.docker.io/library/python", "docker.io"},
+		{"registry.hub.docker.com/library/node:18.12.0-bullseye", "docker.io"},
+		{"ghcr.io/airplanedev/task:v1", "ghcr.io"},
+		{"123456789012.dkr.ecr.us-west-2.amazonaws.com/task-abc:v1", "123456789012.dkr.ecr.us-west-2.amazonaws.com"},
+		{"localhost:5000/task-abc:v1", "localhost:5000"},
+		{"localhost/task-abc:v1", "localhost"},
+	} {
+		t.Run(test.image, func(t *testing.T) {
+			require.Equal(t, test.host, registryHost(test.image))
+		})
+	}
+}
+
+func TestDockerConfigCredentials(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	// A fake credential helper, which has credentials for ghcr.io and token.example.com.
+	bin := t.TempDir()
+	require.NoError(os.WriteFile(filepath.Join(bin, "docker-credential-fake"), []byte(`#!/bin/sh
+read server
+case "$server" in
+  ghcr.io) echo '{"ServerURL": "ghcr.io", "Username": "octocat", "Secret": "ghp_123"}' ;;
+  token.example.com) echo '{"ServerURL": "token.example.com", "Username": "<token>", "Secret": "refresh"}' ;;
+  *) echo "credentials not found in native keychain"; exit 1 ;;
+esac
+`), 0755))
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	dir := t.TempDir()
+	require.NoError(os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{
+		"auths": {
+			"https://index.docker.io/v1/": {"auth": "dXNlcjpodWI="},
+			"harbor.example.com": {"username": "robot$ci", "password": "harbor"},
+			"ghcr.io": {}
+		},
+		"credHelpers": {
+			"ghcr.io": "fake",
+			"token.example.com": "fake",
+			"missing.example.com": "fake"
+		}
+	}`), 0600))
+	provider := DockerConfigCredentials{Dir: dir}
+
+	for _, test := range []struct {
+		host string
+		auth types.AuthConfig
+		ok   bool
+	}{
+		{"docker.io", types.AuthConfig{Username: "user", Password: "hub"}, true},
+		{"harbor.example.com", types.AuthConfig{Username: "robot$ci", Password: "harbor"}, true},
+		{"ghcr.io", types.AuthConfig{Username: "octocat", Password: "ghp_123"}, true},
+		{"token.example.com", types.AuthConfig{IdentityToken: "refresh"}, true},
+		{"missing.example.com", types.AuthConfig{}, false},
+		{"quay.io", types.AuthConfig{}, false},
+	} {
+		auth, ok, err := provider.Credentials(ctx, test.host)
+		require.NoError(err, test.host)
+		require.Equal(test.ok, ok, test.host)
+		require.Equal(test.auth, auth, test.host)
+	}
+
+	// A missing config has no credentials.
+	_, ok, err := DockerConfigCredentials{Dir: t.TempDir()}.Credentials(ctx, "docker.io")
+	require.NoError(err)
+	require.False(ok)
+
+	// Helpers that fail are reported.
+	require.NoError(os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"credsStore": "broken"}`), 0600))
+	_, _, err = provider.Credentials(ctx, "ghcr.io")
+	require.ErrorContains(err, "docker-credential-broken")
+}
+
+func TestRegistryAuthConfigs(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	dockerfile := "FROM python:3.10\nFROM ghcr.io/airplanedev/base:v1 AS base\n"
+
+	// By default, the token is only used for the repo's registry.
+	configs, err := registryAuthConfigs(ctx, &RegistryAuth{
+		Token: "token",
+		Repo:  "us-docker.pkg.dev/airplane/tasks",
+	}, append(baseImages(dockerfile), "us-docker.pkg.dev/airplane/tasks/task-abc:v1")...)
+	require.NoError(err)
+	require.Equal(map[string]types.AuthConfig{
+		"us-docker.pkg.dev": {Username: "oauth2accesstoken", Password: "token", ServerAddress: "us-docker.pkg.dev"},
+	}, configs)
+
+	auth := &RegistryAuth{
+		Repo: "123456789012.dkr.ecr.us-west-2.amazonaws.com",
+		Credentials: ChainCredentials{
+			AnonymousCredentials{},
+			StaticCredentials{Host: "123456789012.dkr.ecr.us-west-2.amazonaws.com", Username: "AWS", Password: "ecr"},
+			StaticCredentials{Host: "https://index.docker.io/v1/", Username: "user", Password: "hub"},
+		},
+	}
+	configs, err = registryAuthConfigs(ctx, auth, append(baseImages(dockerfile), "123456789012.dkr.ecr.us-west-2.amazonaws.com/task-abc:v1")...)
+	require.NoError(err)
+	require.Equal(map[string]types.AuthConfig{
+		"123456789012.dkr.ecr.us-west-2.amazonaws.com": {Username: "AWS", Password: "ecr", ServerAddress: "123456789012.dkr.ecr.us-west-2.amazonaws.com"},
+		"https://index.docker.io/v1/":                  {Username: "user", Password: "hub", ServerAddress: "https://index.docker.io/v1/"},
+	}, configs)
+
+	// The base images of versions.json are on Docker Hub, so they use its credentials.
+	v, err := GetVersion(NamePython, "3.10", false)
+	require.NoError(err)
+	configs, err = registryAuthConfigs(ctx, auth, v.Ref(nil))
+	require.NoError(err)
+	require.Equal(map[string]types.AuthConfig{
+		"https://index.docker.io/v1/": {Username: "user", Password: "hub", ServerAddress: "https://index.docker.io/v1/"},
+	}, configs)
+
+	push, err := pushAuthConfig(ctx, auth, "123456789012.dkr.ecr.us-west-2.amazonaws.com/task-abc:v1")
+	require.NoError(err)
+	require.Equal("AWS", push.Username)
+
+	// Registries without credentials are accessed anonymously.
+	push, err = pushAuthConfig(ctx, &RegistryAuth{Repo: "ghcr.io/airplanedev", Credentials: AnonymousCredentials{}}, "ghcr.io/airplanedev/task-abc:v1")
+	require.NoError(err)
+	require.Equal(types.AuthConfig{}, push)
+}
@@ -0,0 +1,336 @@
+package build
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	dockerJSONMessage "github.com/docker/docker/pkg/jsonmessage"
+	"github.com/mattn/go-isatty"
+	bkclient "github.com/moby/buildkit/client"
+	"github.com/pkg/errors"
+)
+
+// EventType is the type of a build event.
+type EventType string
+
+const (
+	// EventStepStarted is sent when a build step, usually a Dockerfile instruction, starts.
+	EventStepStarted EventType = "step_started"
+	// EventStepFinished is sent when a build step completes, whether or not it was cached.
+	EventStepFinished EventType = "step_finished"
+	// EventCacheHit is sent when a build step is satisfied by the build cache.
+	EventCacheHit EventType = "cache_hit"
+	// EventLayerProgress reports the progress of a layer that is being pulled or pushed.
+	EventLayerProgress EventType = "layer_progress"
+	// EventLog is a line of output, e.g. from a RUN instruction.
+	EventLog EventType = "log"
+	// EventError is sent when the build fails.
+	EventError EventType = "error"
+)
+
+// Event is a build event. Which fields are set depends on its type.
+type Event struct {
+	Type EventType `json:"type"`
+	Time time.Time `json:"time"`
+	// Step identifies the build step that the event belongs to, if any. It is unique within a
+	// build, but its format depends on how the image is built.
+	Step string `json:"step,omitempty"`
+	// Instruction is the Dockerfile instruction of the step, as reported by Docker, e.g.
+	// "RUN yarn install" or "[2/4] RUN yarn install".
+	Instruction string `json:"instruction,omitempty"`
+	// Layer is the ID of the layer that is being pulled or pushed.
+	Layer string `json:"layer,omitempty"`
+	// Status is the status of a layer, e.g. "Downloading".
+	Status string `json:"status,omitempty"`
+	// Current and Total are the progress of a layer, usually in bytes.
+	Current int64 `json:"current,omitempty"`
+	Total   int64 `json:"total,omitempty"`
+	// Message is the log line, or the error message of a failed build.
+	Message string `json:"message,omitempty"`
+}
+
+// EventSink receives the events of builds and pushes. Events are sent in order, from the
+// goroutine that called Build or Push.
+type EventSink interface {
+	Send(Event)
+}
+
+// EventSinkFunc is an EventSink implemented by a function.
+type EventSinkFunc func(Event)
+
+// Send implements EventSink.
+func (f EventSinkFunc) Send(e Event) {
+	f(e)
+}
+
+// TerminalSink writes events to a terminal, or any other writer, as human-readable output.
+type TerminalSink struct {
+	mu         sync.Mutex
+	w          io.Writer
+	isTerminal bool
+}
+
+var _ EventSink = &TerminalSink{}
+
+// NewTerminalSink returns a TerminalSink that writes to `w`. Layer progress bars are only
+// shown if `w` is a terminal.
+func NewTerminalSink(w io.Writer) *TerminalSink {
+	isTerminal := false
+	if f, ok := w.(*os.File); ok {
+		isTerminal = isatty.IsTerminal(f.Fd())
+	}
+	return &TerminalSink{w: w, isTerminal: isTerminal}
+}
+
+// Send implements EventSink.
+func (s *TerminalSink) Send(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch e.Type {
+	case EventStepStarted:
+		fmt.Fprintln(s.w, e.Instruction)
+	case EventCacheHit:
+		fmt.Fprintln(s.w, "CACHED")
+	case EventLayerProgress:
+		msg := dockerJSONMessage.JSONMessage{ID: e.Layer, Status: e.Status}
+		if e.Current > 0 || e.Total > 0 {
+			msg.Progress = &dockerJSONMessage.JSONProgress{Current: e.Current, Total: e.Total}
+		}
+		_ = msg.Display(s.w, s.isTerminal)
+	case EventLog, EventError:
+		fmt.Fprintln(s.w, strings.TrimSuffix(e.Message, "\n"))
+	}
+}
+
+// JSONLinesSink writes every event as a line of JSON, e.g. to a file.
+type JSONLinesSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+var _ EventSink = &JSONLinesSink{}
+
+// NewJSONLinesSink returns a JSONLinesSink that writes to `w`.
+func NewJSONLinesSink(w io.Writer) *JSONLinesSink {
+	return &JSONLinesSink{enc: json.NewEncoder(w)}
+}
+
+// Send implements EventSink. Once writing an event fails, later events are dropped; see Err.
+func (s *JSONLinesSink) Send(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return
+	}
+	if err := s.enc.Encode(e); err != nil {
+		s.err = errors.Wrap(err, "writing build event")
+	}
+}
+
+// Err returns the error of the first event that couldn't be written, if any.
+func (s *JSONLinesSink) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// eventSinkOrDefault returns `sink`, or a TerminalSink that writes to os.Stderr if it is nil.
+func eventSinkOrDefault(sink EventSink) EventSink {
+	if sink == nil {
+		return NewTerminalSink(os.Stderr)
+	}
+	return sink
+}
+
+// eventSender sends events to a sink, filling in the instruction of their step.
+type eventSender struct {
+	sink EventSink
+	now  func() time.Time
+	// instructions are the instructions of the steps that have started.
+	instructions map[string]string
+}
+
+func newEventSender(sink EventSink) *eventSender {
+	return &eventSender{
+		sink:         sink,
+		now:          time.Now,
+		instructions: map[string]string{},
+	}
+}
+
+func (s *eventSender) send(e Event) {
+	e.Time = s.now()
+	if e.Step != "" && e.Instruction == "" {
+		e.Instruction = s.instructions[e.Step]
+	}
+	s.sink.Send(e)
+}
+
+func (s *eventSender) startStep(step, instruction string) {
+	s.instructions[step] = instruction
+	s.send(Event{Type: EventStepStarted, Step: step, Instruction: instruction})
+}
+
+var legacyStepRegexp = regexp.MustCompile(`^Step (\d+/\d+) : (.*)$`)
+
+// dockerMessages converts the JSON messages of the Docker daemon's (legacy) build and push
+// APIs into events.
+type dockerMessages struct {
+	*eventSender
+	// step is the step that is running, if any.
+	step string
+	// partial is the end of the stream output that isn't terminated by a newline yet.
+	partial string
+}
+
+func newDockerMessages(sink EventSink) *dockerMessages {
+	return &dockerMessages{eventSender: newEventSender(sink)}
+}
+
+// handle sends the events of `msg`. If `msg` is an error, the error is returned.
+func (d *dockerMessages) handle(msg *dockerJSONMessage.JSONMessage) error {
+	if msg.Error != nil {
+		d.flush()
+		d.send(Event{Type: EventError, Step: d.step, Message: msg.Error.Message})
+		if msg.Error.Code == 401 {
+			return errors.New("authentication is required")
+		}
+		return msg.Error
+	}
+
+	switch {
+	case msg.Stream != "":
+		lines := strings.Split(d.partial+msg.Stream, "\n")
+		d.partial = lines[len(lines)-1]
+		for _, line := range lines[:len(lines)-1] {
+			d.handleLine(line)
+		}
+	case msg.ID != "" && (msg.Status != "" || msg.Progress != nil):
+		e := Event{Type: EventLayerProgress, Step: d.step, Layer: msg.ID, Status: msg.Status}
+		if msg.Progress != nil {
+			e.Current = msg.Progress.Current
+			e.Total = msg.Progress.Total
+		}
+		d.send(e)
+	case msg.Status != "":
+		d.send(Event{Type: EventLog, Step: d.step, Message: msg.Status})
+	}
+	return nil
+}
+
+func (d *dockerMessages) handleLine(line string) {
+	if m := legacyStepRegexp.FindStringSubmatch(line); m != nil {
+		d.finishStep()
+		d.step = m[1]
+		d.startStep(d.step, m[2])
+		return
+	}
+	if strings.TrimSpace(line) == "---> Using cache" {
+		d.send(Event{Type: EventCacheHit, Step: d.step})
+		return
+	}
+	d.send(Event{Type: EventLog, Step: d.step, Message: line})
+}
+
+func (d *dockerMessages) finishStep() {
+	if d.step != "" {
+		d.send(Event{Type: EventStepFinished, Step: d.step})
+		d.step = ""
+	}
+}
+
+// flush sends any partial line of output.
+func (d *dockerMessages) flush() {
+	if d.partial != "" {
+		d.send(Event{Type: EventLog, Step: d.step, Message: d.partial})
+		d.partial = ""
+	}
+}
+
+// done is called once the build or push succeeded.
+func (d *dockerMessages) done() {
+	d.flush()
+	d.finishStep()
+}
+
+// buildKitTrace converts BuildKit status updates into events, whether they come from a BuildKit
+// client or from the `moby.buildkit.trace` messages of the Docker daemon. Steps are identified
+// by their vertex digest.
+type buildKitTrace struct {
+	*eventSender
+	vertexes map[string]*vertexState
+}
+
+type vertexState struct {
+	started, cached, completed, errored bool
+}
+
+func newBuildKitTrace(sink EventSink) *buildKitTrace {
+	return &buildKitTrace{
+		eventSender: newEventSender(sink),
+		vertexes:    map[string]*vertexState{},
+	}
+}
+
+func (t *buildKitTrace) handle(status *bkclient.SolveStatus) {
+	for _, v := range status.Vertexes {
+		step := v.Digest.String()
+		state, ok := t.vertexes[step]
+		if !ok {
+			state = &vertexState{}
+			t.vertexes[step] = state
+		}
+		if v.Started != nil && !state.started {
+			state.started = true
+			t.startStep(step, v.Name)
+		}
+		if v.Cached && !state.cached {
+			state.cached = true
+			t.send(Event{Type: EventCacheHit, Step: step, Instruction: v.Name})
+		}
+		if v.Error != "" && !state.errored {
+			state.errored = true
+			t.send(Event{Type: EventError, Step: step, Instruction: v.Name, Message: v.Error})
+		}
+		if v.Completed != nil && !state.completed {
+			state.completed = true
+			t.send(Event{Type: EventStepFinished, Step: step, Instruction: v.Name})
+		}
+	}
+	for _, s := range status.Statuses {
+		t.send(Event{
+			Type:    EventLayerProgress,
+			Step:    s.Vertex.String(),
+			Layer:   s.ID,
+			Status:  s.Name,
+			Current: s.Current,
+			Total:   s.Total,
+		})
+	}
+	for _, l := range status.Logs {
+		t.send(Event{
+			Type:    EventLog,
+			Step:    l.Vertex.String(),
+			Message: strings.TrimSuffix(string(l.Data), "\n"),
+		})
+	}
+}
+
+// fail sends an error for a build that failed with `message`, unless the failing step already
+// reported its error.
+func (t *buildKitTrace) fail(message string) {
+	for _, state := range t.vertexes {
+		if state.errored {
+			return
+		}
+	}
+	t.send(Event{Type: EventError, Message: message})
+}
@@ -0,0 +1,146 @@
+package build
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	dockerJSONMessage "github.com/docker/docker/pkg/jsonmessage"
+	controlapi "github.com/moby/buildkit/api/services/control"
+	bkclient "github.com/moby/buildkit/client"
+	"github.com/stretchr/testify/require"
+)
+
+// recordEvents returns a sink that records events, with their times cleared.
+func recordEvents(events *[]Event) EventSink {
+	return EventSinkFunc(func(e Event) {
+		e.Time = time.Time{}
+		*events = append(*events, e)
+	})
+}
+
+func TestDockerMessages(t *testing.T) {
+	require := require.New(t)
+
+	var events []Event
+	d := newDockerMessages(recordEvents(&events))
+	for _, msg := range []dockerJSONMessage.JSONMessage{
+		{Stream: "Step 1/3 : FROM python:3.10"},
+		{Stream: "\n"},
+		{Status: "Pulling from library/python", ID: "3.10"},
+		{Status: "Downloading", ID: "a1b2", Progress: &dockerJSONMessage.JSONProgress{Current: 10, Total: 100}},
+		{Stream: " ---> 1234\nStep 2/3 : COPY . .\n"},
+		{Stream: " ---> Using cache\n"},
+		{Stream: "Step 3/3 : RUN pip install -r requirements.txt\n"},
+		{Stream: "Collecting requests\n"},
+		{Stream: "Successfully built 5678\n"},
+	} {
+		msg := msg
+		require.NoError(d.handle(&msg))
+	}
+	d.done()
+
+	require.Equal([]Event{
+		{Type: EventStepStarted, Step: "1/3", Instruction: "FROM python:3.10"},
+		{Type: EventLayerProgress, Step: "1/3", Instruction: "FROM python:3.10", Layer: "3.10", Status: "Pulling from library/python"},
+		{Type: EventLayerProgress, Step: "1/3", Instruction: "FROM python:3.10", Layer: "a1b2", Status: "Downloading", Current: 10, Total: 100},
+		{Type: EventLog, Step: "1/3", Instruction: "FROM python:3.10", Message: " ---> 1234"},
+		{Type: EventStepFinished, Step: "1/3", Instruction: "FROM python:3.10"},
+		{Type: EventStepStarted, Step: "2/3", Instruction: "COPY . ."},
+		{Type: EventCacheHit, Step: "2/3", Instruction: "COPY . ."},
+		{Type: EventStepFinished, Step: "2/3", Instruction: "COPY . ."},
+		{Type: EventStepStarted, Step: "3/3", Instruction: "RUN pip install -r requirements.txt"},
+		{Type: EventLog, Step: "3/3", Instruction: "RUN pip install -r requirements.txt", Message: "Collecting requests"},
+		{Type: EventLog, Step: "3/3", Instruction: "RUN pip install -r requirements.txt", Message: "Successfully built 5678"},
+		{Type: EventStepFinished, Step: "3/3", Instruction: "RUN pip install -r requirements.txt"},
+	}, events)
+
+	// Errors are attributed to the failing step.
+	events = nil
+	d = newDockerMessages(recordEvents(&events))
+	require.NoError(d.handle(&dockerJSONMessage.JSONMessage{Stream: "Step 1/1 : RUN false\n"}))
+	err := d.handle(&dockerJSONMessage.JSONMessage{Error: &dockerJSONMessage.JSONError{Message: "exit code: 1"}})
+	require.EqualError(err, "exit code: 1")
+	require.Equal(Event{Type: EventError, Step: "1/1", Instruction: "RUN false", Message: "exit code: 1"}, events[len(events)-1])
+}
+
+func TestBuildKitTrace(t *testing.T) {
+	require := require.New(t)
+
+	var events []Event
+	trace := newBuildKitTrace(recordEvents(&events))
+	now := time.Now()
+	const copyStep, runStep = "sha256:c0", "sha256:40"
+
+	trace.handle(bkclient.NewSolveStatus(&controlapi.StatusResponse{
+		Vertexes: []*controlapi.Vertex{
+			{Digest: copyStep, Name: "[2/3] COPY . .", Started: &now},
+			{Digest: runStep, Name: "[3/3] RUN yarn install"},
+		},
+	}))
+	trace.handle(bkclient.NewSolveStatus(&controlapi.StatusResponse{
+		Vertexes: []*controlapi.Vertex{
+			{Digest: copyStep, Name: "[2/3] COPY . .", Started: &now, Completed: &now, Cached: true},
+			{Digest: runStep, Name: "[3/3] RUN yarn install", Started: &now},
+		},
+		Statuses: []*controlapi.VertexStatus{
+			{ID: "sha256:abc", Vertex: runStep, Name: "downloading", Current: 5, Total: 10},
+		},
+		Logs: []*controlapi.VertexLog{
+			{Vertex: runStep, Msg: []byte("yarn install v1.22.19\n")},
+		},
+	}))
+	trace.handle(bkclient.NewSolveStatus(&controlapi.StatusResponse{
+		Vertexes: []*controlapi.Vertex{
+			{Digest: runStep, Name: "[3/3] RUN yarn install", Started: &now, Completed: &now, Error: "exit code: 1"},
+		},
+	}))
+	trace.fail("executor failed running [/bin/sh -c yarn install]: exit code: 1")
+
+	c, r := copyStep, runStep
+	require.Equal([]Event{
+		{Type: EventStepStarted, Step: c, Instruction: "[2/3] COPY . ."},
+		{Type: EventCacheHit, Step: c, Instruction: "[2/3] COPY . ."},
+		{Type: EventStepFinished, Step: c, Instruction: "[2/3] COPY . ."},
+		{Type: EventStepStarted, Step: r, Instruction: "[3/3] RUN yarn install"},
+		{Type: EventLayerProgress, Step: r, Instruction: "[3/3] RUN yarn install", Layer: "sha256:abc", Status: "downloading", Current: 5, Total: 10},
+		{Type: EventLog, Step: r, Instruction: "[3/3] RUN yarn install", Message: "yarn install v1.22.19"},
+		{Type: EventError, Step: r, Instruction: "[3/3] RUN yarn install", Message: "exit code: 1"},
+		{Type: EventStepFinished, Step: r, Instruction: "[3/3] RUN yarn install"},
+	}, events)
+}
+
+func TestEventSinks(t *testing.T) {
+	require := require.New(t)
+
+	events := []Event{
+		{Type: EventStepStarted, Step: "1/2", Instruction: "COPY . ."},
+		{Type: EventCacheHit, Step: "1/2"},
+		{Type: EventLayerProgress, Layer: "a1b2", Status: "Pushed"},
+		{Type: EventLog, Step: "2/2", Message: "Collecting requests\n"},
+		{Type: EventError, Step: "2/2", Message: "exit code: 1"},
+	}
+
+	var buf bytes.Buffer
+	terminal := NewTerminalSink(&buf)
+	for _, e := range events {
+		terminal.Send(e)
+	}
+	require.Equal("COPY . .\nCACHED\na1b2: Pushed\nCollecting requests\nexit code: 1\n", buf.String())
+
+	buf.Reset()
+	jsonl := NewJSONLinesSink(&buf)
+	for _, e := range events {
+		jsonl.Send(e)
+	}
+	require.NoError(jsonl.Err())
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(lines, len(events))
+	for i, line := range lines {
+		var e Event
+		require.NoError(json.Unmarshal([]byte(line), &e))
+		require.Equal(events[i], e)
+	}
+}
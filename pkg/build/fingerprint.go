@@ -0,0 +1,241 @@
+package build
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/airplanedev/lib/pkg/build/ignore"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/pkg/errors"
+)
+
+// fingerprintVersion is mixed into every fingerprint. Bump it whenever the way that images are
+// built changes in a way that isn't reflected in the fingerprint's inputs, so that images built
+// before the change aren't reused.
+const fingerprintVersion = "v1"
+
+// FingerprintInputs are the inputs of a build that determine the image it produces.
+type FingerprintInputs struct {
+	// Root is the root directory whose files are copied into the image. Files that are
+	// ignored through .airplaneignore (see ignore.Func) are excluded.
+	Root string
+	// Dockerfile is the generated Dockerfile.
+	Dockerfile string
+	// BaseImageDigests are the digests that the base images of Dockerfile which aren't pinned
+	// to a digest resolve to, keyed by their reference. See resolveBaseImages.
+	BaseImageDigests map[string]string
+	// BuildContext is the build context of bundle builds.
+	BuildContext BuildContext
+	// Options are the builder options of task builds.
+	Options KindOptions
+	// BuildArgs are the build args that the image is built with.
+	BuildArgs map[string]string
+	// Platforms are the platforms that the image is built for.
+	Platforms []Platform
+	// Target is the docker target that is built.
+	Target string
+}
+
+// Fingerprint returns a content-addressed key of a build's inputs, e.g.
+// "sha256:4f5a...". Builds with the same fingerprint produce equivalent images, so the image
+// of an earlier build can be reused instead of building it again.
+//
+// Base images are identified by their digest. Base images that aren't pinned to a digest in the
+// Dockerfile's FROM instructions must be resolved through BaseImageDigests, since the image that
+// their tag refers to can change.
+func Fingerprint(in FingerprintInputs) (string, error) {
+	h := sha256.New()
+	writeField(h, "version", fingerprintVersion)
+
+	if err := hashFiles(h, in.Root); err != nil {
+		return "", err
+	}
+
+	writeField(h, "dockerfile", in.Dockerfile)
+	for _, image := range baseImages(in.Dockerfile) {
+		if !pinnedImage(image) {
+			digest, ok := in.BaseImageDigests[image]
+			if !ok {
+				return "", errors.Errorf("base image %s isn't pinned to a digest", image)
+			}
+			image += "@" + digest
+		}
+		writeField(h, "base", image)
+	}
+
+	// encoding/json sorts map keys, so this is deterministic.
+	bc, err := json.Marshal(in.BuildContext)
+	if err != nil {
+		return "", errors.Wrap(err, "marshalling build context")
+	}
+	writeField(h, "context", string(bc))
+	options, err := json.Marshal(in.Options)
+	if err != nil {
+		return "", errors.Wrap(err, "marshalling options")
+	}
+	writeField(h, "options", string(options))
+
+	var keys []string
+	for k := range in.BuildArgs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeField(h, "arg", k+"="+in.BuildArgs[k])
+	}
+
+	platforms := in.Platforms
+	if len(platforms) == 0 {
+		platforms = DefaultPlatforms
+	}
+	writeField(h, "platforms", platformsString(platforms))
+	writeField(h, "target", in.Target)
+
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// writeField writes a length-prefixed field, so that the boundaries between fields are
+// unambiguous.
+func writeField(h hash.Hash, name, value string) {
+	fmt.Fprintf(h, "%s %d\n%s\n", name, len(value), value)
+}
+
+// hashFiles hashes the path, executable bit and contents of every file in root that isn't
+// ignored.
+func hashFiles(h hash.Hash, root string) error {
+	include, err := ignore.Func(root)
+	if err != nil {
+		return err
+	}
+
+	// filepath.Walk walks files in lexical order, so the order is deterministic.
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		ok, err := include(path, info)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return errors.Wrap(err, "getting relative path")
+		}
+		digest, err := fileDigest(path)
+		if err != nil {
+			return err
+		}
+		writeField(h, "file", fmt.Sprintf("%s %t %s", filepath.ToSlash(rel), info.Mode()&0111 != 0, digest))
+		return nil
+	})
+}
+
+func fileDigest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.Wrap(err, "opening file")
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.Wrapf(err, "reading %s", path)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// distributionInspector resolves images against their registry, e.g. the Docker client.
+type distributionInspector interface {
+	DistributionInspect(ctx context.Context, image, encodedRegistryAuth string) (registry.DistributionInspect, error)
+}
+
+// resolveBaseImages returns the digests that the base images of `dockerfile` which aren't
+// pinned to a digest currently resolve to, keyed by their reference. Registries are accessed
+// with the credentials of `auth`, if any.
+func resolveBaseImages(ctx context.Context, inspector distributionInspector, auth *RegistryAuth, dockerfile string) (map[string]string, error) {
+	digests := map[string]string{}
+	for _, image := range baseImages(dockerfile) {
+		if _, ok := digests[image]; ok || pinnedImage(image) {
+			continue
+		}
+
+		configs, err := registryAuthConfigs(ctx, auth, image)
+		if err != nil {
+			return nil, err
+		}
+		var encodedAuth string
+		if config, ok := configs[authConfigKey(registryHost(image))]; ok {
+			authjson, err := json.Marshal(config)
+			if err != nil {
+				return nil, errors.Wrap(err, "marshalling auth")
+			}
+			encodedAuth = base64.URLEncoding.EncodeToString(authjson)
+		}
+
+		resp, err := inspector.DistributionInspect(ctx, image, encodedAuth)
+		if err != nil {
+			return nil, errors.Wrapf(err, "resolving base image %s", image)
+		}
+		if resp.Descriptor.Digest == "" {
+			return nil, errors.Errorf("resolving base image %s: registry returned no digest", image)
+		}
+		digests[image] = resp.Descriptor.Digest.String()
+	}
+	return digests, nil
+}
+
+// pinnedImage returns true if `image` is pinned to a digest, e.g. "python:3.10@sha256:...".
+func pinnedImage(image string) bool {
+	return strings.Contains(image, "@")
+}
+
+// baseImages returns the images referenced by the FROM instructions of a Dockerfile. Stages
+// that are built from earlier stages are skipped.
+func baseImages(dockerfile string) []string {
+	var images []string
+	stages := map[string]bool{}
+	for _, line := range strings.Split(dockerfile, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+			continue
+		}
+		fields = fields[1:]
+		for len(fields) > 0 && strings.HasPrefix(fields[0], "--") {
+			fields = fields[1:]
+		}
+		if len(fields) == 0 {
+			continue
+		}
+		image := fields[0]
+		if !stages[strings.ToLower(image)] {
+			images = append(images, image)
+		}
+		if len(fields) >= 3 && strings.EqualFold(fields[1], "AS") {
+			stages[strings.ToLower(fields[2])] = true
+		}
+	}
+	return images
+}
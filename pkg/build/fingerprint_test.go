@@ -0,0 +1,184 @@
+package build
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFingerprint(t *testing.T) {
+	require := require.New(t)
+
+	root := t.TempDir()
+	write := func(path, content string) {
+		p := filepath.Join(root, path)
+		require.NoError(os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(os.WriteFile(p, []byte(content), 0644))
+	}
+	write("main.py", "print('hello')")
+	write("requirements.txt", "requests")
+	write("node_modules/dep/index.js", "module.exports = {}")
+
+	value := "1"
+	in := FingerprintInputs{
+		Root:       root,
+		Dockerfile: "FROM python:3.10-buster@sha256:abc\nCOPY . .\n",
+		BuildContext: BuildContext{
+			Type:    PythonBuildType,
+			Version: BuildTypeVersionPython310,
+			EnvVars: map[string]EnvVarValue{"A": {Value: &value}},
+		},
+		BuildArgs: map[string]string{"B": "2", "A": "1"},
+	}
+	fingerprint := func(in FingerprintInputs) string {
+		f, err := Fingerprint(in)
+		require.NoError(err)
+		return f
+	}
+
+	base := fingerprint(in)
+	require.Regexp(`^sha256:[0-9a-f]{64}$`, base)
+	require.Equal(base, fingerprint(in))
+
+	// Ignored files don't affect the fingerprint.
+	write("node_modules/dep/index.js", "module.exports = { changed: true }")
+	write("__pycache__/main.cpython-310.pyc", "")
+	require.Equal(base, fingerprint(in))
+
+	write(".airplaneignore", "notes.txt\n")
+	withIgnore := fingerprint(in)
+	require.NotEqual(base, withIgnore)
+	write("notes.txt", "todo")
+	require.Equal(withIgnore, fingerprint(in))
+
+	// Files are identified by their contents, not their modification time.
+	write("main.py", "print('hello')")
+	require.Equal(withIgnore, fingerprint(in))
+	write("main.py", "print('world')")
+	changed := fingerprint(in)
+	require.NotEqual(withIgnore, changed)
+	require.NoError(os.Chmod(filepath.Join(root, "main.py"), 0755))
+	require.NotEqual(changed, fingerprint(in))
+
+	for name, modify := range map[string]func(in *FingerprintInputs){
+		"dockerfile": func(in *FingerprintInputs) { in.Dockerfile += "RUN true\n" },
+		"base image": func(in *FingerprintInputs) { in.Dockerfile = "FROM python:3.10-buster@sha256:def\nCOPY . .\n" },
+		"version":    func(in *FingerprintInputs) { in.BuildContext.Version = BuildTypeVersionPython39 },
+		"base":       func(in *FingerprintInputs) { in.BuildContext.Base = BuildBaseSlim },
+		"env var": func(in *FingerprintInputs) {
+			other := "2"
+			in.BuildContext.EnvVars = map[string]EnvVarValue{"A": {Value: &other}}
+		},
+		"build arg": func(in *FingerprintInputs) { in.BuildArgs = map[string]string{"A": "1", "B": "3"} },
+		"options":   func(in *FingerprintInputs) { in.Options = KindOptions{"shim": "true"} },
+		"platforms": func(in *FingerprintInputs) { in.Platforms = []Platform{PlatformLinuxARM64} },
+		"target":    func(in *FingerprintInputs) { in.Target = "task-build" },
+	} {
+		modified := in
+		modify(&modified)
+		require.NotEqual(fingerprint(in), fingerprint(modified), name)
+	}
+
+	// Platforms default to DefaultPlatforms.
+	in.Platforms = DefaultPlatforms
+	require.Equal(fingerprint(FingerprintInputs{
+		Root:         in.Root,
+		Dockerfile:   in.Dockerfile,
+		BuildContext: in.BuildContext,
+		BuildArgs:    in.BuildArgs,
+	}), fingerprint(in))
+
+	// Base images that aren't pinned to a digest are identified by the digest they resolve to.
+	in.Dockerfile = "FROM python:3.10-buster\nCOPY . .\n"
+	_, err := Fingerprint(in)
+	require.ErrorContains(err, "base image python:3.10-buster isn't pinned to a digest")
+	in.BaseImageDigests = map[string]string{"python:3.10-buster": "sha256:abc"}
+	resolved := fingerprint(in)
+	in.BaseImageDigests = map[string]string{"python:3.10-buster": "sha256:def"}
+	require.NotEqual(resolved, fingerprint(in))
+}
+
+type fakeInspector struct {
+	digests map[string]string
+	auths   map[string]string
+}
+
+func (f *fakeInspector) DistributionInspect(ctx context.Context, image, encodedRegistryAuth string) (registry.DistributionInspect, error) {
+	d, ok := f.digests[image]
+	if !ok {
+		return registry.DistributionInspect{}, errors.Errorf("%s: manifest unknown", image)
+	}
+	f.auths[image] = encodedRegistryAuth
+	return registry.DistributionInspect{Descriptor: ocispec.Descriptor{Digest: digest.Digest(d)}}, nil
+}
+
+func TestResolveBaseImages(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	inspector := &fakeInspector{
+		digests: map[string]string{
+			"python:3.10":                    "sha256:python",
+			"ghcr.io/airplanedev/base:v1":    "sha256:base",
+			"ghcr.io/airplanedev/missing:v1": "",
+		},
+		auths: map[string]string{},
+	}
+	auth := &RegistryAuth{
+		Repo: "ghcr.io/airplanedev",
+		Credentials: StaticCredentials{
+			Host:     "ghcr.io",
+			Username: "octocat",
+			Password: "ghp_123",
+		},
+	}
+	digests, err := resolveBaseImages(ctx, inspector, auth, `
+		FROM python:3.10 AS builder
+		FROM ghcr.io/airplanedev/base:v1
+		FROM node:18@sha256:node
+		FROM python:3.10
+		COPY --from=builder /app /app
+	`)
+	require.NoError(err)
+	require.Equal(map[string]string{
+		"python:3.10":                 "sha256:python",
+		"ghcr.io/airplanedev/base:v1": "sha256:base",
+	}, digests)
+
+	// Images are resolved with the credentials of their registry, if any.
+	require.Equal("", inspector.auths["python:3.10"])
+	authjson, err := base64.URLEncoding.DecodeString(inspector.auths["ghcr.io/airplanedev/base:v1"])
+	require.NoError(err)
+	var config types.AuthConfig
+	require.NoError(json.Unmarshal(authjson, &config))
+	require.Equal(types.AuthConfig{Username: "octocat", Password: "ghp_123", ServerAddress: "ghcr.io"}, config)
+
+	_, err = resolveBaseImages(ctx, inspector, nil, "FROM ghcr.io/airplanedev/unknown:v1\n")
+	require.ErrorContains(err, "resolving base image ghcr.io/airplanedev/unknown:v1")
+	_, err = resolveBaseImages(ctx, inspector, nil, "FROM ghcr.io/airplanedev/missing:v1\n")
+	require.ErrorContains(err, "registry returned no digest")
+}
+
+func TestBaseImages(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal([]string{"node:18@sha256:abc", "nginx:alpine"}, baseImages(`
+		FROM node:18@sha256:abc as builder
+		RUN yarn build
+		FROM --platform=linux/amd64 builder AS other
+		from builder as final
+		FROM nginx:alpine
+		COPY --from=builder /dist /usr/share/nginx/html
+	`))
+	require.Empty(baseImages("RUN echo FROM"))
+}
@@ -0,0 +1,421 @@
+package build
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/airplanedev/lib/pkg/utils/fsx"
+	"github.com/pkg/errors"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	DefaultGoVersion = BuildTypeVersionGo120
+
+	// DefaultGoEntrypointFunc is the function that the shim calls if the task doesn't
+	// configure an entrypointFunc.
+	DefaultGoEntrypointFunc = "Main"
+
+	// goRuntimeVersion is the key in versions.json of the base image that Go tasks run in.
+	// Task binaries are statically linked, so they only need CA certificates and timezone data.
+	goRuntimeVersion = "static-debian11"
+	// nameDistroless is the key in versions.json of the distroless images that tasks run in.
+	nameDistroless Name = "distroless"
+
+	// goBundleBinDir is the directory that the binaries of a bundle are written to.
+	goBundleBinDir = "/airplane/.airplane/bin"
+)
+
+//go:embed go-shim.go.tmpl
+var goShim string
+
+// GoMod are the parts of a go.mod that Go builds need.
+type GoMod struct {
+	// Module is the module path, e.g. "github.com/airplanedev/tasks".
+	Module string
+	// Go is the version of the `go` directive, e.g. "1.19". It is empty if the go.mod
+	// doesn't have one.
+	Go string
+}
+
+// ReadGoMod reads the go.mod in `root`.
+func ReadGoMod(root string) (GoMod, error) {
+	f, err := os.Open(filepath.Join(root, "go.mod"))
+	if err != nil {
+		return GoMod{}, errors.Wrap(err, "opening go.mod")
+	}
+	defer f.Close()
+
+	var mod GoMod
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		switch fields[0] {
+		case "module":
+			mod.Module = fields[1]
+			if unquoted, err := strconv.Unquote(mod.Module); err == nil {
+				mod.Module = unquoted
+			}
+		case "go":
+			mod.Go = fields[1]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return GoMod{}, errors.Wrap(err, "reading go.mod")
+	}
+	if mod.Module == "" {
+		return GoMod{}, errors.New("go.mod is missing a module directive")
+	}
+	return mod, nil
+}
+
+type GoShimParams struct {
+	// ImportPath is the import path of the task's package.
+	ImportPath string
+	// EntrypointFunc is the function of the task's package that the shim calls, unless
+	// another one is selected by an argument. Defaults to DefaultGoEntrypointFunc.
+	EntrypointFunc string
+	// EntrypointFuncs are the functions of the task's package that can be selected by an
+	// argument, so that the tasks of a package can share a binary. Defaults to
+	// EntrypointFunc.
+	EntrypointFuncs []string
+}
+
+// GoShim generates the main package that runs a Go task. It calls the task's entrypoint
+// function with the params, passed as a JSON argument, and sets the returned value as the
+// task's output. If the shim is passed two arguments, the first is the name of the function
+// to call.
+func GoShim(params GoShimParams) (string, error) {
+	if params.EntrypointFunc == "" {
+		params.EntrypointFunc = DefaultGoEntrypointFunc
+	}
+	if len(params.EntrypointFuncs) == 0 {
+		params.EntrypointFuncs = []string{params.EntrypointFunc}
+	}
+	for _, fn := range append([]string{params.EntrypointFunc}, params.EntrypointFuncs...) {
+		if !token.IsIdentifier(fn) || !token.IsExported(fn) {
+			return "", errors.Errorf("entrypointFunc %q must be an exported Go function", fn)
+		}
+	}
+	shim, err := applyTemplate(goShim, struct {
+		ImportPath      string
+		EntrypointFunc  string
+		EntrypointFuncs []string
+	}{
+		ImportPath:      backslashEscape(params.ImportPath, `"`),
+		EntrypointFunc:  params.EntrypointFunc,
+		EntrypointFuncs: params.EntrypointFuncs,
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "rendering shim")
+	}
+
+	return shim, nil
+}
+
+// GoImportPath returns the import path of the package of `entrypoint`, a path relative
+// to the root of the module. The package may not be a main package, since those can't be
+// imported by the shim.
+func GoImportPath(root string, mod GoMod, entrypoint string) (string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), filepath.Join(root, entrypoint), nil, parser.PackageClauseOnly)
+	if err != nil {
+		return "", errors.Wrapf(err, "parsing %s", entrypoint)
+	}
+	if f.Name.Name == "main" {
+		return "", errors.Errorf("%s is in package main: the entrypoint of a Go task must be in an importable package", entrypoint)
+	}
+
+	dir := path.Dir(filepath.ToSlash(entrypoint))
+	if dir == "." {
+		return mod.Module, nil
+	}
+	return path.Join(mod.Module, dir), nil
+}
+
+// GoExportedFuncs returns the exported functions of the file at `entrypoint`, a path
+// relative to `root`, that a task can use as its entrypointFunc. Methods and generic
+// functions are skipped, since they can't be called without a receiver or type arguments.
+func GoExportedFuncs(root string, entrypoint string) ([]string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), filepath.Join(root, entrypoint), nil, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, errors.Wrapf(err, "parsing %s", entrypoint)
+	}
+	var funcs []string
+	for _, decl := range f.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv != nil || fn.Type.TypeParams != nil || !fn.Name.IsExported() {
+			continue
+		}
+		funcs = append(funcs, fn.Name.Name)
+	}
+	return funcs, nil
+}
+
+// GoBinaryPath returns the path of the binary that a bundle build compiles for the task
+// at `entrypoint`. Binaries are built per package, so tasks in the same package share
+// a binary, and select their entrypointFunc with an argument.
+func GoBinaryPath(entrypoint string) string {
+	return goPackageBinaryPath(path.Dir(filepath.ToSlash(entrypoint)))
+}
+
+func goPackageBinaryPath(dir string) string {
+	return path.Join(goBundleBinDir, dir, "airplane-task")
+}
+
+// golang creates a dockerfile for a Go task. The task is compiled into a static binary
+// in a builder stage, which is copied into a minimal image.
+func golang(root string, options KindOptions, buildArgs []string, buildOpts dockerfileOptions) (string, error) {
+	entrypoint, _ := options["entrypoint"].(string)
+	if entrypoint == "" {
+		return "", errors.New("entrypoint is unexpectedly missing")
+	}
+	if err := fsx.AssertExistsAll(filepath.Join(root, entrypoint)); err != nil {
+		return "", err
+	}
+
+	mod, err := ReadGoMod(root)
+	if err != nil {
+		return "", err
+	}
+	importPath, err := GoImportPath(root, mod, entrypoint)
+	if err != nil {
+		return "", err
+	}
+	entrypointFunc, _ := options["entrypointFunc"].(string)
+	shim, err := GoShim(GoShimParams{
+		ImportPath:     importPath,
+		EntrypointFunc: entrypointFunc,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	version, _ := options["version"].(string)
+	base, err := goBaseImage(BuildTypeVersion(version), buildOpts)
+	if err != nil {
+		return "", err
+	}
+	runtime, err := goRuntimeImage(buildOpts)
+	if err != nil {
+		return "", err
+	}
+
+	dockerfile := heredoc.Doc(`
+		FROM {{if .CrossCompile}}--platform=$BUILDPLATFORM {{end}}{{.Base}} AS builder
+		{{- if .CrossCompile}}
+		ARG TARGETOS
+		ARG TARGETARCH
+		{{- end}}
+
+		WORKDIR /airplane
+
+		{{.Args}}
+
+		COPY go.* ./
+		RUN {{.RunMounts}}go mod download
+
+		COPY . .
+		RUN mkdir -p .airplane/shim && {{.InlineShim}} > .airplane/shim/main.go
+		RUN {{.RunMounts}}CGO_ENABLED=0 {{.GoEnv}}\
+			go build -trimpath -ldflags="-s -w" -o /airplane/.airplane/task ./.airplane/shim
+
+		FROM {{.RuntimeImage}}
+		WORKDIR /airplane
+		COPY --from=builder /airplane/.airplane/task /airplane/task
+		ENTRYPOINT ["/airplane/task"]
+	`)
+	return applyTemplate(dockerfile, goTemplateParams(base, runtime, buildArgs, shim, buildOpts))
+}
+
+// golangBundle creates a dockerfile for all Go tasks within a task root. A binary is built
+// for the package of each file in `filesToBuild`, at GoBinaryPath, which can call any of the
+// exported functions of the package's files in `filesToBuild`.
+func golangBundle(root string, buildContext BuildContext, buildArgs []string, filesToBuild []string, buildOpts dockerfileOptions) (string, error) {
+	mod, err := ReadGoMod(root)
+	if err != nil {
+		return "", err
+	}
+	base, err := goBaseImage(buildContext.Version, buildOpts)
+	if err != nil {
+		return "", err
+	}
+	runtime, err := goRuntimeImage(buildOpts)
+	if err != nil {
+		return "", err
+	}
+
+	// Each package is only built once.
+	packages := map[string]string{}
+	funcs := map[string][]string{}
+	for _, file := range filesToBuild {
+		dir := path.Dir(filepath.ToSlash(file))
+		fileFuncs, err := GoExportedFuncs(root, file)
+		if err != nil {
+			return "", err
+		}
+		if len(fileFuncs) == 0 {
+			return "", errors.Errorf("%s has no exported functions for a task to call", file)
+		}
+		for _, fn := range fileFuncs {
+			if !slices.Contains(funcs[dir], fn) {
+				funcs[dir] = append(funcs[dir], fn)
+			}
+		}
+		if _, ok := packages[dir]; ok {
+			continue
+		}
+		importPath, err := GoImportPath(root, mod, file)
+		if err != nil {
+			return "", err
+		}
+		packages[dir] = importPath
+	}
+	dirs := make([]string, 0, len(packages))
+	for dir := range packages {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	var shims, builds []string
+	for _, dir := range dirs {
+		sort.Strings(funcs[dir])
+		shim, err := GoShim(GoShimParams{
+			ImportPath:      packages[dir],
+			EntrypointFuncs: funcs[dir],
+		})
+		if err != nil {
+			return "", err
+		}
+		shimDir := path.Join(".airplane/shims", dir)
+		shims = append(shims, fmt.Sprintf("RUN mkdir -p %s && %s > %s/main.go", shimDir, inlineString(shim), shimDir))
+		builds = append(builds, fmt.Sprintf("-o %s ./%s", goPackageBinaryPath(dir), shimDir))
+	}
+
+	dockerfile := heredoc.Doc(`
+		FROM {{if .CrossCompile}}--platform=$BUILDPLATFORM {{end}}{{.Base}} AS builder
+		{{- if .CrossCompile}}
+		ARG TARGETOS
+		ARG TARGETARCH
+		{{- end}}
+
+		WORKDIR /airplane
+
+		{{.Args}}
+
+		COPY go.* ./
+		RUN {{.RunMounts}}go mod download
+
+		COPY . .
+		{{- range .Shims}}
+		{{.}}
+		{{- end}}
+		{{- range .Builds}}
+		RUN {{$.RunMounts}}CGO_ENABLED=0 {{$.GoEnv}}\
+			go build -trimpath -ldflags="-s -w" {{.}}
+		{{- end}}
+
+		FROM {{.RuntimeImage}}
+		WORKDIR /airplane
+		COPY --from=builder {{.BinDir}} {{.BinDir}}
+		# Set an empty entrypoint to override any entrypoints that may be set in the base image.
+		ENTRYPOINT []
+	`)
+	params := goTemplateParams(base, runtime, buildArgs, "", buildOpts)
+	return applyTemplate(dockerfile, struct {
+		goDockerfileParams
+		Shims  []string
+		Builds []string
+		BinDir string
+	}{
+		goDockerfileParams: params,
+		Shims:              shims,
+		Builds:             builds,
+		BinDir:             goBundleBinDir,
+	})
+}
+
+type goDockerfileParams struct {
+	Base         string
+	RuntimeImage string
+	Args         string
+	InlineShim   string
+	RunMounts    string
+	// CrossCompile compiles on the platform of the build host, for the target platform.
+	CrossCompile bool
+	// GoEnv are the environment variables, followed by a space, that select the platform
+	// that `go build` compiles for, if any.
+	GoEnv string
+}
+
+func goTemplateParams(base, runtime string, buildArgs []string, shim string, buildOpts dockerfileOptions) goDockerfileParams {
+	params := goDockerfileParams{
+		Base:         base,
+		RuntimeImage: runtime,
+		Args:         makeArgsCommand(buildArgs),
+	}
+	if shim != "" {
+		params.InlineShim = inlineString(shim)
+	}
+	if buildOpts.CacheMounts {
+		params.RunMounts = runMounts("go build")
+	}
+	if buildOpts.BuildKit {
+		params.CrossCompile = true
+		params.GoEnv = "GOOS=$TARGETOS GOARCH=$TARGETARCH "
+	}
+	return params
+}
+
+// goBaseImage returns the image that Go tasks are compiled with.
+func goBaseImage(version BuildTypeVersion, buildOpts dockerfileOptions) (string, error) {
+	if version == BuildTypeVersionUnspecified {
+		version = DefaultGoVersion
+	}
+	v, err := GetVersion(NameGo, string(version), false)
+	if err != nil {
+		return "", err
+	}
+	// With BuildKit, the compiler runs on the platform of the build host and cross-compiles
+	// for the target platform, so the image can't be pinned to a single platform's digest.
+	// The legacy builder runs the compiler on the target platform.
+	base := v.Ref(buildOpts.Platforms)
+	if buildOpts.BuildKit {
+		base = v.BuildPlatformRef()
+	}
+	if base == "" {
+		return "", errors.Errorf("unsupported Go version %q", version)
+	}
+	return base, nil
+}
+
+// goRuntimeImage returns the image that Go tasks run in. The runtime stage is always built for
+// the target platform, so it is pinned to the digest of each platform that is built.
+func goRuntimeImage(buildOpts dockerfileOptions) (string, error) {
+	v, err := GetVersion(nameDistroless, goRuntimeVersion, false)
+	if err != nil {
+		return "", err
+	}
+	runtime := v.Ref(buildOpts.Platforms)
+	if runtime == "" {
+		return "", errors.Errorf("unknown runtime image %q", goRuntimeVersion)
+	}
+	return runtime, nil
+}
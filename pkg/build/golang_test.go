@@ -0,0 +1,328 @@
+package build
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/airplanedev/lib/pkg/examples"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoBuilder(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []Test{
+		{
+			// Builds with the legacy builder, which doesn't set the platform build args.
+			Root: "go/simple",
+			Kind: TaskKindGo,
+			Options: KindOptions{
+				"entrypoint": "main.go",
+			},
+		},
+		{
+			Root: "go/mainpackage",
+			Kind: TaskKindGo,
+			Options: KindOptions{
+				"entrypoint": "main.go",
+			},
+			ExpectedError: true,
+		},
+		{
+			Root: "go/bundle",
+			Kind: TaskKindGo,
+			BuildContext: BuildContext{
+				Type:    GoBuildType,
+				Version: BuildTypeVersionGo120,
+			},
+			ParamValues: Values{
+				"name": "Airplane",
+				"role": "Astronaut",
+			},
+			Bundle:       true,
+			FilesToBuild: []string{"hello/hello.go", "users/users.go"},
+			BundleRuns: []BundleTestRun{
+				{
+					RelEntrypoint: "hello/hello.go",
+					SearchString:  `airplane_output_set "Hello, Airplane!"`,
+				},
+				{
+					RelEntrypoint: "hello/hello.go",
+					ExportName:    "Goodbye",
+					SearchString:  `airplane_output_set "Goodbye, Airplane!"`,
+				},
+				{
+					RelEntrypoint: "users/users.go",
+					SearchString:  `airplane_output_set [{"id":6,"name":"Andrea Lopez","role":"Astronaut"}`,
+				},
+			},
+		},
+	}
+
+	RunTests(t, ctx, tests)
+}
+
+func TestReadGoMod(t *testing.T) {
+	require := require.New(t)
+
+	mod, err := ReadGoMod(examples.Path(t, "go/bundle"))
+	require.NoError(err)
+	require.Equal(GoMod{Module: "github.com/airplanedev/examples/bundle", Go: "1.20"}, mod)
+
+	root := t.TempDir()
+	require.NoError(os.WriteFile(filepath.Join(root, "go.mod"), []byte(`// Tasks.
+module "example.com/tasks" // quoted
+
+require (
+	github.com/pkg/errors v0.9.1
+)
+`), 0644))
+	mod, err = ReadGoMod(root)
+	require.NoError(err)
+	require.Equal(GoMod{Module: "example.com/tasks"}, mod)
+
+	require.NoError(os.WriteFile(filepath.Join(root, "go.mod"), []byte("go 1.20\n"), 0644))
+	_, err = ReadGoMod(root)
+	require.ErrorContains(err, "missing a module directive")
+}
+
+func TestGoImportPath(t *testing.T) {
+	require := require.New(t)
+
+	root := examples.Path(t, "go/bundle")
+	mod, err := ReadGoMod(root)
+	require.NoError(err)
+
+	importPath, err := GoImportPath(root, mod, "users/users.go")
+	require.NoError(err)
+	require.Equal("github.com/airplanedev/examples/bundle/users", importPath)
+
+	root = examples.Path(t, "go/simple")
+	mod, err = ReadGoMod(root)
+	require.NoError(err)
+	importPath, err = GoImportPath(root, mod, "main.go")
+	require.NoError(err)
+	require.Equal("github.com/airplanedev/examples/simple", importPath)
+
+	root = examples.Path(t, "go/mainpackage")
+	mod, err = ReadGoMod(root)
+	require.NoError(err)
+	_, err = GoImportPath(root, mod, "main.go")
+	require.ErrorContains(err, "package main")
+}
+
+func TestGoDockerfile(t *testing.T) {
+	require := require.New(t)
+
+	dockerfile, err := BuildDockerfile(DockerfileConfig{
+		Builder:      string(NameGo),
+		Root:         examples.Path(t, "go/simple"),
+		Options:      KindOptions{"entrypoint": "main.go", "version": "1.19"},
+		BuildArgKeys: []string{"GOPROXY"},
+	})
+	require.NoError(err)
+	v, err := GetVersion(NameGo, "1.19", false)
+	require.NoError(err)
+	// The legacy builder doesn't set the platform build args, so the compiler runs on the
+	// target platform.
+	require.True(strings.HasPrefix(dockerfile, "FROM "+v.Ref(nil)+" AS builder\n"), dockerfile)
+	require.NotContains(dockerfile, "$BUILDPLATFORM")
+	require.NotContains(dockerfile, "$TARGETOS")
+	require.Contains(dockerfile, "RUN CGO_ENABLED=0 \\\n\tgo build ")
+	require.Contains(dockerfile, "ARG GOPROXY\n")
+	require.Contains(dockerfile, `task "github.com/airplanedev/examples/simple"`)
+	require.Contains(dockerfile, "-o /airplane/.airplane/task ./.airplane/shim\n")
+	runtime, err := GetVersion(nameDistroless, goRuntimeVersion, false)
+	require.NoError(err)
+	require.Contains(dockerfile, "FROM "+runtime.Ref(nil)+"\n")
+	require.Contains(dockerfile, `ENTRYPOINT ["/airplane/task"]`)
+
+	// BuildKit compiles on the platform of the build host and cross-compiles for the target.
+	dockerfile, err = BuildDockerfile(DockerfileConfig{
+		Builder:   string(NameGo),
+		Root:      examples.Path(t, "go/simple"),
+		Options:   KindOptions{"entrypoint": "main.go", "version": "1.19"},
+		BuildKit:  true,
+		Platforms: []Platform{PlatformLinuxAMD64, PlatformLinuxARM64},
+	})
+	require.NoError(err)
+	require.True(strings.HasPrefix(dockerfile, "FROM --platform=$BUILDPLATFORM "+v.BuildPlatformRef()+" AS builder\nARG TARGETOS\nARG TARGETARCH\n"), dockerfile)
+	require.Contains(dockerfile, "RUN CGO_ENABLED=0 GOOS=$TARGETOS GOARCH=$TARGETARCH \\\n\tgo build ")
+
+	_, err = BuildDockerfile(DockerfileConfig{
+		Builder: string(NameGo),
+		Root:    examples.Path(t, "go/simple"),
+		Options: KindOptions{"entrypoint": "main.go", "version": "1.12"},
+	})
+	require.ErrorContains(err, `unsupported Go version "1.12"`)
+
+	dockerfile, err = BuildBundleDockerfile(BundleDockerfileConfig{
+		BuildContext: BuildContext{Type: GoBuildType},
+		Root:         examples.Path(t, "go/bundle"),
+		FilesToBuild: []string{"users/users.go", "hello/hello.go", "users/users.go"},
+		CacheMounts:  true,
+	})
+	require.NoError(err)
+	v, err = GetVersion(NameGo, string(DefaultGoVersion), false)
+	require.NoError(err)
+	require.Contains(dockerfile, "FROM --platform=$BUILDPLATFORM "+v.BuildPlatformRef()+" AS builder\n")
+	require.Contains(dockerfile, "RUN mkdir -p .airplane/shims/hello && ")
+	require.Contains(dockerfile, `task "github.com/airplanedev/examples/bundle/users"`)
+	require.Contains(dockerfile, `"Goodbye": task.Goodbye,`)
+	require.Contains(dockerfile, `"Main": task.Main,`)
+	require.Contains(dockerfile, "RUN --mount=type=cache,id=airplane-go-mod,target=/go/pkg/mod ")
+	require.Contains(dockerfile, `go build -trimpath -ldflags="-s -w" -o /airplane/.airplane/bin/hello/airplane-task ./.airplane/shims/hello`+"\n")
+	require.Contains(dockerfile, `go build -trimpath -ldflags="-s -w" -o /airplane/.airplane/bin/users/airplane-task ./.airplane/shims/users`+"\n")
+	require.Contains(dockerfile, "COPY --from=builder /airplane/.airplane/bin /airplane/.airplane/bin\n")
+}
+
+func TestGoExportedFuncs(t *testing.T) {
+	require := require.New(t)
+
+	root := t.TempDir()
+	require.NoError(os.WriteFile(filepath.Join(root, "task.go"), []byte(`package task
+
+type T struct{}
+
+func Main() {}
+func (T) Method() {}
+func Generic[V any](v V) {}
+func unexported() {}
+func ListUsers() {}
+`), 0644))
+	funcs, err := GoExportedFuncs(root, "task.go")
+	require.NoError(err)
+	require.Equal([]string{"Main", "ListUsers"}, funcs)
+}
+
+func TestGoShim(t *testing.T) {
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go is not installed")
+	}
+
+	for _, test := range []struct {
+		name   string
+		code   string
+		funcs  []string
+		args   []string
+		params string
+		output string
+		err    bool
+	}{
+		{
+			name:   "context, params, output and error",
+			code:   "func Main(ctx context.Context, params struct{ N int }) (int, error) { return params.N * 2, nil }",
+			params: `{"N": 21}`,
+			output: "airplane_output_set 42\n",
+		},
+		{
+			name:   "params only",
+			code:   "func Main(params map[string]interface{}) map[string]interface{} { return params }",
+			params: `{"a": "b"}`,
+			output: "airplane_output_set {\"a\":\"b\"}\n",
+		},
+		{
+			name:   "no output",
+			code:   "func Main(ctx context.Context) error { fmt.Println(\"hello\"); return nil }",
+			params: `{}`,
+			output: "hello\n",
+		},
+		{
+			name:   "error",
+			code:   "func Main(ctx context.Context) (string, error) { return \"\", errors.New(\"oops\") }",
+			params: `{}`,
+			output: "airplane_output_set:error \"oops\"\n",
+			err:    true,
+		},
+		{
+			name:   "panic",
+			code:   "func Main() { panic(\"oops\") }",
+			params: `{}`,
+			output: "airplane_output_set:error \"panic: oops\"\n",
+			err:    true,
+		},
+		{
+			name:   "invalid params",
+			code:   "func Main(params struct{ N int }) {}",
+			params: `{"N": "one"}`,
+			output: "airplane_output_set:error \"decoding params into struct { N int }: json: cannot unmarshal",
+			err:    true,
+		},
+		{
+			name:   "selected function",
+			code:   "func Main() string { return \"main\" }\nfunc Other() string { return \"other\" }",
+			funcs:  []string{"Main", "Other"},
+			args:   []string{"Other"},
+			params: `{}`,
+			output: "airplane_output_set \"other\"\n",
+		},
+		{
+			name:   "default function",
+			code:   "func Main() string { return \"main\" }\nfunc Other() string { return \"other\" }",
+			funcs:  []string{"Main", "Other"},
+			params: `{}`,
+			output: "airplane_output_set \"main\"\n",
+		},
+		{
+			name:   "unknown function",
+			code:   "func Main() {}",
+			args:   []string{"Other"},
+			params: `{}`,
+			output: "airplane_output_set:error \"Other is not an exported function of the task's package.",
+			err:    true,
+		},
+		{
+			name:   "unsupported signature",
+			code:   "func Main(a, b string) {}",
+			params: `{}`,
+			output: "airplane_output_set:error \"Main has an unsupported signature func(string, string). Use func(context.Context, Params) (Output, error) instead.\"\n",
+			err:    true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+			root := t.TempDir()
+			require.NoError(os.WriteFile(filepath.Join(root, "go.mod"), []byte("module example.com/tasks\n\ngo 1.19\n"), 0644))
+			require.NoError(os.WriteFile(filepath.Join(root, "task.go"), []byte(`package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var _, _, _ = context.Background, errors.New, fmt.Println
+
+`+test.code+"\n"), 0644))
+
+			shim, err := GoShim(GoShimParams{ImportPath: "example.com/tasks", EntrypointFuncs: test.funcs})
+			require.NoError(err)
+			require.NoError(os.MkdirAll(filepath.Join(root, ".airplane", "shim"), 0755))
+			require.NoError(os.WriteFile(filepath.Join(root, ".airplane", "shim", "main.go"), []byte(shim), 0644))
+
+			args := append(append([]string{"run", "./.airplane/shim"}, test.args...), test.params)
+			cmd := exec.Command("go", args...)
+			cmd.Dir = root
+			var stdout, stderr []byte
+			stdout, err = cmd.Output()
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				stderr = exitErr.Stderr
+			}
+			if test.err {
+				require.Error(err)
+			} else {
+				require.NoError(err, string(stderr))
+			}
+			require.Contains(string(stdout), test.output)
+		})
+	}
+
+	_, err := GoShim(GoShimParams{ImportPath: "example.com/tasks", EntrypointFunc: "main"})
+	require.ErrorContains(t, err, "must be an exported Go function")
+	_, err = GoShim(GoShimParams{ImportPath: "example.com/tasks", EntrypointFuncs: []string{"Main", "other"}})
+	require.ErrorContains(t, err, "must be an exported Go function")
+}
@@ -60,10 +60,14 @@ type templateParams struct {
 	// FilesToDiscover is a string of space-separated built js files to discover entity configs from.
 	// These files are the output of esbuild on FilesToBuild.
 	FilesToDiscover string
+	// NPMRunMounts are the BuildKit mounts of the steps that install the shim's dependencies,
+	// if cache mounts are enabled.
+	NPMRunMounts string
 }
 
 func getNodeBundleBuildInstructions(
 	root string,
+	nodeVersion string,
 	options KindOptions,
 ) (BuildInstructions, error) {
 	var err error
@@ -91,6 +95,8 @@ func getNodeBundleBuildInstructions(
 	pathYarnLock := filepath.Join(root, "yarn.lock")
 	isYarn := fsx.AssertExistsAll(pathYarnLock) == nil
 
+	isPnpm := usesPnpm(root)
+
 	pathPackageLock := filepath.Join(root, "package-lock.json")
 	hasPackageLock := fsx.AssertExistsAll(pathPackageLock) == nil
 
@@ -148,6 +154,13 @@ func getNodeBundleBuildInstructions(
 			return BuildInstructions{}, err
 		}
 		instructions = append(instructions, packageCopyInstructions...)
+		if isPnpm {
+			// pnpm keeps its lockfile and workspace config next to the root package.json.
+			instructions = append(instructions, InstallInstruction{
+				SrcPath: "pnpm-*.yaml",
+				DstPath: "/airplane/",
+			})
+		}
 
 		// Check all files for pre- or post-install scripts. If there are any found, then
 		// we to run the install with the entire codebase to be safe as opposed to
@@ -239,12 +252,17 @@ func getNodeBundleBuildInstructions(
 
 	instructions = append(instructions, preinstall...)
 
-	installCmd := makeInstallCommand(makeInstallCommandReq{
+	installCmd, err := makeInstallCommand(makeInstallCommandReq{
 		PkgInstallCommand: install,
 		RootPackageJSON:   rootPackageJSON,
+		NodeVersion:       nodeVersion,
 		IsYarn:            isYarn,
+		IsPnpm:            isPnpm,
 		HasPackageLock:    hasPackageLock,
 	})
+	if err != nil {
+		return BuildInstructions{}, err
+	}
 	instructions = append(instructions, InstallInstruction{
 		Cmd: installCmd,
 	})
@@ -360,6 +378,7 @@ func node(
 	root string,
 	options KindOptions,
 	buildArgs []string,
+	buildOpts dockerfileOptions,
 ) (string, error) {
 	var err error
 
@@ -367,7 +386,7 @@ func node(
 	// in the same way. Tasks built with the latest CLI will set
 	// shim=true which enables the new code path.
 	if shim, ok := options["shim"].(string); !ok || shim != "true" {
-		return nodeLegacyBuilder(root, options)
+		return nodeLegacyBuilder(root, options, buildOpts.Platforms)
 	}
 
 	// Assert that the entrypoint file exists:
@@ -386,6 +405,8 @@ func node(
 	pathYarnLock := filepath.Join(root, "yarn.lock")
 	isYarn := fsx.AssertExistsAll(pathYarnLock) == nil
 
+	isPnpm := usesPnpm(root)
+
 	pathPackageLock := filepath.Join(root, "package-lock.json")
 	hasPackageLock := fsx.AssertExistsAll(pathPackageLock) == nil
 
@@ -453,6 +474,10 @@ func node(
 		if err != nil {
 			return "", err
 		}
+		if isPnpm {
+			// pnpm keeps its lockfile and workspace config next to the root package.json.
+			cfg.PackageCopyCmds = append(cfg.PackageCopyCmds, "COPY pnpm-*.yaml /airplane/")
+		}
 
 		// Check all files for pre- or post-install scripts. If there are any found, then
 		// we to run the install with the entire codebase to be safe as opposed to
@@ -499,7 +524,7 @@ func node(
 
 	baseImageType, _ := options["base"].(BuildBase)
 	cfg.UseSlimImage = baseImageType == BuildBaseSlim
-	cfg.Base, err = getBaseNodeImage(cfg.NodeVersion, cfg.UseSlimImage)
+	cfg.Base, err = getBaseNodeImage(cfg.NodeVersion, cfg.UseSlimImage, buildOpts.Platforms)
 	if err != nil {
 		return "", err
 	}
@@ -535,12 +560,21 @@ func node(
 		cfg.InlineTaskShim = inlineString(shim)
 	}
 
-	cfg.InstallCommand = makeInstallCommand(makeInstallCommandReq{
+	cfg.InstallCommand, err = makeInstallCommand(makeInstallCommandReq{
 		PkgInstallCommand: installCommand,
 		RootPackageJSON:   rootPackageJSON,
+		NodeVersion:       cfg.NodeVersion,
 		IsYarn:            isYarn,
+		IsPnpm:            isPnpm,
 		HasPackageLock:    hasPackageLock,
 	})
+	if err != nil {
+		return "", err
+	}
+	if buildOpts.CacheMounts {
+		cfg.InstallCommand = withRunMounts(cfg.InstallCommand)
+		cfg.NPMRunMounts = runMounts("npm install")
+	}
 
 	// For safety purposes, we need to install from the full code if either (1) there are any
 	// hook scripts in the package.json files or (2) there's an airplane preinstall
@@ -587,13 +621,13 @@ func node(
 		# postinstall scripts. We run as root with --unsafe-perm instead, skipping
 		# that lookup. Possibly could fix by building for linux/arm on m1 instead
 		# of always building for linux/amd64.
-		RUN npm install -g esbuild@0.12 --unsafe-perm
+		RUN {{.NPMRunMounts}}npm install -g esbuild@0.12 --unsafe-perm
 
 		# npm >= 7 will automatically install peer dependencies, even if they're satisfied by the root. This is
 		# problematic because we need the @airplane/workflow-runtime package to register the workflow runtime in the
 		# runtime map that is utilized by the user's code, and so we explicitly request legacy behavior in this
 		# instance, which does not install peer dependencies by default.
-		RUN mkdir -p /airplane/.airplane && \
+		RUN {{.NPMRunMounts}}mkdir -p /airplane/.airplane && \
 			cd /airplane/.airplane && \
 			{{.InlineShimPackageJSON}} > package.json && \
 			npm install --legacy-peer-deps
@@ -790,7 +824,7 @@ func TemplateEntrypoint(script string, params NodeShimParams) (string, error) {
 //
 // TODO(amir): possibly just run `npm start` instead of exposing lots
 // of options to users?
-func nodeLegacyBuilder(root string, options KindOptions) (string, error) {
+func nodeLegacyBuilder(root string, options KindOptions, platforms []Platform) (string, error) {
 	instructions, err := getNodeLegacyBuildInstructions(root, options)
 	if err != nil {
 		return "", err
@@ -821,7 +855,7 @@ func nodeLegacyBuilder(root string, options KindOptions) (string, error) {
 	}
 	entrypoint = path.Join(buildWorkdir, entrypoint)
 
-	baseImage, err := getBaseNodeImage(GetNodeVersion(options), false)
+	baseImage, err := getBaseNodeImage(GetNodeVersion(options), false, platforms)
 	if err != nil {
 		return "", err
 	}
@@ -852,7 +886,7 @@ func nodeLegacyBuilder(root string, options KindOptions) (string, error) {
 	})
 }
 
-func getBaseNodeImage(version string, slim bool) (string, error) {
+func getBaseNodeImage(version string, slim bool, platforms []Platform) (string, error) {
 	if version == "" {
 		version = string(DefaultNodeVersion)
 	}
@@ -860,7 +894,7 @@ func getBaseNodeImage(version string, slim bool) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	base := v.String()
+	base := v.Ref(platforms)
 	if base == "" {
 		// Assume the version is already a more-specific version - default to just returning it back
 		base = "node:" + version + "-buster"
@@ -957,6 +991,7 @@ func nodeBundle(
 	buildArgs []string,
 	filesToBuild []string,
 	filesToDiscover []string,
+	buildOpts dockerfileOptions,
 ) (string, error) {
 	var err error
 
@@ -964,13 +999,16 @@ func nodeBundle(
 	// in the same way. Tasks built with the latest CLI will set
 	// shim=true which enables the new code path.
 	if shim, ok := options["shim"].(string); !ok || shim != "true" {
-		return nodeLegacyBuilder(root, options)
+		return nodeLegacyBuilder(root, options, buildOpts.Platforms)
 	}
 
-	instructions, err := getNodeBundleBuildInstructions(root, options)
+	instructions, err := getNodeBundleBuildInstructions(root, string(buildContext.VersionOrDefault()), options)
 	if err != nil {
 		return "", err
 	}
+	if buildOpts.CacheMounts {
+		instructions = instructions.withRunMounts()
+	}
 
 	workdir, _ := options["workdir"].(string)
 	rootPackageJSON := filepath.Join(root, "package.json")
@@ -1030,6 +1068,9 @@ func nodeBundle(
 		InlineWorkflowBundlerScript:      inlineString(workflowBundlerScript),
 		InlineWorkflowInterceptorsScript: inlineString(workflowInterceptorsScript),
 	}
+	if buildOpts.CacheMounts {
+		cfg.NPMRunMounts = runMounts("npm install")
+	}
 
 	// Generate a list of all of the files to build
 	var buildEntrypoints []string
@@ -1078,7 +1119,7 @@ func nodeBundle(
 	}
 
 	cfg.UseSlimImage = buildContext.Base == BuildBaseSlim
-	cfg.Base, err = getBaseNodeImage(cfg.NodeVersion, cfg.UseSlimImage)
+	cfg.Base, err = getBaseNodeImage(cfg.NodeVersion, cfg.UseSlimImage, buildOpts.Platforms)
 	if err != nil {
 		return "", err
 	}
@@ -1138,7 +1179,7 @@ func nodeBundle(
 		ENV NODE_ENV=production
 		WORKDIR /airplane{{.Workdir}}
 		
-		RUN mkdir -p /airplane/.airplane && \
+		RUN {{.NPMRunMounts}}mkdir -p /airplane/.airplane && \
 			cd /airplane/.airplane && \
 			{{.InlineWorkflowShimPackageJSON}} > package.json && \
 			npm install --legacy-peer-deps
@@ -1164,7 +1205,7 @@ func nodeBundle(
 		# problematic because we need the @airplane/workflow-runtime package to register the workflow runtime in the
 		# runtime map that is utilized by the user's code, and so we explicitly request legacy behavior in this
 		# instance, which does not install peer dependencies by default.
-		RUN mkdir -p /airplane/.airplane && \
+		RUN {{.NPMRunMounts}}mkdir -p /airplane/.airplane && \
 			cd /airplane/.airplane && \
 			{{.InlineShimPackageJSON}} > package.json && \
 			npm install --legacy-peer-deps
@@ -1215,11 +1256,13 @@ func isWorkflowRuntime(options KindOptions) bool {
 type makeInstallCommandReq struct {
 	PkgInstallCommand string
 	RootPackageJSON   string
+	NodeVersion       string
 	IsYarn            bool
+	IsPnpm            bool
 	HasPackageLock    bool
 }
 
-func makeInstallCommand(req makeInstallCommandReq) string {
+func makeInstallCommand(req makeInstallCommandReq) (string, error) {
 	installCommand := "npm install"
 	if req.PkgInstallCommand != "" {
 		installCommand = req.PkgInstallCommand
@@ -1236,6 +1279,18 @@ func makeInstallCommand(req makeInstallCommandReq) string {
 			// cache directory for storing packages.
 			installCommand = "yarn install --non-interactive --frozen-lockfile && yarn cache clean"
 		}
+	} else if req.IsPnpm {
+		// pnpm isn't bundled with Node, so install the version that the project uses first.
+		root := filepath.Dir(req.RootPackageJSON)
+		pnpm, err := pnpmPackage(root, req.NodeVersion)
+		if err != nil {
+			return "", err
+		}
+		installCommand = fmt.Sprintf("npm install -g %s && pnpm install", pnpm)
+		if fsx.Exists(filepath.Join(root, pnpmLockfile)) {
+			// Like yarn, fail if the lockfile is out of date rather than updating it.
+			installCommand += " --frozen-lockfile"
+		}
 	} else if req.HasPackageLock {
 		// Use npm ci if possible, since it's faster and behaves better:
 		// https://docs.npmjs.com/cli/v8/commands/npm-ci
@@ -1244,7 +1299,7 @@ func makeInstallCommand(req makeInstallCommandReq) string {
 	// Remove large binaries for platforms that we aren't using
 	installCommand += " && rm -Rf /airplane/node_modules/@swc/core-linux-x64-musl /airplane/node_modules/@temporalio/core-bridge/releases/aarch64* /airplane/node_modules/@temporalio/core-bridge/releases/*windows* /airplane/node_modules/@temporalio/core-bridge/releases/*darwin*"
 
-	return strings.ReplaceAll(installCommand, "\n", "\\n")
+	return strings.ReplaceAll(installCommand, "\n", "\\n"), nil
 }
 
 func makeArgsCommand(buildArgs []string) string {
@@ -9,10 +9,13 @@ import (
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/airplanedev/lib/pkg/utils/fsx"
 	"github.com/blang/semver/v4"
 	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
 )
 
 var (
@@ -224,7 +227,7 @@ func ListDependencies(pathPackageJSON string) (map[string]string, error) {
 // and pulling workspaces from it - this is a shortcut.
 func findWorkspacePackageJSONs(rootPackageJSON string) ([]string, error) {
 	var pathPackageJSONs []string
-	workspaceInfo, err := getYarnWorkspaceInfo(rootPackageJSON)
+	workspaceInfo, err := getWorkspaceInfo(rootPackageJSON)
 	if err != nil {
 		return nil, err
 	}
@@ -238,6 +241,12 @@ func findWorkspacePackageJSONs(rootPackageJSON string) ([]string, error) {
 }
 
 func hasWorkspaces(pathPackageJSON string) (bool, error) {
+	// pnpm ignores the workspaces of package.json in favor of pnpm-workspace.yaml.
+	patterns, ok, err := readPnpmWorkspace(filepath.Dir(pathPackageJSON))
+	if err != nil || ok {
+		return len(patterns) > 0, err
+	}
+
 	var pkg PackageJSON
 	buf, err := os.ReadFile(pathPackageJSON)
 	if errors.Is(err, os.ErrNotExist) {
@@ -379,9 +388,161 @@ func getYarnWorkspaceInfo(pathPackageJSON string) ([]yarnWorkspaceInfo, error) {
 	return infos, nil
 }
 
+const (
+	pnpmLockfile      = "pnpm-lock.yaml"
+	pnpmWorkspaceFile = "pnpm-workspace.yaml"
+)
+
+// usesPnpm returns true if the project at `root` is installed with pnpm.
+func usesPnpm(root string) bool {
+	return fsx.Exists(filepath.Join(root, pnpmLockfile)) || fsx.Exists(filepath.Join(root, pnpmWorkspaceFile))
+}
+
+// readPnpmWorkspace reads the package globs of the pnpm-workspace.yaml in `dir`. It returns false if
+// there is no pnpm-workspace.yaml.
+func readPnpmWorkspace(dir string) ([]string, bool, error) {
+	buf, err := os.ReadFile(filepath.Join(dir, pnpmWorkspaceFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, errors.Wrapf(err, "reading %s", pnpmWorkspaceFile)
+	}
+
+	var workspace struct {
+		Packages []string `yaml:"packages"`
+	}
+	if err := yaml.Unmarshal(buf, &workspace); err != nil {
+		return nil, false, errors.Wrapf(err, "parsing %s", pnpmWorkspaceFile)
+	}
+	return workspace.Packages, true, nil
+}
+
+// getPnpmWorkspaceInfo gets information about the pnpm workspace at `root`. Unlike yarn, pnpm
+// only links a workspace package if it is depended on with the `workspace:` protocol.
+func getPnpmWorkspaceInfo(root string) ([]yarnWorkspaceInfo, error) {
+	patterns, _, err := readPnpmWorkspace(root)
+	if err != nil {
+		return nil, err
+	}
+	var include, exclude []string
+	for _, pattern := range patterns {
+		if strings.HasPrefix(pattern, "!") {
+			exclude = append(exclude, cleanWorkspaceGlob(pattern[1:]))
+		} else {
+			include = append(include, cleanWorkspaceGlob(pattern))
+		}
+	}
+
+	// The root of the workspace is always one of its packages.
+	locations := []string{"."}
+	err = filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || path == root {
+			return nil
+		}
+		if d.Name() == "node_modules" || strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !fsx.Exists(filepath.Join(path, "package.json")) {
+			return nil
+		}
+		location, err := filepath.Rel(root, path)
+		if err != nil {
+			return errors.Wrap(err, "generating relative path")
+		}
+		location = filepath.ToSlash(location)
+		if matchesAnyWorkspaceGlob(include, location) && !matchesAnyWorkspaceGlob(exclude, location) {
+			locations = append(locations, location)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "finding pnpm workspace packages")
+	}
+
+	infos := make([]yarnWorkspaceInfo, len(locations))
+	specs := make([]map[string]string, len(locations))
+	names := map[string]bool{}
+	for i, location := range locations {
+		pathPackageJSON := filepath.Join(root, location, "package.json")
+		buf, err := os.ReadFile(pathPackageJSON)
+		if err != nil {
+			return nil, errors.Wrapf(err, "node: reading %s", pathPackageJSON)
+		}
+		var pkg struct {
+			Name string `json:"name"`
+		}
+		if err := json.Unmarshal(buf, &pkg); err != nil {
+			return nil, errors.Wrapf(err, "parsing %s", pathPackageJSON)
+		}
+		if specs[i], err = ListDependencies(pathPackageJSON); err != nil {
+			return nil, err
+		}
+		infos[i] = yarnWorkspaceInfo{Name: pkg.Name, Location: location}
+		names[pkg.Name] = true
+	}
+
+	for i := range infos {
+		for dep, spec := range specs[i] {
+			if names[dep] && strings.HasPrefix(spec, "workspace:") {
+				infos[i].WorkspaceDependencies = append(infos[i].WorkspaceDependencies, dep)
+			}
+		}
+		sort.Strings(infos[i].WorkspaceDependencies)
+	}
+	return infos, nil
+}
+
+func cleanWorkspaceGlob(pattern string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(pattern, "./"), "/")
+}
+
+func matchesAnyWorkspaceGlob(patterns []string, location string) bool {
+	for _, pattern := range patterns {
+		if matchWorkspaceGlob(strings.Split(pattern, "/"), strings.Split(location, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchWorkspaceGlob reports whether the elements of a slash-separated path match the elements of
+// a workspace glob, in which `**` matches any number of directories.
+func matchWorkspaceGlob(pattern, elems []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(elems); i++ {
+				if matchWorkspaceGlob(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elems) == 0 {
+			return false
+		}
+		if ok, _ := filepath.Match(pattern[0], elems[0]); !ok {
+			return false
+		}
+		pattern, elems = pattern[1:], elems[1:]
+	}
+	return len(elems) == 0
+}
+
+// getWorkspaceInfo gets information about the workspace that a package.json belongs to, from
+// pnpm-workspace.yaml for pnpm workspaces and from yarn otherwise.
+func getWorkspaceInfo(pathPackageJSON string) ([]yarnWorkspaceInfo, error) {
+	if root, ok := fsx.Find(filepath.Dir(pathPackageJSON), pnpmWorkspaceFile); ok {
+		return getPnpmWorkspaceInfo(root)
+	}
+	return getYarnWorkspaceInfo(pathPackageJSON)
+}
+
 // getWorkspaceDependencyPackages gets all local workspaces that are depended on by other workspaces.
 func getWorkspaceDependencyPackages(pathPackageJSON string) (map[string]bool, error) {
-	workspaceInfo, err := getYarnWorkspaceInfo(pathPackageJSON)
+	workspaceInfo, err := getWorkspaceInfo(pathPackageJSON)
 	if err != nil {
 		return nil, err
 	}
@@ -507,15 +668,238 @@ func getNPMLockPackageVersion(dir string, packageName string) (string, error) {
 	return packageObj.Version, nil
 }
 
+type pnpmLock struct {
+	LockfileVersion string `yaml:"lockfileVersion"`
+	// Importers are the projects of a workspace, keyed by their location.
+	Importers map[string]pnpmImporter `yaml:"importers"`
+	// Lockfiles of projects without workspaces list the dependencies of the project at the top level.
+	pnpmImporter `yaml:",inline"`
+	Packages     map[string]yaml.Node `yaml:"packages"`
+}
+
+type pnpmImporter struct {
+	Dependencies         map[string]pnpmLockDependency `yaml:"dependencies"`
+	DevDependencies      map[string]pnpmLockDependency `yaml:"devDependencies"`
+	OptionalDependencies map[string]pnpmLockDependency `yaml:"optionalDependencies"`
+}
+
+type pnpmLockDependency struct {
+	Version string
+}
+
+func (d *pnpmLockDependency) UnmarshalYAML(value *yaml.Node) error {
+	// Lockfiles before v6 map dependencies to their versions, later ones to a specifier and a version.
+	if value.Kind == yaml.ScalarNode {
+		d.Version = value.Value
+		return nil
+	}
+	var dep struct {
+		Version string `yaml:"version"`
+	}
+	if err := value.Decode(&dep); err != nil {
+		return err
+	}
+	d.Version = dep.Version
+	return nil
+}
+
+// version returns the version of a direct dependency of the importer. Dependencies on workspace
+// packages are linked rather than installed, so they don't have a version.
+func (i pnpmImporter) version(packageName string) (string, bool) {
+	for _, deps := range []map[string]pnpmLockDependency{i.Dependencies, i.DevDependencies, i.OptionalDependencies} {
+		dep, ok := deps[packageName]
+		if ok && !strings.HasPrefix(dep.Version, "link:") {
+			return trimPnpmPeerSuffix(dep.Version), true
+		}
+	}
+	return "", false
+}
+
+// trimPnpmPeerSuffix removes the peer dependencies that pnpm appends to versions, e.g.
+// "7.8.0(react@18.2.0)" or "7.8.0_react@18.2.0" before v6 lockfiles.
+func trimPnpmPeerSuffix(version string) string {
+	if i := strings.IndexAny(version, "(_"); i >= 0 {
+		return version[:i]
+	}
+	return version
+}
+
+func readPnpmLock(dir string) (pnpmLock, error) {
+	contents, err := os.ReadFile(filepath.Join(dir, pnpmLockfile))
+	if err != nil {
+		return pnpmLock{}, errors.Wrap(err, "reading pnpm-lock.yaml")
+	}
+
+	var lock pnpmLock
+	if err := yaml.Unmarshal(contents, &lock); err != nil {
+		return pnpmLock{}, errors.Wrap(err, "parsing pnpm-lock.yaml")
+	}
+	return lock, nil
+}
+
+// getPnpmLockPackageVersion tries to get the version of a package from a
+// pnpm-lock.yaml file in the argument directory. Direct dependencies of the
+// root project take precedence over those of other workspace projects, which
+// take precedence over transitive dependencies. If the file doesn't exist or
+// the package isn't in the file, an error is returned.
+func getPnpmLockPackageVersion(dir string, packageName string) (string, error) {
+	lock, err := readPnpmLock(dir)
+	if err != nil {
+		return "", err
+	}
+
+	importers := []pnpmImporter{lock.pnpmImporter, lock.Importers["."]}
+	var locations []string
+	for location := range lock.Importers {
+		if location != "." {
+			locations = append(locations, location)
+		}
+	}
+	sort.Strings(locations)
+	for _, location := range locations {
+		importers = append(importers, lock.Importers[location])
+	}
+	for _, importer := range importers {
+		if version, ok := importer.version(packageName); ok {
+			return version, nil
+		}
+	}
+
+	// Packages are keyed by e.g. "/react@18.2.0", "/react/18.2.0" before v6 lockfiles
+	// or "react@18.2.0" in v9 lockfiles. If there are several versions, use the highest.
+	var latest *semver.Version
+	for key := range lock.Packages {
+		key = strings.TrimPrefix(key, "/")
+		if !strings.HasPrefix(key, packageName) {
+			continue
+		}
+		rest := key[len(packageName):]
+		if len(rest) < 2 || (rest[0] != '@' && rest[0] != '/') {
+			continue
+		}
+		version, err := semver.Parse(trimPnpmPeerSuffix(rest[1:]))
+		if err != nil {
+			continue
+		}
+		if latest == nil || version.GT(*latest) {
+			latest = &version
+		}
+	}
+	if latest == nil {
+		return "", errors.Errorf("no version found for package %q", packageName)
+	}
+	return latest.String(), nil
+}
+
+// pnpmPackage returns the pnpm package to install the project at `root` with on Node
+// `nodeVersion`: the version that package.json pins with `packageManager`, the major version
+// that writes the lockfile's format, or else the latest major version that runs on that Node
+// version. It returns an error if the project needs a pnpm that does not run on it.
+func pnpmPackage(root string, nodeVersion string) (string, error) {
+	nodeMajor, err := strconv.Atoi(strings.Split(nodeVersion, ".")[0])
+	if err != nil {
+		return "", errors.Errorf("invalid node version %q", nodeVersion)
+	}
+
+	pkg := projectPnpmPackage(root)
+	if pkg == "" {
+		switch {
+		case nodeMajor < 16:
+			return "pnpm@7", nil
+		case nodeMajor < 18:
+			return "pnpm@8", nil
+		default:
+			return "pnpm", nil
+		}
+	}
+
+	version := strings.TrimPrefix(pkg, "pnpm@")
+	pnpmMajor, err := strconv.Atoi(strings.Split(version, ".")[0])
+	if err != nil {
+		return "", errors.Errorf("invalid pnpm version %q", version)
+	}
+	if minNode := pnpmMinNodeMajor(pnpmMajor); nodeMajor < minNode {
+		return "", errors.Errorf("this project uses pnpm %s, which requires Node %d or later, but the task uses Node %d: set nodeVersion to %d or later", version, minNode, nodeMajor, minNode)
+	}
+	return pkg, nil
+}
+
+// projectPnpmPackage returns the pnpm package that the project at `root` uses: the version
+// that package.json pins with `packageManager`, or the major version that writes the lockfile's
+// format. It returns an empty string if neither is known.
+func projectPnpmPackage(root string) string {
+	var pkg struct {
+		PackageManager string `json:"packageManager"`
+	}
+	if buf, err := os.ReadFile(filepath.Join(root, "package.json")); err == nil {
+		_ = json.Unmarshal(buf, &pkg)
+	}
+	if strings.HasPrefix(pkg.PackageManager, "pnpm@") {
+		// Drop the hash, e.g. "pnpm@8.6.0+sha256.abc".
+		version, _, _ := strings.Cut(pkg.PackageManager, "+")
+		return version
+	}
+
+	lock, err := readPnpmLock(root)
+	if err != nil {
+		return ""
+	}
+	switch major, _, _ := strings.Cut(lock.LockfileVersion, "."); major {
+	case "5":
+		if lock.LockfileVersion == "5.3" {
+			return "pnpm@6"
+		}
+		return "pnpm@7"
+	case "6":
+		return "pnpm@8"
+	case "9":
+		return "pnpm@9"
+	default:
+		return ""
+	}
+}
+
+// pnpmMinNodeMajor returns the oldest major version of Node that a major version of pnpm
+// runs on.
+func pnpmMinNodeMajor(pnpmMajor int) int {
+	switch {
+	case pnpmMajor <= 6:
+		return 12
+	case pnpmMajor == 7:
+		return 14
+	case pnpmMajor == 8:
+		return 16
+	default:
+		return 18
+	}
+}
+
 // getLockPackageVersion tries to get as specific a package version as possible
-// from the user's bundle. It first tries yarn, then parsing package-lock.json,
-// then falls back to the argument fallback version (e.g., from a package.json
-// file).
+// from the user's bundle. It first tries parsing pnpm-lock.yaml if there is one,
+// then yarn, then parsing package-lock.json, then falls back to the argument
+// fallback version (e.g., from a package.json file).
 func getLockPackageVersion(
 	rootDir string,
 	packageName string,
 	fallbackVersion string,
 ) string {
+	if fsx.Exists(filepath.Join(rootDir, pnpmLockfile)) {
+		pnpmVersion, err := getPnpmLockPackageVersion(rootDir, packageName)
+		if err == nil {
+			log.Printf(
+				"Found %q version in pnpm-lock.yaml: %s\n",
+				packageName,
+				pnpmVersion,
+			)
+			return pnpmVersion
+		}
+		log.Printf(
+			"Error getting %q version from pnpm-lock.yaml: %+v\n",
+			packageName,
+			err,
+		)
+	}
+
 	yarnVersion, err := getYarnLockPackageVersion(rootDir, packageName)
 	if err == nil {
 		log.Printf(
@@ -1,6 +1,9 @@
 package build
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/airplanedev/lib/pkg/build/fixtures"
@@ -56,6 +59,18 @@ func TestExternalPackages(t *testing.T) {
 			externalPackages: []string{"react", "@types/react", "react-table", "lib"},
 			usesWorkspaces:   true,
 		},
+		{
+			desc:             "does not mark local pnpm workspace import as external",
+			packageJSON:      fixtures.Path(t, "node_externals/pnpmworkspace/package.json"),
+			externalPackages: []string{"react", "@types/react", "react-table"},
+			usesWorkspaces:   true,
+		},
+		{
+			desc:             "marks local pnpm workspace import as external without the workspace protocol",
+			packageJSON:      fixtures.Path(t, "node_externals/pnpmworkspace_importlocalmismatched/package.json"),
+			externalPackages: []string{"react", "@types/react", "react-table", "lib"},
+			usesWorkspaces:   true,
+		},
 		{
 			desc:             "marks external all packages in yarn workspace with yarn 2",
 			packageJSON:      fixtures.Path(t, "node_externals/yarn2workspace_importlocal/package.json"),
@@ -129,6 +144,140 @@ func TestGetPackageCopyCmds(t *testing.T) {
 	)
 }
 
+func TestGetPackageJSONsPnpm(t *testing.T) {
+	require := require.New(t)
+
+	// Packages that don't match the globs of pnpm-workspace.yaml, or that match a negated glob,
+	// aren't part of the workspace.
+	root := fixtures.Path(t, "node_externals/pnpmworkspace")
+	packageJSONs, usesWorkspaces, err := GetPackageJSONs(filepath.Join(root, "package.json"))
+	require.NoError(err)
+	require.True(usesWorkspaces)
+	require.ElementsMatch([]string{
+		filepath.Join(root, "package.json"),
+		filepath.Join(root, "lib/package.json"),
+		filepath.Join(root, "examples/1/package.json"),
+	}, packageJSONs)
+
+	// A pnpm project without workspaces.
+	packageJSONs, usesWorkspaces, err = GetPackageJSONs(fixtures.Path(t, "node_externals/pnpmlock/package.json"))
+	require.NoError(err)
+	require.False(usesWorkspaces)
+	require.Len(packageJSONs, 1)
+}
+
+func TestMatchWorkspaceGlob(t *testing.T) {
+	for _, test := range []struct {
+		pattern  string
+		location string
+		match    bool
+	}{
+		{"lib", "lib", true},
+		{"lib", "lib/nested", false},
+		{"packages/*", "packages/a", true},
+		{"packages/*", "packages/a/b", false},
+		{"packages/**", "packages/a/b", true},
+		{"**/test/**", "examples/test", true},
+		{"**/test/**", "examples/test/unit", true},
+		{"**/test/**", "examples/tests", false},
+		{"apps/*-web", "apps/admin-web", true},
+	} {
+		match := matchWorkspaceGlob(strings.Split(test.pattern, "/"), strings.Split(test.location, "/"))
+		require.Equal(t, test.match, match, "%s %s", test.pattern, test.location)
+	}
+}
+
+func TestGetPnpmLockPackageVersion(t *testing.T) {
+	for _, test := range []struct {
+		fixture string
+		pkg     string
+		version string
+	}{
+		// Direct dependencies of the root project.
+		{"pnpmworkspace", "react", "18.2.0"},
+		{"pnpmlock", "react", "18.2.0"},
+		// Direct dependencies of other workspace projects, with peer dependencies.
+		{"pnpmworkspace", "react-table", "7.8.0"},
+		{"pnpmlock", "react-table", "7.8.0"},
+		// Transitive dependencies.
+		{"pnpmworkspace", "csstype", "3.1.0"},
+		{"pnpmlock", "csstype", "3.1.0"},
+		{"pnpmworkspace", "@types/prop-types", "15.7.5"},
+		{"pnpmlock", "@types/prop-types", "15.7.5"},
+	} {
+		version, err := getPnpmLockPackageVersion(fixtures.Path(t, "node_externals/"+test.fixture), test.pkg)
+		require.NoError(t, err, "%s %s", test.fixture, test.pkg)
+		require.Equal(t, test.version, version, "%s %s", test.fixture, test.pkg)
+	}
+
+	// Workspace packages are linked, not installed.
+	_, err := getPnpmLockPackageVersion(fixtures.Path(t, "node_externals/pnpmworkspace"), "lib")
+	require.Error(t, err)
+
+	_, err = getPnpmLockPackageVersion(fixtures.Path(t, "node_externals/pnpmworkspace"), "non-existent-package")
+	require.Error(t, err)
+
+	_, err = getPnpmLockPackageVersion(fixtures.Path(t, "node_externals/non-existent-path"), "react")
+	require.Error(t, err)
+}
+
+func TestPnpmInstallCommand(t *testing.T) {
+	for _, test := range []struct {
+		fixture     string
+		nodeVersion string
+		cmd         string
+		err         string
+	}{
+		{"pnpmworkspace", "18", "npm install -g pnpm@8 && pnpm install --frozen-lockfile", ""},
+		{"pnpmlock", "18", "npm install -g pnpm@7 && pnpm install --frozen-lockfile", ""},
+		// packageManager pins the version, and there's no lockfile to freeze.
+		{"pnpmworkspace_importlocalmismatched", "18", "npm install -g pnpm@8.6.0 && pnpm install", ""},
+		// pnpm 7 still runs on Node 14, but pnpm 8 does not.
+		{"pnpmlock", "14", "npm install -g pnpm@7 && pnpm install --frozen-lockfile", ""},
+		{"pnpmworkspace", "14", "", "pnpm 8, which requires Node 16 or later"},
+		{"pnpmworkspace_importlocalmismatched", "14", "", "pnpm 8.6.0, which requires Node 16 or later"},
+	} {
+		t.Run(test.fixture+"/node"+test.nodeVersion, func(t *testing.T) {
+			require := require.New(t)
+			root := fixtures.Path(t, "node_externals/"+test.fixture)
+			require.True(usesPnpm(root))
+			cmd, err := makeInstallCommand(makeInstallCommandReq{
+				RootPackageJSON: filepath.Join(root, "package.json"),
+				NodeVersion:     test.nodeVersion,
+				IsPnpm:          true,
+			})
+			if test.err != "" {
+				require.ErrorContains(err, test.err)
+				return
+			}
+			require.NoError(err)
+			require.True(strings.HasPrefix(cmd, test.cmd+" && rm -Rf "), cmd)
+		})
+	}
+	require.False(t, usesPnpm(fixtures.Path(t, "node_externals/packagelock")))
+}
+
+func TestPnpmPackageNodeVersion(t *testing.T) {
+	require := require.New(t)
+
+	// Without a lockfile or packageManager, the latest pnpm that runs on the Node version is used.
+	root := t.TempDir()
+	require.NoError(os.WriteFile(filepath.Join(root, "package.json"), []byte(`{}`), 0644))
+	require.NoError(os.WriteFile(filepath.Join(root, "pnpm-workspace.yaml"), []byte("packages: []\n"), 0644))
+	for nodeVersion, pkg := range map[string]string{
+		"14": "pnpm@7",
+		"16": "pnpm@8",
+		"18": "pnpm",
+	} {
+		actual, err := pnpmPackage(root, nodeVersion)
+		require.NoError(err)
+		require.Equal(pkg, actual, nodeVersion)
+	}
+
+	_, err := pnpmPackage(root, "latest")
+	require.Error(err)
+}
+
 func TestGetYarnLockPackageVersion(t *testing.T) {
 	version, err := getYarnLockPackageVersion(
 		fixtures.Path(t, "node_externals/yarnworkspace"),
@@ -193,6 +342,13 @@ func TestGetLockPackageVersion(t *testing.T) {
 	)
 	require.Equal(t, "18.2.0", version)
 
+	version = getLockPackageVersion(
+		fixtures.Path(t, "node_externals/pnpmworkspace"),
+		"csstype",
+		"fallback",
+	)
+	require.Equal(t, "3.1.0", version)
+
 	version = getLockPackageVersion(
 		fixtures.Path(t, "node_externals/non-existent-path"),
 		"react",
@@ -115,34 +115,11 @@ func getPythonBuildInstructionsInternal(
 
 	instructions = append(instructions, preinstall...)
 
-	requirementsPath := filepath.Join(root, "requirements.txt")
-	hasRequirements := fsx.Exists(requirementsPath)
-	var embeddedRequirements []string
-	var err error
-	if hasRequirements {
-		instructions = append(instructions, InstallInstruction{
-			SrcPath: "requirements.txt",
-		})
-		embeddedRequirements, err = collectEmbeddedRequirements(root, requirementsPath)
-		if err != nil {
-			return BuildInstructions{}, err
-		}
-		for _, embeddedReq := range embeddedRequirements {
-			instructions = append(instructions, InstallInstruction{
-				SrcPath: embeddedReq,
-			})
-		}
-
-		if fsx.Exists(filepath.Join(root, "pip.conf")) {
-			instructions = append(instructions, InstallInstruction{
-				SrcPath: "pip.conf",
-			})
-		}
-
-		instructions = append(instructions, InstallInstruction{
-			Cmd: `pip install -r requirements.txt`,
-		})
+	dependencyInstructions, err := pythonDependencyInstructions(root)
+	if err != nil {
+		return BuildInstructions{}, err
 	}
+	instructions = append(instructions, dependencyInstructions...)
 
 	instructions = append(instructions, postinstall...)
 
@@ -156,6 +133,7 @@ func python(
 	root string,
 	opts KindOptions,
 	buildArgs []string,
+	buildOpts dockerfileOptions,
 ) (string, error) {
 	if opts["shim"] != "true" {
 		return pythonLegacy(root, opts)
@@ -188,6 +166,9 @@ func python(
 	if err != nil {
 		return "", err
 	}
+	if buildOpts.CacheMounts {
+		instructions = instructions.withRunMounts()
+	}
 
 	args := make([]string, len(buildArgs))
 	for i, a := range buildArgs {
@@ -226,7 +207,7 @@ func python(
 		Args         string
 		Instructions string
 	}{
-		Base:         v.String(),
+		Base:         v.Ref(buildOpts.Platforms),
 		Args:         argsCommand,
 		Instructions: dockerfileInstructions,
 	})
@@ -277,6 +258,7 @@ func pythonBundle(
 	opts KindOptions,
 	buildArgs []string,
 	filesToDiscover []string,
+	buildOpts dockerfileOptions,
 ) (string, error) {
 	if opts["shim"] != "true" {
 		return pythonLegacy(root, opts)
@@ -297,6 +279,9 @@ func pythonBundle(
 	if err != nil {
 		return "", err
 	}
+	if buildOpts.CacheMounts {
+		instructions = instructions.withRunMounts()
+	}
 
 	args := make([]string, len(buildArgs))
 	for i, a := range buildArgs {
@@ -352,7 +337,7 @@ func pythonBundle(
 		Instructions    string
 		FilesToDiscover string
 	}{
-		Base:            v.String(),
+		Base:            v.Ref(buildOpts.Platforms),
 		Args:            argsCommand,
 		Instructions:    dockerfileInstructions,
 		FilesToDiscover: strings.Join(filesToDiscover, " "),
@@ -0,0 +1,220 @@
+package build
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/airplanedev/lib/pkg/utils/fsx"
+	"github.com/pkg/errors"
+)
+
+// PythonPackageManager is the tool that installs the dependencies of a Python project.
+type PythonPackageManager string
+
+const (
+	// PythonPackageManagerPip installs the dependencies of a requirements.txt with pip.
+	PythonPackageManagerPip PythonPackageManager = "pip"
+	// PythonPackageManagerPoetry installs the dependencies of a Poetry project, i.e. a
+	// pyproject.toml with a [tool.poetry] table or a poetry.lock.
+	PythonPackageManagerPoetry PythonPackageManager = "poetry"
+	// PythonPackageManagerPipenv installs the dependencies of a Pipfile and Pipfile.lock.
+	PythonPackageManagerPipenv PythonPackageManager = "pipenv"
+	// PythonPackageManagerPyproject installs the dependencies of the [project] table of a
+	// pyproject.toml (PEP 621) with pip.
+	PythonPackageManagerPyproject PythonPackageManager = "pyproject"
+)
+
+// PythonDependencyFiles are the files that declare the dependencies of a Python project. See
+// FindPythonRoot.
+var PythonDependencyFiles = []string{
+	"requirements.txt",
+	"pyproject.toml",
+	"poetry.lock",
+	"Pipfile",
+	"Pipfile.lock",
+}
+
+// FindPythonRoot returns the closest directory to `path` that contains any of
+// PythonDependencyFiles. A pyproject.toml only counts if it declares a Poetry or PEP 621
+// project, since it is also used to configure tools such as black or mypy.
+func FindPythonRoot(path string) (string, bool) {
+	for {
+		root, ok := fsx.FindAny(path, PythonDependencyFiles...)
+		if !ok {
+			return "", false
+		}
+		if isPythonProjectRoot(root) {
+			return root, true
+		}
+		path = filepath.Dir(root)
+		if path == root || path == "." {
+			return "", false
+		}
+	}
+}
+
+func isPythonProjectRoot(dir string) bool {
+	for _, file := range PythonDependencyFiles {
+		if file != "pyproject.toml" && fsx.Exists(filepath.Join(dir, file)) {
+			return true
+		}
+	}
+	pyproject, err := readPyprojectTOML(filepath.Join(dir, "pyproject.toml"))
+	return err == nil && (pyproject.Poetry || pyproject.Project)
+}
+
+// PythonDependencies describes how the dependencies of a Python project are installed.
+type PythonDependencies struct {
+	Manager PythonPackageManager
+	// Files are the dependency files, relative to the project root, that are needed to
+	// install the dependencies.
+	Files []string
+	// Lockfile is the lockfile that pins the dependencies, if any. It is also in Files.
+	Lockfile string
+	// Requirements are the dependencies of a PEP 621 project, which are installed directly
+	// rather than from Files.
+	Requirements []string
+}
+
+// DetectPythonDependencies detects how the dependencies of the Python project at `root` are
+// installed. It returns false if the project doesn't declare any dependencies.
+//
+// Poetry projects take precedence over Pipenv projects, which take precedence over a
+// requirements.txt. A requirements.txt takes precedence over the dependencies of a PEP 621
+// pyproject.toml, since it usually pins them.
+func DetectPythonDependencies(root string) (PythonDependencies, bool, error) {
+	var pyproject pyprojectTOML
+	hasPyproject := fsx.Exists(filepath.Join(root, "pyproject.toml"))
+	if hasPyproject {
+		var err error
+		if pyproject, err = readPyprojectTOML(filepath.Join(root, "pyproject.toml")); err != nil {
+			return PythonDependencies{}, false, err
+		}
+	}
+
+	switch {
+	case hasPyproject && (pyproject.Poetry || fsx.Exists(filepath.Join(root, "poetry.lock"))):
+		deps := PythonDependencies{
+			Manager: PythonPackageManagerPoetry,
+			Files:   []string{"pyproject.toml"},
+		}
+		if fsx.Exists(filepath.Join(root, "poetry.lock")) {
+			deps.Lockfile = "poetry.lock"
+			deps.Files = append(deps.Files, deps.Lockfile)
+		}
+		return deps, true, nil
+	case fsx.Exists(filepath.Join(root, "Pipfile")):
+		deps := PythonDependencies{
+			Manager: PythonPackageManagerPipenv,
+			Files:   []string{"Pipfile"},
+		}
+		if fsx.Exists(filepath.Join(root, "Pipfile.lock")) {
+			deps.Lockfile = "Pipfile.lock"
+			deps.Files = append(deps.Files, deps.Lockfile)
+		}
+		return deps, true, nil
+	case fsx.Exists(filepath.Join(root, "requirements.txt")):
+		return PythonDependencies{
+			Manager: PythonPackageManagerPip,
+			Files:   []string{"requirements.txt"},
+		}, true, nil
+	case hasPyproject && pyproject.Project:
+		return PythonDependencies{
+			Manager:      PythonPackageManagerPyproject,
+			Requirements: pyproject.Dependencies,
+		}, true, nil
+	case fsx.Exists(filepath.Join(root, "Pipfile.lock")):
+		return PythonDependencies{}, false, errors.New("found a Pipfile.lock without a Pipfile")
+	default:
+		return PythonDependencies{}, false, nil
+	}
+}
+
+// pythonDependencyInstructions returns the instructions that install the dependencies of the
+// Python project at `root`. Lockfiles are honored: the build fails if they are out of date.
+func pythonDependencyInstructions(root string) ([]InstallInstruction, error) {
+	deps, ok, err := DetectPythonDependencies(root)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	var instructions []InstallInstruction
+	for _, file := range deps.Files {
+		instructions = append(instructions, InstallInstruction{
+			SrcPath: file,
+		})
+	}
+	if deps.Manager == PythonPackageManagerPip {
+		embeddedRequirements, err := collectEmbeddedRequirements(root, filepath.Join(root, "requirements.txt"))
+		if err != nil {
+			return nil, err
+		}
+		for _, embeddedReq := range embeddedRequirements {
+			instructions = append(instructions, InstallInstruction{
+				SrcPath: embeddedReq,
+			})
+		}
+	}
+	if fsx.Exists(filepath.Join(root, "pip.conf")) {
+		instructions = append(instructions, InstallInstruction{
+			SrcPath: "pip.conf",
+		})
+	}
+
+	var cmd string
+	switch deps.Manager {
+	case PythonPackageManagerPip:
+		cmd = `pip install -r requirements.txt`
+	case PythonPackageManagerPoetry:
+		// Dependencies are installed into the system environment, like with pip, rather than
+		// into a virtualenv. --no-root skips installing the project itself, which is copied
+		// in later.
+		cmd = `pip install "poetry>=1.2,<2" && POETRY_VIRTUALENVS_CREATE=false poetry install --no-root --only main --no-interaction --no-ansi`
+	case PythonPackageManagerPipenv:
+		if deps.Lockfile != "" {
+			// --deploy fails the build if the Pipfile.lock is out of date.
+			cmd = `pip install pipenv && pipenv install --system --deploy`
+		} else {
+			cmd = `pip install pipenv && pipenv install --system --skip-lock`
+		}
+	case PythonPackageManagerPyproject:
+		if len(deps.Requirements) == 0 {
+			return nil, nil
+		}
+		quoted := make([]string, len(deps.Requirements))
+		for i, req := range deps.Requirements {
+			quoted[i] = "'" + strings.ReplaceAll(req, "'", `'"'"'`) + "'"
+		}
+		cmd = `pip install ` + strings.Join(quoted, " ")
+	}
+	return append(instructions, InstallInstruction{Cmd: cmd}), nil
+}
+
+// pyprojectTOML are the parts of a pyproject.toml that DetectPythonDependencies needs.
+type pyprojectTOML struct {
+	// Poetry is true if the file has a [tool.poetry] table.
+	Poetry bool
+	// Project is true if the file has a [project] table (PEP 621).
+	Project bool
+	// Dependencies are the `dependencies` of the [project] table.
+	Dependencies []string
+}
+
+// readPyprojectTOML reads a pyproject.toml.
+func readPyprojectTOML(path string) (pyprojectTOML, error) {
+	var file struct {
+		Project struct {
+			Dependencies []string `toml:"dependencies"`
+		} `toml:"project"`
+	}
+	md, err := toml.DecodeFile(path, &file)
+	if err != nil {
+		return pyprojectTOML{}, errors.Wrap(err, "reading pyproject.toml")
+	}
+	return pyprojectTOML{
+		Poetry:       md.IsDefined("tool", "poetry"),
+		Project:      md.IsDefined("project"),
+		Dependencies: file.Project.Dependencies,
+	}, nil
+}
@@ -0,0 +1,267 @@
+package build
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/airplanedev/lib/pkg/examples"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectPythonDependencies(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		files map[string]string
+		deps  PythonDependencies
+		ok    bool
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:  "requirements.txt",
+			files: map[string]string{"requirements.txt": "dice==3.1.2"},
+			deps:  PythonDependencies{Manager: PythonPackageManagerPip, Files: []string{"requirements.txt"}},
+			ok:    true,
+		},
+		{
+			name: "poetry",
+			files: map[string]string{
+				"pyproject.toml":   "[tool.poetry]\nname = \"x\"\n",
+				"poetry.lock":      "",
+				"requirements.txt": "dice==3.1.2",
+			},
+			deps: PythonDependencies{
+				Manager:  PythonPackageManagerPoetry,
+				Files:    []string{"pyproject.toml", "poetry.lock"},
+				Lockfile: "poetry.lock",
+			},
+			ok: true,
+		},
+		{
+			name:  "poetry without lockfile",
+			files: map[string]string{"pyproject.toml": "[tool.poetry.dependencies]\npython = \"^3.8\"\n"},
+			deps:  PythonDependencies{Manager: PythonPackageManagerPoetry, Files: []string{"pyproject.toml"}},
+			ok:    true,
+		},
+		{
+			name: "poetry with PEP 621 metadata",
+			files: map[string]string{
+				"pyproject.toml": "[project]\nname = \"x\"\ndependencies = [\"dice\"]\n",
+				"poetry.lock":    "",
+			},
+			deps: PythonDependencies{
+				Manager:  PythonPackageManagerPoetry,
+				Files:    []string{"pyproject.toml", "poetry.lock"},
+				Lockfile: "poetry.lock",
+			},
+			ok: true,
+		},
+		{
+			name:  "pipenv",
+			files: map[string]string{"Pipfile": "", "Pipfile.lock": "{}"},
+			deps: PythonDependencies{
+				Manager:  PythonPackageManagerPipenv,
+				Files:    []string{"Pipfile", "Pipfile.lock"},
+				Lockfile: "Pipfile.lock",
+			},
+			ok: true,
+		},
+		{
+			name: "requirements.txt and PEP 621",
+			files: map[string]string{
+				"pyproject.toml":   "[project]\ndependencies = [\"dice\"]\n",
+				"requirements.txt": "dice==3.1.2",
+			},
+			deps: PythonDependencies{Manager: PythonPackageManagerPip, Files: []string{"requirements.txt"}},
+			ok:   true,
+		},
+		{
+			name:  "PEP 621",
+			files: map[string]string{"pyproject.toml": "[project]\ndependencies = [\"dice==3.1.2\", 'requests[socks]>=2']\n"},
+			deps: PythonDependencies{
+				Manager:      PythonPackageManagerPyproject,
+				Requirements: []string{"dice==3.1.2", "requests[socks]>=2"},
+			},
+			ok: true,
+		},
+		{
+			name:  "pyproject.toml for tools only",
+			files: map[string]string{"pyproject.toml": "[tool.black]\nline-length = 100\n"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+			root := t.TempDir()
+			for name, content := range test.files {
+				require.NoError(os.WriteFile(filepath.Join(root, name), []byte(content), 0644))
+			}
+
+			deps, ok, err := DetectPythonDependencies(root)
+			require.NoError(err)
+			require.Equal(test.ok, ok)
+			require.Equal(test.deps, deps)
+		})
+	}
+}
+
+func TestFindPythonRoot(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		files map[string]string
+		root  string
+	}{
+		{
+			name:  "requirements.txt",
+			files: map[string]string{"requirements.txt": "", "tasks/pyproject.toml": "[tool.black]\n"},
+			root:  ".",
+		},
+		{
+			name:  "poetry",
+			files: map[string]string{"requirements.txt": "", "tasks/pyproject.toml": "[tool.poetry]\nname = \"x\"\n"},
+			root:  "tasks",
+		},
+		{
+			name:  "pep 621",
+			files: map[string]string{"requirements.txt": "", "tasks/pyproject.toml": "[project]\nname = \"x\"\n"},
+			root:  "tasks",
+		},
+		{
+			name:  "tool config only",
+			files: map[string]string{"tasks/pyproject.toml": "[tool.black]\n"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+			dir := t.TempDir()
+			for file, contents := range test.files {
+				require.NoError(os.MkdirAll(filepath.Dir(filepath.Join(dir, file)), 0755))
+				require.NoError(os.WriteFile(filepath.Join(dir, file), []byte(contents), 0644))
+			}
+
+			root, ok := FindPythonRoot(filepath.Join(dir, "tasks", "main.py"))
+			if test.root == "" {
+				// The search continues past the temporary directory, so only check that it
+				// was not chosen.
+				require.False(ok && strings.HasPrefix(root, dir))
+				return
+			}
+			require.True(ok)
+			require.Equal(filepath.Join(dir, test.root), root)
+		})
+	}
+}
+
+func TestReadPyprojectTOML(t *testing.T) {
+	require := require.New(t)
+
+	pyproject, err := readPyprojectTOML(filepath.Join(examples.Path(t, "python/pyproject"), "pyproject.toml"))
+	require.NoError(err)
+	require.Equal(pyprojectTOML{
+		Project:      true,
+		Dependencies: []string{"dice == 3.1.2"},
+	}, pyproject)
+
+	path := filepath.Join(t.TempDir(), "pyproject.toml")
+	require.NoError(os.WriteFile(path, []byte(`
+[project]
+name = "example"
+dependencies = [
+  # Comments are skipped.
+  "httpx>=0.23", 'pydantic<2', # Trailing comments too.
+  "pandas ; python_version >= \"3.9\"",
+]
+optional-dependencies = { dev = ["pytest"] }
+
+[project.scripts]
+example = "example:main"
+
+[tool.poetry]
+`), 0644))
+	pyproject, err = readPyprojectTOML(path)
+	require.NoError(err)
+	require.Equal(pyprojectTOML{
+		Poetry:       true,
+		Project:      true,
+		Dependencies: []string{"httpx>=0.23", "pydantic<2", `pandas ; python_version >= "3.9"`},
+	}, pyproject)
+
+	// Subtables define their parent tables.
+	require.NoError(os.WriteFile(path, []byte("[tool.poetry.dependencies]\npython = \"^3.10\"\n"), 0644))
+	pyproject, err = readPyprojectTOML(path)
+	require.NoError(err)
+	require.Equal(pyprojectTOML{Poetry: true}, pyproject)
+
+	for _, content := range []string{
+		"[project]\ndependencies = [\"httpx\"\n",
+		"[project]\ndependencies = [\"httpx\", 1]\n",
+		"[project]\ndependencies = \"httpx\"\n",
+	} {
+		require.NoError(os.WriteFile(path, []byte(content), 0644))
+		_, err = readPyprojectTOML(path)
+		require.ErrorContains(err, "reading pyproject.toml", content)
+	}
+}
+
+func TestPythonDependencyInstructions(t *testing.T) {
+	for _, test := range []struct {
+		root         string
+		instructions []InstallInstruction
+	}{
+		{
+			root: "python/poetry",
+			instructions: []InstallInstruction{
+				{SrcPath: "pyproject.toml"},
+				{Cmd: `pip install "poetry>=1.2,<2" && POETRY_VIRTUALENVS_CREATE=false poetry install --no-root --only main --no-interaction --no-ansi`},
+			},
+		},
+		{
+			root: "python/pipenv",
+			instructions: []InstallInstruction{
+				{SrcPath: "Pipfile"},
+				{Cmd: `pip install pipenv && pipenv install --system --skip-lock`},
+			},
+		},
+		{
+			root: "python/pyproject",
+			instructions: []InstallInstruction{
+				{Cmd: `pip install 'dice == 3.1.2'`},
+			},
+		},
+		{
+			root: "python/embeddedrequirements",
+			instructions: []InstallInstruction{
+				{SrcPath: "requirements.txt"},
+				{SrcPath: "embedded_requirements.txt"},
+				{Cmd: `pip install -r requirements.txt`},
+			},
+		},
+		{
+			root: "python/simple",
+		},
+	} {
+		t.Run(test.root, func(t *testing.T) {
+			require := require.New(t)
+			instructions, err := pythonDependencyInstructions(examples.Path(t, test.root))
+			require.NoError(err)
+			require.Equal(test.instructions, instructions)
+		})
+	}
+
+	// Lockfiles are installed from.
+	require := require.New(t)
+	root := t.TempDir()
+	require.NoError(os.WriteFile(filepath.Join(root, "Pipfile"), nil, 0644))
+	require.NoError(os.WriteFile(filepath.Join(root, "Pipfile.lock"), []byte("{}"), 0644))
+	require.NoError(os.WriteFile(filepath.Join(root, "pip.conf"), nil, 0644))
+	instructions, err := pythonDependencyInstructions(root)
+	require.NoError(err)
+	require.Equal([]InstallInstruction{
+		{SrcPath: "Pipfile"},
+		{SrcPath: "Pipfile.lock"},
+		{SrcPath: "pip.conf"},
+		{Cmd: `pip install pipenv && pipenv install --system --deploy`},
+	}, instructions)
+}
@@ -44,6 +44,33 @@ func TestPythonBuilder(t *testing.T) {
 			},
 			SearchString: "[1]",
 		},
+		{
+			Root: "python/poetry",
+			Kind: TaskKindPython,
+			Options: KindOptions{
+				"shim":       "true",
+				"entrypoint": "main.py",
+			},
+			SearchString: "[1]",
+		},
+		{
+			Root: "python/pipenv",
+			Kind: TaskKindPython,
+			Options: KindOptions{
+				"shim":       "true",
+				"entrypoint": "main.py",
+			},
+			SearchString: "[1]",
+		},
+		{
+			Root: "python/pyproject",
+			Kind: TaskKindPython,
+			Options: KindOptions{
+				"shim":       "true",
+				"entrypoint": "main.py",
+			},
+			SearchString: "[1]",
+		},
 		{
 			Root: "python/requirementswithbuildargs",
 			Kind: TaskKindPython,
@@ -154,6 +181,44 @@ func TestPythonBundleBuilder(t *testing.T) {
 				},
 			},
 		},
+		{
+			Root: "python/poetry",
+			Kind: TaskKindPython,
+			Options: KindOptions{
+				"shim": "true",
+			},
+			Bundle: true,
+			BuildContext: BuildContext{
+				Type:    PythonBuildType,
+				Version: BuildTypeVersionPython310,
+				Base:    BuildBaseSlim,
+			},
+			BundleRuns: []BundleTestRun{
+				{
+					RelEntrypoint: "main.py",
+					SearchString:  "[1]",
+				},
+			},
+		},
+		{
+			Root: "python/pipenv",
+			Kind: TaskKindPython,
+			Options: KindOptions{
+				"shim": "true",
+			},
+			Bundle: true,
+			BuildContext: BuildContext{
+				Type:    PythonBuildType,
+				Version: BuildTypeVersionPython310,
+				Base:    BuildBaseSlim,
+			},
+			BundleRuns: []BundleTestRun{
+				{
+					RelEntrypoint: "main.py",
+					SearchString:  "[1]",
+				},
+			},
+		},
 		{
 			Root: "python/embeddedrequirements",
 			Kind: TaskKindPython,
@@ -68,6 +68,11 @@ func (t *Tree) Write(dst string, r io.Reader) error {
 	return os.WriteFile(filepath.Join(t.root, dst), buf, 0600)
 }
 
+// Dir returns the directory of the tree.
+func (t *Tree) Dir() string {
+	return t.root
+}
+
 // Archive archives the tree and returns a tarball.
 func (t *Tree) Archive() (io.ReadCloser, error) {
 	r, err := archive.Tar(t.root, archive.Gzip)
@@ -2,6 +2,7 @@ package build
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/MakeNowJust/heredoc/v2"
 	"golang.org/x/exp/slices"
@@ -22,6 +23,7 @@ const (
 	TaskKindNode   TaskKind = "node"
 	TaskKindPython TaskKind = "python"
 	TaskKindShell  TaskKind = "shell"
+	TaskKindGo     TaskKind = "go"
 	TaskKindApp    TaskKind = "app"
 
 	TaskKindSQL     TaskKind = "sql"
@@ -36,6 +38,7 @@ const (
 	ViewBuildType   BuildType = "view"
 	PythonBuildType BuildType = "python"
 	ShellBuildType  BuildType = "shell"
+	GoBuildType     BuildType = "go"
 	// NoneBuildType indicates that the entity should not be built.
 	NoneBuildType BuildType = "none"
 )
@@ -58,6 +61,10 @@ const (
 	BuildTypeVersionPython310 BuildTypeVersion = "3.10"
 	BuildTypeVersionPython311 BuildTypeVersion = "3.11"
 
+	BuildTypeVersionGo119 BuildTypeVersion = "1.19"
+	BuildTypeVersionGo120 BuildTypeVersion = "1.20"
+	BuildTypeVersionGo121 BuildTypeVersion = "1.21"
+
 	BuildTypeVersionUnspecified BuildTypeVersion = ""
 )
 
@@ -85,6 +92,12 @@ var AllBuildTypeVersions = map[BuildType][]BuildTypeVersion{
 	ShellBuildType: {
 		BuildTypeVersionUnspecified,
 	},
+	GoBuildType: {
+		BuildTypeVersionGo119,
+		BuildTypeVersionGo120,
+		BuildTypeVersionGo121,
+		BuildTypeVersionUnspecified,
+	},
 	NoneBuildType: {
 		BuildTypeVersionUnspecified,
 	},
@@ -95,6 +108,8 @@ type BuildContext struct {
 	Version BuildTypeVersion       `json:"version"`
 	Base    BuildBase              `json:"base"`
 	EnvVars map[string]EnvVarValue `json:"envVars"`
+	// Platforms are the platforms to build images for. If empty, DefaultPlatforms is used.
+	Platforms []Platform `json:"platforms,omitempty"`
 }
 type EnvVarValue struct {
 	Value  *string `json:"value,omitempty"`
@@ -105,6 +120,11 @@ func (b BuildContext) Valid() bool {
 	if !b.Type.Valid() {
 		return false
 	}
+	for _, p := range b.Platforms {
+		if !p.Valid() {
+			return false
+		}
+	}
 	return slices.Contains(AllBuildTypeVersions[b.Type], b.Version)
 }
 
@@ -121,11 +141,56 @@ func (b BuildContext) DefaultVersion() BuildTypeVersion {
 		return DefaultNodeVersion
 	case PythonBuildType:
 		return DefaultPythonVersion
+	case GoBuildType:
+		return DefaultGoVersion
 	default:
 		return BuildTypeVersionUnspecified
 	}
 }
 
+// Platform is an OS and architecture that images are built for, e.g. "linux/arm64".
+type Platform string
+
+const (
+	PlatformLinuxAMD64 Platform = "linux/amd64"
+	PlatformLinuxARM64 Platform = "linux/arm64"
+)
+
+// AllPlatforms are the platforms that images can be built for.
+var AllPlatforms = []Platform{
+	PlatformLinuxAMD64,
+	PlatformLinuxARM64,
+}
+
+// DefaultPlatforms are the platforms that images are built for if none are configured.
+var DefaultPlatforms = []Platform{PlatformLinuxAMD64}
+
+func (p Platform) Valid() bool {
+	return slices.Contains(AllPlatforms, p)
+}
+
+// validatePlatforms checks that `platforms` are valid, and defaults them to DefaultPlatforms.
+func validatePlatforms(platforms []Platform) ([]Platform, error) {
+	if len(platforms) == 0 {
+		return DefaultPlatforms, nil
+	}
+	for _, p := range platforms {
+		if !p.Valid() {
+			return nil, fmt.Errorf("build: unsupported platform %q", p)
+		}
+	}
+	return platforms, nil
+}
+
+// platformsString returns the value of a --platform flag for `platforms`.
+func platformsString(platforms []Platform) string {
+	s := make([]string, len(platforms))
+	for i, p := range platforms {
+		s[i] = string(p)
+	}
+	return strings.Join(s, ",")
+}
+
 type BuildBase string
 
 const (
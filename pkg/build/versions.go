@@ -13,7 +13,12 @@ import (
 //  2. Manually push the new base images into the public cache in the
 //     Airplane Registry. See Slab:
 //     https://airplane.slab.com/posts/publishing-to-the-public-cache-registry-8bzwq93d
-//  3. Alpine-based images will not work with shim-based builders, but it's
+//  3. Pin a digest for every platform in Platforms, and the digest of the
+//     image's manifest list in Index, by running
+//     `go run ./scripts/pinversions`. Without either, builds for platforms
+//     other than linux/amd64 fall back to the unpinned tag, and
+//     TestVersionsPinned fails.
+//  4. Alpine-based images will not work with shim-based builders, but it's
 //     a straightforward change if we end up wanting it (different echo
 //     semantics than debian-based images). These base images are cached on
 //     our agents, so for the most part, we don't need to worry about the
@@ -23,8 +28,9 @@ import (
 var versionsJSON []byte
 
 // Versions contains a mapping table of (builder, version) to
-// (node, tag, digest) image tuples. The digests are always for
-// images built for the linux/amd64 architecture.
+// (node, tag, digest) image tuples. Digest is always for the image
+// built for the linux/amd64 architecture. Images for other
+// platforms are pinned through Platforms or Index.
 //
 // This lookup table is used to construct Dockerfiles that always
 // pull from the most-up-date version of the underlying base image
@@ -35,6 +41,12 @@ type Version struct {
 	Image  string `json:"image"`
 	Tag    string `json:"tag"`
 	Digest string `json:"digest"`
+	// Platforms are the digests of the image for each platform. The linux/amd64 digest
+	// defaults to Digest.
+	Platforms map[Platform]string `json:"platforms,omitempty"`
+	// Index is the digest of the image's manifest list, which BuildKit resolves to the image
+	// for each platform that is built.
+	Index string `json:"index,omitempty"`
 }
 
 func (v Version) String() string {
@@ -45,6 +57,60 @@ func (v Version) String() string {
 	return v.Image + "@" + v.Digest
 }
 
+// PlatformDigest returns the digest of the image for `platform`, if pinned.
+func (v Version) PlatformDigest(platform Platform) string {
+	if digest, ok := v.Platforms[platform]; ok {
+		return digest
+	}
+	if platform == PlatformLinuxAMD64 {
+		return v.Digest
+	}
+	return ""
+}
+
+// Ref returns the image reference to use as the base image of a build for `platforms`.
+//
+// A build for a single platform uses that platform's digest. Builds for multiple platforms,
+// or for platforms without a pinned digest, use the manifest list digest if pinned, and
+// otherwise fall back to the tag.
+func (v Version) Ref(platforms []Platform) string {
+	if v.Image == "" {
+		return ""
+	}
+	if len(platforms) == 0 {
+		platforms = DefaultPlatforms
+	}
+	if len(platforms) == 1 {
+		if digest := v.PlatformDigest(platforms[0]); digest != "" {
+			return v.Image + "@" + digest
+		}
+	}
+	if v.Index != "" {
+		return v.Image + "@" + v.Index
+	}
+	if v.Tag != "" {
+		return v.Image + ":" + v.Tag
+	}
+	return ""
+}
+
+// BuildPlatformRef returns the image reference to use for a build stage that runs on the
+// platform of the build host, i.e. `FROM --platform=$BUILDPLATFORM`. The host's platform isn't
+// known when the Dockerfile is generated, so this uses the manifest list digest if pinned,
+// which BuildKit resolves for the host, and otherwise falls back to the tag.
+func (v Version) BuildPlatformRef() string {
+	if v.Image == "" {
+		return ""
+	}
+	if v.Index != "" {
+		return v.Image + "@" + v.Index
+	}
+	if v.Tag != "" {
+		return v.Image + ":" + v.Tag
+	}
+	return ""
+}
+
 func GetVersions() (Versions, error) {
 	var versions Versions
 	if err := json.Unmarshal(versionsJSON, &versions); err != nil {
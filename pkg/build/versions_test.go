@@ -0,0 +1,85 @@
+package build
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slices"
+)
+
+func TestVersionRef(t *testing.T) {
+	v := Version{Image: "python", Tag: "3.10-buster", Digest: "sha256:amd"}
+	pinned := v
+	pinned.Platforms = map[Platform]string{PlatformLinuxARM64: "sha256:arm"}
+	indexed := v
+	indexed.Index = "sha256:index"
+
+	for _, test := range []struct {
+		name      string
+		version   Version
+		platforms []Platform
+		ref       string
+	}{
+		{"default", v, nil, "python@sha256:amd"},
+		{"amd64", v, []Platform{PlatformLinuxAMD64}, "python@sha256:amd"},
+		{"unpinned arm64", v, []Platform{PlatformLinuxARM64}, "python:3.10-buster"},
+		{"pinned arm64", pinned, []Platform{PlatformLinuxARM64}, "python@sha256:arm"},
+		{"multi-platform", pinned, AllPlatforms, "python:3.10-buster"},
+		{"multi-platform index", indexed, AllPlatforms, "python@sha256:index"},
+		{"arm64 index", indexed, []Platform{PlatformLinuxARM64}, "python@sha256:index"},
+		{"no image", Version{}, nil, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			require.Equal(t, test.ref, test.version.Ref(test.platforms))
+		})
+	}
+}
+
+func TestVersionBuildPlatformRef(t *testing.T) {
+	require := require.New(t)
+
+	v := Version{Image: "golang", Tag: "1.20-bookworm", Digest: "sha256:amd"}
+	require.Equal("golang:1.20-bookworm", v.BuildPlatformRef())
+	v.Platforms = map[Platform]string{PlatformLinuxARM64: "sha256:arm"}
+	require.Equal("golang:1.20-bookworm", v.BuildPlatformRef())
+	v.Index = "sha256:index"
+	require.Equal("golang@sha256:index", v.BuildPlatformRef())
+	require.Equal("", Version{}.BuildPlatformRef())
+}
+
+// unpinnedVersions are the entries of versions.json that aren't pinned for every platform in
+// AllPlatforms yet. Pin them by running `go run ./scripts/pinversions`, and remove them from
+// this list. New entries must be pinned.
+var unpinnedVersions = map[string][]string{
+	"node":       {"18", "18-slim", "16", "16-slim", "15", "15-slim", "14", "14-slim", "12"},
+	"python":     {"3", "3-slim", "3.7", "3.7-slim", "3.8", "3.8-slim", "3.9", "3.9-slim", "3.10", "3.10-slim", "3.11", "3.11-slim"},
+	"go":         {"1.19", "1.20", "1.21"},
+	"distroless": {"static-debian11"},
+}
+
+func TestVersionsPinned(t *testing.T) {
+	versions, err := GetVersions()
+	require.NoError(t, err)
+
+	for builder, entries := range versions {
+		for key, v := range entries {
+			builder, key, v := builder, key, v
+			t.Run(builder+"/"+key, func(t *testing.T) {
+				require := require.New(t)
+
+				var missing []Platform
+				for _, p := range AllPlatforms {
+					if v.PlatformDigest(p) == "" {
+						missing = append(missing, p)
+					}
+				}
+				if slices.Contains(unpinnedVersions[builder], key) {
+					require.False(len(missing) == 0 && v.Index != "", "%s %s is pinned, remove it from unpinnedVersions", builder, key)
+					return
+				}
+				require.Empty(missing, "%s %s has no digest for these platforms, run `go run ./scripts/pinversions`", builder, key)
+				require.NotEmpty(v.Index, "%s %s has no index digest, run `go run ./scripts/pinversions`", builder, key)
+			})
+		}
+	}
+}
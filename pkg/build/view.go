@@ -16,7 +16,7 @@ import (
 )
 
 // view creates a dockerfile for a view.
-func view(root string, options KindOptions) (string, error) {
+func view(root string, options KindOptions, buildOpts dockerfileOptions) (string, error) {
 	// Assert that the entrypoint file exists:
 	entrypoint, _ := options["entrypoint"].(string)
 	if entrypoint == "" {
@@ -36,7 +36,7 @@ func view(root string, options KindOptions) (string, error) {
 	}
 
 	// TODO: possibly support multiple build tools.
-	base, err := getBaseNodeImage("", false)
+	base, err := getBaseNodeImage("", false, buildOpts.Platforms)
 	if err != nil {
 		return "", err
 	}
@@ -156,7 +156,7 @@ func view(root string, options KindOptions) (string, error) {
 
 // viewBundle creates a dockerfile for all views within a root.
 func viewBundle(root string, buildContext BuildContext, options KindOptions, filesToBuild []string,
-	filesToDiscover []string) (string, error) {
+	filesToDiscover []string, buildOpts dockerfileOptions) (string, error) {
 	// Assert that API host is set.
 	apiHost, _ := options["apiHost"].(string)
 	if apiHost == "" {
@@ -168,7 +168,7 @@ func viewBundle(root string, buildContext BuildContext, options KindOptions, fil
 
 	useSlimImage := buildContext.Base == BuildBaseSlim
 	nodeVersion := GetNodeVersion(options)
-	base, err := getBaseNodeImage(nodeVersion, useSlimImage)
+	base, err := getBaseNodeImage(nodeVersion, useSlimImage, buildOpts.Platforms)
 	if err != nil {
 		return "", err
 	}
@@ -3,6 +3,9 @@ package build
 import (
 	"context"
 	"testing"
+
+	"github.com/airplanedev/lib/pkg/examples"
+	"github.com/stretchr/testify/require"
 )
 
 // These tests ensure that a View image can be built without error.
@@ -92,3 +95,37 @@ func TestViewBundleBuilder(t *testing.T) {
 
 	RunTests(t, ctx, tests)
 }
+
+func TestViewDockerfilePlatforms(t *testing.T) {
+	require := require.New(t)
+
+	v, err := GetVersion(NameNode, string(DefaultNodeVersion), false)
+	require.NoError(err)
+	amd64 := v.Ref([]Platform{PlatformLinuxAMD64})
+	arm64 := v.Ref([]Platform{PlatformLinuxARM64})
+	require.NotEqual(amd64, arm64)
+
+	dockerfile, err := BuildDockerfile(DockerfileConfig{
+		Builder: string(NameView),
+		Root:    examples.Path(t, "view/simple"),
+		Options: KindOptions{
+			"entrypoint": "src/App.tsx",
+			"apiHost":    "https://api:5000",
+		},
+		Platforms: []Platform{PlatformLinuxARM64},
+	})
+	require.NoError(err)
+	require.Contains(dockerfile, "FROM "+arm64+" as builder\n")
+	require.NotContains(dockerfile, amd64)
+
+	dockerfile, err = BuildBundleDockerfile(BundleDockerfileConfig{
+		BuildContext: BuildContext{Type: ViewBuildType},
+		Root:         examples.Path(t, "view/simple"),
+		Options:      KindOptions{"apiHost": "https://api:5000"},
+		FilesToBuild: []string{"src/App.tsx"},
+		Platforms:    []Platform{PlatformLinuxARM64},
+	})
+	require.NoError(err)
+	require.Contains(dockerfile, "FROM "+arm64+" as builder\n")
+	require.NotContains(dockerfile, amd64)
+}
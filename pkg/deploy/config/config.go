@@ -41,10 +41,16 @@ type ViewConfig struct {
 	EnvVars TaskEnv `yaml:"envVars,omitempty" json:"envVars,omitempty"`
 }
 
+type BuildConfig struct {
+	// Platforms are the platforms to build images for, e.g. "linux/arm64".
+	Platforms []string `yaml:"platforms,omitempty" json:"platforms,omitempty"`
+}
+
 type AirplaneConfig struct {
 	Javascript JavaScriptConfig `yaml:"javascript,omitempty" json:"javascript,omitempty"`
 	Python     PythonConfig     `yaml:"python,omitempty" json:"python,omitempty"`
 	View       ViewConfig       `yaml:"view,omitempty" json:"view,omitempty"`
+	Build      BuildConfig      `yaml:"build,omitempty" json:"build,omitempty"`
 }
 
 func HasAirplaneConfig(dir string) bool {
@@ -46,6 +46,9 @@ func TestNewAirplaneConfigFromFile(t *testing.T) {
 						"fromValue": EnvVarValue{Value: pointers.String("viewValue")},
 					},
 				},
+				Build: BuildConfig{
+					Platforms: []string{"linux/amd64", "linux/arm64"},
+				},
 			},
 		},
 	}
@@ -51,9 +51,10 @@ func TaskBuildContext(taskroot string, taskRuntime runtime.Interface) (build.Bui
 	}
 
 	return build.BuildContext{
-		Version: buildVersion,
-		Base:    base,
-		EnvVars: envVars,
+		Version:   buildVersion,
+		Base:      base,
+		EnvVars:   envVars,
+		Platforms: buildPlatforms(c),
 	}, nil
 }
 
@@ -82,8 +83,17 @@ func ViewBuildContext(viewroot string) (build.BuildContext, error) {
 	}
 
 	return build.BuildContext{
-		Version: buildVersion,
-		Base:    build.BuildBaseSlim,
-		EnvVars: envVars,
+		Version:   buildVersion,
+		Base:      build.BuildBaseSlim,
+		EnvVars:   envVars,
+		Platforms: buildPlatforms(c),
 	}, nil
 }
+
+func buildPlatforms(c config.AirplaneConfig) []build.Platform {
+	var platforms []build.Platform
+	for _, p := range c.Build.Platforms {
+		platforms = append(platforms, build.Platform(p))
+	}
+	return platforms
+}
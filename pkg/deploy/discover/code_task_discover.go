@@ -135,10 +135,11 @@ func (c *CodeTaskDiscoverer) GetTaskRoot(ctx context.Context, file string) (stri
 	}
 
 	return pm.RootDir, build.BuildContext{
-		Type:    buildType,
-		Version: bc.Version,
-		Base:    base,
-		EnvVars: bc.EnvVars,
+		Type:      buildType,
+		Version:   bc.Version,
+		Base:      base,
+		EnvVars:   bc.EnvVars,
+		Platforms: bc.Platforms,
 	}, nil
 }
 
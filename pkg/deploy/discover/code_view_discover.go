@@ -168,10 +168,11 @@ func (dd *CodeViewDiscoverer) GetViewRoot(ctx context.Context, file string) (str
 	}
 
 	return root, build.BuildContext{
-		Type:    build.ViewBuildType,
-		Version: bc.Version,
-		Base:    bc.Base,
-		EnvVars: bc.EnvVars,
+		Type:      build.ViewBuildType,
+		Version:   bc.Version,
+		Base:      bc.Base,
+		EnvVars:   bc.EnvVars,
+		Platforms: bc.Platforms,
 	}, nil
 }
 
@@ -241,10 +241,11 @@ func setBuildVersionAndWorkingDir(file string, def definitions.DefinitionInterfa
 	}
 
 	return taskPathMetadata.RootDir, build.BuildContext{
-		Type:    buildType,
-		Version: buildTypeVersion,
-		Base:    buildBase,
-		EnvVars: envVars,
+		Type:      buildType,
+		Version:   buildTypeVersion,
+		Base:      buildBase,
+		EnvVars:   envVars,
+		Platforms: bc.Platforms,
 	}, nil
 }
 
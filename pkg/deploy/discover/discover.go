@@ -106,7 +106,7 @@ type Discoverer struct {
 	// EnvSlug is the slug of the environment to look for discovered tasks in.
 	//
 	// If a task is discovered, but doesn't exist in this environment, then the task
-	// is treated as missing.
+	// is treated as missing. Discover fails if the environment does not exist or is archived.
 	EnvSlug string
 }
 
@@ -115,6 +115,10 @@ type Discoverer struct {
 // precedence; if a single discoverer discovers multiple configs with the same slug, the first config
 // discovered takes precedence. Configs are returned in alphabetical order of their slugs.
 func (d *Discoverer) Discover(ctx context.Context, paths ...string) ([]TaskConfig, []ViewConfig, error) {
+	if err := d.checkEnv(ctx); err != nil {
+		return nil, nil, err
+	}
+
 	taskConfigsBySlug := map[string][]TaskConfig{}
 	viewConfigsBySlug := map[string][]ViewConfig{}
 	for _, p := range paths {
@@ -195,6 +199,26 @@ func (d *Discoverer) Discover(ctx context.Context, paths ...string) ([]TaskConfi
 	return deduplicateConfigs(taskConfigsBySlug, d.TaskDiscoverers), deduplicateConfigs(viewConfigsBySlug, d.ViewDiscoverers), nil
 }
 
+// checkEnv verifies that the Discoverer's environment exists and is not archived, so that
+// discovery fails fast instead of treating every task as missing.
+func (d *Discoverer) checkEnv(ctx context.Context) error {
+	if d.EnvSlug == "" || d.Client == nil {
+		return nil
+	}
+	env, err := d.Client.GetEnv(ctx, d.EnvSlug)
+	if err != nil {
+		var merr *api.EnvMissingError
+		if errors.As(err, &merr) {
+			return err
+		}
+		return errors.Wrapf(err, "checking environment %q", d.EnvSlug)
+	}
+	if env.IsArchived {
+		return errors.Errorf("environment with slug %q is archived", d.EnvSlug)
+	}
+	return nil
+}
+
 // deduplicateConfigs returns a list of configs unique by slug, sorted by slug
 // from a map of slug -> [task config, ...]. Configs are chosen based on order of Discoverers & order of discovery.
 func deduplicateConfigs[C interface{ GetSource() ConfigSource }, D ConfigDiscoverer](taskConfigsBySlug map[string][]C, configDiscoverers []D) []C {
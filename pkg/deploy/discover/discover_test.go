@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/airplanedev/lib/pkg/api"
+	libhttp "github.com/airplanedev/lib/pkg/api/http"
 	"github.com/airplanedev/lib/pkg/api/mock"
 	"github.com/airplanedev/lib/pkg/build"
 	"github.com/airplanedev/lib/pkg/deploy/taskdir/definitions"
@@ -1033,3 +1034,95 @@ func TestDiscover(t *testing.T) {
 		})
 	}
 }
+
+func TestDiscoverAgainstServer(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	server := mock.NewServer(mock.ServerOpts{
+		Client: &mock.MockClient{
+			Tasks: map[string]api.Task{
+				"my_task": {ID: "tsk123", Slug: "my_task", Kind: build.TaskKindNode, InterpolationMode: "jst"},
+			},
+		},
+	})
+	defer server.Close()
+	client := api.NewHTTPClient(server.URL, "", api.HTTPClientOpts{
+		ClientOpts: libhttp.ClientOpts{
+			Headers: map[string]string{
+				"X-Airplane-Client-Kind":    "test",
+				"X-Airplane-Client-Version": "1",
+			},
+			UserAgent: "airplane/test/1",
+		},
+	})
+	d := &Discoverer{
+		TaskDiscoverers: []TaskDiscoverer{&DefnDiscoverer{Client: client, Logger: &logger.MockLogger{}}},
+		Client:          client,
+		Logger:          &logger.MockLogger{},
+	}
+
+	// Transient errors are retried.
+	server.InjectFault(mock.Fault{Path: "/v0/tasks/getMetadata", StatusCode: 503, Times: 1})
+	taskConfigs, _, err := d.Discover(ctx, "./fixtures/defn.task.yaml")
+	require.NoError(err)
+	require.Len(taskConfigs, 1)
+	require.Equal("tsk123", taskConfigs[0].TaskID)
+
+	// Deploy the discovered task.
+	req, err := taskConfigs[0].Def.GetUpdateTaskRequest(ctx, client, false)
+	require.NoError(err)
+	_, err = client.UpdateTask(ctx, req)
+	require.NoError(err)
+	require.Equal("sunt in tempor eu", server.Client.Tasks["my_task"].Name)
+
+	// Archived tasks are skipped.
+	require.NoError(client.ArchiveTask(ctx, api.ArchiveTaskRequest{Slug: "my_task"}))
+	taskConfigs, _, err = d.Discover(ctx, "./fixtures/defn.task.yaml")
+	require.NoError(err)
+	require.Empty(taskConfigs)
+
+	var paths []string
+	for _, r := range server.Requests() {
+		paths = append(paths, r.Path)
+	}
+	require.Equal([]string{
+		"/v0/tasks/getMetadata",
+		"/v0/tasks/getMetadata",
+		"/v0/tasks/update",
+		"/v0/tasks/archive",
+		"/v0/tasks/getMetadata",
+	}, paths)
+}
+
+func TestDiscoverEnv(t *testing.T) {
+	ctx := context.Background()
+	client := &mock.MockClient{
+		Tasks: map[string]api.Task{
+			"my_task": {ID: "tsk123", Slug: "my_task", Kind: build.TaskKindNode, InterpolationMode: "jst"},
+		},
+		Envs: map[string]api.Env{
+			"prod": {ID: "env1", Slug: "prod"},
+			"old":  {ID: "env2", Slug: "old", IsArchived: true},
+		},
+	}
+	newDiscoverer := func(envSlug string) *Discoverer {
+		return &Discoverer{
+			TaskDiscoverers: []TaskDiscoverer{&DefnDiscoverer{Client: client, Logger: &logger.MockLogger{}}},
+			Client:          client,
+			Logger:          &logger.MockLogger{},
+			EnvSlug:         envSlug,
+		}
+	}
+
+	taskConfigs, _, err := newDiscoverer("prod").Discover(ctx, "./fixtures/defn.task.yaml")
+	require.NoError(t, err)
+	require.Len(t, taskConfigs, 1)
+
+	_, _, err = newDiscoverer("missing").Discover(ctx, "./fixtures/defn.task.yaml")
+	var merr *api.EnvMissingError
+	require.ErrorAs(t, err, &merr)
+
+	_, _, err = newDiscoverer("old").Discover(ctx, "./fixtures/defn.task.yaml")
+	require.EqualError(t, err, `environment with slug "old" is archived`)
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/airplanedev/lib/pkg/deploy/taskdir/definitions"
 	"github.com/airplanedev/lib/pkg/runtime"
 	_ "github.com/airplanedev/lib/pkg/runtime/builtin"
+	_ "github.com/airplanedev/lib/pkg/runtime/golang"
 	_ "github.com/airplanedev/lib/pkg/runtime/image"
 	_ "github.com/airplanedev/lib/pkg/runtime/javascript"
 	_ "github.com/airplanedev/lib/pkg/runtime/python"
@@ -132,10 +133,11 @@ func (sd *ScriptDiscoverer) GetTaskRoot(ctx context.Context, file string) (strin
 	}
 
 	return pathMetadata.RootDir, build.BuildContext{
-		Type:    buildType,
-		Version: buildTypeVersion,
-		Base:    buildBase,
-		EnvVars: bc.EnvVars,
+		Type:      buildType,
+		Version:   buildTypeVersion,
+		Base:      buildBase,
+		EnvVars:   bc.EnvVars,
+		Platforms: bc.Platforms,
 	}, nil
 }
 
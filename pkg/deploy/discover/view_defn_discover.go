@@ -125,10 +125,11 @@ func (dd *ViewDefnDiscoverer) GetViewRoot(ctx context.Context, file string) (str
 	}
 
 	return root, build.BuildContext{
-		Type:    build.ViewBuildType,
-		Version: bc.Version,
-		Base:    bc.Base,
-		EnvVars: bc.EnvVars,
+		Type:      build.ViewBuildType,
+		Version:   bc.Version,
+		Base:      bc.Base,
+		EnvVars:   bc.EnvVars,
+		Platforms: bc.Platforms,
 	}, nil
 }
 
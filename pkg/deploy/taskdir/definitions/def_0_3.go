@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"text/template"
 
@@ -33,6 +34,7 @@ type Definition_0_3 struct {
 	Node   *NodeDefinition_0_3   `json:"node,omitempty"`
 	Python *PythonDefinition_0_3 `json:"python,omitempty"`
 	Shell  *ShellDefinition_0_3  `json:"shell,omitempty"`
+	Go     *GoDefinition_0_3     `json:"go,omitempty"`
 
 	SQL     *SQLDefinition_0_3    `json:"sql,omitempty"`
 	REST    *RESTDefinition_0_3   `json:"rest,omitempty"`
@@ -46,6 +48,7 @@ type Definition_0_3 struct {
 	Runtime            build.TaskRuntime        `json:"runtime,omitempty"`
 
 	Schedules map[string]ScheduleDefinition_0_3 `json:"schedules,omitempty"`
+	Webhooks  map[string]WebhookDefinition_0_3  `json:"webhooks,omitempty"`
 
 	buildConfig  build.BuildConfig
 	defnFilePath string
@@ -493,6 +496,123 @@ func (d *ShellDefinition_0_3) getBuildType() (build.BuildType, build.BuildTypeVe
 func (d *ShellDefinition_0_3) SetBuildVersionBase(v build.BuildTypeVersion, b build.BuildBase) {
 }
 
+var _ taskKind_0_3 = &GoDefinition_0_3{}
+
+type GoDefinition_0_3 struct {
+	// Entrypoint is the relative path from the task definition file to a file of the task's
+	// package. It does not apply for inline configured tasks.
+	Entrypoint string `json:"entrypoint"`
+	// EntrypointFunc is the exported function of the entrypoint's package that the task
+	// calls. Defaults to build.DefaultGoEntrypointFunc.
+	EntrypointFunc string      `json:"entrypointFunc,omitempty"`
+	EnvVars        api.TaskEnv `json:"envVars,omitempty"`
+	Version        string      `json:"-"`
+
+	absoluteEntrypoint string `json:"-"`
+}
+
+func (d *GoDefinition_0_3) fillInUpdateTaskRequest(ctx context.Context, client api.IAPIClient, req *api.UpdateTaskRequest, bc build.BuildConfig, forBundle bool) error {
+	req.Env = d.EnvVars
+	if forBundle {
+		// The binary is shared by the tasks of the entrypoint's package, so it is passed the
+		// function to call unless the task uses the default.
+		req.Command = []string{build.GoBinaryPath(bc["entrypoint"].(string))}
+		req.Arguments = []string{"{{JSON.stringify(params)}}"}
+		if d.EntrypointFunc != "" {
+			req.Arguments = append([]string{d.EntrypointFunc}, req.Arguments...)
+		}
+	}
+	return nil
+}
+
+func (d *GoDefinition_0_3) hydrateFromTask(ctx context.Context, client api.IAPIClient, t *api.Task) error {
+	if v, ok := t.KindOptions["entrypoint"]; ok {
+		if sv, ok := v.(string); ok {
+			d.Entrypoint = sv
+		} else {
+			return errors.Errorf("expected string entrypoint, got %T instead", v)
+		}
+	}
+	if v, ok := t.KindOptions["entrypointFunc"]; ok {
+		if sv, ok := v.(string); ok {
+			d.EntrypointFunc = sv
+		} else {
+			return errors.Errorf("expected string entrypointFunc, got %T instead", v)
+		}
+	}
+	if v, ok := t.KindOptions["version"]; ok {
+		if sv, ok := v.(string); ok {
+			d.Version = sv
+		} else {
+			return errors.Errorf("expected string version, got %T instead", v)
+		}
+	}
+	d.EnvVars = t.Env
+	return nil
+}
+
+func (d *GoDefinition_0_3) setEntrypoint(entrypoint string) error {
+	d.Entrypoint = entrypoint
+	return nil
+}
+
+func (d *GoDefinition_0_3) setAbsoluteEntrypoint(entrypoint string) error {
+	d.absoluteEntrypoint = entrypoint
+	return nil
+}
+
+func (d *GoDefinition_0_3) getAbsoluteEntrypoint() (string, error) {
+	if d.absoluteEntrypoint == "" {
+		return "", ErrNoAbsoluteEntrypoint
+	}
+	return d.absoluteEntrypoint, nil
+}
+
+func (d *GoDefinition_0_3) getKindOptions() (build.KindOptions, error) {
+	ko := build.KindOptions{}
+	if d.Entrypoint != "" {
+		ko["entrypoint"] = d.Entrypoint
+	}
+	if d.EntrypointFunc != "" {
+		ko["entrypointFunc"] = d.EntrypointFunc
+	}
+	if d.Version != "" {
+		ko["version"] = d.Version
+	}
+	return ko, nil
+}
+
+func (d *GoDefinition_0_3) getEntrypoint() (string, error) {
+	return d.Entrypoint, nil
+}
+
+func (d *GoDefinition_0_3) getEnv() (api.TaskEnv, error) {
+	return d.EnvVars, nil
+}
+
+func (d *GoDefinition_0_3) setEnv(e api.TaskEnv) error {
+	d.EnvVars = e
+	return nil
+}
+
+func (d *GoDefinition_0_3) getConfigAttachments() []api.ConfigAttachment {
+	return []api.ConfigAttachment{}
+}
+
+func (d *GoDefinition_0_3) getResourceAttachments() map[string]string {
+	return nil
+}
+
+func (d *GoDefinition_0_3) getBuildType() (build.BuildType, build.BuildTypeVersion, build.BuildBase) {
+	return build.GoBuildType, build.BuildTypeVersion(d.Version), build.BuildBaseNone
+}
+
+func (d *GoDefinition_0_3) SetBuildVersionBase(v build.BuildTypeVersion, b build.BuildBase) {
+	if d.Version == "" {
+		d.Version = string(v)
+	}
+}
+
 var _ taskKind_0_3 = &SQLDefinition_0_3{}
 
 type SQLDefinition_0_3 struct {
@@ -912,6 +1032,18 @@ type ScheduleDefinition_0_3 struct {
 	ParamValues map[string]interface{} `json:"paramValues,omitempty"`
 }
 
+type WebhookDefinition_0_3 struct {
+	Name          string                             `json:"name,omitempty"`
+	Description   string                             `json:"description,omitempty"`
+	ParamMappings map[string]string                  `json:"paramMappings,omitempty"`
+	Verification  *WebhookVerificationDefinition_0_3 `json:"verification,omitempty"`
+}
+
+type WebhookVerificationDefinition_0_3 struct {
+	SecretConfig string `json:"secretConfig"`
+	Header       string `json:"header,omitempty"`
+}
+
 //go:embed schema_0_3.json
 var schemaStr string
 
@@ -940,6 +1072,10 @@ func NewDefinition_0_3(name string, slug string, kind build.TaskKind, entrypoint
 		def.Shell = &ShellDefinition_0_3{
 			Entrypoint: entrypoint,
 		}
+	case build.TaskKindGo:
+		def.Go = &GoDefinition_0_3{
+			Entrypoint: entrypoint,
+		}
 	case build.TaskKindSQL:
 		def.SQL = &SQLDefinition_0_3{
 			Entrypoint: entrypoint,
@@ -1054,6 +1190,7 @@ func (d Definition_0_3) GenerateCommentedFile(format DefFormat) ([]byte, error)
 		d.RequireRequests ||
 		!d.AllowSelfApprovals.IsZero() ||
 		!d.Timeout.IsZero() ||
+		len(d.Webhooks) > 0 ||
 		d.Builtin != nil {
 		return d.Marshal(format)
 	}
@@ -1112,6 +1249,17 @@ func (d Definition_0_3) GenerateCommentedFile(format DefFormat) ([]byte, error)
 			return nil, errors.Wrap(err, "executing shell template")
 		}
 		paramsExtraInfo = shellParamsExtraDescription
+	case build.TaskKindGo:
+		if len(d.Go.EnvVars) > 0 {
+			return d.Marshal(format)
+		}
+		tmpl, err := template.New("go").Parse(goTemplate)
+		if err != nil {
+			return nil, errors.Wrap(err, "parsing go template")
+		}
+		if err := tmpl.Execute(taskDefinition, d.Go); err != nil {
+			return nil, errors.Wrap(err, "executing go template")
+		}
 	case build.TaskKindSQL:
 		if d.SQL.Resource != "" || len(d.SQL.QueryArgs) > 0 {
 			return d.Marshal(format)
@@ -1194,9 +1342,38 @@ func (d *Definition_0_3) Unmarshal(format DefFormat, buf []byte) error {
 	if err = json.Unmarshal(buf, &d); err != nil {
 		return err
 	}
+
+	if errs := d.validateSchedules(); len(errs) > 0 {
+		return errors.WithStack(ErrSchemaValidation{Errors: errs})
+	}
 	return nil
 }
 
+// validateSchedules checks that each schedule has a valid cron expression. Cron expressions
+// are only validated as strings by the JSON schema.
+func (d *Definition_0_3) validateSchedules() []gojsonschema.ResultError {
+	slugs := make([]string, 0, len(d.Schedules))
+	for slug := range d.Schedules {
+		slugs = append(slugs, slug)
+	}
+	sort.Strings(slugs)
+
+	var errs []gojsonschema.ResultError
+	for _, slug := range slugs {
+		cron := d.Schedules[slug].CronExpr
+		_, err := api.ParseCronExpr(cron)
+		var cerr api.ErrInvalidCronExpr
+		if errors.As(err, &cerr) {
+			for _, ferr := range cerr.Errors {
+				errs = append(errs, newFieldError(cron, ferr.Error(), "schedules", slug, "cron"))
+			}
+		} else if err != nil {
+			return []gojsonschema.ResultError{newFieldError(cron, err.Error(), "schedules", slug, "cron")}
+		}
+	}
+	return errs
+}
+
 func (d *Definition_0_3) Normalize(ctx context.Context, client api.IAPIClient) error {
 	// Rewrites Resource to be a slug rather than a name.
 	if d.SQL != nil {
@@ -1234,6 +1411,8 @@ func (d Definition_0_3) Kind() (build.TaskKind, error) {
 		return build.TaskKindPython, nil
 	} else if d.Shell != nil {
 		return build.TaskKindShell, nil
+	} else if d.Go != nil {
+		return build.TaskKindGo, nil
 	} else if d.SQL != nil {
 		return build.TaskKindSQL, nil
 	} else if d.REST != nil {
@@ -1254,6 +1433,8 @@ func (d Definition_0_3) taskKind() (taskKind_0_3, error) {
 		return d.Python, nil
 	} else if d.Shell != nil {
 		return d.Shell, nil
+	} else if d.Go != nil {
+		return d.Go, nil
 	} else if d.SQL != nil {
 		return d.SQL, nil
 	} else if d.REST != nil {
@@ -1311,6 +1492,8 @@ func (d Definition_0_3) GetUpdateTaskRequest(ctx context.Context, client api.IAP
 
 	req.ExecuteRules.DisallowSelfApprove = pointers.Bool(!d.AllowSelfApprovals.Value())
 
+	req.Webhooks = d.GetWebhooks()
+
 	bc, err := d.GetBuildConfig()
 	if err != nil {
 		return api.UpdateTaskRequest{}, err
@@ -1534,6 +1717,29 @@ func (d *Definition_0_3) GetSchedules() map[string]api.Schedule {
 	return schedules
 }
 
+func (d *Definition_0_3) GetWebhooks() map[string]api.Webhook {
+	if len(d.Webhooks) == 0 {
+		return nil
+	}
+
+	webhooks := make(map[string]api.Webhook)
+	for slug, def := range d.Webhooks {
+		webhook := api.Webhook{
+			Name:          def.Name,
+			Description:   def.Description,
+			ParamMappings: def.ParamMappings,
+		}
+		if def.Verification != nil {
+			webhook.Verification = &api.WebhookVerification{
+				SecretConfig: def.Verification.SecretConfig,
+				Header:       def.Verification.Header,
+			}
+		}
+		webhooks[slug] = webhook
+	}
+	return webhooks
+}
+
 func NewDefinitionFromTask_0_3(ctx context.Context, client api.IAPIClient, t api.Task) (Definition_0_3, error) {
 	d := Definition_0_3{
 		Name:            t.Name,
@@ -1596,6 +1802,34 @@ func NewDefinitionFromTask_0_3(ctx context.Context, client api.IAPIClient, t api
 		d.Schedules = schedules
 	}
 
+	webhooks := make(map[string]WebhookDefinition_0_3)
+	for _, trigger := range t.Triggers {
+		if trigger.Kind != api.TriggerKindWebhook || trigger.Slug == nil || trigger.KindConfig.Webhook == nil {
+			// Trigger is not a webhook deployed via code
+			continue
+		}
+		if trigger.ArchivedAt != nil || trigger.DisabledAt != nil {
+			// Trigger is archived or disabled, so don't add to task defn file
+			continue
+		}
+
+		webhook := WebhookDefinition_0_3{
+			Name:          trigger.Name,
+			Description:   trigger.Description,
+			ParamMappings: trigger.KindConfig.Webhook.ParamMappings,
+		}
+		if v := trigger.KindConfig.Webhook.Verification; v != nil {
+			webhook.Verification = &WebhookVerificationDefinition_0_3{
+				SecretConfig: v.SecretConfig,
+				Header:       v.Header,
+			}
+		}
+		webhooks[*trigger.Slug] = webhook
+	}
+	if len(webhooks) > 0 {
+		d.Webhooks = webhooks
+	}
+
 	return d, nil
 }
 
@@ -1640,6 +1874,9 @@ func (d *Definition_0_3) convertTaskKindFromTask(ctx context.Context, client api
 	case build.TaskKindShell:
 		d.Shell = &ShellDefinition_0_3{}
 		return d.Shell.hydrateFromTask(ctx, client, t)
+	case build.TaskKindGo:
+		d.Go = &GoDefinition_0_3{}
+		return d.Go.hydrateFromTask(ctx, client, t)
 	case build.TaskKindSQL:
 		d.SQL = &SQLDefinition_0_3{}
 		return d.SQL.hydrateFromTask(ctx, client, t)
@@ -2,6 +2,7 @@ package definitions
 
 import (
 	"context"
+	"encoding/json"
 	"testing"
 	"time"
 
@@ -539,6 +540,29 @@ func TestTaskToDefinition_0_3(t *testing.T) {
 				AllowSelfApprovals: DefaultTrueDefinition{pointers.Bool(true)},
 			},
 		},
+		{
+			name: "go task",
+			task: api.Task{
+				Name:      "Go Task",
+				Slug:      "go_task",
+				Arguments: []string{},
+				Kind:      build.TaskKindGo,
+				KindOptions: build.KindOptions{
+					"entrypoint":     "users.go",
+					"entrypointFunc": "ListUsers",
+				},
+			},
+			definition: Definition_0_3{
+				Name:       "Go Task",
+				Slug:       "go_task",
+				Parameters: []ParameterDefinition_0_3{},
+				Go: &GoDefinition_0_3{
+					Entrypoint:     "users.go",
+					EntrypointFunc: "ListUsers",
+				},
+				AllowSelfApprovals: DefaultTrueDefinition{pointers.Bool(true)},
+			},
+		},
 		{
 			name: "image task",
 			task: api.Task{
@@ -1357,6 +1381,76 @@ func TestDefinitionToUpdateTaskRequest_0_3(t *testing.T) {
 				Timeout:           0,
 			},
 		},
+		{
+			name:     "go task from bundle",
+			isBundle: true,
+			definition: Definition_0_3{
+				Name: "Go Task",
+				Slug: "go_task",
+				Go: &GoDefinition_0_3{
+					Entrypoint: "tasks/users/users.go",
+					Version:    "1.20",
+				},
+				buildConfig: build.BuildConfig{
+					"entrypoint": "tasks/users/users.go",
+				},
+			},
+			request: api.UpdateTaskRequest{
+				Name:       "Go Task",
+				Slug:       "go_task",
+				Command:    []string{"/airplane/.airplane/bin/tasks/users/airplane-task"},
+				Arguments:  []string{"{{JSON.stringify(params)}}"},
+				Parameters: []api.Parameter{},
+				Resources:  map[string]string{},
+				Configs:    &[]api.ConfigAttachment{},
+				Kind:       build.TaskKindGo,
+				KindOptions: build.KindOptions{
+					"entrypoint": "tasks/users/users.go",
+					"version":    "1.20",
+				},
+				ExecuteRules: api.UpdateExecuteRulesRequest{
+					DisallowSelfApprove: pointers.Bool(false),
+					RequireRequests:     pointers.Bool(false),
+				},
+				Timeout: 0,
+			},
+		},
+		{
+			name:     "go task with entrypointFunc from bundle",
+			isBundle: true,
+			definition: Definition_0_3{
+				Name: "Go Task",
+				Slug: "go_task",
+				Go: &GoDefinition_0_3{
+					Entrypoint:     "tasks/users/users.go",
+					EntrypointFunc: "ListUsers",
+					Version:        "1.20",
+				},
+				buildConfig: build.BuildConfig{
+					"entrypoint": "tasks/users/users.go",
+				},
+			},
+			request: api.UpdateTaskRequest{
+				Name:       "Go Task",
+				Slug:       "go_task",
+				Command:    []string{"/airplane/.airplane/bin/tasks/users/airplane-task"},
+				Arguments:  []string{"ListUsers", "{{JSON.stringify(params)}}"},
+				Parameters: []api.Parameter{},
+				Resources:  map[string]string{},
+				Configs:    &[]api.ConfigAttachment{},
+				Kind:       build.TaskKindGo,
+				KindOptions: build.KindOptions{
+					"entrypoint":     "tasks/users/users.go",
+					"entrypointFunc": "ListUsers",
+					"version":        "1.20",
+				},
+				ExecuteRules: api.UpdateExecuteRulesRequest{
+					DisallowSelfApprove: pointers.Bool(false),
+					RequireRequests:     pointers.Bool(false),
+				},
+				Timeout: 0,
+			},
+		},
 		{
 			name: "image task",
 			definition: Definition_0_3{
@@ -1877,3 +1971,143 @@ func TestDefinitionGetSchedules_0_3(t *testing.T) {
 	require.Contains(scheduleDef.ParamValues, "param_one")
 	require.Equal(scheduleDef.ParamValues["param_one"], 5.5)
 }
+
+func TestDefinitionWebhooks_0_3(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	buf := []byte(`name: Webhook Task
+slug: webhook_task
+python:
+  entrypoint: main.py
+webhooks:
+  on_signup:
+    name: On signup
+    paramMappings:
+      email: "{{body.user.email}}"
+    verification:
+      secretConfig: signup_secret
+      header: X-Signature
+  no_verification:
+    paramMappings:
+      id: "{{query.id}}"
+`)
+	var def Definition_0_3
+	require.NoError(def.Unmarshal(DefFormatYAML, buf))
+	require.Equal(map[string]WebhookDefinition_0_3{
+		"on_signup": {
+			Name:          "On signup",
+			ParamMappings: map[string]string{"email": "{{body.user.email}}"},
+			Verification: &WebhookVerificationDefinition_0_3{
+				SecretConfig: "signup_secret",
+				Header:       "X-Signature",
+			},
+		},
+		"no_verification": {
+			ParamMappings: map[string]string{"id": "{{query.id}}"},
+		},
+	}, def.Webhooks)
+
+	client := &mock.MockClient{
+		Tasks: map[string]api.Task{
+			"webhook_task": {ID: "tsk123", Slug: "webhook_task"},
+		},
+	}
+	req, err := def.GetUpdateTaskRequest(ctx, client, false)
+	require.NoError(err)
+	require.Equal(map[string]api.Webhook{
+		"on_signup": {
+			Name:          "On signup",
+			ParamMappings: map[string]string{"email": "{{body.user.email}}"},
+			Verification: &api.WebhookVerification{
+				SecretConfig: "signup_secret",
+				Header:       "X-Signature",
+			},
+		},
+		"no_verification": {
+			ParamMappings: map[string]string{"id": "{{query.id}}"},
+		},
+	}, req.Webhooks)
+
+	// Round-trip the webhooks through a deploy.
+	_, err = client.UpdateTask(ctx, req)
+	require.NoError(err)
+	task, err := client.GetTask(ctx, api.GetTaskRequest{Slug: "webhook_task"})
+	require.NoError(err)
+	d, err := NewDefinitionFromTask_0_3(ctx, client, task)
+	require.NoError(err)
+	require.Equal(def.Webhooks, d.Webhooks)
+
+	// Removing a webhook from the definition removes it from the task, but webhooks that
+	// weren't deployed from code, e.g. ones created in the UI, are kept.
+	task.Triggers = append(task.Triggers, api.Trigger{
+		Name:       "UI webhook",
+		Kind:       api.TriggerKindWebhook,
+		KindConfig: api.TriggerKindConfig{Webhook: &api.TriggerKindConfigWebhook{}},
+	})
+	client.Tasks["webhook_task"] = task
+	delete(def.Webhooks, "no_verification")
+	req, err = def.GetUpdateTaskRequest(ctx, client, false)
+	require.NoError(err)
+	_, err = client.UpdateTask(ctx, req)
+	require.NoError(err)
+	task, err = client.GetTask(ctx, api.GetTaskRequest{Slug: "webhook_task"})
+	require.NoError(err)
+	d, err = NewDefinitionFromTask_0_3(ctx, client, task)
+	require.NoError(err)
+	require.Equal(def.Webhooks, d.Webhooks)
+	var names []string
+	for _, trigger := range task.Triggers {
+		names = append(names, trigger.Name)
+	}
+	require.ElementsMatch([]string{"UI webhook", "On signup"}, names)
+
+	// A definition without webhooks leaves the task's webhooks unchanged.
+	def.Webhooks = nil
+	req, err = def.GetUpdateTaskRequest(ctx, client, false)
+	require.NoError(err)
+	require.Nil(req.Webhooks)
+	b, err := json.Marshal(req)
+	require.NoError(err)
+	require.NotContains(string(b), `"webhooks"`)
+	_, err = client.UpdateTask(ctx, req)
+	require.NoError(err)
+	unchanged, err := client.GetTask(ctx, api.GetTaskRequest{Slug: "webhook_task"})
+	require.NoError(err)
+	require.Equal(task.Triggers, unchanged.Triggers)
+
+	// Verification requires a secret.
+	err = def.Unmarshal(DefFormatYAML, []byte(`name: Webhook Task
+slug: webhook_task
+python:
+  entrypoint: main.py
+webhooks:
+  on_signup:
+    verification:
+      header: X-Signature
+`))
+	require.Error(err)
+}
+
+func TestDefinitionInvalidSchedules_0_3(t *testing.T) {
+	require := require.New(t)
+
+	var def Definition_0_3
+	err := def.Unmarshal(DefFormatYAML, []byte(`name: Hello World
+slug: hello_world
+python:
+  entrypoint: hello_world.py
+schedules:
+  valid:
+    cron: "*/5 9-17 * * mon-fri"
+  typo:
+    cron: 0 25 * * mnday
+`))
+	var serr ErrSchemaValidation
+	require.ErrorAs(err, &serr)
+	require.Len(serr.Errors, 2)
+	require.Equal("schedules.typo.cron", serr.Errors[0].Field())
+	require.Equal(`hour "25": value 25 out of range [0, 23]`, serr.Errors[0].Description())
+	require.Equal("schedules.typo.cron", serr.Errors[1].Field())
+	require.Equal(`dayOfWeek "mnday": invalid value "mnday"`, serr.Errors[1].Description())
+}
@@ -53,6 +53,7 @@ type DefinitionInterface interface {
 	SetWorkdir(taskroot, workdir string) error
 
 	GetSchedules() map[string]api.Schedule
+	GetWebhooks() map[string]api.Webhook
 
 	// Entrypoint returns ErrNoEntrypoint if the task kind definition requires no entrypoint. May be
 	// empty. May be absolute or relative; if relative, it is relative to the defn file.
@@ -13,3 +13,20 @@ type ErrSchemaValidation struct {
 func (err ErrSchemaValidation) Error() string {
 	return fmt.Sprintf("invalid format: %v", err.Errors)
 }
+
+// newFieldError creates a schema validation error for a field that is well-formed according to
+// the JSON schema but failed a semantic check. `field` is the path to the field from the root of
+// the definition.
+func newFieldError(value interface{}, description string, field ...string) gojsonschema.ResultError {
+	context := gojsonschema.NewJsonContext(gojsonschema.STRING_CONTEXT_ROOT, nil)
+	for _, f := range field {
+		context = gojsonschema.NewJsonContext(f, context)
+	}
+
+	err := &gojsonschema.ResultErrorFields{}
+	err.SetType("invalid_value")
+	err.SetContext(context)
+	err.SetValue(value)
+	err.SetDescription(description)
+	return err
+}
@@ -115,6 +115,30 @@ shell:
   #   ENV_VAR_FROM_VALUE:
   #     value: env_var_value
 `
+const goTemplate = `
+# Configuration for a Go task.
+go:
+  # The path to the .go file containing the logic for this task. This can be
+  # absolute or relative to the location of the definition file. The task calls
+  # the ` + "`entrypointFunc`" + ` function of the file's package, which must not be a
+  # main package.
+  entrypoint: {{.Entrypoint}}
+
+  # The exported function of the entrypoint's package to call. Default: Main.
+  # entrypointFunc: Main
+
+  # A map of environment variables to use when running the task. The value
+  # should be an object; if specifying raw values, the value must be an object
+  # with ` + "`value`" + ` mapped to the value of the environment variable; if
+  # using config variables, the value must be an object with ` + "`config`" + `
+  # mapped to the name of the config variable.
+  # envVars:
+  #   ENV_VAR_FROM_CONFIG:
+  #     config: database_url
+  #   ENV_VAR_FROM_VALUE:
+  #     value: env_var_value
+`
+
 const shellParamsExtraDescription = ` Parameters are passed into your script
 # as environment variables of form PARAM_{SLUG}, e.g. PARAM_USER_EMAIL.`
 
@@ -43,6 +43,14 @@ func TestYAMLComments(t *testing.T) {
 			kind:       build.TaskKindShell,
 			entrypoint: "my_task.sh",
 		},
+		{
+			descriptor: "go",
+			name:       "My Task",
+			slug:       "my_task",
+			file:       fixturesPath + "/go.task.yaml",
+			kind:       build.TaskKindGo,
+			entrypoint: "my_task.go",
+		},
 		{
 			descriptor: "docker",
 			name:       "My Task",
@@ -0,0 +1,3 @@
+module github.com/airplanedev/examples/bundle
+
+go 1.20
@@ -0,0 +1,17 @@
+package hello
+
+import (
+	"fmt"
+)
+
+type Params struct {
+	Name string `json:"name"`
+}
+
+func Main(params Params) string {
+	return fmt.Sprintf("Hello, %s!", params.Name)
+}
+
+func Goodbye(params Params) string {
+	return fmt.Sprintf("Goodbye, %s!", params.Name)
+}
@@ -0,0 +1,43 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+type User struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Role string `json:"role"`
+}
+
+type Params struct {
+	Role string `json:"role"`
+}
+
+// Main lists the users with a role, sorted by name.
+func Main(ctx context.Context, params Params) ([]User, error) {
+	if params.Role == "" {
+		return nil, errors.New("role is required")
+	}
+
+	users := []User{
+		{ID: 1, Name: "Gabriel Davis", Role: "Dentist"},
+		{ID: 2, Name: "Carolyn Garcia", Role: "Sales"},
+		{ID: 3, Name: "Frances Hernandez", Role: "Astronaut"},
+		{ID: 4, Name: "Melissa Rodriguez", Role: "Engineer"},
+		{ID: 5, Name: "Jacob Hall", Role: "Engineer"},
+		{ID: 6, Name: "Andrea Lopez", Role: "Astronaut"},
+	}
+	var matches []User
+	for _, u := range users {
+		if u.Role == params.Role {
+			matches = append(matches, u)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].Name < matches[j].Name
+	})
+	return matches, nil
+}
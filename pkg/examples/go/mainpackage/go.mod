@@ -0,0 +1,3 @@
+module github.com/airplanedev/examples/mainpackage
+
+go 1.19
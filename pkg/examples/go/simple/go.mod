@@ -0,0 +1,3 @@
+module github.com/airplanedev/examples/simple
+
+go 1.19
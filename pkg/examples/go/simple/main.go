@@ -0,0 +1,16 @@
+package simple
+
+import (
+	"context"
+	"fmt"
+)
+
+type Params struct {
+	ID string `json:"id"`
+}
+
+// Main is called with the task's params when the task is executed.
+func Main(ctx context.Context, params Params) (string, error) {
+	fmt.Printf("Running with id %s\n", params.ID)
+	return params.ID, nil
+}
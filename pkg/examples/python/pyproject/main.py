@@ -0,0 +1,4 @@
+import dice
+
+def main(params):
+    print(dice.roll('1d1'))
@@ -0,0 +1,280 @@
+package golang
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/MakeNowJust/heredoc/v2"
+	"github.com/airplanedev/lib/pkg/build"
+	"github.com/airplanedev/lib/pkg/deploy/taskdir/definitions"
+	"github.com/airplanedev/lib/pkg/runtime"
+	"github.com/airplanedev/lib/pkg/utils/airplane_directory"
+	"github.com/airplanedev/lib/pkg/utils/fsx"
+	"github.com/airplanedev/lib/pkg/utils/logger"
+	"github.com/pkg/errors"
+)
+
+// Init register the runtime.
+func init() {
+	runtime.Register(".go", Runtime{})
+}
+
+// Code template.
+var code = template.Must(template.New("go").Parse(`{{with .Comment -}}
+{{.}}
+
+{{end -}}
+package task
+
+import (
+	"context"
+	"sort"
+)
+
+type Params struct {
+	// Params are decoded from JSON, e.g. a "user_id" param:
+	// UserID string ` + "`json:\"user_id\"`" + `
+}
+
+type User struct {
+	ID   int    ` + "`json:\"id\"`" + `
+	Name string ` + "`json:\"name\"`" + `
+	Role string ` + "`json:\"role\"`" + `
+}
+
+// Main is your task's entrypoint. When your task is executed, this
+// function will be called.
+func Main(ctx context.Context, params Params) ([]User, error) {
+	data := []User{
+		{ID: 1, Name: "Gabriel Davis", Role: "Dentist"},
+		{ID: 2, Name: "Carolyn Garcia", Role: "Sales"},
+		{ID: 3, Name: "Frances Hernandez", Role: "Astronaut"},
+		{ID: 4, Name: "Melissa Rodriguez", Role: "Engineer"},
+		{ID: 5, Name: "Jacob Hall", Role: "Engineer"},
+		{ID: 6, Name: "Andrea Lopez", Role: "Astronaut"},
+	}
+
+	// Sort the data in ascending order by name.
+	sort.Slice(data, func(i, j int) bool {
+		return data[i].Name < data[j].Name
+	})
+
+	// You can return data to show output to users.
+	// Output documentation: https://docs.airplane.dev/tasks/output
+	return data, nil
+}
+`))
+
+// Data represents the data template.
+type data struct {
+	Comment string
+}
+
+// minLocalGoMinor is the minimum minor version of Go that is needed to run tasks locally,
+// since `go run` is run with `-C`.
+const minLocalGoMinor = 20
+
+// Runtime implementation.
+type Runtime struct{}
+
+// PrepareRun implementation.
+func (r Runtime) PrepareRun(ctx context.Context, logger logger.Logger, opts runtime.PrepareRunOptions) (rexprs []string, rcloser io.Closer, rerr error) {
+	if err := checkGoInstalled(ctx, logger); err != nil {
+		return nil, nil, err
+	}
+
+	root, err := r.Root(opts.Path)
+	if err != nil {
+		return nil, nil, err
+	}
+	mod, err := build.ReadGoMod(root)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entrypoint, err := filepath.Rel(root, opts.Path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "entrypoint is not within the task root")
+	}
+	importPath, err := build.GoImportPath(root, mod, entrypoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	entrypointFunc, _ := opts.KindOptions["entrypointFunc"].(string)
+	shim, err := build.GoShim(build.GoShimParams{
+		ImportPath:     importPath,
+		EntrypointFunc: entrypointFunc,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, taskDir, closer, err := airplane_directory.CreateTaskDir(root, opts.TaskSlug)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer func() {
+		// If we encountered an error before returning, then we're responsible
+		// for performing our own cleanup.
+		if rerr != nil {
+			closer.Close()
+		}
+	}()
+
+	// The shim is a main package inside of the module, so that it can import the task.
+	if err := os.WriteFile(filepath.Join(taskDir, "main.go"), []byte(shim), 0644); err != nil {
+		return nil, nil, errors.Wrap(err, "writing shim file")
+	}
+	shimPkg, err := filepath.Rel(root, taskDir)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "shim is not within the task root")
+	}
+
+	pv, err := json.Marshal(opts.ParamValues)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "serializing param values")
+	}
+
+	return []string{"go", "-C", root, "run", "./" + filepath.ToSlash(shimPkg), string(pv)}, closer, nil
+}
+
+// checkGoInstalled checks that a version of Go that supports `go -C` is installed.
+func checkGoInstalled(ctx context.Context, logger logger.Logger) error {
+	if _, err := exec.LookPath("go"); err != nil {
+		return errors.New(heredoc.Doc(`
+            Could not find the go command on your PATH.
+            Ensure that Go is installed and available in your shell environment.
+        `))
+	}
+	cmd := exec.CommandContext(ctx, "go", "env", "GOVERSION")
+	logger.Debug("Running %s", strings.Join(cmd.Args, " "))
+	out, err := cmd.Output()
+	if err != nil {
+		return errors.New(fmt.Sprintf(heredoc.Doc(`
+            Got an error while running %s:
+            %s
+        `), strings.Join(cmd.Args, " "), err.Error()))
+	}
+	version := strings.TrimSpace(string(out))
+	if minor, ok := goMinorVersion(strings.TrimPrefix(version, "go")); ok && minor < minLocalGoMinor {
+		return errors.Errorf("Found %s on your PATH, but running Go tasks locally requires go1.%d or later.", version, minLocalGoMinor)
+	}
+	return nil
+}
+
+// Generate implementation.
+func (r Runtime) Generate(t *runtime.Task) ([]byte, fs.FileMode, error) {
+	d := data{}
+	if t != nil {
+		d.Comment = runtime.Comment(r, t.URL)
+	}
+
+	var buf bytes.Buffer
+	if err := code.Execute(&buf, d); err != nil {
+		return nil, 0, fmt.Errorf("go: template execute - %w", err)
+	}
+
+	return buf.Bytes(), 0644, nil
+}
+
+// GenerateInline implementation.
+func (r Runtime) GenerateInline(def *definitions.Definition_0_3) ([]byte, fs.FileMode, error) {
+	return nil, 0, errors.New("cannot generate inline go task configuration")
+}
+
+// Workdir implementation.
+func (r Runtime) Workdir(path string) (string, error) {
+	return r.Root(path)
+}
+
+// Root implementation.
+//
+// The root of a Go task is the root of its module.
+func (r Runtime) Root(path string) (string, error) {
+	root, ok := fsx.Find(path, "go.mod")
+	if !ok {
+		return "", errors.Errorf("could not find a go.mod for %s", path)
+	}
+	return root, nil
+}
+
+// Version implementation.
+//
+// The version is the oldest supported version of Go that satisfies the `go` directive of
+// the task's go.mod.
+func (r Runtime) Version(rootPath string) (build.BuildTypeVersion, error) {
+	mod, err := build.ReadGoMod(rootPath)
+	if err != nil {
+		return "", err
+	}
+	if mod.Go == "" {
+		return build.BuildTypeVersionUnspecified, nil
+	}
+	required, ok := goMinorVersion(mod.Go)
+	if !ok {
+		return "", errors.Errorf("unable to parse go directive %q of go.mod", mod.Go)
+	}
+
+	var latest build.BuildTypeVersion
+	for _, v := range build.AllBuildTypeVersions[build.GoBuildType] {
+		minor, ok := goMinorVersion(string(v))
+		if !ok {
+			continue
+		}
+		if minor >= required {
+			return v, nil
+		}
+		latest = v
+	}
+	return "", errors.Errorf("go.mod requires go %s, but the latest supported version is %s", mod.Go, latest)
+}
+
+// goMinorVersion returns the minor version of a Go 1 version, e.g. 20 for "1.20.3" or
+// "1.21rc2".
+func goMinorVersion(version string) (int, bool) {
+	major, rest, ok := strings.Cut(version, ".")
+	if !ok || major != "1" {
+		return 0, false
+	}
+	end := 0
+	for end < len(rest) && rest[end] >= '0' && rest[end] <= '9' {
+		end++
+	}
+	minor, err := strconv.Atoi(rest[:end])
+	if err != nil {
+		return 0, false
+	}
+	return minor, true
+}
+
+// Kind implementation.
+func (r Runtime) Kind() build.TaskKind {
+	return build.TaskKindGo
+}
+
+// FormatComment implementation.
+func (r Runtime) FormatComment(s string) string {
+	var lines []string
+
+	for _, line := range strings.Split(s, "\n") {
+		lines = append(lines, "// "+line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// SupportsLocalExecution implementation.
+func (r Runtime) SupportsLocalExecution() bool {
+	return true
+}
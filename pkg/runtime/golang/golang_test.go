@@ -0,0 +1,83 @@
+package golang
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/airplanedev/lib/pkg/build"
+	"github.com/airplanedev/lib/pkg/examples"
+	"github.com/airplanedev/lib/pkg/runtime"
+	"github.com/airplanedev/lib/pkg/utils/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoot(t *testing.T) {
+	require := require.New(t)
+
+	root := examples.Path(t, "go/bundle")
+	r, err := Runtime{}.Root(filepath.Join(root, "users", "users.go"))
+	require.NoError(err)
+	require.Equal(root, r)
+
+	_, err = Runtime{}.Root(filepath.Join(t.TempDir(), "main.go"))
+	require.ErrorContains(err, "could not find a go.mod")
+}
+
+func TestVersion(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		gomod   string
+		version build.BuildTypeVersion
+		err     bool
+	}{
+		{"no go directive", "module example.com/task\n", build.BuildTypeVersionUnspecified, false},
+		{"older", "module example.com/task\n\ngo 1.16\n", build.BuildTypeVersionGo119, false},
+		{"exact", "module example.com/task\n\ngo 1.20 // comment\n", build.BuildTypeVersionGo120, false},
+		{"patch", "module example.com/task\n\ngo 1.21.3\n", build.BuildTypeVersionGo121, false},
+		{"newer", "module example.com/task\n\ngo 1.99\n", "", true},
+		{"invalid", "module example.com/task\n\ngo latest\n", "", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			require := require.New(t)
+			root := t.TempDir()
+			require.NoError(os.WriteFile(filepath.Join(root, "go.mod"), []byte(test.gomod), 0644))
+
+			version, err := Runtime{}.Version(root)
+			if test.err {
+				require.Error(err)
+				return
+			}
+			require.NoError(err)
+			require.Equal(test.version, version)
+		})
+	}
+}
+
+func TestPrepareRun(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	root := t.TempDir()
+	require.NoError(os.WriteFile(filepath.Join(root, "go.mod"), []byte("module example.com/tasks\n\ngo 1.19\n"), 0644))
+	require.NoError(os.MkdirAll(filepath.Join(root, "users"), 0755))
+	code, _, err := Runtime{}.Generate(&runtime.Task{URL: "https://app.airplane.dev/t/list_users"})
+	require.NoError(err)
+	entrypoint := filepath.Join(root, "users", "users.go")
+	require.NoError(os.WriteFile(entrypoint, code, 0644))
+	require.Equal("list_users", runtime.Slug(entrypoint))
+
+	cmd, closer, err := Runtime{}.PrepareRun(ctx, &logger.MockLogger{}, runtime.PrepareRunOptions{
+		Path:        entrypoint,
+		ParamValues: runtime.Values{},
+		TaskSlug:    "list_users",
+	})
+	require.NoError(err)
+	defer closer.Close()
+
+	out, err := exec.CommandContext(ctx, cmd[0], cmd[1:]...).CombinedOutput()
+	require.NoError(err, string(out))
+	require.Contains(string(out), `airplane_output_set [{"id":6,"name":"Andrea Lopez","role":"Astronaut"},`)
+}
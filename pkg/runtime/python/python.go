@@ -111,12 +111,48 @@ func (r Runtime) PrepareRun(ctx context.Context, logger logger.Logger, opts runt
 		return nil, nil, errors.Wrap(err, "serializing param values")
 	}
 
-	bin := pythonBin(logger)
+	bin := projectPythonBin(ctx, logger, root)
+	if bin == "" {
+		bin = pythonBin(logger)
+	}
 	if bin == "" {
 		return nil, nil, errors.New("could not find python")
 	}
 	// -u forces the stdout stream to be unbuffered, or else Python may buffer logs until the run completes.
-	return []string{pythonBin(logger), "-u", filepath.Join(taskDir, "shim.py"), string(pv)}, closer, nil
+	return []string{bin, "-u", filepath.Join(taskDir, "shim.py"), string(pv)}, closer, nil
+}
+
+// projectPythonBin returns the Python interpreter of the virtualenv that Poetry or Pipenv
+// manages for the project at root, if any, so that tasks run with the project's dependencies.
+func projectPythonBin(ctx context.Context, logger logger.Logger, root string) string {
+	deps, ok, err := build.DetectPythonDependencies(root)
+	if err != nil || !ok {
+		return ""
+	}
+
+	var cmd *exec.Cmd
+	switch deps.Manager {
+	case build.PythonPackageManagerPoetry:
+		cmd = exec.CommandContext(ctx, "poetry", "env", "info", "--executable")
+	case build.PythonPackageManagerPipenv:
+		cmd = exec.CommandContext(ctx, "pipenv", "--py")
+	default:
+		return ""
+	}
+	cmd.Dir = root
+	logger.Debug("Running %s", strings.Join(cmd.Args, " "))
+	out, err := cmd.Output()
+	if err != nil {
+		logger.Debug("Could not find the %s virtualenv, falling back to the system python: %s", deps.Manager, err)
+		return ""
+	}
+	bin := strings.TrimSpace(string(out))
+	if bin == "" || !fsx.Exists(bin) {
+		logger.Debug("Could not find the %s virtualenv, falling back to the system python", deps.Manager)
+		return ""
+	}
+	logger.Debug("Using the %s virtualenv at %s", deps.Manager, bin)
+	return bin
 }
 
 // pythonBin returns the first of python3 or python found on PATH, if any.
@@ -461,7 +497,7 @@ func (r Runtime) Workdir(path string) (string, error) {
 
 // Root implementation.
 func (r Runtime) Root(path string) (string, error) {
-	root, ok := fsx.Find(path, "requirements.txt")
+	root, ok := build.FindPythonRoot(path)
 	if ok {
 		return root, nil
 
@@ -3,9 +3,11 @@ package python
 import (
 	"context"
 	"encoding/json"
+	"path/filepath"
 	"testing"
 
 	"github.com/airplanedev/lib/pkg/deploy/taskdir/definitions"
+	"github.com/airplanedev/lib/pkg/examples"
 	"github.com/airplanedev/lib/pkg/utils/logger"
 	"github.com/stretchr/testify/require"
 )
@@ -18,6 +20,18 @@ func TestCheckPythonInstalled(t *testing.T) {
 	require.NoError(err)
 }
 
+func TestRoot(t *testing.T) {
+	for _, example := range []string{"python/requirements", "python/poetry", "python/pipenv", "python/pyproject"} {
+		t.Run(example, func(t *testing.T) {
+			require := require.New(t)
+			root := examples.Path(t, example)
+			r, err := Runtime{}.Root(filepath.Join(root, "main.py"))
+			require.NoError(err)
+			require.Equal(root, r)
+		})
+	}
+}
+
 func TestInlineMinimal(t *testing.T) {
 	require := require.New(t)
 
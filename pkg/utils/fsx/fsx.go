@@ -65,17 +65,27 @@ func Find(dir, filename string) (string, bool) {
 // Continues until the `end` directory is reached (inclusively).
 // If `end` is an empty string, continues until the root directory.
 func FindUntil(start, end, filename string) (string, bool) {
-	dst := filepath.Join(start, filename)
+	return findUntil(start, end, []string{filename})
+}
+
+// FindAny is like Find, but finds the closest directory that contains
+// any of the given filenames.
+func FindAny(dir string, filenames ...string) (string, bool) {
+	return findUntil(dir, "", filenames)
+}
 
-	if !Exists(dst) {
-		next := filepath.Dir(start)
-		if next == start || next == "." || (end != "" && strings.HasPrefix(end, next)) || next == string(filepath.Separator) {
-			return "", false
+func findUntil(start, end string, filenames []string) (string, bool) {
+	for _, filename := range filenames {
+		if Exists(filepath.Join(start, filename)) {
+			return start, true
 		}
-		return FindUntil(next, end, filename)
 	}
 
-	return start, true
+	next := filepath.Dir(start)
+	if next == start || next == "." || (end != "" && strings.HasPrefix(end, next)) || next == string(filepath.Separator) {
+		return "", false
+	}
+	return findUntil(next, end, filenames)
 }
 
 func TrimExtension(file string) string {
@@ -76,6 +76,22 @@ func TestFindUntil(t *testing.T) {
 	assert.Equal("b", getFile(filepath.Join(v, filename)))
 }
 
+func TestFindAny(t *testing.T) {
+	var assert = require.New(t)
+
+	// Should return the closest directory with any of the files:
+	v, ok := FindAny("testdata/a/b/c", "b.txt", "c.txt")
+	assert.True(ok)
+	assert.Equal("testdata/a/b/c", v)
+
+	v, ok = FindAny("testdata/a/b/c", "b.txt", "missing.txt")
+	assert.True(ok)
+	assert.Equal("testdata/a/b", v)
+
+	_, ok = FindAny("testdata/a/b/c", "missing.txt", "other.txt")
+	assert.False(ok)
+}
+
 func TestAssertExistsAll(t *testing.T) {
 	var assert = require.New(t)
 
@@ -0,0 +1,246 @@
+// Command pinversions pins the digests of the base images in pkg/build/versions.json for
+// every platform that images can be built for, along with the digest of each image's
+// manifest list, by resolving each tag against its registry.
+//
+// Run it from the root of the repo, optionally with the builders to pin:
+//
+//	go run ./scripts/pinversions node python go
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/airplanedev/lib/pkg/build"
+	"github.com/airplanedev/ojson"
+	"github.com/pkg/errors"
+)
+
+func main() {
+	file := flag.String("file", "pkg/build/versions.json", "path of versions.json")
+	flag.Parse()
+
+	if err := run(context.Background(), *file, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, file string, builders []string) error {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return errors.Wrap(err, "reading versions")
+	}
+	var versions ojson.Value
+	if err := json.Unmarshal(b, &versions); err != nil {
+		return errors.Wrap(err, "parsing versions")
+	}
+	root, ok := versions.V.(*ojson.Object)
+	if !ok {
+		return errors.New("versions must be an object")
+	}
+	if len(builders) == 0 {
+		builders = root.KeyOrder()
+	}
+
+	for _, builder := range builders {
+		v, _ := root.Get(builder)
+		entries, ok := v.(*ojson.Object)
+		if !ok {
+			return errors.Errorf("unknown builder %q", builder)
+		}
+		for _, key := range entries.KeyOrder() {
+			v, _ := entries.Get(key)
+			entry, ok := v.(*ojson.Object)
+			if !ok {
+				return errors.Errorf("%s %s must be an object", builder, key)
+			}
+			if err := pin(ctx, entry); err != nil {
+				return errors.Wrapf(err, "pinning %s %s", builder, key)
+			}
+			fmt.Fprintf(os.Stderr, "Pinned %s %s\n", builder, key)
+		}
+	}
+
+	out, err := json.Marshal(versions)
+	if err != nil {
+		return errors.Wrap(err, "marshalling versions")
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, out, "", "  "); err != nil {
+		return errors.Wrap(err, "indenting versions")
+	}
+	buf.WriteString("\n")
+	return errors.Wrap(os.WriteFile(file, buf.Bytes(), 0644), "writing versions")
+}
+
+// pin sets the `platforms` and `index` digests of a versions.json entry.
+func pin(ctx context.Context, entry *ojson.Object) error {
+	image, _ := entry.Get("image")
+	tag, _ := entry.Get("tag")
+	digest, _ := entry.Get("digest")
+	imageStr, _ := image.(string)
+	tagStr, _ := tag.(string)
+	if imageStr == "" || tagStr == "" {
+		return errors.New("image and tag are required")
+	}
+
+	index, digests, err := resolve(ctx, imageStr, tagStr)
+	if err != nil {
+		return err
+	}
+	platforms := ojson.NewObject()
+	for _, p := range build.AllPlatforms {
+		d, ok := digests[p]
+		if !ok {
+			return errors.Errorf("%s:%s has no image for %s", imageStr, tagStr, p)
+		}
+		platforms.Set(string(p), d)
+	}
+	// The tag may have moved since the digest was pinned. The digest is left as is, since it
+	// is the image that is cached in the Airplane registry, but the tag should be bumped.
+	amd64 := digests[build.PlatformLinuxAMD64]
+	if digest == nil {
+		entry.Set("digest", amd64)
+	} else if digest != amd64 {
+		fmt.Fprintf(os.Stderr, "warning: %s:%s is now %s, but the digest is %v\n", imageStr, tagStr, amd64, digest)
+	}
+	entry.Set("platforms", platforms)
+	entry.Set("index", index)
+	return nil
+}
+
+var (
+	manifestListTypes = []string{
+		"application/vnd.docker.distribution.manifest.list.v2+json",
+		"application/vnd.oci.image.index.v1+json",
+	}
+	challengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+)
+
+type manifestList struct {
+	Manifests []struct {
+		Digest   string `json:"digest"`
+		Platform struct {
+			OS           string `json:"os"`
+			Architecture string `json:"architecture"`
+		} `json:"platform"`
+	} `json:"manifests"`
+}
+
+// resolve returns the digest of the manifest list of `image:tag`, along with the digest of
+// the image for each platform.
+func resolve(ctx context.Context, image, tag string) (string, map[build.Platform]string, error) {
+	host, repo, ok := strings.Cut(image, "/")
+	if !ok {
+		return "", nil, errors.Errorf("image %q must include its registry", image)
+	}
+	switch host {
+	case "docker.io", "index.docker.io", "registry.hub.docker.com":
+		host = "registry-1.docker.io"
+	}
+	url := fmt.Sprintf("https://%s/v2/%s/manifests/%s", host, repo, tag)
+
+	resp, err := getManifest(ctx, url, "")
+	if err != nil {
+		return "", nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		resp.Body.Close()
+		token, err := getToken(ctx, resp.Header.Get("WWW-Authenticate"))
+		if err != nil {
+			return "", nil, err
+		}
+		if resp, err = getManifest(ctx, url, token); err != nil {
+			return "", nil, err
+		}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, errors.Errorf("getting manifest of %s:%s: %s", image, tag, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "reading manifest")
+	}
+	index := resp.Header.Get("Docker-Content-Digest")
+	if index == "" {
+		index = fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+	}
+	var list manifestList
+	if err := json.Unmarshal(body, &list); err != nil {
+		return "", nil, errors.Wrap(err, "parsing manifest list")
+	}
+	digests := map[build.Platform]string{}
+	for _, m := range list.Manifests {
+		p := build.Platform(m.Platform.OS + "/" + m.Platform.Architecture)
+		if _, ok := digests[p]; !ok {
+			digests[p] = m.Digest
+		}
+	}
+	return index, digests, nil
+}
+
+func getManifest(ctx context.Context, url, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "creating request")
+	}
+	req.Header.Set("Accept", strings.Join(manifestListTypes, ", "))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	return resp, errors.Wrap(err, "getting manifest")
+}
+
+// getToken gets an anonymous pull token for the Bearer `challenge` of a registry.
+func getToken(ctx context.Context, challenge string) (string, error) {
+	params := map[string]string{}
+	for _, m := range challengeParam.FindAllStringSubmatch(challenge, -1) {
+		params[m[1]] = m[2]
+	}
+	if params["realm"] == "" {
+		return "", errors.Errorf("unexpected auth challenge %q", challenge)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, params["realm"], nil)
+	if err != nil {
+		return "", errors.Wrap(err, "creating token request")
+	}
+	q := req.URL.Query()
+	for _, k := range []string{"service", "scope"} {
+		if params[k] != "" {
+			q.Set(k, params[k])
+		}
+	}
+	req.URL.RawQuery = q.Encode()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "getting token")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("getting token: %s", resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", errors.Wrap(err, "decoding token")
+	}
+	if token.Token == "" {
+		return token.AccessToken, nil
+	}
+	return token.Token, nil
+}